@@ -0,0 +1,144 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen means a request wasn't even tried, because the last
+// BreakerThreshold requests in a row failed and the server is probably
+// down (see BreakerThreshold)
+var ErrCircuitOpen = errors.New("too many requests to Cognos have failed; not trying again yet")
+
+// defaultBreakerCooldown is used when BreakerCooldown is 0
+const defaultBreakerCooldown = 60
+
+// the states of the circuit breaker, as returned by BreakerState
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half-open"
+)
+
+// circuitBreaker keeps track of failed requests. It is shared between an
+// instance and any instances derived from it, since they all talk to the
+// same server.
+type circuitBreaker struct {
+	lock     sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+}
+
+// breakerExemptKey marks a context as exempt from the circuit breaker
+type breakerExemptKey struct{}
+
+// exemptFromBreaker returns a context for requests that should be tried
+// even when the circuit breaker is open (ex: checking on a report that is
+// already running, since giving up on it would waste the run)
+func exemptFromBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, breakerExemptKey{}, true)
+}
+
+// breakerCooldown returns how long the breaker stays open
+func (c *CognosInstance) breakerCooldown() time.Duration {
+	if c.BreakerCooldown == 0 {
+		return time.Second * defaultBreakerCooldown
+	}
+	return time.Second * time.Duration(c.BreakerCooldown)
+}
+
+// setBreakerState changes the state. The breaker must be locked. The
+// returned announce lets people know, and must be called after the breaker
+// is unlocked, so a BreakerChanged hook can look at the breaker.
+func (c *CognosInstance) setBreakerState(state string) (announce func()) {
+	if c.breaker.state == state {
+		return func() {}
+	}
+	c.breaker.state = state
+	return func() {
+		log.Println("Cognos circuit breaker is now " + state)
+		if c.Hooks.BreakerChanged != nil {
+			c.Hooks.BreakerChanged(state)
+		}
+	}
+}
+
+// breakerAllow panics with ErrCircuitOpen (marked permanent, so it isn't
+// retried) if the breaker is open. Once the cooldown is over, one request
+// is let through to see if the server is back (half-open), and the rest
+// keep failing until we know. settle must be called when the request is
+// over. If it was the probe and it ended without a result (ex: ctx was
+// cancelled), the breaker goes back to open, so the next request gets to
+// probe instead of everything failing forever.
+func (c *CognosInstance) breakerAllow(ctx context.Context) (settle func()) {
+	if c.BreakerThreshold <= 0 || ctx.Value(breakerExemptKey{}) != nil {
+		return func() {}
+	}
+
+	// this runs after the unlock
+	announce := func() {}
+	defer func() { announce() }()
+	c.breaker.lock.Lock()
+	defer c.breaker.lock.Unlock()
+
+	switch c.breaker.state {
+	case BreakerOpen:
+		if time.Since(c.breaker.openedAt) < c.breakerCooldown() {
+			panic(permanent(ErrCircuitOpen))
+		}
+		// this request is the probe
+		announce = c.setBreakerState(BreakerHalfOpen)
+		return func() {
+			announce := func() {}
+			defer func() { announce() }()
+			c.breaker.lock.Lock()
+			defer c.breaker.lock.Unlock()
+			// breakerResult takes us out of half-open, so if we are
+			// still here we never found out
+			if c.breaker.state == BreakerHalfOpen {
+				announce = c.setBreakerState(BreakerOpen)
+			}
+		}
+	case BreakerHalfOpen:
+		// someone else is already probing
+		panic(permanent(ErrCircuitOpen))
+	}
+	return func() {}
+}
+
+// breakerResult records whether a request reached a working server
+func (c *CognosInstance) breakerResult(ok bool) {
+	if c.BreakerThreshold <= 0 {
+		return
+	}
+
+	// this runs after the unlock
+	announce := func() {}
+	defer func() { announce() }()
+	c.breaker.lock.Lock()
+	defer c.breaker.lock.Unlock()
+
+	if ok {
+		c.breaker.failures = 0
+		announce = c.setBreakerState(BreakerClosed)
+		return
+	}
+
+	c.breaker.failures++
+	if c.breaker.state == BreakerHalfOpen || c.breaker.failures >= c.BreakerThreshold {
+		c.breaker.openedAt = time.Now()
+		announce = c.setBreakerState(BreakerOpen)
+	}
+}
+
+// BreakerState returns BreakerClosed, BreakerOpen, or BreakerHalfOpen
+// (see BreakerThreshold)
+func (c *CognosInstance) BreakerState() string {
+	c.breaker.lock.Lock()
+	defer c.breaker.lock.Unlock()
+	return c.breaker.state
+}
@@ -0,0 +1,126 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cooledDown makes the breaker's cooldown be over
+func cooledDown(c *CognosInstance) {
+	c.breaker.lock.Lock()
+	c.breaker.openedAt = time.Now().Add(-c.breakerCooldown())
+	c.breaker.lock.Unlock()
+}
+
+func TestBreaker(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 0
+	c.BreakerThreshold = 2
+	var lock sync.Mutex
+	var changes []string
+	c.Hooks.BreakerChanged = func(state string) {
+		lock.Lock()
+		changes = append(changes, state)
+		lock.Unlock()
+	}
+
+	// closed -> open
+	srv.InjectFaults(503, 2)
+	for i := 0; i < 2; i++ {
+		if _, err := c.LsFolderE(srv.Public.ID); err == nil {
+			t.Fatal("a 503 didn't fail the listing")
+		}
+	}
+	if c.BreakerState() != BreakerOpen {
+		t.Fatalf("the breaker is %s after 2 failures", c.BreakerState())
+	}
+	srv.ResetRequests()
+	if _, err := c.LsFolderE(srv.Public.ID); !errors.Is(err, ErrCircuitOpen) || len(srv.Requests()) != 0 {
+		t.Errorf("an open breaker let a request through: %v", err)
+	}
+
+	// open -> half-open -> open, because the probe gave up before the
+	// server answered
+	cooledDown(c)
+	srv.SetDelay(200 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.LsFolderContext(ctx, srv.Public.ID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("the probe got %v", err)
+	}
+	if c.BreakerState() != BreakerOpen {
+		t.Fatalf("the breaker is %s after the probe was cancelled", c.BreakerState())
+	}
+
+	// open -> half-open -> closed. The cooldown is still over, so this is
+	// the next probe.
+	srv.SetDelay(0)
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatalf("the probe got %v", err)
+	}
+	if c.BreakerState() != BreakerClosed {
+		t.Errorf("the breaker is %s after the probe worked", c.BreakerState())
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	want := "open half-open open half-open closed"
+	if strings.Join(changes, " ") != want {
+		t.Errorf("went through %v, want %s", changes, want)
+	}
+}
+
+func TestBreakerProbeFails(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 0
+	c.BreakerThreshold = 1
+
+	srv.InjectFaults(503, 2)
+	c.LsFolderE(srv.Public.ID)
+	cooledDown(c)
+	// the probe fails, so the cooldown starts over
+	c.LsFolderE(srv.Public.ID)
+	if _, err := c.LsFolderE(srv.Public.ID); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestBreakerHookReadsState(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 0
+	c.BreakerThreshold = 1
+	var lock sync.Mutex
+	var seen []string
+	c.Hooks.BreakerChanged = func(state string) {
+		// this would deadlock if the hook was called with the breaker locked
+		current := c.BreakerState()
+		lock.Lock()
+		seen = append(seen, state+"="+current)
+		lock.Unlock()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		srv.InjectFaults(503, 1)
+		c.LsFolderE(srv.Public.ID)
+		cooledDown(c)
+		c.LsFolderE(srv.Public.ID)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the hook deadlocked")
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	want := "open=open half-open=half-open closed=closed"
+	if strings.Join(seen, " ") != want {
+		t.Errorf("the hook saw %v, want %s", seen, want)
+	}
+}
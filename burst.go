@@ -0,0 +1,43 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNotBurst means a report was run with bursting, but it isn't set up to
+// burst, so there is only one output. Use DownloadReportCSV instead.
+var ErrNotBurst = errors.New("the report is not burst-enabled")
+
+// burstOutput is one output of a burst run, as listed on the viewer page
+type burstOutput struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// DownloadBurstCSV runs a burst-enabled report and returns each output
+// as CSV, keyed by the burst value (ex: the school). If the report isn't
+// burst-enabled, it panics with ErrNotBurst.
+func (c *CognosInstance) DownloadBurstCSV(id string) map[string]string {
+	run := c.startReportLink(context.Background(), id, c.runLink(id)+"&run.burst=true")
+	defer run.finish()
+	run.waitFinished()
+
+	var outputs []burstOutput
+	if !findJSVar(run.page, "g_PS_BurstOutputs", &outputs) {
+		// this will panic if the report failed. If it didn't, it wasn't
+		// burst (or there was nothing to burst).
+		run.outputLink()
+		if run.noData {
+			return map[string]string{}
+		}
+		panic(fmt.Errorf("%w: %s", ErrNotBurst, id))
+	}
+
+	csvs := make(map[string]string)
+	for _, output := range outputs {
+		csvs[output.Key] = c.requestContext(run.downloadContext(), "GET", output.URL, "", nil)
+	}
+	return csvs
+}
@@ -0,0 +1,179 @@
+package cognos
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry is the metadata stored next to a cached report output
+type cacheEntry struct {
+	ReportID  string    `json:"reportId"`
+	Format    string    `json:"format"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	Size      int       `json:"size"`
+	SHA256    string    `json:"sha256"`
+}
+
+// keyedLocks hands out one mutex per key. It is used so two goroutines
+// asking for the same uncached report don't both run it.
+type keyedLocks struct {
+	lock  sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// get returns the mutex for key, making it if needed
+func (k *keyedLocks) get(key string) *sync.Mutex {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if k.locks == nil {
+		k.locks = make(map[string]*sync.Mutex)
+	}
+	if k.locks[key] == nil {
+		k.locks[key] = new(sync.Mutex)
+	}
+	return k.locks[key]
+}
+
+// outputKey identifies a report output. The DSN, who we log in as, and
+// who the report is run as can all change what a report returns (ex: row
+// security), so they are part of it along with the report and format.
+func (c *CognosInstance) outputKey(id string, format string) string {
+	return strings.Join([]string{c.DSN, c.authUser(), c.runAs, id, format}, "\x00")
+}
+
+// cacheKey returns the file name (without extension) used to cache the
+// output with the given outputKey
+func cacheKey(outputKey string) string {
+	sum := sha256.Sum256([]byte(outputKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// cachePaths returns the paths of the payload and metadata files for a key
+func (c *CognosInstance) cachePaths(key string) (payloadPath, metaPath string) {
+	base := filepath.Join(c.CacheDir, key)
+	return base + ".out", base + ".json"
+}
+
+// cacheEnabled returns true if the result cache is turned on
+func (c *CognosInstance) cacheEnabled() bool {
+	return c.CacheDir != "" && c.CacheTTL > 0
+}
+
+// readCache returns the cached output for key, if there is one that is
+// fresh enough and intact
+func (c *CognosInstance) readCache(key string) (output string, found bool) {
+	payloadPath, metaPath := c.cachePaths(key)
+	metaJSON, err := ioutil.ReadFile(metaPath)
+	if err != nil {
+		return "", false
+	}
+	var entry cacheEntry
+	if json.Unmarshal(metaJSON, &entry) != nil {
+		return "", false
+	}
+	if time.Since(entry.FetchedAt) > time.Second*time.Duration(c.CacheTTL) {
+		return "", false
+	}
+
+	payload, err := ioutil.ReadFile(payloadPath)
+	if err != nil || len(payload) != entry.Size {
+		return "", false
+	}
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != entry.SHA256 {
+		return "", false
+	}
+	return string(payload), true
+}
+
+// writeCache stores a report output. Failing to write the cache is not
+// worth failing the download over, so errors are ignored.
+func (c *CognosInstance) writeCache(key, id, format, output string) {
+	err := os.MkdirAll(c.CacheDir, 0700)
+	if err != nil {
+		return
+	}
+
+	sum := sha256.Sum256([]byte(output))
+	metaJSON, err := json.Marshal(cacheEntry{
+		ReportID:  id,
+		Format:    format,
+		FetchedAt: time.Now(),
+		Size:      len(output),
+		SHA256:    hex.EncodeToString(sum[:]),
+	})
+	if err != nil {
+		return
+	}
+
+	// write the payload first so the metadata never points at a
+	// payload that isn't there yet
+	payloadPath, metaPath := c.cachePaths(key)
+	if writeFileAtomic(payloadPath, []byte(output)) != nil {
+		return
+	}
+	writeFileAtomic(metaPath, metaJSON)
+}
+
+// cachedDownload returns the cached output for a report if there is a
+// fresh one, otherwise it calls run and caches the result. Only one
+// goroutine will run a given report at a time; others wait for its result.
+// Outputs are only reused for the same DSN, user, and run as user (see
+// outputKey), since instances for diffrent users can share CacheDir.
+func (c *CognosInstance) cachedDownload(ctx context.Context, id, format string, bypass bool, run func() string) string {
+	if !c.cacheEnabled() {
+		return run()
+	}
+
+	// we need to know who we are to know whose output to look for
+	panicOnErr(c.fetchLogin(ctx))
+	key := cacheKey(c.outputKey(id, format))
+	lock := c.cacheLocks.get(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !bypass {
+		if output, found := c.readCache(key); found {
+			count(&c.stats.cacheHits)
+			return output
+		}
+	}
+	count(&c.stats.cacheMisses)
+
+	output := run()
+	c.writeCache(key, id, format, output)
+	return output
+}
+
+// InvalidateReport removes every cached output for the report with the
+// given id, so the next download runs it again
+func (c *CognosInstance) InvalidateReport(id string) {
+	if c.CacheDir == "" {
+		return
+	}
+
+	metaPaths, _ := filepath.Glob(filepath.Join(c.CacheDir, "*.json"))
+	for _, metaPath := range metaPaths {
+		metaJSON, err := ioutil.ReadFile(metaPath)
+		if err != nil {
+			continue
+		}
+		var entry cacheEntry
+		if json.Unmarshal(metaJSON, &entry) != nil || entry.ReportID != id {
+			continue
+		}
+
+		payloadPath, _ := c.cachePaths(strings.TrimSuffix(filepath.Base(metaPath), ".json"))
+		os.Remove(metaPath)
+		os.Remove(payloadPath)
+	}
+}
@@ -0,0 +1,55 @@
+package cognos
+
+import "testing"
+
+func TestCachedDownload(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Daily", "a\n1\n")
+	c.CacheDir = t.TempDir()
+	c.CacheTTL = 60
+
+	for i := 0; i < 2; i++ {
+		if csv := c.DownloadReportCSV(report.ID); csv != report.CSV {
+			t.Fatalf("download %d got %q", i, csv)
+		}
+	}
+	if n := countRequests(srv, isRun); n != 1 {
+		t.Errorf("report ran %d times, want 1 (then the cache)", n)
+	}
+
+	c.InvalidateReport(report.ID)
+	c.DownloadReportCSV(report.ID)
+	if n := countRequests(srv, isRun); n != 2 {
+		t.Errorf("report ran %d times after InvalidateReport, want 2", n)
+	}
+}
+
+func TestCacheIsPerUserAndDSN(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Grades", "student,grade\n1,A\n")
+	c.CacheDir = t.TempDir()
+	c.CacheTTL = 60
+	c.DownloadReportCSV(report.ID)
+
+	// a report can return diffrent rows to someone else, so nobody else
+	// gets our copy
+	others := map[string]*CognosInstance{
+		"WithUser":               c.WithUser("0401other", "pass"),
+		"WithCredentialProvider": c.WithCredentialProvider(staticCredentials(`APSCN\0401third`, "pass")),
+		"WithDSN":                c.WithDSN("otherdsn"),
+	}
+	for name, other := range others {
+		before := countRequests(srv, isRun)
+		other.DownloadReportCSV(report.ID)
+		if countRequests(srv, isRun) != before+1 {
+			t.Errorf("%s got the cached output", name)
+		}
+	}
+
+	// but we still get ours
+	before := countRequests(srv, isRun)
+	c.WithUser(srv.User, srv.Pass).DownloadReportCSV(report.ID)
+	if countRequests(srv, isRun) != before {
+		t.Error("the same user didn't get the cached output")
+	}
+}
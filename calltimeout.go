@@ -0,0 +1,37 @@
+package cognos
+
+import (
+	"context"
+	"time"
+)
+
+// callTimeoutKey is the context key for WithCallTimeout
+type callTimeoutKey struct{}
+
+// WithCallTimeout returns a copy of ctx that makes requests made with it
+// (ex: with LsFolderContext or RequestContext) give up on each attempt
+// after d, instead of after the httpTimeout given to MakeInstance. Like
+// httpTimeout, this includes reading the response, and it is per attempt,
+// so a request that is retried can take longer in total (see
+// OperationTimeout, or give ctx a deadline, for a limit on the whole
+// thing). d can be longer than httpTimeout (ex: for a big download) or
+// shorter (ex: for a folder listing that should be quick). 0 means no limit.
+func WithCallTimeout(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, callTimeoutKey{}, d)
+}
+
+// callTimeout returns the timeout set with WithCallTimeout, if there is one
+func callTimeout(ctx context.Context) (d time.Duration, set bool) {
+	d, set = ctx.Value(callTimeoutKey{}).(time.Duration)
+	return d, set
+}
+
+// downloadContext returns the context for downloading the run's output,
+// which has DownloadTimeout if it is set
+func (r *ReportRun) downloadContext() context.Context {
+	ctx := r.context()
+	if r.c.DownloadTimeout > 0 {
+		ctx = WithCallTimeout(ctx, time.Second*time.Duration(r.c.DownloadTimeout))
+	}
+	return ctx
+}
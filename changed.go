@@ -0,0 +1,42 @@
+package cognos
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// HashCSV returns the hex sha256 of a report output. Lines matching
+// ignore (ex: a "Run on 3/14/2024" row) are left out of the hash, so
+// outputs that only differ in those lines hash the same. Line endings
+// are normalized, so \r\n and \n hash the same too. ignore may be nil.
+func HashCSV(csv string, ignore *regexp.Regexp) string {
+	hash := sha256.New()
+	for _, line := range strings.Split(csv, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if ignore != nil && ignore.MatchString(line) {
+			continue
+		}
+		hash.Write([]byte(line))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// HashReportOutput is HashCSV using c.VolatileLines. Use this to hash
+// previously stored outputs so they can be compared with the hashes from
+// DownloadReportCSVIfChanged.
+func (c *CognosInstance) HashReportOutput(csv string) string {
+	return HashCSV(csv, c.VolatileLines)
+}
+
+// DownloadReportCSVIfChanged downloads a report like DownloadReportCSV,
+// then compares the hash of the output (see HashReportOutput) with
+// lastHash. changed is false if they match, so the caller can skip
+// processing the output. Pass an empty lastHash the first time.
+func (c *CognosInstance) DownloadReportCSVIfChanged(id string, lastHash string) (csv string, newHash string, changed bool) {
+	csv = c.DownloadReportCSV(id)
+	newHash = c.HashReportOutput(csv)
+	return csv, newHash, newHash != lastHash
+}
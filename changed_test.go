@@ -0,0 +1,48 @@
+package cognos
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestHashCSVIgnoresVolatileLines(t *testing.T) {
+	runDate := regexp.MustCompile(`^Run on `)
+	monday := "Run on 3/11/2024\nstudent,grade\n1,A\n"
+	tuesday := "Run on 3/12/2024\r\nstudent,grade\r\n1,A\r\n"
+	changed := "Run on 3/12/2024\nstudent,grade\n1,B\n"
+
+	if HashCSV(monday, runDate) != HashCSV(tuesday, runDate) {
+		t.Error("outputs that only differ in the run date and line endings hash diffrently")
+	}
+	if HashCSV(monday, runDate) == HashCSV(changed, runDate) {
+		t.Error("a changed grade hashes the same")
+	}
+	if HashCSV(monday, nil) == HashCSV(tuesday, nil) {
+		t.Error("without ignore, the run date didn't count")
+	}
+}
+
+func TestDownloadReportCSVIfChanged(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.VolatileLines = regexp.MustCompile(`^Run on `)
+	report := srv.Public.AddReport("Grades", "Run on 3/11/2024\nstudent,grade\n1,A\n")
+
+	_, hash, changed := c.DownloadReportCSVIfChanged(report.ID, "")
+	if !changed {
+		t.Error("the first download wasn't a change")
+	}
+
+	report.CSV = "Run on 3/12/2024\nstudent,grade\n1,A\n"
+	_, newHash, changed := c.DownloadReportCSVIfChanged(report.ID, hash)
+	if changed || newHash != hash {
+		t.Error("a new run date counted as a change")
+	}
+
+	report.CSV = "Run on 3/13/2024\nstudent,grade\n1,B\n"
+	if _, _, changed = c.DownloadReportCSVIfChanged(report.ID, hash); !changed {
+		t.Error("a changed grade wasn't a change")
+	}
+	if c.HashReportOutput(report.CSV) == hash {
+		t.Error("HashReportOutput dosen't match what was downloaded")
+	}
+}
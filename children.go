@@ -0,0 +1,92 @@
+package cognos
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// entriesIndicator matches the "Entries: 1 - 15 of 45" text the portal
+// puts above a listing when it is split into pages. Only the numbers are
+// used, so it works whatever language the portal is in.
+var entriesIndicator = regexp.MustCompile(`(?s)<[^>]*class="pagingText"[^>]*>([^<]*)<`)
+
+// indicatorNumbers matches the numbers in the entries indicator
+var indicatorNumbers = regexp.MustCompile(`[0-9]+`)
+
+// entryTotal returns the total from the entries indicator of a listing
+// page, and false if the page dosen't have one
+func entryTotal(page string) (int, bool) {
+	match := entriesIndicator.FindStringSubmatch(page)
+	if match == nil {
+		return 0, false
+	}
+	numbers := indicatorNumbers.FindAllString(match[1], -1)
+	if len(numbers) < 3 {
+		return 0, false
+	}
+	total, err := strconv.Atoi(numbers[len(numbers)-1])
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
+
+// FolderChildCount returns how many entries are in the folder with the
+// given ID, without getting the whole listing (ex: for a tree that only
+// lists a folder when it is opened). If the folder's listing is
+// remembered (see LsFolder and ListingTTL), no request is made.
+// Otherwise we ask for a listing one entry long and read the count off
+// of the top of it. Older portals don't split listings into pages, and
+// then we get the whole listing and count it, which is remembered like
+// LsFolder would. Hidden entries are only counted if ShowHidden is set.
+func (c *CognosInstance) FolderChildCount(id string) (n int, err error) {
+	err = catch(func() {
+		n = c.folderChildCount(id)
+	})
+	return n, err
+}
+
+// FolderHasChildren returns true if there is anything in the folder with
+// the given ID (see FolderChildCount)
+func (c *CognosInstance) FolderHasChildren(id string) (bool, error) {
+	n, err := c.FolderChildCount(id)
+	return n > 0, err
+}
+
+// folderChildCount does the work for FolderChildCount. It panics with an
+// *OpError if it fails.
+func (c *CognosInstance) folderChildCount(id string) int {
+	defer wrapOp("FolderChildCount", id, nil)
+	key := c.cacheScope() + "\x00" + id
+	cached, found := c.listings.get(key)
+	if found && time.Since(cached.fetchedAt) < time.Second*time.Duration(c.ListingTTL) {
+		c.folderListed(id, true)
+		return len(cached.entries)
+	}
+
+	link := folderLinkFromID(id) + "&m_pageSize=1"
+	if c.ShowHidden {
+		link += "&m_showHidden=true"
+	}
+	var respHTML string
+	c.requestStream(context.Background(), "GET", link, "", nil, func(resp *http.Response) {
+		respHTML = readAll(resp.Body)
+	})
+
+	if total, found := entryTotal(respHTML); found {
+		return total
+	}
+
+	// the portal didn't split the listing up, so this is all of it
+	entries := c.parseListing(id, respHTML)
+	c.listings.put(key, cachedListing{
+		entries:   entries,
+		fetchedAt: time.Now(),
+		hash:      listingHash(respHTML),
+	})
+	c.folderListed(id, false)
+	return len(entries)
+}
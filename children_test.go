@@ -0,0 +1,87 @@
+package cognos
+
+import "testing"
+
+func TestFolderChildCount(t *testing.T) {
+	srv, c := newTestInstance(t)
+	folder := srv.Public.AddFolder("Reports")
+	for _, name := range []string{"A", "B", "C"} {
+		folder.AddReport(name, "a\n1\n")
+	}
+	folder.AddReport("Hidden", "a\n1\n").Hidden = true
+	empty := srv.Public.AddFolder("Empty")
+
+	if n, err := c.FolderChildCount(folder.ID); n != 3 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+	for _, r := range srv.Requests() {
+		if isListing(r) && r.Form.Get("m_pageSize") != "1" {
+			t.Errorf("asked for %s", r.URL)
+		}
+	}
+	c.ShowHidden = true
+	if n, err := c.FolderChildCount(folder.ID); n != 4 || err != nil {
+		t.Errorf("with hidden got %d, %v", n, err)
+	}
+	if has, err := c.FolderHasChildren(empty.ID); has || err != nil {
+		t.Errorf("the empty folder got %v, %v", has, err)
+	}
+	if _, err := c.FolderChildCount("i0000000000000000000000000000000"); err == nil {
+		t.Error("a missing folder worked")
+	}
+}
+
+func TestFolderChildCountCached(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.ListingTTL = 60
+	folder := srv.Public.AddFolder("Reports")
+	folder.AddReport("A", "a\n1\n")
+	folder.AddReport("B", "a\n1\n")
+
+	// a remembered listing is counted without asking
+	c.LsFolder(folder.ID)
+	srv.ResetRequests()
+	if n, err := c.FolderChildCount(folder.ID); n != 2 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if n := countRequests(srv, isListing); n != 0 {
+		t.Errorf("made %d listing requests", n)
+	}
+}
+
+func TestFolderChildCountNoPages(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.NoListingPages = true
+	c.ListingTTL = 60
+	folder := srv.Public.AddFolder("Reports")
+	folder.AddReport("A", "a\n1\n")
+	folder.AddReport("B", "a\n1\n")
+
+	// the whole listing comes back, so it is counted and remembered
+	if n, err := c.FolderChildCount(folder.ID); n != 2 || err != nil {
+		t.Errorf("got %d, %v", n, err)
+	}
+	if listing := c.LsFolder(folder.ID); len(listing) != 2 {
+		t.Errorf("listed %+v", listing)
+	}
+	if n := countRequests(srv, isListing); n != 1 {
+		t.Errorf("made %d listing requests", n)
+	}
+}
+
+func TestEntryTotal(t *testing.T) {
+	tests := map[string]int{
+		`<div class="pagingText">Entries: 1 - 15 of 45</div>`:          45,
+		`<td class="pagingText" nowrap>Entradas: 16 - 30 de 1234</td>`: 1234,
+	}
+	for page, want := range tests {
+		if got, found := entryTotal(page); got != want || !found {
+			t.Errorf("%s: got %d, %v", page, got, found)
+		}
+	}
+	for _, page := range []string{"<table></table>", `<div class="pagingText">Entries</div>`} {
+		if _, found := entryTotal(page); found {
+			t.Errorf("%s: found a total", page)
+		}
+	}
+}
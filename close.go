@@ -0,0 +1,231 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed means the CognosInstance (or the one it was derived from) has
+// been closed with Close
+var ErrClosed = errors.New("the CognosInstance has been closed")
+
+// lifecycle keeps track of what is going on, so Close can wait for it. It
+// is shared between an instance and any instances derived from it that use
+// the same session (ex: WithDSN). Ones with their own session (ex:
+// WithUser) get their own lifecycle, since they have their own runs and
+// their own session to log out of.
+type lifecycle struct {
+	lock   sync.Mutex
+	closed bool
+	// active counts requests and report runs that are in progress
+	active int
+	// idle is closed once we are closed and active gets to 0
+	idle       chan struct{}
+	idleClosed bool
+	runs       map[*ReportRun]bool
+	logout     sync.Once
+	// children are the lifecycles of instances derived from this one with
+	// their own session, which are closed when we are. parent is the
+	// reverse, so a child can be forgotten once it is closed.
+	children map[*lifecycle]*CognosInstance
+	parent   *lifecycle
+}
+
+func newLifecycle() *lifecycle {
+	return &lifecycle{
+		idle:     make(chan struct{}),
+		runs:     make(map[*ReportRun]bool),
+		children: make(map[*lifecycle]*CognosInstance),
+	}
+}
+
+// deriveLife gives derived (a copy of c with its own session) its own
+// lifecycle, which is closed when c is
+func (c *CognosInstance) deriveLife(derived *CognosInstance) {
+	derived.life = newLifecycle()
+	derived.life.parent = c.life
+
+	c.life.lock.Lock()
+	defer c.life.lock.Unlock()
+	if c.life.closed {
+		// it can't make any requests, so there is no session to log out of
+		derived.life.closed = true
+		derived.life.markIdle()
+		derived.life.logout.Do(func() {})
+		return
+	}
+	c.life.children[derived.life] = derived
+}
+
+// afterCloseKey marks a context as allowed to make requests after Close
+type afterCloseKey struct{}
+
+// allowAfterClose returns a context for requests that are part of
+// something that started before Close (ex: polling a report), or are part
+// of closing
+func allowAfterClose(ctx context.Context) context.Context {
+	return context.WithValue(ctx, afterCloseKey{}, true)
+}
+
+// markIdle closes idle if we are closed and nothing is going on. The
+// lifecycle must be locked.
+func (l *lifecycle) markIdle() {
+	if l.closed && l.active == 0 && !l.idleClosed {
+		l.idleClosed = true
+		close(l.idle)
+	}
+}
+
+// enter counts something as in progress until leave is called. It panics
+// with ErrClosed if we have been closed, unless ctx is allowed to go on
+// after Close.
+func (c *CognosInstance) enter(ctx context.Context) (leave func()) {
+	c.life.lock.Lock()
+	defer c.life.lock.Unlock()
+
+	if c.life.closed && ctx.Value(afterCloseKey{}) == nil {
+		panic(ErrClosed)
+	}
+	c.life.active++
+	return func() {
+		c.life.lock.Lock()
+		defer c.life.lock.Unlock()
+		c.life.active--
+		c.life.markIdle()
+	}
+}
+
+// trackRun counts a report run as in progress until finish is called on
+// it, so Close waits for it (or cancels it)
+func (c *CognosInstance) trackRun(r *ReportRun) {
+	r.leave = c.enter(context.Background())
+
+	c.life.lock.Lock()
+	defer c.life.lock.Unlock()
+	c.life.runs[r] = true
+}
+
+// finish tells Close the run is done. It is ok to call more than once.
+func (r *ReportRun) finish() {
+	if r.leave == nil {
+		return
+	}
+	r.c.life.lock.Lock()
+	delete(r.c.life.runs, r)
+	r.c.life.lock.Unlock()
+
+	r.leave()
+	r.leave = nil
+}
+
+// context returns the context for requests that are part of the run.
+// They are allowed to keep going after Close, since the run started
+// before it, but they stop if the ctx the run was started with is done.
+func (r *ReportRun) context() context.Context {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return allowAfterClose(ctx)
+}
+
+// logoffLink is the link that ends our session
+func logoffLink() string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=portal/logoff.xts" +
+		"&h_CAM_action=logoff"
+}
+
+// Logout ends our session on the server. The next request will log in
+// again.
+func (c *CognosInstance) Logout() {
+	c.logout(context.Background())
+}
+
+func (c *CognosInstance) logout(ctx context.Context) {
+	c.requestContext(ctx, "GET", logoffLink(), "", nil)
+	c.forgetPassport()
+}
+
+// Close shuts the instance down. Requests and report runs that start after
+// Close is called panic with ErrClosed, but ones that had already started
+// (including ones still waiting for a request slot) are allowed to finish,
+// until ctx is done. After that, if CancelOnClose is set, any reports that
+// are still running are cancelled on the server. Then we log out. Close
+// returns ctx.Err() if it gave up waiting, or the error from logging out.
+//
+// Instances derived from this one are closed too. Ones with their own
+// session (ex: WithUser) are closed at the same time, and log out of their
+// own session. Closing one of those only closes it (and the ones derived
+// from it), not the instance it came from. It is safe to call Close more
+// than once, and from more than one goroutine. Only the first call logs
+// out.
+func (c *CognosInstance) Close(ctx context.Context) (err error) {
+	c.life.lock.Lock()
+	c.life.closed = true
+	c.life.markIdle()
+	var children []*CognosInstance
+	for _, child := range c.life.children {
+		children = append(children, child)
+	}
+	c.life.lock.Unlock()
+
+	var wg sync.WaitGroup
+	childErrs := make([]error, len(children))
+	for i, child := range children {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			childErrs[i] = child.Close(ctx)
+		}()
+	}
+
+	select {
+	case <-c.life.idle:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	closingCtx := allowAfterClose(context.Background())
+	if err != nil && c.CancelOnClose {
+		// runs that are still starting fill in State under the lock
+		c.life.lock.Lock()
+		var conversations []string
+		for run := range c.life.runs {
+			if run.State.Conversation != "" {
+				conversations = append(conversations, run.State.Conversation)
+			}
+		}
+		c.life.lock.Unlock()
+
+		for _, conversation := range conversations {
+			catch(func() {
+				c.releaseConversation(closingCtx, conversation)
+			})
+		}
+	}
+
+	c.life.logout.Do(func() {
+		logoutErr := catch(func() {
+			c.logout(closingCtx)
+		})
+		if err == nil {
+			err = logoutErr
+		}
+	})
+
+	wg.Wait()
+	for _, childErr := range childErrs {
+		if err == nil {
+			err = childErr
+		}
+	}
+	if parent := c.life.parent; parent != nil {
+		parent.lock.Lock()
+		delete(parent.children, c.life)
+		parent.lock.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,168 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// isLogoff returns true for a request that ends our session
+func isLogoff(r cognostest.Request) bool {
+	return r.Form.Get("h_CAM_action") == "logoff"
+}
+
+func TestCloseWaitsForRuns(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 2
+	finance := c.WithDSN("testfin")
+
+	run := c.StartReport(report.ID)
+	closed := make(chan error)
+	go func() {
+		closed <- c.Close(context.Background())
+	}()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned %v while a report was running", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the run started before Close, so it can finish
+	if csv := run.Wait(); csv != report.CSV {
+		t.Errorf("got %q", csv)
+	}
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Errorf("Close got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't return after the report finished")
+	}
+
+	// but nothing new can start, even on a derived instance
+	for _, instance := range []*CognosInstance{c, finance} {
+		if _, err := instance.LsFolderE(srv.Public.ID); !errors.Is(err, ErrClosed) {
+			t.Errorf("listing after Close got %v", err)
+		}
+	}
+	if err := catch(func() { c.StartReport(report.ID) }); !errors.Is(err, ErrClosed) {
+		t.Errorf("starting a report after Close got %v", err)
+	}
+
+	// only the first Close logs out
+	c.Close(context.Background())
+	finance.Close(context.Background())
+	if n := countRequests(srv, isLogoff); n != 1 {
+		t.Errorf("logged out %d times, want 1", n)
+	}
+}
+
+func TestCloseCancelsRuns(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 5
+	c.CancelOnClose = true
+
+	// nobody is waiting on this one, so it never finishes
+	c.StartReport(report.ID)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := c.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close got %v", err)
+	}
+	if n := countRequests(srv, isCancel); n != 1 {
+		t.Errorf("cancelled %d reports, want 1", n)
+	}
+	if n := countRequests(srv, isLogoff); n != 1 {
+		t.Errorf("logged out %d times, want 1", n)
+	}
+}
+
+func TestCloseWhileRunStarts(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 5
+	c.CancelOnClose = true
+	c.ServerVersion() // log in first, so the only slow request is the run's
+
+	srv.SetDelay(20 * time.Millisecond)
+	started := make(chan *ReportRun)
+	go func() {
+		started <- c.StartReport(report.ID)
+	}()
+	waitFor(t, "the run to be tracked", func() bool {
+		c.life.lock.Lock()
+		defer c.life.lock.Unlock()
+		return len(c.life.runs) == 1
+	})
+
+	// Close gives up while the run is (or just was) filling in its State.
+	// Nothing else orders the two, so -race catches it if they don't lock.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := c.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Close got %v", err)
+	}
+	if run := <-started; run.State.Conversation == "" {
+		t.Error("the run didn't get a conversation")
+	}
+}
+
+func TestCloseWithUser(t *testing.T) {
+	srv, c := newTestInstance(t)
+	other := c.WithUser("other", "pass")
+	for _, instance := range []*CognosInstance{c, other} {
+		if _, err := instance.LsFolderE(srv.Public.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// closing the other user's instance dosen't close c
+	if err := other.Close(context.Background()); err != nil {
+		t.Errorf("Close got %v", err)
+	}
+	if _, err := other.LsFolderE(srv.Public.ID); !errors.Is(err, ErrClosed) {
+		t.Errorf("listing after Close got %v", err)
+	}
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Errorf("c got %v after the other user was closed", err)
+	}
+	if n := countRequests(srv, isLogoff); n != 1 {
+		t.Errorf("logged out %d times, want 1", n)
+	}
+
+	// but closing c closes the ones derived from it, which each log out
+	third := c.WithUser("other", "pass")
+	if _, err := third.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Errorf("Close got %v", err)
+	}
+	if _, err := third.LsFolderE(srv.Public.ID); !errors.Is(err, ErrClosed) {
+		t.Errorf("listing after c was closed got %v", err)
+	}
+	if n := countRequests(srv, isLogoff); n != 3 {
+		t.Errorf("logged out %d times, want 3", n)
+	}
+	if len(c.life.children) != 0 {
+		t.Errorf("c still remembers %d closed instances", len(c.life.children))
+	}
+
+	// one made after c is closed starts out closed, with nothing to log
+	// out of
+	late := c.WithUser("other", "pass")
+	if _, err := late.LsFolderE(srv.Public.ID); !errors.Is(err, ErrClosed) {
+		t.Errorf("listing on an instance made after Close got %v", err)
+	}
+	srv.ResetRequests()
+	late.Close(context.Background())
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("closing it made %d requests", n)
+	}
+}
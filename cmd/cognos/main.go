@@ -0,0 +1,292 @@
+// Command cognos is a small command line wrapper around the cognos package
+// for people who need Cognos data but don't want to write Go.
+//
+// Usage:
+//
+//	cognos [flags] ls <path>
+//	cognos [flags] cat [-o file] <path>
+//	cognos [flags] export <folder-path> <dir>
+//	cognos [flags] ping
+//	cognos [flags] whoami
+//
+// Paths look like public/Some Folder/Some Report or ~/My Report.
+// Server settings can be given as flags or with the environment variables
+// COGNOS_URL, COGNOS_USER, COGNOS_DOMAIN, COGNOS_NAMESPACE, and COGNOS_DSN.
+// The password is only read from COGNOS_PASS or from a file given with
+// -pass-file, so it never shows up in your shell history or the process list.
+//
+// Exit codes: 0 success, 1 usage or other errors, 2 authentication failure,
+// 3 folder or report not found, 4 a report failed to run.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/9072997/cognos"
+)
+
+const (
+	exitOK = iota
+	exitError
+	exitAuth
+	exitNotFound
+	exitReport
+)
+
+// cliError is what we panic with when we want to exit with a specific code
+type cliError struct {
+	code    int
+	message string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// envDefault returns the value of an environment variable, or def if it is unset
+func envDefault(name, def string) string {
+	if value, set := os.LookupEnv(name); set {
+		return value
+	}
+	return def
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: cognos [flags] ls <path>")
+	fmt.Fprintln(os.Stderr, "       cognos [flags] cat [-o file] <path>")
+	fmt.Fprintln(os.Stderr, "       cognos [flags] export <folder-path> <dir>")
+	fmt.Fprintln(os.Stderr, "       cognos [flags] ping")
+	fmt.Fprintln(os.Stderr, "       cognos [flags] whoami")
+	fmt.Fprintln(os.Stderr, "flags:")
+	flag.PrintDefaults()
+}
+
+// run does everything main does, but returns an exit code so defered
+// functions get a chance to run
+func run(args []string) (exitCode int) {
+	flags := flag.NewFlagSet("cognos", flag.ContinueOnError)
+	flags.Usage = usage
+	url := flags.String("url", envDefault("COGNOS_URL", "https://adecognos.arkansas.gov"), "base URL of the Cognos server ($COGNOS_URL)")
+	user := flags.String("user", envDefault("COGNOS_USER", ""), `Cognos user, ex: APSCN\0401jpenn ($COGNOS_USER)`)
+	domain := flags.String("domain", envDefault("COGNOS_DOMAIN", ""), `Windows domain, ex: APSCN, if it isn't part of the user ($COGNOS_DOMAIN)`)
+	namespace := flags.String("namespace", envDefault("COGNOS_NAMESPACE", "esp"), "authentication namespace ($COGNOS_NAMESPACE)")
+	dsn := flags.String("dsn", envDefault("COGNOS_DSN", ""), "DSN, ex: bentonvisms ($COGNOS_DSN)")
+	passFile := flags.String("pass-file", "", "read the password from this file instead of $COGNOS_PASS")
+	retryDelay := flags.Uint("retry-delay", 5, "seconds between retries and report status checks")
+	retryCount := flags.Int("retries", 3, "number of times to retry a failed request (-1 for forever)")
+	timeout := flags.Uint("timeout", 300, "seconds before giving up on a single HTTP request")
+	concurrency := flags.Uint("concurrency", 4, "maximum number of requests at once")
+	flag.CommandLine = flags
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+	if flags.NArg() < 1 {
+		usage()
+		return exitError
+	}
+
+	// turn panics into error messages and exit codes. Users of the CLI
+	// should never see a stack trace.
+	defer func() {
+		if r := recover(); r != nil {
+			cliErr, isCLIErr := r.(cliError)
+			if !isCLIErr {
+				cliErr = classify(r)
+			}
+			fmt.Fprintln(os.Stderr, "cognos:", cliErr.message)
+			exitCode = cliErr.code
+		}
+	}()
+
+	pass := os.Getenv("COGNOS_PASS")
+	if *passFile != "" {
+		passBytes, err := ioutil.ReadFile(*passFile)
+		if err != nil {
+			panic(cliError{exitError, "unable to read password file: " + err.Error()})
+		}
+		pass = strings.TrimRight(string(passBytes), "\r\n")
+	}
+	if *user == "" || pass == "" {
+		panic(cliError{exitError, "a user and password are required (see -user, $COGNOS_PASS, and -pass-file)"})
+	}
+
+	c, err := cognos.NewInstance(
+		*user, pass, strings.TrimRight(*url, "/"), *dsn,
+		cognos.WithNamespace(*namespace),
+		cognos.WithRetry(time.Duration(*retryDelay)*time.Second, *retryCount),
+		cognos.WithTimeout(time.Duration(*timeout)*time.Second),
+		cognos.WithConcurrency(int(*concurrency)),
+	)
+	if err != nil {
+		panic(cliError{exitError, err.Error()})
+	}
+	if *domain != "" {
+		c.Domain = *domain
+	}
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch command {
+	case "ls":
+		ls(c, commandArgs)
+	case "cat":
+		cat(c, commandArgs)
+	case "export":
+		return export(c, commandArgs)
+	case "ping":
+		ping(c)
+	case "whoami":
+		whoami(c)
+	default:
+		usage()
+		return exitError
+	}
+	return exitOK
+}
+
+// classify turns a panic from the cognos package into an exit code and a
+// message that makes sense to a human
+func classify(r interface{}) cliError {
+	message := fmt.Sprint(r)
+	err, _ := r.(error)
+	switch {
+	case errors.Is(err, cognos.ErrAuthFailed):
+		return cliError{exitAuth, "authentication failed (check the user, password, and namespace)"}
+	case errors.Is(err, cognos.ErrNotFound):
+		return cliError{exitNotFound, message}
+	case errors.Is(err, cognos.ErrPrompting), errors.Is(err, cognos.ErrReportFailed),
+		errors.Is(err, cognos.ErrConversationGone), errors.Is(err, cognos.ErrPollFailed):
+		return cliError{exitReport, message}
+	default:
+		return cliError{exitError, message}
+	}
+}
+
+// splitPath turns public/a/b into []string{"public", "a", "b"}
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// lookup resolves a path and panics with a not found error if it is the wrong type
+func lookup(c *cognos.CognosInstance, path string, want cognos.FolderEntryType) cognos.FolderEntry {
+	entry := c.FolderEntryFromPath(splitPath(path))
+	if entry.Type != want {
+		if want == cognos.Folder {
+			panic(cliError{exitNotFound, path + " is not a folder"})
+		}
+		panic(cliError{exitNotFound, path + " is not a report"})
+	}
+	return entry
+}
+
+// sortedNames returns the names of the entries in a folder in order
+func sortedNames(entries map[string]cognos.FolderEntry) []string {
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func ls(c *cognos.CognosInstance, args []string) {
+	if len(args) != 1 {
+		panic(cliError{exitError, "usage: cognos ls <path>"})
+	}
+	folder := lookup(c, args[0], cognos.Folder)
+	entries := c.LsFolder(folder.ID)
+	for _, name := range sortedNames(entries) {
+		switch entries[name].Type {
+		case cognos.Folder:
+			fmt.Printf("folder\t%s\n", name)
+		case cognos.Job:
+			fmt.Printf("job\t%s\n", name)
+		case cognos.Other:
+			fmt.Printf("other\t%s\n", name)
+		default:
+			fmt.Printf("report\t%s\n", name)
+		}
+	}
+}
+
+func cat(c *cognos.CognosInstance, args []string) {
+	flags := flag.NewFlagSet("cat", flag.ContinueOnError)
+	outFile := flags.String("o", "", "write the CSV to this file instead of stdout")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		panic(cliError{exitError, "usage: cognos cat [-o file] <path>"})
+	}
+
+	report := lookup(c, flags.Arg(0), cognos.Report)
+	csv := c.DownloadReportCSV(report.ID)
+
+	if *outFile == "" {
+		fmt.Print(csv)
+		return
+	}
+	if err := ioutil.WriteFile(*outFile, []byte(csv), 0644); err != nil {
+		panic(cliError{exitError, err.Error()})
+	}
+}
+
+// fileName turns a report name into something safe to use as a file name
+func fileName(name string) string {
+	return cognos.SanitizeFileName(name) + ".csv"
+}
+
+// export downloads every report in a folder. A failed report dosen't stop
+// the rest, but the exit code will say something went wrong.
+func export(c *cognos.CognosInstance, args []string) (exitCode int) {
+	if len(args) != 2 {
+		panic(cliError{exitError, "usage: cognos export <folder-path> <dir>"})
+	}
+	folder := lookup(c, args[0], cognos.Folder)
+	if err := os.MkdirAll(args[1], 0755); err != nil {
+		panic(cliError{exitError, err.Error()})
+	}
+
+	entries := c.LsFolder(folder.ID)
+	for _, name := range sortedNames(entries) {
+		if entries[name].Type != cognos.Report {
+			continue
+		}
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					fmt.Fprintf(os.Stderr, "cognos: %s: %s\n", name, classify(r).message)
+					exitCode = exitReport
+				}
+			}()
+
+			csv := c.DownloadReportCSV(entries[name].ID)
+			path := filepath.Join(args[1], fileName(name))
+			if err := ioutil.WriteFile(path, []byte(csv), 0644); err != nil {
+				panic(err)
+			}
+			fmt.Println(path)
+		}()
+	}
+	return exitCode
+}
+
+// ping checks that we can log in and see the folder roots
+func ping(c *cognos.CognosInstance) {
+	c.FolderEntryFromPath([]string{"public"})
+	fmt.Println("ok")
+}
+
+// whoami prints who the server says we are logged in as
+func whoami(c *cognos.CognosInstance) {
+	identity := c.WhoAmI()
+	fmt.Printf("%s\t%s\n", identity.DisplayName, identity.CAMID)
+	fmt.Printf("namespace\t%s\n", identity.Namespace)
+	fmt.Printf("groups\t%s\n", strings.Join(identity.Groups, ", "))
+	fmt.Printf("roles\t%s\n", strings.Join(identity.Roles, ", "))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/9072997/cognos"
+	"github.com/9072997/cognos/cognostest"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name  string
+		panic interface{}
+		code  int
+	}{
+		{"auth", fmt.Errorf("logging in: %w", cognos.ErrAuthFailed), exitAuth},
+		{"not found", &cognos.NotFoundError{Component: "Daily"}, exitNotFound},
+		{"prompting", &cognos.PromptingError{ReportID: "i1"}, exitReport},
+		{"failed", fmt.Errorf("%w: RSV-SRV-0042", cognos.ErrReportFailed), exitReport},
+		{"poll", fmt.Errorf("%w: 10 checks in a row failed", cognos.ErrPollFailed), exitReport},
+		// these mention reports, but the report didn't fail
+		{"network", errors.New("Cognos request to /report?ui.object=i1 failed: connection refused"), exitError},
+		{"not a report", "x is not a report", exitError},
+	}
+	for _, test := range tests {
+		if code := classify(test.panic).code; code != test.code {
+			t.Errorf("%s: got exit code %d, want %d", test.name, code, test.code)
+		}
+	}
+}
+
+// runCLI runs the CLI with args and returns what it printed and its exit code
+func runCLI(t *testing.T, args ...string) (output string, exitCode int) {
+	stdout, err := ioutil.TempFile(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	realStdout := os.Stdout
+	os.Stdout = stdout
+	exitCode = run(args)
+	os.Stdout = realStdout
+
+	outputBytes, err := ioutil.ReadFile(stdout.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout.Close()
+	return string(outputBytes), exitCode
+}
+
+func TestWhoAmI(t *testing.T) {
+	srv := cognostest.NewServer()
+	defer srv.Close()
+	srv.DisplayName = "Jon Penn"
+	srv.Groups = []string{"Everyone", "Bentonville Staff"}
+	t.Setenv("COGNOS_PASS", srv.Pass)
+
+	output, exitCode := runCLI(t,
+		"-url", srv.URL, "-user", srv.User, "-namespace", srv.Namespace, "-dsn", srv.DSN,
+		"whoami",
+	)
+	if exitCode != 0 {
+		t.Fatalf("exit code %d", exitCode)
+	}
+	want := "Jon Penn\tCAMID(\"" + srv.Namespace + ":u:test\")\n" +
+		"namespace\t" + srv.Namespace + "\n" +
+		"groups\tEveryone, Bentonville Staff\n" +
+		"roles\tConsumers\n"
+	if output != want {
+		t.Errorf("got %q, want %q", output, want)
+	}
+}
+
+func TestBadFlags(t *testing.T) {
+	srv := cognostest.NewServer()
+	defer srv.Close()
+	t.Setenv("COGNOS_PASS", srv.Pass)
+
+	// these would make an instance that never sends anything, or gives up
+	// on every request right away
+	for _, flag := range []string{"-concurrency", "-timeout"} {
+		_, exitCode := runCLI(t,
+			"-url", srv.URL, "-user", srv.User, "-namespace", srv.Namespace, "-dsn", srv.DSN,
+			flag, "0", "ping",
+		)
+		if exitCode != exitError {
+			t.Errorf("%s 0: exit code %d", flag, exitCode)
+		}
+		if n := len(srv.Requests()); n != 0 {
+			t.Errorf("%s 0: made %d requests", flag, n)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := map[string]string{
+		"Daily Attendance": "Daily Attendance.csv",
+		"A/B: C?":          "A_B_ C_.csv",
+		"con":              "_con.csv",
+		"Trailing. ":       "Trailing.csv",
+	}
+	for name, want := range tests {
+		if got := fileName(name); got != want {
+			t.Errorf("%q: got %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package cognostest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Interaction is one request/response pair in a cassette
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a scrubbed copy of a request. URL is only the path
+// and query (no host).
+type RecordedRequest struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// RecordedResponse is a scrubbed copy of a response
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Cassette is what gets saved to (and loaded from) a cassette file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// scrubbedHeaders are never written to a cassette
+var scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "WWW-Authenticate"}
+
+// VolatileParams matches the names of query/form parameters that change
+// from run to run (conversation IDs, tracking values, etc). They are
+// ignored when matching a request against a cassette.
+var VolatileParams = regexp.MustCompile(`^(ui\.conversation|m_tracking|cv\.actionState|ui\.cafcontextid|executionParameters|cv\.id|conversation|tracking)$`)
+
+// Recorder is an http.RoundTripper that passes requests on to Transport and
+// records each request and response. Credentials and cookies are scrubbed.
+// Call Save to write the cassette file when you are done.
+//
+//	rec := cognostest.NewRecorder(c.Transport(), "testdata/run.json", c.Pass)
+//	c.SetTransport(rec)
+//	c.DownloadReportCSV(id)
+//	rec.Save()
+type Recorder struct {
+	Transport http.RoundTripper
+	Path      string
+	// Secrets are replaced with REDACTED anywhere they show up in a
+	// recorded URL or body (ex: the password)
+	Secrets []string
+
+	lock     sync.Mutex
+	cassette Cassette
+}
+
+// NewRecorder returns a Recorder that will save to path. Any secrets
+// given will be scrubbed from the cassette.
+func NewRecorder(transport http.RoundTripper, path string, secrets ...string) *Recorder {
+	return &Recorder{
+		Transport: transport,
+		Path:      path,
+		Secrets:   secrets,
+	}
+}
+
+// scrub removes secrets from a string
+func (r *Recorder) scrub(s string) string {
+	for _, secret := range r.Secrets {
+		if secret == "" {
+			continue
+		}
+		s = strings.Replace(s, secret, "REDACTED", -1)
+		s = strings.Replace(s, url.QueryEscape(secret), "REDACTED", -1)
+	}
+	return s
+}
+
+// scrubHeader returns a copy of header without credentials or cookies
+func scrubHeader(header http.Header) http.Header {
+	scrubbed := header.Clone()
+	for _, name := range scrubbedHeaders {
+		scrubbed.Del(name)
+	}
+	if len(scrubbed) == 0 {
+		return nil
+	}
+	return scrubbed
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := r.Transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    r.scrub(req.URL.RequestURI()),
+			Header: scrubHeader(req.Header),
+			Body:   r.scrub(string(reqBody)),
+		},
+		Response: RecordedResponse{
+			Status: resp.StatusCode,
+			Header: scrubHeader(resp.Header),
+			Body:   r.scrub(string(respBody)),
+		},
+	})
+	return resp, nil
+}
+
+// Save writes everything recorded so far to r.Path
+func (r *Recorder) Save() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	cassetteJSON, err := json.MarshalIndent(r.cassette, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(r.Path, cassetteJSON, 0644)
+}
+
+// Replayer is an http.RoundTripper that answers requests from a cassette
+// without touching the network. Requests are matched on method, path,
+// and query/form parameters (except ones matching IgnoreParams). If the
+// same request was recorded more than once (ex: polling a report) the
+// responses are replayed in the order they were recorded. A request that
+// dosen't match anything fails with an error, and is listed by Unmatched.
+type Replayer struct {
+	// IgnoreParams defaults to VolatileParams. Change it before the first request.
+	IgnoreParams *regexp.Regexp
+
+	lock      sync.Mutex
+	cassette  Cassette
+	queues    map[string][]RecordedResponse
+	unmatched []string
+}
+
+// NewReplayer returns a Replayer for an already loaded cassette
+func NewReplayer(cassette Cassette) *Replayer {
+	return &Replayer{
+		IgnoreParams: VolatileParams,
+		cassette:     cassette,
+	}
+}
+
+// LoadReplayer reads a cassette file written by Recorder.Save
+func LoadReplayer(path string) (*Replayer, error) {
+	cassetteJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	err = json.Unmarshal(cassetteJSON, &cassette)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cassette %s: %w", path, err)
+	}
+	return NewReplayer(cassette), nil
+}
+
+// matchKey builds the string requests are matched on
+func (r *Replayer) matchKey(method, requestURI, contentType, body string) string {
+	parsedURL, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return method + " " + requestURI
+	}
+	params := parsedURL.Query()
+
+	// form bodies count too. The polling POST dosen't always have a
+	// content type, so assume a form if there isn't one.
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if body != "" && (mediaType == "" || mediaType == "application/x-www-form-urlencoded") {
+		if form, err := url.ParseQuery(body); err == nil {
+			for name, values := range form {
+				params[name] = append(params[name], values...)
+			}
+		}
+	}
+
+	var significant []string
+	for name, values := range params {
+		if r.IgnoreParams != nil && r.IgnoreParams.MatchString(name) {
+			continue
+		}
+		for _, value := range values {
+			significant = append(significant, url.QueryEscape(name)+"="+url.QueryEscape(value))
+		}
+	}
+	sort.Strings(significant)
+	return method + " " + parsedURL.Path + "?" + strings.Join(significant, "&")
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.queues == nil {
+		r.queues = make(map[string][]RecordedResponse)
+		for _, interaction := range r.cassette.Interactions {
+			key := r.matchKey(
+				interaction.Request.Method,
+				interaction.Request.URL,
+				interaction.Request.Header.Get("Content-Type"),
+				interaction.Request.Body,
+			)
+			r.queues[key] = append(r.queues[key], interaction.Response)
+		}
+	}
+
+	key := r.matchKey(req.Method, req.URL.RequestURI(), req.Header.Get("Content-Type"), string(reqBody))
+	queue := r.queues[key]
+	if len(queue) == 0 {
+		r.unmatched = append(r.unmatched, key)
+		return nil, errors.New("cognostest: no recorded response for " + key)
+	}
+	recorded := queue[0]
+	r.queues[key] = queue[1:]
+
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(recorded.Body)),
+		ContentLength: int64(len(recorded.Body)),
+		Request:       req,
+	}, nil
+}
+
+// Unmatched returns the match keys of every request that had no recorded
+// response. Tests should fail if this is not empty.
+func (r *Replayer) Unmatched() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]string(nil), r.unmatched...)
+}
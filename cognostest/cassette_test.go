@@ -0,0 +1,71 @@
+package cognostest_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/9072997/cognos"
+	"github.com/9072997/cognos/cognostest"
+)
+
+func TestRecordAndReplayPolling(t *testing.T) {
+	srv := cognostest.NewServer()
+	report := srv.Public.AddReport("Daily", "a,b\n1,2\n")
+	report.Polls = 3
+	cassettePath := filepath.Join(t.TempDir(), "daily.json")
+
+	c := cognos.MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 0, 0, 10, 4)
+	rec := cognostest.NewRecorder(c.Transport(), cassettePath, srv.Pass)
+	c.SetTransport(rec)
+	if csv := c.DownloadReportCSV(report.ID); csv != report.CSV {
+		t.Fatalf("recording got %q", csv)
+	}
+	if err := rec.Save(); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	cassetteJSON, err := ioutil.ReadFile(cassettePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"Authorization", "Cookie", srv.Pass + `"`} {
+		if strings.Contains(string(cassetteJSON), secret) {
+			t.Errorf("the cassette has %s in it", secret)
+		}
+	}
+
+	// the server is gone, so everything has to come from the cassette
+	replayer, err := cognostest.LoadReplayer(cassettePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = cognos.MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 0, 0, 10, 4)
+	c.SetTransport(replayer)
+	csv, err := c.DownloadReportCSVContext(context.Background(), report.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if csv != report.CSV {
+		t.Errorf("replay got %q, want %q", csv, report.CSV)
+	}
+	if unmatched := replayer.Unmatched(); len(unmatched) > 0 {
+		t.Errorf("requests weren't in the cassette: %v", unmatched)
+	}
+}
+
+func TestReplayerRejectsUnknownRequests(t *testing.T) {
+	replayer := cognostest.NewReplayer(cognostest.Cassette{})
+	c := cognos.MakeInstance(`APSCN\test`, "test", "http://cognos.invalid", "esp", "testsms", 0, 0, 10, 4)
+	c.SetTransport(replayer)
+
+	if _, err := c.LsFolderE("i1"); err == nil {
+		t.Error("a request that isn't in the cassette worked")
+	}
+	if len(replayer.Unmatched()) != 1 {
+		t.Errorf("got unmatched requests %v, want 1", replayer.Unmatched())
+	}
+}
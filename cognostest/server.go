@@ -0,0 +1,1779 @@
+// Package cognostest provides a fake Cognos server for testing code that
+// uses the cognos package without a connection to a real Cognos install.
+//
+// The fake server serves the portal home page (with the folder root IDs),
+// folder listings generated from an in-memory tree of folders and reports,
+// and the report run conversation (working, still working, then a download
+// link to the CSV). It can also be told to fail requests with a given HTTP
+// status to exercise retry paths.
+//
+//	srv := cognostest.NewServer()
+//	defer srv.Close()
+//	srv.Public.AddFolder("Attendance").AddReport("Daily", "a,b\n1,2\n")
+//	c := cognos.MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 0, 3, 10, 4)
+package cognostest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gatewayPath is the path of the Cognos gateway CGI
+const gatewayPath = "/ibmcognos/cgi-bin/cognos.cgi"
+
+// dispatchPath is the path of the dispatcher's servlet. It serves
+// everything the gateway does, but wants a passport instead of NTLM.
+const dispatchPath = "/p2pd/servlet/dispatch"
+
+// outputPath is where finished report outputs are downloaded from
+const outputPath = "/cognostest/output/"
+
+// Folder is a folder in the fake server's content tree
+type Folder struct {
+	Name    string
+	ID      string
+	Folders []*Folder
+	Reports []*Report
+	Jobs    []*Job
+	// Packages are the packages in the folder. Remove one to break the
+	// reports based on it.
+	Packages []*Package
+	// Hidden makes the folder only show up in listings that ask for
+	// hidden entries
+	Hidden bool
+	// ReadOnly makes creating things in the folder fail with a permission
+	// fault
+	ReadOnly bool
+	// Links are other links listed in the folder, that aren't to anything
+	// in the tree (ex: a URL object, or a customized portal's extra links)
+	Links  []Link
+	server *Server
+}
+
+// Link is a link listed in a folder (see Folder.Links)
+type Link struct {
+	Name string
+	Href string
+}
+
+// Report is a report in the fake server's content tree
+type Report struct {
+	Name string
+	ID   string
+	// Hidden makes the report only show up in listings that ask for
+	// hidden entries
+	Hidden bool
+	// CSV is what downloading the report returns
+	CSV string
+	// CSVFor is what the report returns when it is run as someone else,
+	// keyed by username. If there is no entry, CSV is used.
+	CSVFor map[string]string
+	// Outputs is what the report returns in formats other than CSV (ex:
+	// XLSX), keyed by format. Running it in a format that isn't here
+	// fails.
+	Outputs map[string]string
+	// Polls is the number of times the report says it is still working
+	// before it finishes. 0 means it finishes right away.
+	Polls int
+	// Schedules is what the report's schedule page lists
+	Schedules []Schedule
+	// History is what the report's run history page lists, newest first
+	History []RunRecord
+	// Package is the package the report is based on. If it isn't in a
+	// folder any more, the report's package is broken.
+	Package *Package
+	// SavedOutputs is what the report's output versions page lists
+	SavedOutputs []SavedOutput
+	// RunOptions are what the report's run options page says. If it is
+	// nil the page has none of them, like a report that has never had
+	// them set.
+	RunOptions *RunOptions
+	// Prompting makes the report ask for parameters instead of running,
+	// unless it is run with a value for every required prompt in Prompts
+	Prompting bool
+	// Bursts makes the report burst-enabled. When it is run with bursting,
+	// there is one output per key instead of CSV.
+	Bursts map[string]string
+	// Columns is what the report's query metadata says it outputs. If it
+	// is nil the metadata isn't available.
+	Columns []Column
+	// Spec is the report specification XML. If it is "" the report's
+	// specification isn't available.
+	Spec string
+	// Prompts are the parameters the report says it asks for
+	Prompts []Prompt
+	// Params are the saved prompt values (ex: for a report view, or set
+	// with SaveDefaultPromptValues)
+	Params map[string]string
+	// ReadOnly makes changing the report fail with a permission fault
+	ReadOnly bool
+	// NoData makes the report show the "No Data Available" page instead
+	// of a link to the output, like a real report that didn't find
+	// anything. (A report can also just have a CSV with only a header.)
+	NoData bool
+	// IgnoreRowLimit makes the report return every row, even when it is
+	// run with a row limit
+	IgnoreRowLimit bool
+	// ShortDownloads is how many more times downloading the output stops
+	// halfway, after saying (with Content-Length) it would send all of it
+	ShortDownloads int
+	// AcceptRanges makes downloading the CSV output honor Range requests
+	// (with If-Range), like a gateway that supports resuming downloads
+	AcceptRanges bool
+	// Broken makes the report return a page the client won't understand
+	Broken bool
+}
+
+// Prompt is a report parameter. The fields match cognos.Prompt.
+type Prompt struct {
+	Name     string `json:"name"`
+	Caption  string `json:"caption"`
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	Multi    bool   `json:"multi"`
+}
+
+// Column is a column of a report's output. The fields match
+// cognos.ColumnInfo.
+type Column struct {
+	Name     string `json:"name"`
+	DataType string `json:"dataType"`
+}
+
+// Account is another user in the namespace, for the directory pages
+type Account struct {
+	Name string
+	// My is the account's My Folders. It is nil if the account has never
+	// logged in, so it dosen't have one.
+	My *Folder
+	// Inaccessible makes looking at the account fail with a permission
+	// fault
+	Inaccessible bool
+}
+
+// CAMID returns the account's search path
+func (a *Account) CAMID(namespace string) string {
+	return `CAMID("` + namespace + `:u:` + a.Name + `")`
+}
+
+// directoryPageSize is how many accounts the directory page lists at once
+const directoryPageSize = 50
+
+// Delivery is a report output the server was asked to email
+type Delivery struct {
+	ReportID string
+	EventID  string
+	To       []string
+	Subject  string
+	Attach   bool
+	Format   string
+	// Params are the prompt values the report was run with
+	Params map[string]string
+}
+
+// Package is a package (data source) in the fake server's content tree
+type Package struct {
+	Name string
+	ID   string
+}
+
+// SearchPath is what reports based on the package say it is
+func (p *Package) SearchPath() string {
+	return "/content/package[@name='" + p.Name + "']"
+}
+
+// Job is a job in the fake server's content tree
+type Job struct {
+	Name  string
+	ID    string
+	Steps []JobStep
+	// Hidden makes the job only show up in listings that ask for hidden
+	// entries
+	Hidden bool
+	// Polls is the number of times the job says it is still running
+	// before it finishes
+	Polls int
+}
+
+// JobStep is a step in a job
+type JobStep struct {
+	Name string
+	// Fail makes the step fail
+	Fail bool
+	// OutputIDs are the saved outputs the step says it made
+	OutputIDs []string
+}
+
+// Schedule is a schedule on a report. The fields match cognos.Schedule.
+type Schedule struct {
+	ID          string    `json:"id"`
+	Frequency   string    `json:"frequency"`
+	NextRun     time.Time `json:"nextRun"`
+	LastRun     time.Time `json:"lastRun"`
+	Owner       string    `json:"owner"`
+	Enabled     bool      `json:"enabled"`
+	Formats     []string  `json:"formats"`
+	Destination string    `json:"destination"`
+}
+
+// RunOptions are a report's saved run options. Fields left nil (or empty)
+// are left off the page.
+type RunOptions struct {
+	OutputFormats []string     `json:"outputFormats,omitempty"`
+	Prompt        *bool        `json:"prompt,omitempty"`
+	Delivery      *RunDelivery `json:"delivery,omitempty"`
+	Languages     []string     `json:"languages,omitempty"`
+}
+
+// RunDelivery is where a report's output goes when it runs in the
+// background
+type RunDelivery struct {
+	Save  bool     `json:"save"`
+	Email bool     `json:"email"`
+	To    []string `json:"to,omitempty"`
+}
+
+// SavedOutput is a saved output version of a report. The fields match
+// cognos.SavedOutput.
+type SavedOutput struct {
+	ID      string    `json:"id"`
+	Saved   time.Time `json:"saved"`
+	Status  string    `json:"status"`
+	Formats []string  `json:"formats"`
+	Size    int64     `json:"size"`
+}
+
+// RunRecord is a past run of a report. The fields match cognos.RunRecord.
+type RunRecord struct {
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Status string    `json:"status"`
+	User   string    `json:"user"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Request is a request the fake server received
+type Request struct {
+	Method string
+	URL    string
+	Form   url.Values
+	Header http.Header
+}
+
+// conversation is a report run in progress
+type conversation struct {
+	report         *Report
+	pollsRemaining int
+	runAs          string
+	burst          bool
+	rowLimit       int
+	format         string
+	answered       bool
+	started        time.Time
+}
+
+// Server is a fake Cognos server. Change the exported fields before making
+// requests, or lock them yourself, since the server reads them from other
+// goroutines.
+type Server struct {
+	*httptest.Server
+
+	// credentials the fake server expects (basic auth). Requests with
+	// diffrent credentials get a 401. If User is empty any credentials
+	// are accepted.
+	User string
+	Pass string
+	// Namespace and DSN are not checked, but are here for convenience
+	Namespace string
+	DSN       string
+	// ProductVersion is put on the portal home page
+	ProductVersion string
+	// Public and My are the roots of the content tree
+	Public *Folder
+	My     *Folder
+	// DisplayName, Groups, Roles, and Capabilities are what the personal
+	// information page says about the logged in user
+	DisplayName  string
+	Groups       []string
+	Roles        []string
+	Capabilities []string
+	// Accounts are listed by the directory pages. Use AddAccount to add
+	// one.
+	Accounts []*Account
+	// AllowRunAs lets reports be run as another user (see Report.CSVFor).
+	// Otherwise trying to gets a fault.
+	AllowRunAs bool
+	// ListingETags makes folder listings have an ETag, and return 304 Not
+	// Modified if the folder hasn't changed since the client's copy
+	ListingETags bool
+	// NoListingPages makes the server ignore m_pageSize and always list
+	// every entry, like older portals
+	NoListingPages bool
+	// NoSMTP makes emailing a report fail, like a server that dosen't
+	// have a mail server set up
+	NoSMTP bool
+	// Language is the language the report viewer answers in when a
+	// request dosen't ask for one with Accept-Language, like a gateway that
+	// defaults sessions to another language. Only en (the default) and es
+	// are modeled (see spanish.go).
+	Language string
+	// Deliveries are the report outputs the server has been asked to
+	// email, oldest first
+	Deliveries []Delivery
+	// XSRF makes the server give out an XSRF token in a cookie, and reject
+	// POSTs that don't send it back in the X-XSRF-TOKEN header, like a
+	// portal with a newer fix pack. See RotateXSRFToken.
+	XSRF bool
+	// Delay makes every request take at least this long, for testing
+	// timeouts and running out of request slots. Use SetDelay to change
+	// it while requests are going.
+	Delay time.Duration
+
+	lock          sync.Mutex
+	inFlight      int
+	maxInFlight   int
+	connections   int
+	nextID        int
+	faults        []int
+	requests      []Request
+	conversations map[string]*conversation
+	jobEvents     map[string]*jobEvent
+	passports     map[string]bool
+	xsrfToken     string
+}
+
+// jobEvent is a job run in progress
+type jobEvent struct {
+	job            *Job
+	pollsRemaining int
+}
+
+// NewServer starts a fake Cognos server with empty public and my folders.
+// Call Close when you are done with it.
+func NewServer() *Server {
+	s := &Server{
+		User:           `APSCN\test`,
+		Pass:           "test",
+		Namespace:      "esp",
+		DSN:            "testsms",
+		ProductVersion: "10.2.2",
+		DisplayName:    "Test User",
+		Groups:         []string{"Everyone"},
+		Roles:          []string{"Consumers"},
+		Capabilities:   []string{"canUseCognosViewer", "canUseScheduling"},
+		conversations:  make(map[string]*conversation),
+		jobEvents:      make(map[string]*jobEvent),
+		passports:      make(map[string]bool),
+	}
+	s.Public = &Folder{Name: "Public Folders", ID: s.newID(), server: s}
+	s.My = &Folder{Name: "My Folders", ID: s.newID(), server: s}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	s.Server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.lock.Lock()
+			s.connections++
+			s.lock.Unlock()
+		}
+	}
+	s.Server.Start()
+	return s
+}
+
+// newID returns a new unique store ID
+func (s *Server) newID() string {
+	s.nextID++
+	return fmt.Sprintf("i%08X", s.nextID)
+}
+
+// AddAccount adds an account to the directory and returns it. If
+// withFolders is set, it gets an empty My Folders.
+func (s *Server) AddAccount(name string, withFolders bool) *Account {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	account := &Account{Name: name}
+	if withFolders {
+		account.My = &Folder{Name: "My Folders", ID: s.newID(), server: s}
+	}
+	s.Accounts = append(s.Accounts, account)
+	return account
+}
+
+// AddFolder adds a subfolder and returns it
+func (f *Folder) AddFolder(name string) *Folder {
+	f.server.lock.Lock()
+	defer f.server.lock.Unlock()
+
+	child := &Folder{Name: name, ID: f.server.newID(), server: f.server}
+	f.Folders = append(f.Folders, child)
+	return child
+}
+
+// AddReport adds a report that returns csv and returns the report so
+// you can set Polls, Prompting, etc.
+func (f *Folder) AddReport(name, csv string) *Report {
+	f.server.lock.Lock()
+	defer f.server.lock.Unlock()
+
+	report := &Report{Name: name, ID: f.server.newID(), CSV: csv}
+	f.Reports = append(f.Reports, report)
+	return report
+}
+
+// AddPackage adds a package and returns it
+func (f *Folder) AddPackage(name string) *Package {
+	f.server.lock.Lock()
+	defer f.server.lock.Unlock()
+
+	pkg := &Package{Name: name, ID: f.server.newID()}
+	f.Packages = append(f.Packages, pkg)
+	return pkg
+}
+
+// Remove removes whatever is in the folder with the given name, like it
+// was deleted while the server is running. It returns false if there is
+// nothing by that name.
+func (f *Folder) Remove(name string) bool {
+	f.server.lock.Lock()
+	defer f.server.lock.Unlock()
+
+	for i, child := range f.Folders {
+		if child.Name == name {
+			f.Folders = append(f.Folders[:i:i], f.Folders[i+1:]...)
+			return true
+		}
+	}
+	for i, report := range f.Reports {
+		if report.Name == name {
+			f.Reports = append(f.Reports[:i:i], f.Reports[i+1:]...)
+			return true
+		}
+	}
+	for i, job := range f.Jobs {
+		if job.Name == name {
+			f.Jobs = append(f.Jobs[:i:i], f.Jobs[i+1:]...)
+			return true
+		}
+	}
+	for i, pkg := range f.Packages {
+		if pkg.Name == name {
+			f.Packages = append(f.Packages[:i:i], f.Packages[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Rename renames whatever is in the folder with the given name while the
+// server is running. It returns false if there is nothing by that name.
+func (f *Folder) Rename(name, newName string) bool {
+	f.server.lock.Lock()
+	defer f.server.lock.Unlock()
+
+	for _, child := range f.Folders {
+		if child.Name == name {
+			child.Name = newName
+			return true
+		}
+	}
+	for _, report := range f.Reports {
+		if report.Name == name {
+			report.Name = newName
+			return true
+		}
+	}
+	for _, job := range f.Jobs {
+		if job.Name == name {
+			job.Name = newName
+			return true
+		}
+	}
+	for _, pkg := range f.Packages {
+		if pkg.Name == name {
+			pkg.Name = newName
+			return true
+		}
+	}
+	return false
+}
+
+// AddJob adds a job with the given steps and returns it
+func (f *Folder) AddJob(name string, steps ...JobStep) *Job {
+	f.server.lock.Lock()
+	defer f.server.lock.Unlock()
+
+	job := &Job{Name: name, ID: f.server.newID(), Steps: steps}
+	f.Jobs = append(f.Jobs, job)
+	return job
+}
+
+// ForgetConversations makes the server forget every report run in
+// progress, like a real server does when a conversation expires
+func (s *Server) ForgetConversations() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.conversations = make(map[string]*conversation)
+}
+
+// InjectFaults makes the next count requests fail with the HTTP status code
+// status (ex: 401 or 503). Faults are queued, so calling this twice will
+// fail the first batch of requests with one status and the next with the other.
+func (s *Server) InjectFaults(status int, count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := 0; i < count; i++ {
+		s.faults = append(s.faults, status)
+	}
+}
+
+// SetDelay changes Delay. Unlike setting it directly, this is safe while
+// requests are going.
+func (s *Server) SetDelay(delay time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.Delay = delay
+}
+
+// Requests returns every request the server has received so far,
+// including ones that were failed on purpose
+func (s *Server) Requests() []Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// RotateXSRFToken gives out a new XSRF token (see XSRF). POSTs with the
+// old one are rejected, but the rejection comes with the new one.
+func (s *Server) RotateXSRFToken() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.xsrfToken = s.newID()
+}
+
+// SetCredentials changes User and Pass while requests are being made, like
+// a password being changed on a real server
+func (s *Server) SetCredentials(user, pass string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.User = user
+	s.Pass = pass
+}
+
+// MaxInFlight returns the most requests the server has been handling at
+// the same time
+func (s *Server) MaxInFlight() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.maxInFlight
+}
+
+// Connections returns how many connections have been made to the server,
+// for checking that they are reused
+func (s *Server) Connections() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.connections
+}
+
+// ResetRequests clears the list returned by Requests
+func (s *Server) ResetRequests() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	// Requests has the headers we were sent, not the ones we fill in
+	header := r.Header.Clone()
+	// the real gateway will take a form body even without a content type
+	if r.Method == "POST" && r.Header.Get("Content-Type") == "" {
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	r.ParseForm()
+
+	s.lock.Lock()
+	delay := s.Delay
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		s.inFlight--
+		s.lock.Unlock()
+	}()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, Request{
+		Method: r.Method,
+		URL:    r.URL.RequestURI(),
+		Form:   r.Form,
+		Header: header,
+	})
+
+	// injected faults come first
+	if len(s.faults) > 0 {
+		status := s.faults[0]
+		s.faults = s.faults[1:]
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if r.URL.Path == dispatchPath {
+		if !s.checkPassport(w, r) {
+			return
+		}
+		r.URL.Path = gatewayPath
+	}
+
+	// check credentials. The NTLM negotiator tries without credentials
+	// first, so a request with no credentials is treated as already
+	// authenticated. Only wrong credentials are rejected.
+	if s.User != "" {
+		user, pass, ok := r.BasicAuth()
+		if ok && (user != s.User || pass != s.Pass) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cognos"`)
+			http.Error(w, http.StatusText(401), 401)
+			return
+		}
+	}
+
+	if s.XSRF {
+		if s.xsrfToken == "" {
+			s.xsrfToken = s.newID()
+		}
+		http.SetCookie(w, &http.Cookie{Name: "XSRF-TOKEN", Value: s.xsrfToken, Path: "/"})
+		if r.Method == "POST" && r.Header.Get("X-XSRF-TOKEN") != s.xsrfToken {
+			http.Error(w, "CAM-CRP-1315 The request was rejected because the XSRF token is missing or invalid.", 403)
+			return
+		}
+	}
+
+	if strings.HasPrefix(r.URL.Path, outputPath) {
+		s.serveOutput(w, r, strings.TrimPrefix(r.URL.EscapedPath(), outputPath))
+		return
+	}
+	if r.URL.Path != gatewayPath {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/cc.xts" && r.Form.Get("m_folder") != "":
+		s.serveFolder(w, r, r.Form.Get("m_folder"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/properties_general.xts":
+		s.serveProperties(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/properties_schedule.xts":
+		s.serveSchedules(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/properties_runhistory.xts":
+		s.serveRunHistory(w, r.Form.Get("m_obj"), r.Form.Get("m_limit"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/properties_outputversions.xts":
+		s.serveOutputVersions(w, r.Form)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/report_spec.xts":
+		s.serveSpec(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/report_metadata.xts":
+		s.serveMetadata(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/report_prompts.xts":
+		s.servePrompts(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/run_options.xts":
+		s.serveRunOptions(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/report_options.xts":
+		s.serveReportOptions(w, r.Form)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/new_folder.xts":
+		s.serveNewFolder(w, r.Form)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/new_reportview.xts":
+		s.serveNewReportView(w, r.Form)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/run.xts" && r.Form.Get("m_cmd") == "runWithOptions":
+		s.serveDelivery(w, r.Form)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/run.xts":
+		s.serveRunJob(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/jobStatus.xts":
+		s.serveJobStatus(w, r.Form.Get("m_event"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/schedule.xts":
+		s.serveScheduleForm(w, r.Form)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/logoff.xts":
+		fmt.Fprint(w, "<html><body>You have logged off.</body></html>\n")
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/directory.xts":
+		start, _ := strconv.Atoi(r.Form.Get("m_start"))
+		s.serveDirectory(w, start)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/properties_account.xts":
+		s.serveAccount(w, r.Form.Get("m_obj"))
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/activities.xts":
+		s.serveActivities(w)
+	case r.Form.Get("b_action") == "xts.run" && r.Form.Get("m") == "portal/preferences_personal.xts":
+		s.servePersonal(w)
+	case r.Form.Get("b_action") == "xts.run":
+		s.logOn(w, r)
+		s.serveHome(w)
+	case r.Form.Get("b_action") == "cognosViewer" && r.Form.Get("ui.action") == "run":
+		rowLimit, _ := strconv.Atoi(r.Form.Get("run.rowLimit"))
+		s.serveRun(w, r.Form.Get("ui.object"), runOptions{
+			runAs:    r.Form.Get("run.runAs"),
+			burst:    r.Form.Get("run.burst") == "true",
+			rowLimit: rowLimit,
+			format:   r.Form.Get("run.outputFormat"),
+			params:   r.Form,
+			spanish:  s.viewerLanguage(r) == "es",
+		})
+	case r.Form.Get("b_action") == "cognosViewer" && r.Form.Get("ui.action") == "wait":
+		s.serveWait(w, r.Form.Get("ui.conversation"), s.viewerLanguage(r) == "es")
+	case r.Form.Get("b_action") == "cognosViewer" && r.Form.Get("ui.action") == "cancel":
+		s.serveCancel(w, r.Form.Get("ui.conversation"))
+	default:
+		http.Error(w, "cognostest: unsupported request", 400)
+	}
+}
+
+// checkPassport handles logging on to the dispatcher (h_CAM_action=logonAs),
+// and checks the passport cookie on everything else. It returns false if
+// the request has been answered.
+func (s *Server) checkPassport(w http.ResponseWriter, r *http.Request) bool {
+	if r.Form.Get("h_CAM_action") == "logonAs" {
+		user := s.User
+		if i := strings.LastIndexByte(user, '\\'); i >= 0 {
+			user = user[i+1:]
+		}
+		if s.User != "" && (r.Form.Get("CAMUsername") != user || r.Form.Get("CAMPassword") != s.Pass) {
+			http.Error(w, "CAM-AAA-0036 Unable to authenticate because the credentials are invalid.", 403)
+			return false
+		}
+		s.givePassport(w)
+		s.serveHome(w)
+		return false
+	}
+
+	cookie, err := r.Cookie("cam_passport")
+	if err != nil || !s.passports[cookie.Value] {
+		http.Error(w, http.StatusText(401), 401)
+		return false
+	}
+	if r.Form.Get("m") == "portal/logoff.xts" {
+		delete(s.passports, cookie.Value)
+	}
+	return true
+}
+
+// logOn gives out a passport like the gateway does when someone goes to
+// the portal, unless the request already has one
+func (s *Server) logOn(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie("cam_passport"); err == nil && s.passports[cookie.Value] {
+		return
+	}
+	s.givePassport(w)
+}
+
+// givePassport sets a new passport cookie
+func (s *Server) givePassport(w http.ResponseWriter) {
+	passport := s.newID()
+	s.passports[passport] = true
+	http.SetCookie(w, &http.Cookie{Name: "cam_passport", Value: passport, Path: "/"})
+}
+
+// serveHome serves the portal home page, which has the folder root IDs
+func (s *Server) serveHome(w http.ResponseWriter) {
+	fmt.Fprintf(w, "<html><head><script>\n"+
+		"var g_PS_PFRootId = \"%s\";\n"+
+		"var g_PS_MFRootId = \"%s\";\n"+
+		"var g_PS_ProductVersion = \"%s\";\n"+
+		"</script></head><body>IBM Cognos Connection</body></html>\n",
+		s.Public.ID, s.My.ID, s.ProductVersion)
+}
+
+// servePersonal serves the personal information page for the logged in user
+func (s *Server) servePersonal(w http.ResponseWriter) {
+	username := s.User
+	if i := strings.Index(username, `\`); i >= 0 {
+		username = username[i+1:]
+	}
+	jsVar := func(name string, value interface{}) {
+		valueJSON, _ := json.Marshal(value)
+		fmt.Fprintf(w, "var %s = %s;\n", name, valueJSON)
+	}
+
+	fmt.Fprint(w, "<html><head><script>\n")
+	jsVar("g_PS_CAMID", "CAMID(\""+s.Namespace+":u:"+username+"\")")
+	jsVar("g_PS_UserName", s.DisplayName)
+	jsVar("g_PS_Groups", s.Groups)
+	jsVar("g_PS_Roles", s.Roles)
+	jsVar("g_PS_Capabilities", s.Capabilities)
+	fmt.Fprint(w, "</script></head><body>Personal information</body></html>\n")
+}
+
+// findFolder finds a folder by ID in the tree. It returns nil if there isn't one.
+func (s *Server) findFolder(id string) *Folder {
+	var search func(f *Folder) *Folder
+	search = func(f *Folder) *Folder {
+		if f.ID == id {
+			return f
+		}
+		for _, child := range f.Folders {
+			if found := search(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	for _, root := range s.roots() {
+		if found := search(root); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// roots returns the roots of every content tree, including the accounts'
+// My Folders
+func (s *Server) roots() []*Folder {
+	roots := []*Folder{s.Public, s.My}
+	for _, account := range s.Accounts {
+		if account.My != nil {
+			roots = append(roots, account.My)
+		}
+	}
+	return roots
+}
+
+// findReport finds a report by ID in the tree. It returns nil if there isn't one.
+func (s *Server) findReport(id string) *Report {
+	var search func(f *Folder) *Report
+	search = func(f *Folder) *Report {
+		for _, report := range f.Reports {
+			if report.ID == id {
+				return report
+			}
+		}
+		for _, child := range f.Folders {
+			if found := search(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	for _, root := range s.roots() {
+		if found := search(root); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findPackage finds a package by ID in the tree. It returns nil if there
+// isn't one.
+func (s *Server) findPackage(id string) *Package {
+	var search func(f *Folder) *Package
+	search = func(f *Folder) *Package {
+		for _, pkg := range f.Packages {
+			if pkg.ID == id {
+				return pkg
+			}
+		}
+		for _, child := range f.Folders {
+			if found := search(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	for _, root := range s.roots() {
+		if found := search(root); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// serveFolder serves a folder listing in the same shape as the portal
+func (s *Server) serveFolder(w http.ResponseWriter, r *http.Request, id string) {
+	folder := s.findFolder(id)
+	if folder == nil && s.findPackage(id) != nil {
+		// what is in a package isn't modeled, so it looks empty
+		folder = &Folder{ID: id}
+	}
+	if folder == nil {
+		http.Error(w, "cognostest: no such folder", 404)
+		return
+	}
+
+	var page strings.Builder
+	pageSize, _ := strconv.Atoi(r.Form.Get("m_pageSize"))
+	first, _ := strconv.Atoi(r.Form.Get("m_first"))
+	if s.NoListingPages {
+		pageSize = 0
+	}
+	s.writeListing(&page, folder, r.Form.Get("m_showHidden") == "true", pageSize, first)
+	if s.ListingETags {
+		etag := fmt.Sprintf(`"%x"`, sha256.Sum256([]byte(page.String())))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	fmt.Fprint(w, page.String())
+}
+
+// writeListing writes the listing page of a folder. Names are escaped
+// twice, like the portal does it. Hidden entries are left out unless
+// showHidden is set, and then their link is marked. If pageSize is more
+// than 0, only that many entries are listed, starting at first (counting
+// from 1), under an entries indicator like the portal's.
+func (s *Server) writeListing(w io.Writer, folder *Folder, showHidden bool, pageSize int, first int) {
+	var rows []string
+	row := func(link, name string, hidden bool) {
+		if hidden && !showHidden {
+			return
+		}
+		linkClass := ""
+		if hidden {
+			linkClass = ` class="hiddenObject"`
+		}
+		rows = append(rows, fmt.Sprintf("<tr><td class=\"tableText\"><a%s href=\"%s\">%s</a></td></tr>\n",
+			linkClass, html.EscapeString(link), html.EscapeString(html.EscapeString(name))))
+	}
+
+	for _, child := range folder.Folders {
+		link := gatewayPath + "?b_action=xts.run&m=portal/cc.xts&m_folder=" + url.QueryEscape(child.ID)
+		row(link, child.Name, child.Hidden)
+	}
+	for _, pkg := range folder.Packages {
+		link := gatewayPath + "?b_action=xts.run&m=portal/cc.xts&m_folder=" + url.QueryEscape(pkg.ID) +
+			"&m_class=package"
+		row(link, pkg.Name, false)
+	}
+	for _, report := range folder.Reports {
+		link := gatewayPath + "?b_action=cognosViewer&ui.action=run&ui.object=" + url.QueryEscape(report.ID)
+		row(link, report.Name, report.Hidden)
+	}
+	for _, job := range folder.Jobs {
+		link := gatewayPath + "?b_action=cognosViewer&ui.action=run&ui.object=" + url.QueryEscape(job.ID) +
+			"&ui.objectClass=jobDefinition"
+		row(link, job.Name, job.Hidden)
+	}
+	for _, link := range folder.Links {
+		row(link.Href, link.Name, false)
+	}
+
+	fmt.Fprint(w, "<html><body>\n")
+	if pageSize > 0 && len(rows) > 0 {
+		if first < 1 {
+			first = 1
+		}
+		total := len(rows)
+		start := first - 1
+		if start > total {
+			start = total
+		}
+		end := start + pageSize
+		if end > total {
+			end = total
+		}
+		rows = rows[start:end]
+		fmt.Fprintf(w, "<div class=\"pagingText\">Entries: %d - %d of %d</div>\n", start+1, end, total)
+	}
+	fmt.Fprint(w, "<table>\n")
+	for _, row := range rows {
+		fmt.Fprint(w, row)
+	}
+	fmt.Fprint(w, "</table></body></html>\n")
+}
+
+// findJob finds a job by ID in the tree. It returns nil if there isn't one.
+func (s *Server) findJob(id string) *Job {
+	var search func(f *Folder) *Job
+	search = func(f *Folder) *Job {
+		for _, job := range f.Jobs {
+			if job.ID == id {
+				return job
+			}
+		}
+		for _, child := range f.Folders {
+			if found := search(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+
+	if found := search(s.Public); found != nil {
+		return found
+	}
+	return search(s.My)
+}
+
+// serveRunJob starts a job. searchPath must be in the form storeID("id").
+func (s *Server) serveRunJob(w http.ResponseWriter, searchPath string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+	job := s.findJob(id)
+	if job == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+
+	eventID := "e" + s.newID()
+	s.jobEvents[eventID] = &jobEvent{job: job, pollsRemaining: job.Polls}
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_EventID = %q;\n</script></head><body></body></html>\n", eventID)
+}
+
+// serveDelivery runs a report and "emails" the output, by adding it to
+// Deliveries
+func (s *Server) serveDelivery(w http.ResponseWriter, form url.Values) {
+	searchPath := form.Get("m_obj")
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+	report := s.findReport(id)
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+	if s.NoSMTP {
+		fmt.Fprint(w, "<html><body><table><tr><td>"+
+			"NC-DSO-0114 The mail server is not configured. The email could not be delivered."+
+			"</td></tr></table></body></html>\n")
+		return
+	}
+
+	delivery := Delivery{
+		ReportID: id,
+		EventID:  "e" + s.newID(),
+		To:       strings.Split(form.Get("dlv_to"), ";"),
+		Subject:  form.Get("dlv_subject"),
+		Attach:   form.Get("dlv_attach") == "true",
+		Format:   form.Get("run.outputFormat"),
+		Params:   make(map[string]string),
+	}
+	for name := range form {
+		if strings.HasPrefix(name, "p_") {
+			delivery.Params[strings.TrimPrefix(name, "p_")] = strings.Join(form[name], "\n")
+		}
+	}
+	s.Deliveries = append(s.Deliveries, delivery)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_EventID = %q;\n</script></head><body></body></html>\n", delivery.EventID)
+}
+
+// serveJobStatus serves the status of a job run
+func (s *Server) serveJobStatus(w http.ResponseWriter, eventID string) {
+	event, exists := s.jobEvents[eventID]
+	if !exists {
+		s.serveMissingObject(w, eventID)
+		return
+	}
+
+	type stepStatus struct {
+		Name      string   `json:"name"`
+		Status    string   `json:"status"`
+		Error     string   `json:"error,omitempty"`
+		OutputIDs []string `json:"outputIds,omitempty"`
+	}
+	status := struct {
+		Status string       `json:"status"`
+		Steps  []stepStatus `json:"steps"`
+	}{Status: "executing"}
+
+	failed := 0
+	for _, step := range event.job.Steps {
+		stepStatus := stepStatus{Name: step.Name, Status: "executing"}
+		if event.pollsRemaining == 0 {
+			if step.Fail {
+				failed++
+				stepStatus.Status = "failed"
+				stepStatus.Error = "RSV-SRV-0042 The step failed."
+			} else {
+				stepStatus.Status = "succeeded"
+				stepStatus.OutputIDs = step.OutputIDs
+			}
+		}
+		status.Steps = append(status.Steps, stepStatus)
+	}
+	if event.pollsRemaining > 0 {
+		event.pollsRemaining--
+	} else if failed == 0 {
+		status.Status = "succeeded"
+	} else if failed == len(event.job.Steps) {
+		status.Status = "failed"
+	} else {
+		status.Status = "partial"
+	}
+
+	statusJSON, _ := json.Marshal(status)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_JobStatus = %s;\n</script></head><body></body></html>\n", statusJSON)
+}
+
+// serveProperties serves the properties page of an object. searchPath
+// must be in the form storeID("id").
+func (s *Server) serveProperties(w http.ResponseWriter, searchPath string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+
+	name, class := "", ""
+	packageInputs := ""
+	if folder := s.findFolder(id); folder != nil {
+		name, class = folder.Name, "folder"
+	} else if pkg := s.findPackage(id); pkg != nil {
+		name, class = pkg.Name, "package"
+	} else if report := s.findReport(id); report != nil {
+		name, class = report.Name, "report"
+		if report.Package != nil {
+			packageName := ""
+			if s.findPackage(report.Package.ID) != nil {
+				packageName = report.Package.Name
+			}
+			packageInputs = fmt.Sprintf(
+				"<input type=\"hidden\" name=\"m_package\" value=\"%s\">\n"+
+					"<input type=\"hidden\" name=\"m_packageName\" value=\"%s\">\n",
+				html.EscapeString(report.Package.SearchPath()), html.EscapeString(packageName))
+		}
+	} else {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+
+	fmt.Fprintf(w, "<html><body><form>\n"+
+		"<input type=\"hidden\" name=\"m_class\" value=\"%s\">\n"+
+		"<input type=\"hidden\" name=\"m_name\" value=\"%s\">\n"+
+		"%s</form></body></html>\n",
+		class, html.EscapeString(name), packageInputs)
+}
+
+// serveDirectory serves a page of the accounts in the namespace, starting
+// at start
+func (s *Server) serveDirectory(w http.ResponseWriter, start int) {
+	type account struct {
+		Name  string `json:"name"`
+		CAMID string `json:"camid"`
+	}
+	accounts := []account{}
+	for i := start; i < len(s.Accounts) && i < start+directoryPageSize; i++ {
+		accounts = append(accounts, account{Name: s.Accounts[i].Name, CAMID: s.Accounts[i].CAMID(s.Namespace)})
+	}
+	accountsJSON, _ := json.Marshal(accounts)
+
+	fmt.Fprintf(w, "<html><head><script>\n"+
+		"var g_PS_Accounts = %s;\n"+
+		"var g_PS_MoreAccounts = %t;\n"+
+		"</script></head><body>Directory</body></html>\n",
+		accountsJSON, start+directoryPageSize < len(s.Accounts))
+}
+
+// serveAccount serves the properties page of an account, which has its
+// My Folders root. camid must be in the form CAMID("namespace:u:name").
+func (s *Server) serveAccount(w http.ResponseWriter, camid string) {
+	for _, account := range s.Accounts {
+		if account.CAMID(s.Namespace) != camid {
+			continue
+		}
+		if account.Inaccessible {
+			fmt.Fprint(w, "<html><body><table><tr><td>"+
+				"CM-CAM-4005 You do not have permission to read this object."+
+				"</td></tr></table></body></html>\n")
+			return
+		}
+		myID := ""
+		if account.My != nil {
+			myID = account.My.ID
+		}
+		fmt.Fprintf(w, "<html><head><script>\n"+
+			"var g_PS_MFRootId = \"%s\";\n"+
+			"</script></head><body>Account properties</body></html>\n", myID)
+		return
+	}
+	s.serveMissingObject(w, camid)
+}
+
+// serveSchedules serves the schedules page of a report. searchPath must
+// be in the form storeID("id").
+func (s *Server) serveSchedules(w http.ResponseWriter, searchPath string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+	report := s.findReport(id)
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+
+	schedules := report.Schedules
+	if schedules == nil {
+		schedules = []Schedule{}
+	}
+	schedulesJSON, _ := json.Marshal(schedules)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_Schedules = %s;\n</script></head><body></body></html>\n", schedulesJSON)
+}
+
+// serveScheduleForm creates, updates, or deletes a schedule
+func (s *Server) serveScheduleForm(w http.ResponseWriter, form url.Values) {
+	// find the report and schedule being changed
+	var report *Report
+	index := -1
+	scheduleID := form.Get("m_schedule")
+	if form.Get("m_cmd") == "create" {
+		searchPath := form.Get("m_obj")
+		report = s.findReport(strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`))
+		if report == nil {
+			s.serveMissingObject(w, searchPath)
+			return
+		}
+		scheduleID = "s" + s.newID()
+	} else {
+		var search func(f *Folder)
+		search = func(f *Folder) {
+			for _, r := range f.Reports {
+				for i, schedule := range r.Schedules {
+					if schedule.ID == scheduleID {
+						report, index = r, i
+					}
+				}
+			}
+			for _, child := range f.Folders {
+				search(child)
+			}
+		}
+		search(s.Public)
+		search(s.My)
+		if report == nil {
+			s.serveMissingObject(w, scheduleID)
+			return
+		}
+	}
+
+	if form.Get("m_cmd") == "delete" {
+		report.Schedules = append(report.Schedules[:index], report.Schedules[index+1:]...)
+		fmt.Fprint(w, "<html><body>Deleted</body></html>\n")
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, form.Get("sch_start"))
+	if err != nil {
+		http.Error(w, "cognostest: bad start time", 400)
+		return
+	}
+	schedule := Schedule{
+		ID:          scheduleID,
+		Frequency:   "Every day at " + start.Format("15:04"),
+		NextRun:     start,
+		Owner:       s.DisplayName,
+		Enabled:     form.Get("sch_enabled") == "true",
+		Formats:     []string{form.Get("sch_format")},
+		Destination: form.Get("sch_delivery"),
+	}
+	if form.Get("sch_frequency") == "weekly" {
+		schedule.Frequency = "Every week on " + form.Get("sch_days") + " at " + start.Format("15:04")
+	}
+	if index < 0 {
+		report.Schedules = append(report.Schedules, schedule)
+	} else {
+		report.Schedules[index] = schedule
+	}
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_ScheduleID = %q;\n</script></head><body>Saved</body></html>\n", scheduleID)
+}
+
+// servePrompts serves the prompt information for a report. searchPath
+// must be in the form storeID("id").
+func (s *Server) servePrompts(w http.ResponseWriter, searchPath string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+	report := s.findReport(id)
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+
+	prompts := report.Prompts
+	if prompts == nil {
+		prompts = []Prompt{}
+	}
+	promptsJSON, _ := json.Marshal(prompts)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_Prompts = %s;\n</script></head><body></body></html>\n", promptsJSON)
+}
+
+// serveNewReportView makes a report view. The view has the same output as
+// the report, but it never prompts.
+func (s *Server) serveNewReportView(w http.ResponseWriter, form url.Values) {
+	searchPath := form.Get("m_obj")
+	source := s.findReport(strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`))
+	if source == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+	folder := s.findFolder(form.Get("m_folder"))
+	if folder == nil {
+		s.serveMissingObject(w, form.Get("m_folder"))
+		return
+	}
+
+	view := &Report{
+		Name:    form.Get("m_name"),
+		ID:      s.newID(),
+		CSV:     source.CSV,
+		CSVFor:  source.CSVFor,
+		Polls:   source.Polls,
+		Prompts: source.Prompts,
+		Params:  make(map[string]string),
+	}
+	for name := range form {
+		if strings.HasPrefix(name, "p_") {
+			view.Params[strings.TrimPrefix(name, "p_")] = strings.Join(form[name], "\n")
+		}
+	}
+	folder.Reports = append(folder.Reports, view)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_ObjectID = %q;\n</script></head><body>Saved</body></html>\n", view.ID)
+}
+
+// serveNewFolder makes a folder
+func (s *Server) serveNewFolder(w http.ResponseWriter, form url.Values) {
+	parent := s.findFolder(form.Get("m_folder"))
+	if parent == nil {
+		s.serveMissingObject(w, form.Get("m_folder"))
+		return
+	}
+	if parent.ReadOnly {
+		fmt.Fprint(w, "<html><body><table><tr><td>"+
+			"CM-CAM-4005 You do not have permission to update this object."+
+			"</td></tr></table></body></html>\n")
+		return
+	}
+
+	name := form.Get("m_name")
+	taken := false
+	for _, folder := range parent.Folders {
+		taken = taken || folder.Name == name
+	}
+	for _, report := range parent.Reports {
+		taken = taken || report.Name == name
+	}
+	for _, job := range parent.Jobs {
+		taken = taken || job.Name == name
+	}
+	for _, pkg := range parent.Packages {
+		taken = taken || pkg.Name == name
+	}
+	if taken {
+		fmt.Fprint(w, "<html><body><table><tr><td>"+
+			"CM-REQ-4024 An object named "+html.EscapeString(name)+" already exists."+
+			"</td></tr></table></body></html>\n")
+		return
+	}
+
+	folder := &Folder{Name: name, ID: s.newID(), server: s}
+	parent.Folders = append(parent.Folders, folder)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_ObjectID = %q;\n</script></head><body>Saved</body></html>\n", folder.ID)
+}
+
+// serveRunHistory serves the run history page of a report. searchPath
+// must be in the form storeID("id").
+func (s *Server) serveRunHistory(w http.ResponseWriter, searchPath string, limit string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+	report := s.findReport(id)
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+
+	history := report.History
+	if history == nil {
+		history = []RunRecord{}
+	}
+	if n, err := strconv.Atoi(limit); err == nil && n > 0 && n < len(history) {
+		history = history[:n]
+	}
+	historyJSON, _ := json.Marshal(history)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_RunHistory = %s;\n</script></head><body></body></html>\n", historyJSON)
+}
+
+// serveOutputVersions lists (or deletes one of) the saved outputs of a
+// report
+func (s *Server) serveOutputVersions(w http.ResponseWriter, form url.Values) {
+	searchPath := form.Get("m_obj")
+	report := s.findReport(strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`))
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+
+	if form.Get("m_cmd") == "delete" {
+		if report.ReadOnly {
+			fmt.Fprint(w, "<html><body><table><tr><td>"+
+				"CM-CAM-4005 You do not have permission to update this object."+
+				"</td></tr></table></body></html>\n")
+			return
+		}
+		for i, output := range report.SavedOutputs {
+			if output.ID == form.Get("m_version") {
+				report.SavedOutputs = append(report.SavedOutputs[:i:i], report.SavedOutputs[i+1:]...)
+				fmt.Fprint(w, "<html><head><script>\nvar g_PS_Deleted = true;\n</script></head><body>Deleted</body></html>\n")
+				return
+			}
+		}
+		s.serveMissingObject(w, form.Get("m_version"))
+		return
+	}
+
+	outputs := report.SavedOutputs
+	if outputs == nil {
+		outputs = []SavedOutput{}
+	}
+	outputsJSON, _ := json.Marshal(outputs)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_OutputVersions = %s;\n</script></head><body></body></html>\n", outputsJSON)
+}
+
+// serveSpec serves the specification of a report. searchPath must be in
+// the form storeID("id").
+func (s *Server) serveSpec(w http.ResponseWriter, searchPath string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+	report := s.findReport(id)
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+	if report.Spec == "" {
+		fmt.Fprint(w, "<html><body><table><tr><td>"+
+			"CM-REQ-4012 The report specification is unavailable."+
+			"</td></tr></table></body></html>\n")
+		return
+	}
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprint(w, report.Spec)
+}
+
+// serveMetadata serves the query metadata of a report. searchPath must
+// be in the form storeID("id").
+func (s *Server) serveMetadata(w http.ResponseWriter, searchPath string) {
+	id := strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`)
+	report := s.findReport(id)
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+	if report.Columns == nil {
+		fmt.Fprint(w, "<html><body><table><tr><td>"+
+			"RSV-ERR-0021 The metadata for this report is not available."+
+			"</td></tr></table></body></html>\n")
+		return
+	}
+
+	columnsJSON, _ := json.Marshal(report.Columns)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_Columns = %s;\n</script></head><body></body></html>\n", columnsJSON)
+}
+
+// serveReportOptions saves a report's default prompt values
+func (s *Server) serveReportOptions(w http.ResponseWriter, form url.Values) {
+	searchPath := form.Get("m_obj")
+	report := s.findReport(strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`))
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+	if report.ReadOnly {
+		fmt.Fprint(w, "<html><body><table><tr><td>"+
+			"CM-CAM-4005 You do not have permission to update this object."+
+			"</td></tr></table></body></html>\n")
+		return
+	}
+
+	if report.Params == nil {
+		report.Params = make(map[string]string)
+	}
+	for name := range form {
+		if strings.HasPrefix(name, "p_") {
+			report.Params[strings.TrimPrefix(name, "p_")] = strings.Join(form[name], "\n")
+		}
+	}
+	fmt.Fprint(w, "<html><head><script>\nvar g_PS_Saved = true;\n</script></head><body>Saved</body></html>\n")
+}
+
+// serveRunOptions serves the run options of a report
+func (s *Server) serveRunOptions(w http.ResponseWriter, searchPath string) {
+	report := s.findReport(strings.TrimSuffix(strings.TrimPrefix(searchPath, `storeID("`), `")`))
+	if report == nil {
+		s.serveMissingObject(w, searchPath)
+		return
+	}
+	options := RunOptions{}
+	if report.RunOptions != nil {
+		options = *report.RunOptions
+	}
+	optionsJSON, _ := json.Marshal(options)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_RunOptions = %s;\n</script></head><body>Run options</body></html>\n", optionsJSON)
+}
+
+// serveMissingObject serves the fault for an object that doesn't exist
+func (s *Server) serveMissingObject(w http.ResponseWriter, searchPath string) {
+	fmt.Fprint(w, "<html><body><table><tr><td>"+
+		"CM-REQ-4010 The object "+html.EscapeString(searchPath)+" was not found."+
+		"</td></tr></table></body></html>\n")
+}
+
+// runOptions are the run.* options a report was run with
+type runOptions struct {
+	runAs    string
+	burst    bool
+	rowLimit int
+	format   string
+	// params has the p_ prompt values (and everything else in the form)
+	params url.Values
+	// spanish makes the viewer pages Spanish (see Server.Language)
+	spanish bool
+}
+
+// promptsAnswered returns true if params has a value for every required
+// prompt of a report that has prompts
+func promptsAnswered(report *Report, params url.Values) bool {
+	if len(report.Prompts) == 0 {
+		return false
+	}
+	for _, prompt := range report.Prompts {
+		if prompt.Required && params.Get("p_"+prompt.Name) == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// serveRun starts a report conversation
+func (s *Server) serveRun(w http.ResponseWriter, id string, opts runOptions) {
+	report := s.findReport(id)
+	if report == nil {
+		http.Error(w, "cognostest: no such report", 404)
+		return
+	}
+	if opts.runAs != "" && !s.AllowRunAs {
+		fmt.Fprint(w, "<html><body><table><tr><td>"+
+			"CAM-AAA-0134 You do not have the capability to run reports as another user."+
+			"</td></tr></table></body></html>\n")
+		return
+	}
+
+	conversationID := "c" + s.newID()
+	s.conversations[conversationID] = &conversation{
+		report:         report,
+		pollsRemaining: report.Polls,
+		runAs:          opts.runAs,
+		burst:          opts.burst && report.Bursts != nil,
+		rowLimit:       opts.rowLimit,
+		format:         opts.format,
+		answered:       promptsAnswered(report, opts.params),
+		started:        time.Now(),
+	}
+	s.serveConversation(w, conversationID, "working", opts.spanish)
+}
+
+// serveWait serves a poll of a report conversation
+func (s *Server) serveWait(w http.ResponseWriter, conversationID string, spanish bool) {
+	if _, exists := s.conversations[conversationID]; !exists {
+		s.serveConversationGone(w, conversationID)
+		return
+	}
+	s.serveConversation(w, conversationID, "stillWorking", spanish)
+}
+
+// serveCancel cancels a report conversation
+func (s *Server) serveCancel(w http.ResponseWriter, conversationID string) {
+	if _, exists := s.conversations[conversationID]; !exists {
+		s.serveConversationGone(w, conversationID)
+		return
+	}
+	delete(s.conversations, conversationID)
+	fmt.Fprint(w, "<html><body><script>\n"+`var oCV = {"m_sStatus": "cancelled"};`+"\n</script></body></html>\n")
+}
+
+// serveActivities lists every conversation the server knows about. The
+// fake server only has one session, so they are all ours.
+func (s *Server) serveActivities(w http.ResponseWriter) {
+	type activity struct {
+		ID         string    `json:"id"`
+		ReportID   string    `json:"reportId"`
+		ReportName string    `json:"reportName"`
+		State      string    `json:"state"`
+		Started    time.Time `json:"started"`
+	}
+	activities := []activity{}
+	for id, conv := range s.conversations {
+		state := "finished"
+		if conv.pollsRemaining > 0 {
+			state = "working"
+		}
+		activities = append(activities, activity{
+			ID:         id,
+			ReportID:   conv.report.ID,
+			ReportName: conv.report.Name,
+			State:      state,
+			Started:    conv.started,
+		})
+	}
+	sort.Slice(activities, func(i, j int) bool {
+		return activities[i].ID < activities[j].ID
+	})
+	activitiesJSON, _ := json.Marshal(activities)
+	fmt.Fprintf(w, "<html><head><script>\nvar g_PS_Conversations = %s;\n</script></head><body></body></html>\n", activitiesJSON)
+}
+
+// serveConversationGone serves the fault page for a conversation that
+// doesn't exist
+func (s *Server) serveConversationGone(w http.ResponseWriter, conversationID string) {
+	fmt.Fprint(w, "<html><body><table><tr><td>"+
+		"RSV-SRV-0040 The conversation "+html.EscapeString(conversationID)+
+		" does not exist or has expired."+
+		"</td></tr></table></body></html>\n")
+}
+
+// serveConversation serves the viewer page for a conversation. If the report
+// is not done yet, the page has status (working or stillWorking) so the
+// client polls again.
+func (s *Server) serveConversation(w http.ResponseWriter, conversationID string, status string, spanish bool) {
+	conv := s.conversations[conversationID]
+	report := conv.report
+
+	if spanish {
+		// only the pages that say something in words are diffrent
+		switch {
+		case report.Prompting && !conv.answered, report.Broken:
+		case report.NoData && conv.pollsRemaining == 0:
+			fmt.Fprint(w, spanishNoDataPage)
+			return
+		case conv.pollsRemaining > 0:
+			conv.pollsRemaining--
+			writeSpanishWorking(w, status, conversationID, report.ID)
+			return
+		}
+	}
+
+	// the stillWorking page has the whole thing HTML-encoded
+	workingMarker := `"m_sStatus": "working"`
+	if status == "stillWorking" {
+		workingMarker = `&quot;m_sStatus&quot;: &quot;stillWorking&quot;`
+	}
+
+	fmt.Fprint(w, "<html><body><script>\n")
+	switch {
+	case report.Prompting && !conv.answered:
+		fmt.Fprint(w, `var oCV = {"m_sStatus": "prompting"};`+"\n")
+	case report.Broken:
+		fmt.Fprint(w, "this is not the page you are looking for\n")
+	case report.NoData && conv.pollsRemaining == 0:
+		fmt.Fprint(w, "</script><span class=\"textItem\">No Data Available</span><script>\n")
+	case conv.pollsRemaining > 0:
+		conv.pollsRemaining--
+		fmt.Fprintf(w, "var oCV = {%s, "+
+			`"b_action": "cognosViewer", `+
+			`"m_sActionState": "state-%[2]s", `+
+			`"cv.id": "_NS_", `+
+			`"cv.objectPermissions": "read execute traverse", `+
+			`"m_sParameters": "", `+
+			`"m_sTracking": "tracking-%[2]s", `+
+			`"m_sCAFContext": "caf-%[2]s", `+
+			`"m_sConversation": "%[2]s", `+
+			`"ui.object": "%[3]s", `+
+			`"ui.objectClass": "report", `+
+			`"ui.primaryAction": "run"};`+"\n",
+			workingMarker, conversationID, report.ID)
+	default:
+		if conv.burst {
+			var outputs []map[string]string
+			for key := range report.Bursts {
+				outputs = append(outputs, map[string]string{
+					"key": key,
+					"url": outputPath + conversationID + "/" + url.PathEscape(key),
+				})
+			}
+			outputsJSON, _ := json.Marshal(outputs)
+			fmt.Fprintf(w, "var g_PS_BurstOutputs = %s;\n", outputsJSON)
+			break
+		}
+		fmt.Fprintf(w, "var sURL = '%s';\n", outputPath+conversationID)
+	}
+	fmt.Fprint(w, "</script></body></html>\n")
+}
+
+// serveOutput serves the output (usually a CSV) for a finished conversation
+func (s *Server) serveOutput(w http.ResponseWriter, r *http.Request, conversationID string) {
+	// burst outputs are at <conversation>/<key>
+	conversationID, burstKey, isBurst := strings.Cut(conversationID, "/")
+	conv, exists := s.conversations[conversationID]
+	if !exists || conv.pollsRemaining > 0 {
+		http.Error(w, "cognostest: no such output", 404)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	if isBurst {
+		key, _ := url.PathUnescape(burstKey)
+		csv, found := conv.report.Bursts[key]
+		if !found {
+			http.Error(w, "cognostest: no such output", 404)
+			return
+		}
+		fmt.Fprint(w, csv)
+		return
+	}
+	if conv.format != "" && conv.format != "CSV" {
+		output, found := conv.report.Outputs[conv.format]
+		if !found {
+			http.Error(w, "cognostest: no such output", 404)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, output)
+		return
+	}
+	csv := conv.report.CSV
+	if csvFor, found := conv.report.CSVFor[conv.runAs]; found && conv.runAs != "" {
+		csv = csvFor
+	}
+	if conv.rowLimit > 0 && !conv.report.IgnoreRowLimit {
+		// the header plus rowLimit rows. This dosen't handle newlines in
+		// quotes, so don't use those with row limits.
+		lines := strings.SplitAfter(csv, "\n")
+		if len(lines) > conv.rowLimit+1 {
+			csv = strings.Join(lines[:conv.rowLimit+1], "")
+		}
+	}
+	status := 200
+	if conv.report.AcceptRanges {
+		sum := sha256.Sum256([]byte(csv))
+		etag := fmt.Sprintf(`"%x"`, sum[:8])
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", etag)
+		ifRange := r.Header.Get("If-Range")
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && (ifRange == "" || ifRange == etag) {
+			var start int
+			if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-", &start); err != nil || start < 0 || start >= len(csv) {
+				http.Error(w, "cognostest: bad range", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(csv)-1, len(csv)))
+			status = http.StatusPartialContent
+			csv = csv[start:]
+		}
+	}
+	if conv.report.ShortDownloads > 0 {
+		conv.report.ShortDownloads--
+		// net/http closes the connection when we send less than this
+		w.Header().Set("Content-Length", strconv.Itoa(len(csv)))
+		csv = csv[:len(csv)/2]
+	}
+	w.WriteHeader(status)
+	fmt.Fprint(w, csv)
+}
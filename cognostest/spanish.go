@@ -0,0 +1,70 @@
+package cognostest
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// viewerLanguage returns the language (ex: en or es) the report viewer
+// answers a request in. The first language in Accept-Language wins, and
+// without one it is the server's Language.
+func (s *Server) viewerLanguage(r *http.Request) string {
+	language := r.Header.Get("Accept-Language")
+	if language == "" {
+		language = s.Language
+	}
+	if language == "" {
+		return "en"
+	}
+	language, _, _ = strings.Cut(language, ",")
+	language, _, _ = strings.Cut(language, ";")
+	language, _, _ = strings.Cut(language, "-")
+	return strings.ToLower(strings.TrimSpace(language))
+}
+
+// The Spanish pages are laid out like the ones captured from a gateway
+// that defaults sessions to Spanish (with our IDs in them). The JSON has
+// no spaces in it, the stillWorking state is in an HTML-encoded hidden
+// field, and everything meant for people is in Spanish.
+
+// spanishWorkingPage is the working page. The arguments are the status,
+// the conversation ID, and the report ID.
+const spanishWorkingPage = `<html lang="es"><head><title>IBM Cognos Viewer - En ejecución</title></head><body>
+<script>
+var oCV={"m_sStatus":"%[1]s","b_action":"cognosViewer","m_sActionState":"state-%[2]s","cv.id":"_NS_","cv.objectPermissions":"read execute traverse","m_sParameters":"","m_sTracking":"tracking-%[2]s","m_sCAFContext":"caf-%[2]s","m_sConversation":"%[2]s","ui.object":"%[3]s","ui.objectClass":"report","ui.primaryAction":"run"};
+</script>
+<div class="statusText">Su informe se está ejecutando. Espere...</div>
+</body></html>
+`
+
+// spanishStillWorkingPage is the page for a poll of a report that isn't
+// done yet. The argument is the HTML-encoded state.
+const spanishStillWorkingPage = `<html lang="es"><head><title>IBM Cognos Viewer - En ejecución</title></head><body>
+<form name="formWarpRequest"><input type="hidden" name="cv.state" value="%s"></form>
+<div class="statusText">Su informe todavía se está ejecutando. Espere...</div>
+</body></html>
+`
+
+// spanishNoDataPage is what a report that didn't find anything shows
+const spanishNoDataPage = `<html lang="es"><body>
+<span class="textItem">No hay datos disponibles</span>
+</body></html>
+`
+
+// attributeEscaper HTML-encodes an attribute value the way the viewer does
+var attributeEscaper = strings.NewReplacer(`&`, "&amp;", `"`, "&quot;", `<`, "&lt;", `>`, "&gt;")
+
+// writeSpanishWorking writes the Spanish page for a report that is not
+// done yet. status is working or stillWorking.
+func writeSpanishWorking(w io.Writer, status string, conversationID string, reportID string) {
+	page := fmt.Sprintf(spanishWorkingPage, status, conversationID, reportID)
+	if status != "stillWorking" {
+		fmt.Fprint(w, page)
+		return
+	}
+	start := strings.Index(page, "{")
+	end := strings.LastIndex(page, "}") + 1
+	fmt.Fprintf(w, spanishStillWorkingPage, attributeEscaper.Replace(page[start:end]))
+}
@@ -0,0 +1,268 @@
+package cognos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Config holds everything needed to make a CognosInstance. The fields
+// match the parameters of MakeInstance. It can be loaded from a JSON or
+// TOML file, from environment variables, or both. RetryDelay, HTTPTimeout,
+// and ConcurrentRequests get the same defaults as NewInstance (5 seconds,
+// 300 seconds, and 4) if they are left out, but setting HTTPTimeout or
+// ConcurrentRequests to 0 is an error.
+type Config struct {
+	User               string `json:"user" toml:"user"`
+	Domain             string `json:"domain" toml:"domain"`
+	Pass               string `json:"pass" toml:"pass"`
+	URL                string `json:"url" toml:"url"`
+	Namespace          string `json:"namespace" toml:"namespace"`
+	DSN                string `json:"dsn" toml:"dsn"`
+	RetryDelay         uint   `json:"retry_delay" toml:"retry_delay"`
+	RetryCount         int    `json:"retry_count" toml:"retry_count"`
+	HTTPTimeout        uint   `json:"http_timeout" toml:"http_timeout"`
+	ConcurrentRequests uint   `json:"concurrent_requests" toml:"concurrent_requests"`
+	PollInterval       uint   `json:"poll_interval" toml:"poll_interval"`
+	OperationTimeout   uint   `json:"operation_timeout" toml:"operation_timeout"`
+	// DefaultOutputFormat is CognosInstance.DefaultOutputFormat
+	DefaultOutputFormat string `json:"default_output_format" toml:"default_output_format"`
+	// these are TransportOptions
+	MaxIdleConnsPerHost int  `json:"max_idle_conns_per_host" toml:"max_idle_conns_per_host"`
+	IdleConnTimeout     uint `json:"idle_conn_timeout" toml:"idle_conn_timeout"`
+	HTTP2               bool `json:"http2" toml:"http2"`
+
+	// explicit has the names (ex: http_timeout) of the fields that were
+	// set by the JSON, TOML, or environment variables we loaded, so we can
+	// tell a 0 that was left out from one that was asked for
+	explicit map[string]bool
+}
+
+// UnmarshalJSON decodes a config like encoding/json would, and remembers
+// which fields were there
+func (cfg *Config) UnmarshalJSON(data []byte) error {
+	type plainConfig Config
+	err := json.Unmarshal(data, (*plainConfig)(cfg))
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	for name := range fields {
+		cfg.setExplicit(strings.ToLower(name))
+	}
+	return nil
+}
+
+// setExplicit remembers that the field with the given name was set
+func (cfg *Config) setExplicit(name string) {
+	if cfg.explicit == nil {
+		cfg.explicit = make(map[string]bool)
+	}
+	cfg.explicit[name] = true
+}
+
+// withDefaults returns cfg with the defaults filled in for anything that
+// was left out
+func (cfg Config) withDefaults() Config {
+	if cfg.RetryDelay == 0 && !cfg.explicit["retry_delay"] {
+		cfg.RetryDelay = defaultRetryDelay
+	}
+	if cfg.HTTPTimeout == 0 {
+		cfg.HTTPTimeout = uint(defaultHTTPTimeout / time.Second)
+	}
+	if cfg.ConcurrentRequests == 0 {
+		cfg.ConcurrentRequests = defaultConcurrentRequests
+	}
+	return cfg
+}
+
+// Validate returns an error describing every problem with the config,
+// or nil if there aren't any
+func (cfg Config) Validate() error {
+	var problems []string
+	required := []struct {
+		name  string
+		value string
+	}{
+		{"user", cfg.User},
+		{"pass", cfg.Pass},
+		{"url", cfg.URL},
+		{"namespace", cfg.Namespace},
+		{"dsn", cfg.DSN},
+	}
+	for _, field := range required {
+		if field.value == "" {
+			problems = append(problems, field.name+" is required")
+		}
+	}
+	if cfg.URL != "" {
+		parsedURL, err := url.Parse(cfg.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			problems = append(problems, "url must be a full http or https URL (ex: https://adecognos.arkansas.gov)")
+		}
+	}
+	if cfg.RetryCount < -1 {
+		problems = append(problems, "retry_count must be -1 (retry forever) or more")
+	}
+	if cfg.MaxIdleConnsPerHost < 0 {
+		problems = append(problems, "max_idle_conns_per_host can't be negative")
+	}
+	if cfg.DefaultOutputFormat != "" && !scheduleFormats[strings.ToUpper(cfg.DefaultOutputFormat)] {
+		problems = append(problems, "unsupported default_output_format "+cfg.DefaultOutputFormat)
+	}
+	// 0 is only a problem if it was asked for. Otherwise it is the default.
+	if cfg.ConcurrentRequests == 0 && cfg.explicit["concurrent_requests"] {
+		problems = append(problems, "concurrent_requests must be at least 1")
+	}
+	if cfg.HTTPTimeout == 0 && cfg.explicit["http_timeout"] {
+		problems = append(problems, "http_timeout must be at least 1")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid Cognos config: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// MakeInstance makes a CognosInstance from the config. It panics if the
+// config is invalid, so call Validate first if you haven't already.
+func (cfg Config) MakeInstance() *CognosInstance {
+	if err := cfg.Validate(); err != nil {
+		panic(err)
+	}
+	cfg = cfg.withDefaults()
+
+	c := MakeInstance(
+		cfg.User, cfg.Pass, cfg.URL, cfg.Namespace, cfg.DSN,
+		cfg.RetryDelay,
+		cfg.RetryCount,
+		cfg.HTTPTimeout,
+		cfg.ConcurrentRequests,
+	)
+	c.PollInterval = cfg.PollInterval
+	c.OperationTimeout = cfg.OperationTimeout
+	c.DefaultOutputFormat = cfg.DefaultOutputFormat
+	transportOpts := TransportOptions{
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+		HTTP2:               cfg.HTTP2,
+	}
+	if transportOpts != (TransportOptions{}) {
+		c.SetTransportOptions(transportOpts)
+	}
+	if cfg.Domain != "" {
+		c.Domain = cfg.Domain
+	}
+	return c
+}
+
+// NewFromConfig makes a CognosInstance from cfg, or returns the error from
+// Validate if there is something wrong with it. A Config can be decoded
+// straight from JSON (see ConfigFromFile).
+func NewFromConfig(cfg Config) (*CognosInstance, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg.MakeInstance(), nil
+}
+
+// applyEnv overwrites config values with any COGNOS_* environment
+// variables that are set
+func (cfg *Config) applyEnv() error {
+	stringFields := map[string]*string{
+		"COGNOS_USER":      &cfg.User,
+		"COGNOS_DOMAIN":    &cfg.Domain,
+		"COGNOS_PASS":      &cfg.Pass,
+		"COGNOS_URL":       &cfg.URL,
+		"COGNOS_NAMESPACE": &cfg.Namespace,
+		"COGNOS_DSN":       &cfg.DSN,
+	}
+	for name, field := range stringFields {
+		if value, set := os.LookupEnv(name); set {
+			*field = value
+		}
+	}
+
+	uintFields := map[string]*uint{
+		"COGNOS_RETRY_DELAY":         &cfg.RetryDelay,
+		"COGNOS_HTTP_TIMEOUT":        &cfg.HTTPTimeout,
+		"COGNOS_CONCURRENT_REQUESTS": &cfg.ConcurrentRequests,
+		"COGNOS_POLL_INTERVAL":       &cfg.PollInterval,
+		"COGNOS_OPERATION_TIMEOUT":   &cfg.OperationTimeout,
+	}
+	for name, field := range uintFields {
+		if value, set := os.LookupEnv(name); set {
+			n, err := strconv.ParseUint(value, 10, 0)
+			if err != nil {
+				return fmt.Errorf("%s must be a positive whole number: %w", name, err)
+			}
+			*field = uint(n)
+			cfg.setExplicit(strings.ToLower(strings.TrimPrefix(name, "COGNOS_")))
+		}
+	}
+
+	if value, set := os.LookupEnv("COGNOS_RETRY_COUNT"); set {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("COGNOS_RETRY_COUNT must be a whole number: %w", err)
+		}
+		cfg.RetryCount = n
+	}
+
+	return nil
+}
+
+// ConfigFromEnv loads a config from the environment variables COGNOS_USER,
+// COGNOS_PASS, COGNOS_URL, COGNOS_NAMESPACE, COGNOS_DSN, COGNOS_RETRY_DELAY,
+// COGNOS_RETRY_COUNT, COGNOS_HTTP_TIMEOUT, COGNOS_CONCURRENT_REQUESTS,
+// COGNOS_POLL_INTERVAL, and COGNOS_OPERATION_TIMEOUT. The config is validated before it is returned.
+func ConfigFromEnv() (cfg Config, err error) {
+	err = cfg.applyEnv()
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
+
+// ConfigFromFile loads a config from a JSON file, or a TOML file if the
+// name ends in .toml. Field names are the snake_case versions of the Config
+// fields (ex: retry_delay). Environment variables (see ConfigFromEnv) are
+// then applied on top, so they win over the file. The config is validated
+// before it is returned.
+func ConfigFromFile(path string) (cfg Config, err error) {
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		var meta toml.MetaData
+		meta, err = toml.DecodeFile(path, &cfg)
+		for _, key := range meta.Keys() {
+			cfg.setExplicit(key.String())
+		}
+	} else {
+		var configJSON []byte
+		configJSON, err = ioutil.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(configJSON, &cfg)
+		}
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("unable to load Cognos config from %s: %w", path, err)
+	}
+
+	err = cfg.applyEnv()
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.Validate()
+}
@@ -0,0 +1,206 @@
+package cognos
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearConfigEnv unsets every COGNOS_* environment variable for the rest
+// of the test
+func clearConfigEnv(t *testing.T) {
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, "COGNOS_") {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// writeConfig writes a config file named name and returns its path
+func writeConfig(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testConfigJSON = `{
+	"user": "APSCN\\0401jpenn",
+	"pass": "hunter2",
+	"url": "https://adecognos.arkansas.gov",
+	"namespace": "esp",
+	"dsn": "bentonvisms",
+	"retry_count": 3,
+	"http_timeout": 60,
+	"concurrent_requests": 2
+}`
+
+func TestConfigFromFile(t *testing.T) {
+	clearConfigEnv(t)
+	jsonPath := writeConfig(t, "cognos.json", testConfigJSON)
+	tomlPath := writeConfig(t, "cognos.toml", `
+user = 'APSCN\0401jpenn'
+pass = "hunter2"
+url = "https://adecognos.arkansas.gov"
+namespace = "esp"
+dsn = "bentonvisms"
+retry_count = 3
+http_timeout = 60
+concurrent_requests = 2
+`)
+
+	for _, path := range []string{jsonPath, tomlPath} {
+		cfg, err := ConfigFromFile(path)
+		if err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+		if cfg.User != `APSCN\0401jpenn` || cfg.DSN != "bentonvisms" || cfg.RetryCount != 3 || cfg.HTTPTimeout != 60 {
+			t.Errorf("%s: got %+v", filepath.Base(path), cfg)
+		}
+	}
+}
+
+func TestConfigEnvOverridesFile(t *testing.T) {
+	clearConfigEnv(t)
+	path := writeConfig(t, "cognos.json", testConfigJSON)
+	t.Setenv("COGNOS_DSN", "bentonvifms")
+	t.Setenv("COGNOS_RETRY_COUNT", "-1")
+
+	cfg, err := ConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DSN != "bentonvifms" || cfg.RetryCount != -1 {
+		t.Errorf("the environment didn't win: %+v", cfg)
+	}
+	if cfg.Namespace != "esp" {
+		t.Errorf("the file's namespace was lost: %+v", cfg)
+	}
+}
+
+func TestConfigMissingFields(t *testing.T) {
+	clearConfigEnv(t)
+	t.Setenv("COGNOS_USER", `APSCN\0401jpenn`)
+	t.Setenv("COGNOS_URL", "https://adecognos.arkansas.gov")
+
+	_, err := ConfigFromEnv()
+	if err == nil {
+		t.Fatal("a config without a password, namespace, or DSN was accepted")
+	}
+	for _, field := range []string{"pass", "namespace", "dsn"} {
+		if !strings.Contains(err.Error(), field+" is required") {
+			t.Errorf("%q dosen't mention %s", err, field)
+		}
+	}
+	if strings.Contains(err.Error(), "user is required") {
+		t.Errorf("%q complains about the user, which was set", err)
+	}
+}
+
+func TestConfigMalformed(t *testing.T) {
+	clearConfigEnv(t)
+	tests := map[string]string{
+		"broken.json": `{"user": "APSCN\\0401jpenn", "pass": `,
+		"broken.toml": "user = APSCN\\0401jpenn\n",
+		"wrong.json":  `{"retry_count": "three"}`,
+	}
+	for name, contents := range tests {
+		_, err := ConfigFromFile(writeConfig(t, name, contents))
+		if err == nil || !strings.Contains(err.Error(), "unable to load Cognos config") {
+			t.Errorf("%s: got %v, want a load error", name, err)
+		}
+	}
+
+	t.Setenv("COGNOS_RETRY_DELAY", "soon")
+	if _, err := ConfigFromFile(writeConfig(t, "cognos.json", testConfigJSON)); err == nil || !strings.Contains(err.Error(), "COGNOS_RETRY_DELAY") {
+		t.Errorf("a bad COGNOS_RETRY_DELAY gave %v", err)
+	}
+}
+
+// requiredJSON and requiredTOML are configs with only the fields that
+// don't have a default
+const (
+	requiredJSON = `"user": "APSCN\\0401jpenn", "pass": "hunter2", "url": "https://adecognos.arkansas.gov", "namespace": "esp", "dsn": "bentonvisms"`
+	requiredTOML = `
+user = 'APSCN\0401jpenn'
+pass = "hunter2"
+url = "https://adecognos.arkansas.gov"
+namespace = "esp"
+dsn = "bentonvisms"
+`
+)
+
+func TestConfigDefaults(t *testing.T) {
+	srv, _ := newTestInstance(t)
+	cfg := Config{User: srv.User, Pass: srv.Pass, URL: srv.URL, Namespace: srv.Namespace, DSN: srv.DSN}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same as NewInstance
+	if c.RetryDelay != 5 || c.client.Timeout != 300*time.Second || c.concurrentRequests != 4 {
+		t.Errorf("got a %ds retry delay, %v timeout, and %d slots", c.RetryDelay, c.client.Timeout, c.concurrentRequests)
+	}
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Error(err)
+	}
+
+	// and a config file that leaves them out gets them too
+	clearConfigEnv(t)
+	cfg, err = ConfigFromFile(writeConfig(t, "cognos.toml", requiredTOML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = cfg.MakeInstance()
+	if c.RetryDelay != 5 || c.client.Timeout != 300*time.Second || c.concurrentRequests != 4 {
+		t.Errorf("from a file got a %ds retry delay, %v timeout, and %d slots", c.RetryDelay, c.client.Timeout, c.concurrentRequests)
+	}
+}
+
+func TestConfigExplicitZero(t *testing.T) {
+	clearConfigEnv(t)
+
+	for _, field := range []string{"http_timeout", "concurrent_requests"} {
+		// decoded straight from JSON
+		var cfg Config
+		if err := json.Unmarshal([]byte(`{`+requiredJSON+`, "`+field+`": 0}`), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), field+" must be at least 1") {
+			t.Errorf("%s: 0 in JSON got %v", field, err)
+		}
+
+		// from a TOML file
+		if _, err := ConfigFromFile(writeConfig(t, "cognos.toml", requiredTOML+field+" = 0\n")); err == nil || !strings.Contains(err.Error(), field+" must be at least 1") {
+			t.Errorf("%s: 0 in TOML got %v", field, err)
+		}
+
+		// from the environment
+		t.Setenv("COGNOS_"+strings.ToUpper(field), "0")
+		if _, err := ConfigFromFile(writeConfig(t, "cognos.json", `{`+requiredJSON+`}`)); err == nil || !strings.Contains(err.Error(), field+" must be at least 1") {
+			t.Errorf("%s: 0 in the environment got %v", field, err)
+		}
+		os.Unsetenv("COGNOS_" + strings.ToUpper(field))
+	}
+
+	// a retry delay of 0 is fine, and isn't replaced with the default
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{`+requiredJSON+`, "retry_delay": 0}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c := cfg.MakeInstance(); c.RetryDelay != 0 {
+		t.Errorf("got a %ds retry delay", c.RetryDelay)
+	}
+}
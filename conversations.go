@@ -0,0 +1,90 @@
+package cognos
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Conversation is a report run our session has going on the server (see
+// ListConversations)
+type Conversation struct {
+	// ID is the same as RunState.Conversation
+	ID         string `json:"id"`
+	ReportID   string `json:"reportId"`
+	ReportName string `json:"reportName"`
+	// State is "working" if the report is still running, or "finished" if
+	// it is done but the output hasn't been released yet
+	State   string    `json:"state"`
+	Started time.Time `json:"started"`
+}
+
+// activitiesLink is the page that lists our session's report runs
+func activitiesLink() string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=portal/activities.xts"
+}
+
+// ListConversations returns the report runs (interactive and background)
+// our session still has on the server. After a crash, the ones left over
+// from last time can be cleaned up with ReleaseConversation.
+func (c *CognosInstance) ListConversations() []Conversation {
+	page := c.Request("GET", activitiesLink(), "")
+
+	conversations := []Conversation{}
+	if !findJSVar(page, "g_PS_Conversations", &conversations) {
+		if fault, found := parseFault(page); found {
+			panic(fmt.Errorf("Cognos returned an error when listing conversations: %w", fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when listing conversations"))
+	}
+	return conversations
+}
+
+// cancelData returns the post data that tells the viewer to cancel a
+// conversation and release anything it is holding on to
+func cancelData(conversation string) string {
+	valuesToSend := make(url.Values)
+	valuesToSend.Set("b_action", "cognosViewer")
+	valuesToSend.Set("cv.catchLogOnFault", "true")
+	valuesToSend.Set("cv.responseFormat", "data")
+	valuesToSend.Set("cv.showFaultPage", "true")
+	valuesToSend.Set("ui.action", "cancel")
+	valuesToSend.Set("ui.conversation", conversation)
+	return valuesToSend.Encode()
+}
+
+// ReleaseConversation cancels the report run with the given conversation
+// ID if it is still running, and frees up the server resources it is
+// using. If the server has already forgotten about it (ex: it finished and
+// expired) this does nothing.
+func (c *CognosInstance) ReleaseConversation(id string) {
+	c.releaseConversation(context.Background(), id)
+}
+
+func (c *CognosInstance) releaseConversation(ctx context.Context, id string) {
+	// releasing something twice is fine, so this can be retried
+	ctx = withIdempotent(ctx, true)
+	headers := c.viewerHeaders()
+	headers.Set("Content-Type", formContentType)
+	page := c.requestContext(ctx, "POST", "/ibmcognos/cgi-bin/cognos.cgi", cancelData(id), headers)
+
+	if fault, found := parseFault(page); found {
+		if isConversationGone(fault) {
+			return
+		}
+		panic(fmt.Errorf("Cognos returned an error when releasing conversation %s: %w", id, fault))
+	}
+}
+
+// Cancel stops the report on the server. Calling Wait after this will
+// panic with ErrConversationGone.
+func (r *ReportRun) Cancel() {
+	if r.State.Conversation == "" {
+		// it finished (or failed) right away, so there is nothing to cancel
+		return
+	}
+	r.c.ReleaseConversation(r.State.Conversation)
+}
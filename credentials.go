@@ -0,0 +1,230 @@
+package cognos
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+
+	"github.com/Azure/go-ntlmssp"
+	"golang.org/x/net/publicsuffix"
+)
+
+// credentials are what SetCredentials (or a CredentialProvider) changed
+// the User, Domain, and Pass to. It is shared between an instance and any
+// instances derived from it.
+type credentials struct {
+	lock sync.RWMutex
+	// set is false until SetCredentials is called or the provider gives
+	// us credentials. Until then the fields on the instance are used.
+	set    bool
+	user   string
+	domain string
+	pass   string
+	// oldPasses are scrubbed from messages too, since a request that
+	// started before the change can still fail with the old one
+	oldPasses []string
+	// generation goes up each time the credentials change
+	generation uint64
+
+	// provider is where we get credentials from, if it isn't nil (see
+	// WithCredentialProvider). It never changes.
+	provider CredentialProvider
+	// stale is set when the server rejects the credentials we got from
+	// the provider, so we ask it again
+	stale bool
+	// fetching makes sure only one goroutine asks the provider at a time
+	fetching sync.Mutex
+}
+
+// login returns who we log in as right now
+func (c *CognosInstance) login() (user, domain, pass string) {
+	if c.creds == nil {
+		// not made with MakeInstance
+		return c.User, c.Domain, c.Pass
+	}
+	c.creds.lock.RLock()
+	defer c.creds.lock.RUnlock()
+	if c.creds.set {
+		return c.creds.user, c.creds.domain, c.creds.pass
+	}
+	return c.User, c.Domain, c.Pass
+}
+
+// passwords returns the current password and any old ones, for scrub
+func (c *CognosInstance) passwords() []string {
+	if c.creds == nil {
+		return []string{c.Pass}
+	}
+	c.creds.lock.RLock()
+	defer c.creds.lock.RUnlock()
+	passes := append([]string{c.Pass}, c.creds.oldPasses...)
+	if c.creds.set {
+		passes = append(passes, c.creds.pass)
+	}
+	return passes
+}
+
+// credentialGeneration is used to tell if the credentials changed while a
+// request was going (see settleCredentials)
+func (c *CognosInstance) credentialGeneration() uint64 {
+	c.creds.lock.RLock()
+	defer c.creds.lock.RUnlock()
+	return c.creds.generation
+}
+
+// SetCredentials changes who we log in as, for this instance and every
+// instance derived from it (ex: with WithDSN, but not WithUser), without losing caches,
+// request slots, and everything else that goes with the instance. user
+// is like the user passed to MakeInstance. If it dosen't have a domain in
+// front, the domain stays the same.
+//
+// Our session cookies are thrown away and idle connections (which NTLM
+// has already logged in on) are closed, so the next request logs in
+// again. Requests that are already going finish with the old session.
+// If the new password is wrong, the next request fails with a 401 like
+// any other bad password (see RetryCount). The User and Pass fields are
+// not changed. Use Username to see who we log in as now.
+func (c *CognosInstance) SetCredentials(user, pass string) {
+	c.setLogin(user, pass)
+}
+
+// WithUser returns a copy of c that logs in as a diffrent user (ex: to
+// get to that user's My Folders as them). user is like the user passed to
+// MakeInstance, and if it dosen't have a domain in front, c's domain is
+// used. This is much cheaper than another MakeInstance, and the copy
+// counts against the same concurrentRequests as c, so making one per user
+// dosen't multiply the load on the server.
+//
+// Shared with c: request slots (and priority), a Pool's budget, retry and
+// timeout settings, the circuit breaker, hooks, stats, the server
+// version, the transport settings, and the CacheDir setting. The cache
+// directory can be shared, but each user only gets their own outputs from
+// it, since a report can return diffrent rows for diffrent users.
+//
+// Not shared: credentials (SetCredentials on one dosen't change the
+// other), cookies, the dispatcher passport, connections, folder roots (so
+// ~ is the new user's My Folders), cached paths and listings, cached
+// report outputs, and report runs (identical runs are only shared between
+// instances logged in as the same user). The copy is closed when c is,
+// but it can also be closed (and log out) by itself. Closing it when you
+// are done with it lets it be forgotten before c is closed.
+func (c *CognosInstance) WithUser(user, pass string) *CognosInstance {
+	currentUser, currentDomain, _ := c.login()
+	if currentDomain == "" {
+		currentDomain, _ = splitUser(currentUser)
+	}
+	domain, name := splitUser(user)
+	if domain == "" {
+		domain = currentDomain
+	}
+	return c.withOwnSession(&credentials{
+		set:    true,
+		user:   name,
+		domain: domain,
+		pass:   pass,
+	})
+}
+
+// setLogin does the work for SetCredentials. If user and pass are what we
+// already log in with, nothing is thrown away.
+func (c *CognosInstance) setLogin(user, pass string) {
+	currentUser, currentDomain, currentPass := c.login()
+	userDomain, currentName := splitUser(currentUser)
+	if currentDomain == "" {
+		currentDomain = userDomain
+	}
+	domain, name := splitUser(user)
+	if domain == "" {
+		domain = currentDomain
+	}
+
+	changed := name != currentName || domain != currentDomain || pass != currentPass
+
+	c.creds.lock.Lock()
+	if changed && currentPass != pass {
+		c.creds.oldPasses = append(c.creds.oldPasses, currentPass)
+	}
+	c.creds.set = true
+	c.creds.stale = false
+	c.creds.user = name
+	c.creds.domain = domain
+	c.creds.pass = pass
+	if changed {
+		c.creds.generation++
+	}
+	c.creds.lock.Unlock()
+
+	if changed {
+		c.forgetSession()
+	}
+}
+
+// settleCredentials is called after a request that started when the
+// credential generation was generation. If the credentials changed while
+// it was going, its connection (now idle) and any cookies it got are
+// still from the old session, so they are thrown away again.
+func (c *CognosInstance) settleCredentials(generation uint64) {
+	if c.credentialGeneration() != generation {
+		c.forgetSession()
+	}
+}
+
+// forgetSession throws away our cookies, passport, and idle connections
+func (c *CognosInstance) forgetSession() {
+	if jar, resettable := c.client.Jar.(*resettableJar); resettable {
+		jar.reset()
+	}
+	c.forgetPassport()
+	closeIdleConnections(c.client.Transport)
+}
+
+// closeIdleConnections closes the idle connections of rt, if it has any,
+// looking inside the NTLM negotiator
+func closeIdleConnections(rt http.RoundTripper) {
+	if negotiator, isNTLM := rt.(ntlmssp.Negotiator); isNTLM {
+		rt = negotiator.RoundTripper
+	}
+	if closer, ok := rt.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// resettableJar is a cookie jar that can be emptied (see SetCredentials)
+type resettableJar struct {
+	lock sync.RWMutex
+	jar  *cookiejar.Jar
+}
+
+func newResettableJar() *resettableJar {
+	j := &resettableJar{}
+	j.reset()
+	return j
+}
+
+// reset throws away every cookie
+func (j *resettableJar) reset() {
+	jar, err := cookiejar.New(
+		&cookiejar.Options{
+			PublicSuffixList: publicsuffix.List,
+		},
+	)
+	panicOnErr(err)
+	j.lock.Lock()
+	j.jar = jar
+	j.lock.Unlock()
+}
+
+func (j *resettableJar) current() *cookiejar.Jar {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return j.jar
+}
+
+func (j *resettableJar) Cookies(u *url.URL) []*http.Cookie {
+	return j.current().Cookies(u)
+}
+
+func (j *resettableJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.current().SetCookies(u, cookies)
+}
@@ -0,0 +1,163 @@
+package cognos
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// logonsAs returns how many times we logged on to the dispatcher as user
+func logonsAs(srv *cognostest.Server, user string) int {
+	return countRequests(srv, func(r cognostest.Request) bool {
+		return r.Form.Get("h_CAM_action") == "logonAs" && r.Form.Get("CAMUsername") == user
+	})
+}
+
+// newDispatcherInstance is newTestInstance, but it logs on to the
+// dispatcher, where the fake server checks the password
+func newDispatcherInstance(t *testing.T) (*cognostest.Server, *CognosInstance) {
+	t.Helper()
+	srv, c := newTestInstance(t)
+	c.DispatcherURL = srv.URL
+	return srv, c
+}
+
+func TestSetCredentials(t *testing.T) {
+	srv, c := newDispatcherInstance(t)
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	user, pass := c.User, c.Pass
+
+	srv.SetCredentials(`APSCN\other`, "new")
+	c.SetCredentials("other", "new")
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	// the old session was thrown away, so we had to log on again
+	if n := logonsAs(srv, "other"); n != 1 {
+		t.Errorf("logged on as other %d times", n)
+	}
+	if c.Username() != "other" || c.authUser() != `APSCN\other` {
+		t.Errorf("now logged in as %q (%q)", c.Username(), c.authUser())
+	}
+	if c.User != user || c.Pass != pass {
+		t.Error("SetCredentials changed the User or Pass field")
+	}
+	// scrub still knows about the old password
+	passes := " " + strings.Join(c.passwords(), " ") + " "
+	if !strings.Contains(passes, " test ") || !strings.Contains(passes, " new ") {
+		t.Errorf("scrub only knows the passwords%s", passes)
+	}
+
+	// a wrong password fails like any other wrong password
+	c.SetCredentials("other", "wrong")
+	if _, err := c.LsFolderE(srv.Public.ID); err == nil {
+		t.Error("a wrong password worked")
+	}
+}
+
+func TestSetCredentialsDuringRequest(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.Delay = 200 * time.Millisecond
+
+	// the home page gives us a passport, and we change the credentials
+	// before it comes back
+	done := make(chan struct{})
+	go func() {
+		c.ServerVersion()
+		close(done)
+	}()
+	waitFor(t, "the home page to be asked for", func() bool { return srv.MaxInFlight() == 1 })
+	c.SetCredentials("other", "new")
+	<-done
+
+	// that passport is for the old credentials
+	if c.hasPassport() {
+		t.Error("kept the session from before SetCredentials")
+	}
+}
+
+func TestSetCredentialsDuringDispatcherLogon(t *testing.T) {
+	srv, c := newDispatcherInstance(t)
+	srv.Delay = 200 * time.Millisecond
+
+	// the first listing logs on as test, and we change the credentials
+	// before the passport comes back
+	done := make(chan error)
+	go func() {
+		_, err := c.LsFolderE(srv.Public.ID)
+		done <- err
+	}()
+	waitFor(t, "the logon to start", func() bool { return srv.MaxInFlight() == 1 })
+	c.SetCredentials("other", "new")
+	srv.SetCredentials(`APSCN\other`, "new")
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// the old passport must not be used for the next request
+	srv.SetDelay(0)
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	if logonsAs(srv, "test") != 1 || logonsAs(srv, "other") != 1 {
+		t.Errorf("logged on as test %d times and other %d times", logonsAs(srv, "test"), logonsAs(srv, "other"))
+	}
+}
+
+func TestWithUserSharesSlots(t *testing.T) {
+	srv, c := newTestInstance(t)
+	other := c.WithUser("other", "pass")
+	srv.Delay = 200 * time.Millisecond
+
+	// c has all 4 slots, so other has to wait for one
+	wait := saturate(t, c, srv.Public.ID, 4)
+	done := make(chan error)
+	go func() {
+		_, err := other.LsFolderE(srv.Public.ID)
+		done <- err
+	}()
+	waitFor(t, "the other user to queue", func() bool {
+		_, waiting := other.RequestSlots()
+		return waiting == 1
+	})
+	if inFlight, waiting := c.RequestSlots(); inFlight != 4 || waiting != 1 {
+		t.Errorf("c sees %d in flight and %d waiting", inFlight, waiting)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	wait()
+	if n := srv.MaxInFlight(); n > 4 {
+		t.Errorf("the server got %d requests at once", n)
+	}
+}
+
+func TestWithUserOwnSession(t *testing.T) {
+	srv, c := newDispatcherInstance(t)
+	other := c.WithUser("other", "new")
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the other user dosen't get c's passport, so it logs on for itself
+	srv.SetCredentials(`APSCN\other`, "new")
+	if _, err := other.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	if logonsAs(srv, "test") != 1 || logonsAs(srv, "other") != 1 {
+		t.Errorf("logged on as test %d times and other %d times", logonsAs(srv, "test"), logonsAs(srv, "other"))
+	}
+	if c.authUser() != `APSCN\test` || other.authUser() != `APSCN\other` {
+		t.Errorf("logging in as %q and %q", c.authUser(), other.authUser())
+	}
+
+	// changing one's credentials dosen't change the other's
+	other.SetCredentials("third", "pass")
+	if c.authUser() != `APSCN\test` {
+		t.Errorf("c is now logging in as %q", c.authUser())
+	}
+}
@@ -0,0 +1,115 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDumps is how many pages WithDebugDump keeps. The oldest ones are
+// deleted to make room.
+const maxDumps = 20
+
+// maxDumpSize is how much of a page WithDebugDump saves
+const maxDumpSize = 1 << 20
+
+// dumpPrefix starts the names of the files WithDebugDump saves, so we only
+// ever delete our own
+const dumpPrefix = "cognos-dump-"
+
+// debugDumper saves pages we couldn't understand. It is shared between an
+// instance and any instances derived from it.
+type debugDumper struct {
+	lock sync.Mutex
+	dir  string
+}
+
+// WithDebugDump returns a copy of c that saves pages it can't understand
+// (ex: a folder listing or report viewer page after the portal changed)
+// in dir, so you can see what broke without making the request again. The
+// name of the file is in the error. Passwords and cookie values are
+// scrubbed out of the page first. Only the first MB of a page is saved,
+// and only the newest 20 pages are kept, so a loop that keeps failing
+// can't fill up the disk.
+func (c *CognosInstance) WithDebugDump(dir string) *CognosInstance {
+	derived := *c
+	derived.dumps = &debugDumper{dir: dir}
+	return &derived
+}
+
+// notUnderstood returns an error with message for a page we couldn't
+// understand, after saving the page if we are doing that (see
+// WithDebugDump)
+func (c *CognosInstance) notUnderstood(page string, message string) error {
+	return c.dumpFailure(page, errors.New(message))
+}
+
+// dumpFailure saves page if we are doing that (see WithDebugDump), and
+// adds where it was saved to err. Otherwise it returns err as is.
+func (c *CognosInstance) dumpFailure(page string, err error) error {
+	if c.dumps == nil {
+		return err
+	}
+	path, dumpErr := c.dumps.save(c.scrubCookies(c.scrub(page)))
+	if dumpErr != nil {
+		log.Println("Unable to save the page we couldn't understand: " + dumpErr.Error())
+		return err
+	}
+	return fmt.Errorf("%w (the page is saved in %s)", err, path)
+}
+
+// scrubCookies takes the values of our cookies (ex: the CAM passport) out
+// of s
+func (c *CognosInstance) scrubCookies(s string) string {
+	if c.client.Jar == nil {
+		return s
+	}
+	for _, base := range []string{c.URL, c.DispatcherURL} {
+		baseURL, err := url.Parse(base)
+		if base == "" || err != nil {
+			continue
+		}
+		for _, cookie := range c.client.Jar.Cookies(baseURL) {
+			if len(cookie.Value) >= 4 {
+				s = strings.Replace(s, cookie.Value, redacted, -1)
+			}
+		}
+	}
+	return s
+}
+
+// save writes page to a new file, making room for it first
+func (d *debugDumper) save(page string) (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	err := os.MkdirAll(d.dir, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	// the names start with the time, so sorting them puts the oldest first
+	old, err := filepath.Glob(filepath.Join(d.dir, dumpPrefix+"*"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(old)
+	for len(old) >= maxDumps {
+		os.Remove(old[0])
+		old = old[1:]
+	}
+
+	if len(page) > maxDumpSize {
+		page = page[:maxDumpSize]
+	}
+	name := dumpPrefix + time.Now().UTC().Format("20060102T150405.000000000") + ".html"
+	path := filepath.Join(d.dir, name)
+	return path, os.WriteFile(path, []byte(page), 0600)
+}
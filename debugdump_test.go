@@ -0,0 +1,102 @@
+package cognos
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// dumps returns the files WithDebugDump saved in dir
+func dumps(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, dumpPrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestDebugDump(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "a\n1\n")
+	report.Broken = true
+	dir := filepath.Join(t.TempDir(), "dumps")
+
+	// without WithDebugDump nothing is saved
+	_, err := c.DownloadReportCSVE(report.ID)
+	if err == nil || strings.Contains(err.Error(), dir) {
+		t.Fatalf("got %v", err)
+	}
+
+	_, err = c.WithDebugDump(dir).DownloadReportCSVE(report.ID)
+	files := dumps(t, dir)
+	if err == nil || len(files) != 1 || !strings.Contains(err.Error(), files[0]) {
+		t.Fatalf("got %v, saved %q", err, files)
+	}
+	page, _ := os.ReadFile(files[0])
+	if !strings.Contains(string(page), "this is not the page you are looking for") {
+		t.Errorf("saved %q", page)
+	}
+}
+
+func TestDebugDumpScrubs(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c = c.WithDebugDump(t.TempDir())
+	// the home page gives us a passport
+	c.ServerVersion()
+	gateway, _ := url.Parse(srv.URL + gatewayPath)
+	var passport string
+	for _, cookie := range c.client.Jar.Cookies(gateway) {
+		if cookie.Name == passportCookie {
+			passport = cookie.Value
+		}
+	}
+	if passport == "" {
+		t.Fatal("we didn't get a passport")
+	}
+
+	// TestPasswordNotInDebugDump covers the password
+	c.SetTransport(pageTransport("<html><body>passport " + passport + "</body></html>"))
+	_, err := c.StatEntry(srv.Public.ID)
+	files := dumps(t, c.dumps.dir)
+	if err == nil || len(files) != 1 {
+		t.Fatalf("got %v, saved %q", err, files)
+	}
+	page, _ := os.ReadFile(files[0])
+	if strings.Contains(string(page), passport) || !strings.Contains(string(page), "passport "+redacted) {
+		t.Errorf("saved %q", page)
+	}
+}
+
+func TestDebugDumpLimits(t *testing.T) {
+	_, c := newTestInstance(t)
+	c.RetryCount = 0
+	c = c.WithDebugDump(t.TempDir())
+
+	c.SetTransport(pageTransport("<html>nope</html>"))
+	for i := 0; i < maxDumps+5; i++ {
+		if _, err := c.StatEntry("i1A2B3C4D5E6F"); err == nil {
+			t.Fatal("a page of nope worked")
+		}
+	}
+	if files := dumps(t, c.dumps.dir); len(files) != maxDumps {
+		t.Fatalf("kept %d pages", len(files))
+	}
+
+	// the newest sorts last
+	c.SetTransport(pageTransport("<html>" + strings.Repeat("x", maxDumpSize) + "</html>"))
+	c.StatEntry("i1A2B3C4D5E6F")
+	files := dumps(t, c.dumps.dir)
+	if len(files) != maxDumps {
+		t.Fatalf("kept %d pages", len(files))
+	}
+	info, err := os.Stat(files[len(files)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != maxDumpSize {
+		t.Errorf("saved %d bytes", info.Size())
+	}
+}
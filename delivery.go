@@ -0,0 +1,100 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrDeliveryRejected means Cognos wouldn't deliver a report's output
+// (ex: because it dosen't have a mail server set up)
+var ErrDeliveryRejected = errors.New("Cognos rejected the delivery")
+
+// EmailDelivery is who a report's output is emailed to (see EmailReport)
+type EmailDelivery struct {
+	To      []string
+	Subject string
+	// Attach attaches the output to the email. Otherwise the output is
+	// saved, and the email has a link to it.
+	Attach bool
+	// Format is the output format (CSV, PDF, HTML, XLSX, or XML). Empty
+	// means CSV.
+	Format string
+	// Params are prompt values to run the report with (see
+	// DownloadOptions.Params)
+	Params map[string]string
+}
+
+// looseEmailAddress is close enough to an email address to be worth
+// sending to Cognos. Cognos (or the mail server) can reject it after that.
+var looseEmailAddress = regexp.MustCompile(`^[^@\s,;]+@[^@\s,;]+\.[^@\s,;]+$`)
+
+// Validate returns an error describing every problem with the delivery,
+// or nil if there aren't any. Addresses are only checked loosely.
+func (d EmailDelivery) Validate() error {
+	var problems []string
+	if len(d.To) == 0 {
+		problems = append(problems, "at least one recipient is required")
+	}
+	for _, address := range d.To {
+		if !looseEmailAddress.MatchString(address) {
+			problems = append(problems, fmt.Sprintf("%q is not an email address", address))
+		}
+	}
+	if d.Format != "" && !scheduleFormats[strings.ToUpper(d.Format)] {
+		problems = append(problems, "unsupported format "+d.Format)
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid email delivery: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// EmailReport runs the report with the given id on the server, and has
+// Cognos email the output. It returns as soon as Cognos accepts the run,
+// with the ID of the run (like RunJob uses), without waiting for the
+// report to finish or the email to be sent. If Cognos won't do it (ex: it
+// dosen't have a mail server set up), it panics with ErrDeliveryRejected
+// and Cognos's reason. The delivery is checked with Validate before
+// anything is sent.
+func (c *CognosInstance) EmailReport(id string, delivery EmailDelivery) (eventID string) {
+	if err := delivery.Validate(); err != nil {
+		panic(err)
+	}
+	format := strings.ToUpper(delivery.Format)
+	if format == "" {
+		format = "CSV"
+	}
+
+	values := url.Values{
+		"b_action":         {"xts.run"},
+		"m":                {"portal/run.xts"},
+		"m_cmd":            {"runWithOptions"},
+		"m_obj":            {objectSearchPath(id)},
+		"run.outputFormat": {format},
+		"dlv_email":        {"true"},
+		"dlv_to":           {strings.Join(delivery.To, ";")},
+		"dlv_subject":      {delivery.Subject},
+		"dlv_attach":       {fmt.Sprint(delivery.Attach)},
+		// a link needs something to link to
+		"dlv_save": {fmt.Sprint(!delivery.Attach)},
+	}
+	body := values.Encode()
+	if len(delivery.Params) > 0 {
+		body += "&" + paramsQuery(delivery.Params)
+	}
+
+	// this sends email, so it is a POST and isn't retried if we can't
+	// tell if it went through
+	page := c.Request("POST", "/ibmcognos/cgi-bin/cognos.cgi", body)
+	if !findJSVar(page, "g_PS_EventID", &eventID) {
+		if fault, found := parseFault(page); found {
+			panic(fmt.Errorf("%w: %w", ErrDeliveryRejected, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when attempting to email the report"))
+	}
+	return eventID
+}
@@ -0,0 +1,243 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrHeaderMismatch means two outputs being compared don't have the same
+// columns
+var ErrHeaderMismatch = errors.New("the outputs don't have the same columns")
+
+// ErrDuplicateKey means more than one row in an output has the same key,
+// so the rows can't be matched up
+var ErrDuplicateKey = errors.New("more than one row has the same key")
+
+// CellChange is a column that changed in a row (see RecordDiff)
+type CellChange struct {
+	Column string `json:"column"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// RowChange is a row that is in both outputs, but with diffrent values
+type RowChange struct {
+	// Key is the values of the key columns, in the order they were given
+	Key []string `json:"key"`
+	// Old and New are the whole row. They are in the order of the columns
+	// in Header, even if the old output had them in a diffrent order.
+	Old     []string     `json:"old"`
+	New     []string     `json:"new"`
+	Changes []CellChange `json:"changes"`
+}
+
+// RecordDiff is what changed between two outputs of a report
+type RecordDiff struct {
+	// Header is the columns of the new output. Every row is in this order.
+	Header []string `json:"header"`
+	// Added and Removed are in the order they were in the new and old
+	// outputs
+	Added    [][]string  `json:"added"`
+	Removed  [][]string  `json:"removed"`
+	Modified []RowChange `json:"modified"`
+}
+
+// Changed returns true if anything changed
+func (d RecordDiff) Changed() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0 || len(d.Modified) > 0
+}
+
+// columnIndexes maps the column names in header to where they are. It
+// fails if a name is there twice.
+func columnIndexes(header []string) (map[string]int, error) {
+	indexes := make(map[string]int, len(header))
+	for i, name := range header {
+		if _, exists := indexes[name]; exists {
+			return nil, fmt.Errorf("%w: column %q is there more than once", ErrHeaderMismatch, name)
+		}
+		indexes[name] = i
+	}
+	return indexes, nil
+}
+
+// keyedRows indexes rows (in header order) by the values of the key
+// columns. The key values are joined with a separator that can't be in a
+// CSV cell we got from Cognos.
+func keyedRows(rows [][]string, keyIndexes []int, which string) (map[string][]string, []string, error) {
+	byKey := make(map[string][]string, len(rows))
+	order := make([]string, 0, len(rows))
+	for _, row := range rows {
+		keyValues := make([]string, len(keyIndexes))
+		for i, index := range keyIndexes {
+			keyValues[i] = row[index]
+		}
+		key := strings.Join(keyValues, "\x00")
+		if _, exists := byKey[key]; exists {
+			return nil, nil, fmt.Errorf("%w: %q in the %s output", ErrDuplicateKey, keyValues, which)
+		}
+		byKey[key] = row
+		order = append(order, key)
+	}
+	return byKey, order, nil
+}
+
+// reorderRows puts rows in the column order of header, padding short rows
+// with ""
+func reorderRows(rows [][]string, from []string, header []string) [][]string {
+	fromIndexes, _ := columnIndexes(from)
+	reordered := make([][]string, len(rows))
+	for i, row := range rows {
+		newRow := make([]string, len(header))
+		for j, name := range header {
+			if index := fromIndexes[name]; index < len(row) {
+				newRow[j] = row[index]
+			}
+		}
+		reordered[i] = newRow
+	}
+	return reordered
+}
+
+// DiffRecords compares two report outputs, each a header row followed by
+// the data rows (like csv.Reader.ReadAll returns). Rows are matched up by
+// the values of keyColumns. The outputs must have the same columns, but
+// they can be in a diffrent order. An output with nothing in it at all
+// (not even a header) counts as having no rows. If the columns don't match
+// the error wraps ErrHeaderMismatch, and if two rows in the same output
+// have the same key it wraps ErrDuplicateKey. Rows are looked up by key,
+// so this is fine for big outputs.
+func DiffRecords(old, new [][]string, keyColumns []string) (RecordDiff, error) {
+	if len(keyColumns) == 0 {
+		return RecordDiff{}, errors.New("at least one key column is needed to compare outputs")
+	}
+	if len(old) == 0 && len(new) == 0 {
+		return RecordDiff{}, nil
+	}
+	if len(old) == 0 {
+		old = new[:1]
+	}
+	if len(new) == 0 {
+		new = old[:1]
+	}
+
+	header := new[0]
+	newIndexes, err := columnIndexes(header)
+	if err != nil {
+		return RecordDiff{}, err
+	}
+	oldIndexes, err := columnIndexes(old[0])
+	if err != nil {
+		return RecordDiff{}, err
+	}
+	var missing, extra []string
+	for _, name := range old[0] {
+		if _, found := newIndexes[name]; !found {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range header {
+		if _, found := oldIndexes[name]; !found {
+			extra = append(extra, name)
+		}
+	}
+	if len(missing) > 0 || len(extra) > 0 {
+		return RecordDiff{}, fmt.Errorf("%w: removed %q, added %q", ErrHeaderMismatch, missing, extra)
+	}
+
+	keyIndexes := make([]int, len(keyColumns))
+	for i, name := range keyColumns {
+		index, found := newIndexes[name]
+		if !found {
+			return RecordDiff{}, fmt.Errorf("the key column %q isn't in the outputs", name)
+		}
+		keyIndexes[i] = index
+	}
+
+	oldRows := reorderRows(old[1:], old[0], header)
+	newRows := reorderRows(new[1:], header, header)
+	oldByKey, oldOrder, err := keyedRows(oldRows, keyIndexes, "old")
+	if err != nil {
+		return RecordDiff{}, err
+	}
+	newByKey, newOrder, err := keyedRows(newRows, keyIndexes, "new")
+	if err != nil {
+		return RecordDiff{}, err
+	}
+
+	diff := RecordDiff{Header: header}
+	for _, key := range newOrder {
+		newRow := newByKey[key]
+		oldRow, found := oldByKey[key]
+		if !found {
+			diff.Added = append(diff.Added, newRow)
+			continue
+		}
+		var changes []CellChange
+		for i, name := range header {
+			if oldRow[i] != newRow[i] {
+				changes = append(changes, CellChange{Column: name, Old: oldRow[i], New: newRow[i]})
+			}
+		}
+		if len(changes) > 0 {
+			diff.Modified = append(diff.Modified, RowChange{
+				Key:     strings.Split(key, "\x00"),
+				Old:     oldRow,
+				New:     newRow,
+				Changes: changes,
+			})
+		}
+	}
+	for _, key := range oldOrder {
+		if _, found := newByKey[key]; !found {
+			diff.Removed = append(diff.Removed, oldByKey[key])
+		}
+	}
+	return diff, nil
+}
+
+// Records returns the table as a header row followed by the data rows,
+// like csv.Reader.ReadAll (see DiffRecords). A table with no columns has
+// no records at all.
+func (t Table) Records() [][]string {
+	if len(t.Columns) == 0 {
+		return nil
+	}
+	header := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		header[i] = column.Name
+	}
+	return append([][]string{header}, t.Rows...)
+}
+
+// DiffReports runs the reports with the given IDs (at the same time) and
+// compares their outputs with DiffRecords (ex: two report views of the
+// same report, saved with diffrent prompt values). If either report
+// fails, the error is returned.
+func (c *CognosInstance) DiffReports(oldID, newID string, keyColumns []string) (RecordDiff, error) {
+	var oldTable, newTable Table
+	var oldErr, newErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		oldErr = catch(func() {
+			oldTable = c.DownloadReportTable(oldID)
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		newErr = catch(func() {
+			newTable = c.DownloadReportTable(newID)
+		})
+	}()
+	wg.Wait()
+	if oldErr != nil {
+		return RecordDiff{}, fmt.Errorf("unable to run report %s: %w", oldID, oldErr)
+	}
+	if newErr != nil {
+		return RecordDiff{}, fmt.Errorf("unable to run report %s: %w", newID, newErr)
+	}
+	return DiffRecords(oldTable.Records(), newTable.Records(), keyColumns)
+}
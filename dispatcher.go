@@ -0,0 +1,169 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// gatewayPath is the gateway CGI that almost every link goes to
+const gatewayPath = "/ibmcognos/cgi-bin/cognos.cgi"
+
+// dispatchPath is where the dispatcher's servlet is (see DispatcherURL)
+const dispatchPath = "/p2pd/servlet/dispatch"
+
+// passportCookie is the cookie the dispatcher gives us when we log on
+const passportCookie = "cam_passport"
+
+// dispatcherSession remembers if we have a passport from the dispatcher.
+// It is shared between an instance and any instances derived from it.
+type dispatcherSession struct {
+	lock     sync.Mutex
+	loggedOn bool
+}
+
+// viaDispatcher returns true if a request for link should go to the
+// dispatcher. Only links to the gateway CGI itself can. Anything else
+// (ex: report outputs) is served by the gateway.
+func (c *CognosInstance) viaDispatcher(link string) bool {
+	if c.DispatcherURL == "" {
+		return false
+	}
+	path := link
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	return path == gatewayPath
+}
+
+// newRequest makes a request with the headers we always send
+func newRequest(ctx context.Context, method string, fullURL string, reqBody string, headers http.Header) *http.Request {
+	// make an io.reader if we have post data
+	var reqBodyReader io.Reader
+	if len(reqBody) > 0 {
+		reqBodyReader = strings.NewReader(reqBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, fullURL, reqBodyReader)
+	panicOnErr(err)
+	for name, values := range headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", defaultAccept)
+	}
+	if len(reqBody) > 0 && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", formContentType)
+	}
+	return req
+}
+
+// send sends one request for link. It goes to the dispatcher if it can
+// (see viaDispatcher), but if the dispatcher refuses the connection we
+// fall back to the gateway.
+func (c *CognosInstance) send(ctx context.Context, method string, link string, reqBody string, headers http.Header) (*http.Response, error) {
+	err := c.fetchLogin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.viaDispatcher(link) {
+		resp, err := c.sendToDispatcher(ctx, method, link, reqBody, headers)
+		if err == nil || !neverSent(err) {
+			return resp, err
+		}
+		log.Println("Unable to reach the Cognos dispatcher, using the gateway instead: " + c.scrub(err.Error()))
+	}
+
+	return c.do(ctx, method, c.URL+link, reqBody, headers, true)
+}
+
+// sendToDispatcher sends a request for a gateway link to the dispatcher
+// instead, logging on first if we don't have a passport
+func (c *CognosInstance) sendToDispatcher(ctx context.Context, method string, link string, reqBody string, headers http.Header) (*http.Response, error) {
+	err := c.dispatcherLogon(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatchURL := strings.TrimSuffix(c.DispatcherURL, "/") + dispatchPath + strings.TrimPrefix(link, gatewayPath)
+	resp, err := c.do(ctx, method, dispatchURL, reqBody, headers, false)
+	if err == nil && resp.StatusCode == 401 {
+		// our passport expired. The retry will log on again.
+		c.forgetPassport()
+	}
+	return resp, err
+}
+
+// dispatcherLogon gets a passport from the dispatcher, unless we already
+// have one. The dispatcher dosen't do NTLM like the gateway, so we log on
+// to the namespace with a form instead.
+func (c *CognosInstance) dispatcherLogon(ctx context.Context) error {
+	c.dispatcher.lock.Lock()
+	defer c.dispatcher.lock.Unlock()
+	if c.dispatcher.loggedOn {
+		return nil
+	}
+
+	dispatchURL := strings.TrimSuffix(c.DispatcherURL, "/") + dispatchPath
+	user, _, pass := c.login()
+	_, user = splitUser(user)
+	form := url.Values{
+		"b_action":     {"xts.run"},
+		"m":            {"portal/cc.xts"},
+		"h_CAM_action": {"logonAs"},
+		"CAMNamespace": {c.Namespace},
+		"CAMUsername":  {user},
+		"CAMPassword":  {pass},
+	}
+	resp, err := c.client.Do(newRequest(ctx, "POST", dispatchURL, form.Encode(), nil))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == 401 || resp.StatusCode == 403 {
+		c.credentialsRejected()
+		return fmt.Errorf("%w: the Cognos dispatcher refused to log us on: %s", ErrAuthFailed, resp.Status)
+	}
+	if resp.StatusCode != 200 {
+		return errors.New("Unable to log on to the Cognos dispatcher: " + resp.Status)
+	}
+
+	parsedURL, err := url.Parse(dispatchURL)
+	panicOnErr(err)
+	for _, cookie := range c.client.Jar.Cookies(parsedURL) {
+		if cookie.Name == passportCookie {
+			c.dispatcher.loggedOn = true
+			return nil
+		}
+	}
+	return errors.New("Unable to log on to the Cognos dispatcher: no passport was given")
+}
+
+// hasPassport returns true if the gateway has given us a passport, so we
+// already have a session with it
+func (c *CognosInstance) hasPassport() bool {
+	parsedURL, err := url.Parse(c.URL + "/ibmcognos/cgi-bin/cognos.cgi")
+	if err != nil || c.client.Jar == nil {
+		return false
+	}
+	for _, cookie := range c.client.Jar.Cookies(parsedURL) {
+		if cookie.Name == passportCookie {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetPassport makes the next request to the dispatcher log on again
+func (c *CognosInstance) forgetPassport() {
+	c.dispatcher.lock.Lock()
+	c.dispatcher.loggedOn = false
+	c.dispatcher.lock.Unlock()
+}
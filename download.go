@@ -1,79 +1,1074 @@
 package cognos
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"html"
+	"io"
+	"log"
+	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
+// DownloadOptions changes how a single report download is done.
+// The zero value is the same as calling DownloadReportCSV.
+type DownloadOptions struct {
+	// BypassCache runs the report even if there is a cached output
+	// (see CacheDir). The new output is still cached.
+	BypassCache bool
+	// FailOnNoData panics with ErrNoData if the report didn't find
+	// anything, instead of returning an empty (or header only) output
+	FailOnNoData bool
+	// RowLimit is the most rows (not counting the header) to get. 0 means
+	// all of them. Cognos is asked to stop after this many, and if it
+	// dosen't, the output is cut off as it is downloaded.
+	RowLimit int
+	// DownloadRate overrides CognosInstance.DownloadRate if it isn't 0
+	DownloadRate uint
+	// SlowReportThreshold overrides CognosInstance.SlowReportThreshold if
+	// it isn't 0
+	SlowReportThreshold uint
+	// Params are prompt values to run the report with, keyed by prompt
+	// name (see MultiValueSeparator for multi-select prompts, or use
+	// EncodeParams to make them from typed values)
+	Params map[string]string
+	// ValidateParams checks Params with ValidateParams before running the
+	// report, and panics with the ParamErrors if there are problems
+	ValidateParams bool
+	// Delimiter is the field seperator of the output, for the functions
+	// that split it into columns (ex: DownloadReportTableWithOptions). 0
+	// means guess between a comma, tab, and semicolon. It dosen't change
+	// what DownloadReportCSVWithOptions returns.
+	Delimiter rune
+	// Format is the output format DownloadReport gets (CSV, PDF, HTML,
+	// XLSX, or XML). Empty means CognosInstance.DefaultOutputFormat. The
+	// functions with CSV in the name ignore it. RowLimit is only enforced
+	// by Cognos (not as the output is downloaded) for formats other than
+	// CSV.
+	Format string
+	// Independent runs the report even if the same report (with the same
+	// options) is already being run by another goroutine. Normally we
+	// wait for that run and return its output instead.
+	Independent bool
+}
+
 // DownloadReportCSV returns a string containing CSV data for a cognos report.
 // This function triggers the execution of the report, and may take a while
-// to return.
-func (c CognosInstance) DownloadReportCSV(id string) string {
-	respHTML := c.Request("GET", reportLinkFromID(id), "")
-
-	// if the report isn't finished we need to poll to see when it is
-	if strings.Contains(respHTML, `"m_sStatus": "working"`) {
-		// when we re-check if the report is done we need to send along some post
-		// data to identify the report. The list here is stolen from scottorgan
-		valuesToSend := make(url.Values)
-		valuesToSend.Set("b_action", findJSONValueInPage(respHTML, "b_action"))
-		valuesToSend.Set("cv.actionState", findJSONValueInPage(respHTML, "m_sActionState"))
-		valuesToSend.Set("cv.catchLogOnFault", "true")
-		valuesToSend.Set("cv.id", findJSONValueInPage(respHTML, "cv.id"))
-		valuesToSend.Set("cv.objectPermissions", findJSONValueInPage(respHTML, "cv.objectPermissions"))
-		valuesToSend.Set("cv.responseFormat", "data")
-		valuesToSend.Set("cv.showFaultPage", "true")
-		valuesToSend.Set("executionParameters", findJSONValueInPage(respHTML, "m_sParameters"))
-		valuesToSend.Set("m_tracking", findJSONValueInPage(respHTML, "m_sTracking"))
-		valuesToSend.Set("ui.action", "wait")
-		valuesToSend.Set("ui.cafcontextid", findJSONValueInPage(respHTML, "m_sCAFContext"))
-		valuesToSend.Set("ui.conversation", findJSONValueInPage(respHTML, "m_sConversation"))
-		valuesToSend.Set("ui.object", findJSONValueInPage(respHTML, "ui.object"))
-		valuesToSend.Set("ui.objectClass", findJSONValueInPage(respHTML, "ui.objectClass"))
-		valuesToSend.Set("ui.primaryAction", findJSONValueInPage(respHTML, "ui.primaryAction"))
-		postData := valuesToSend.Encode()
-
-		// if either of these strings is present, the report is not finished
-		wStr1 := `"m_sStatus": "working"`
-		wStr2 := `&quot;m_sStatus&quot;: &quot;stillWorking&quot;`
-		// loop until neither string is present
-		for strings.Contains(respHTML, wStr1) || strings.Contains(respHTML, wStr2) {
-			time.Sleep(time.Second * time.Duration(c.RetryDelay))
-			respHTML = c.Request("POST", "/ibmcognos/cgi-bin/cognos.cgi", postData)
+// to return. If it fails, it panics with an *OpError.
+func (c *CognosInstance) DownloadReportCSV(id string) string {
+	return c.DownloadReportCSVWithOptions(id, DownloadOptions{})
+}
+
+// DownloadReportCSVWithOptions is DownloadReportCSV with options
+func (c *CognosInstance) DownloadReportCSVWithOptions(id string, opts DownloadOptions) string {
+	defer wrapOp("DownloadReportCSV", id, nil)
+	opts.Format = "CSV"
+	return c.downloadReport(context.Background(), id, opts)
+}
+
+// DownloadReportCSVContext is DownloadReportCSV, but it returns an error
+// instead of panicking, and it stops as soon as ctx is done (while
+// starting the report, between checks on it, or while downloading it). If
+// it is stopped while the report is running, the run is cancelled on the
+// server too (if we can). Then the error works with errors.Is(err,
+// ctx.Err()), and not ErrReportFailed. Since one caller giving up
+// shouldn't stop the report for another, the run isn't shared with other
+// goroutines running the same report (see DownloadOptions.Independent).
+func (c *CognosInstance) DownloadReportCSVContext(ctx context.Context, id string) (csv string, err error) {
+	err = catch(func() {
+		defer wrapOp("DownloadReportCSV", id, nil)
+		csv = c.downloadReport(ctx, id, DownloadOptions{Format: "CSV"})
+	})
+	return csv, err
+}
+
+// DownloadReport returns the output of a report in opts.Format, or
+// DefaultOutputFormat if that isn't set, or CSV if neither is. Otherwise
+// it works like DownloadReportCSVWithOptions. If it fails, it panics with
+// an *OpError.
+func (c *CognosInstance) DownloadReport(id string, opts DownloadOptions) []byte {
+	defer wrapOp("DownloadReport", id, nil)
+	if opts.Format == "" {
+		opts.Format = c.DefaultOutputFormat
+	}
+	if opts.Format == "" {
+		opts.Format = "CSV"
+	}
+	return []byte(c.downloadReport(context.Background(), id, opts))
+}
+
+// DownloadReportByPath is DownloadReport for the report at path (see
+// FolderEntryFromPath)
+func (c *CognosInstance) DownloadReportByPath(path []string, opts DownloadOptions) []byte {
+	defer wrapOp("DownloadReport", "", path)
+	entry := c.FolderEntryFromPath(path)
+	if entry.Type != Report {
+		panic(fmt.Errorf("%s is not a report", strings.Join(path, "/")))
+	}
+	return c.DownloadReport(entry.ID, opts)
+}
+
+// downloadReport does the work for DownloadReport and
+// DownloadReportCSVWithOptions. opts.Format must be set.
+func (c *CognosInstance) downloadReport(ctx context.Context, id string, opts DownloadOptions) string {
+	opts.Format = strings.ToUpper(opts.Format)
+	if !scheduleFormats[opts.Format] {
+		panic("unsupported output format " + opts.Format)
+	}
+	if opts.ValidateParams {
+		panicOnErr(c.ValidateParams(id, opts.Params))
+	}
+
+	format := opts.Format
+	if opts.RowLimit > 0 {
+		// a limited output shouldn't be mistaken for the whole thing
+		format += fmt.Sprintf("\x00rows=%d", opts.RowLimit)
+	}
+	if len(opts.Params) > 0 {
+		// diffrent prompt values give diffrent output
+		format += "\x00" + paramsQuery(opts.Params)
+	}
+	output := c.cachedDownload(ctx, id, format, opts.BypassCache, func() string {
+		// a run that can be stopped can't be shared
+		independent := opts.Independent || ctx.Done() != nil
+		return c.sharedRun(id, format, independent, func() string {
+			run := c.startReportWithOptions(ctx, id, opts)
+			return run.Wait()
+		})
+	})
+	noData := output == ""
+	if opts.Format == "CSV" {
+		noData = !hasRows(output)
+	}
+	if opts.FailOnNoData && noData {
+		panic(fmt.Errorf("%w: %s", ErrNoData, id))
+	}
+	return output
+}
+
+// sharedRun calls run, unless another goroutine is already running the
+// same report in the same format, in which case it waits for that one and
+// returns the same output. If the run panics, everyone waiting on it
+// panics with the same error. If independent is true, run is always
+// called.
+func (c *CognosInstance) sharedRun(id, format string, independent bool, run func() string) string {
+	if independent {
+		return run()
+	}
+
+	output, err, _ := c.runs.Do(c.outputKey(id, format), func() (interface{}, error) {
+		var output string
+		err := catch(func() {
+			output = run()
+		})
+		return output, err
+	})
+	panicOnErr(err)
+	return output.(string)
+}
+
+// hasRows returns true if a CSV output has at least one line after the
+// header
+func hasRows(csv string) bool {
+	_, rest, found := strings.Cut(strings.TrimSpace(csv), "\n")
+	return found && strings.TrimSpace(rest) != ""
+}
+
+// DownloadReportCSVWithInfo is DownloadReportCSV, but it also returns
+// timing and other details about the run. If the output came from the
+// cache, only ReportID, Cached, and Bytes are filled in.
+func (c *CognosInstance) DownloadReportCSVWithInfo(id string) (csv string, info RunInfo) {
+	ran := false
+	csv = c.cachedDownload(context.Background(), id, "CSV", false, func() string {
+		run := c.StartReport(id)
+		output := run.Wait()
+		info = run.Info()
+		info.ReportID = id
+		ran = true
+		return output
+	})
+	if !ran {
+		info = RunInfo{
+			ReportID: id,
+			Cached:   true,
+			Bytes:    int64(len(csv)),
+			NoData:   !hasRows(csv),
+			SHA256:   sha256Hex(csv),
+		}
+	}
+	return csv, info
+}
+
+// RunInfo is how long a report run took, and where the time went
+type RunInfo struct {
+	ReportID string
+	// Conversation and Tracking identify the run on the Cognos server
+	Conversation string
+	Tracking     string
+	// SubmittedAt is when we asked Cognos to run the report
+	SubmittedAt time.Time
+	// Polls is how many times we checked if the report was done
+	Polls int
+	// CompletedAt is when we saw that the report was done
+	CompletedAt time.Time
+	// DownloadTime is how long it took to download the output once the
+	// report was done
+	DownloadTime time.Duration
+	// Bytes is the size of the output
+	Bytes int64
+	// Cached is true if the output came from the cache and the report
+	// wasn't actually run
+	Cached bool
+	// RowLimitedBy is how DownloadOptions.RowLimit was applied: "client"
+	// if we had to cut the output off ourselves, or "server" if we didn't
+	// (so Cognos did, or there weren't that many rows anyway). It is ""
+	// if there was no limit.
+	RowLimitedBy string
+	// NoData is true if the report didn't find anything
+	NoData bool
+	// SHA256 is the hex SHA-256 of the output, so you can store it with
+	// the output and check it later
+	SHA256 string
+	// LengthChecked is true if the server said how big the output was
+	// (Content-Length) and that is what we got. A download that dosen't
+	// match is retried (or fails with ErrShortDownload), so it is only
+	// false if the server didn't say.
+	LengthChecked bool
+}
+
+// Throughput is how fast the output was downloaded, in bytes per second.
+// It is 0 if it wasn't downloaded (ex: it came from the cache).
+func (i RunInfo) Throughput() float64 {
+	if i.DownloadTime <= 0 {
+		return 0
+	}
+	return float64(i.Bytes) / i.DownloadTime.Seconds()
+}
+
+// ServerTime is how long the report took to run on the server (as far as
+// we can tell, since we only check every PollInterval)
+func (i RunInfo) ServerTime() time.Duration {
+	return i.CompletedAt.Sub(i.SubmittedAt)
+}
+
+// ErrConversationGone means a report run can't be resumed because Cognos
+// has already forgotten about it (it finished a long time ago, was
+// cancelled, or the server restarted). The report needs to be run again.
+var ErrConversationGone = errors.New("the report conversation no longer exists on the Cognos server")
+
+// ErrPollFailed means we lost track of a running report because checking
+// on it kept failing (see PollFailureLimit). The report may still be
+// running on the server, and can be picked up again with ResumeReport.
+var ErrPollFailed = errors.New("unable to check on the running report")
+
+// ErrShortDownload means the output we downloaded wasn't the size the
+// server said it would be (ex: the connection closed early)
+var ErrShortDownload = errors.New("the download was a diffrent size than the server said")
+
+// ErrReportFailed means Cognos says the report itself failed
+var ErrReportFailed = errors.New("the report failed")
+
+// ErrPrompting means the report asked for prompt values instead of
+// running. Save default prompt values for it (see SaveDefaultPromptValues)
+// or pass them in DownloadOptions.Params. The error is a *PromptingError.
+var ErrPrompting = errors.New("the report prompted for additional information")
+
+// PromptingError is what we fail with when a report prompts (see
+// ErrPrompting)
+type PromptingError struct {
+	// ReportID is the report that prompted
+	ReportID string
+}
+
+func (e *PromptingError) Error() string {
+	if e.ReportID == "" {
+		return ErrPrompting.Error()
+	}
+	return ErrPrompting.Error() + ": " + e.ReportID
+}
+
+func (e *PromptingError) Unwrap() error { return ErrPrompting }
+
+// ErrNoData means the report ran fine, but didn't find anything. By
+// default that isn't an error, and you just get an empty output, but
+// some functions can be asked to panic with this instead (see
+// DownloadOptions.FailOnNoData).
+var ErrNoData = errors.New("the report returned no data")
+
+// ErrRunAsDenied means Cognos wouldn't let us run a report as someone else
+// (see RunAs), probably because our user dosen't have the capability
+var ErrRunAsDenied = errors.New("not allowed to run reports as another user")
+
+// defaultPollFailureLimit is used when PollFailureLimit is 0
+const defaultPollFailureLimit = 10
+
+// defaultLanguage is used when Language is empty
+const defaultLanguage = "en"
+
+// viewerHeaders returns the headers we send on requests to the report
+// viewer, pinning the language it answers in (see Language)
+func (c *CognosInstance) viewerHeaders() http.Header {
+	language := c.Language
+	if language == "" {
+		language = defaultLanguage
+	}
+	return http.Header{"Accept-Language": {language}}
+}
+
+// viewerStatus returns the m_sStatus of a viewer page (ex: working,
+// stillWorking, or prompting), or "" if it dosen't have one. It is a key
+// in the page's JavaScript, so unlike the text on the page it is the same
+// whatever language the viewer answers in, and whatever way the JSON is
+// spaced out. The stillWorking page has it HTML-encoded.
+func viewerStatus(page string) string {
+	if status, found := findJSONValue(page, "m_sStatus"); found {
+		return status
+	}
+	if status, found := findJSONValue(html.UnescapeString(page), "m_sStatus"); found {
+		return status
+	}
+	return ""
+}
+
+// isWorking returns true if a viewer page says the report is not finished
+func isWorking(page string) bool {
+	status := viewerStatus(page)
+	return status == "working" || status == "stillWorking"
+}
+
+// RunState is everything needed to keep checking on a running report.
+// It can be saved as JSON and passed to ResumeReport later (even by
+// another process) to pick up where we left off.
+type RunState struct {
+	ReportID            string    `json:"reportId"`
+	StartedAt           time.Time `json:"startedAt"`
+	BAction             string    `json:"bAction"`
+	ActionState         string    `json:"actionState"`
+	CVID                string    `json:"cvId"`
+	ObjectPermissions   string    `json:"objectPermissions"`
+	ExecutionParameters string    `json:"executionParameters"`
+	Tracking            string    `json:"tracking"`
+	CAFContext          string    `json:"cafContext"`
+	Conversation        string    `json:"conversation"`
+	ObjectClass         string    `json:"objectClass"`
+	PrimaryAction       string    `json:"primaryAction"`
+}
+
+// ReportRun is a report that has been started on the server, but might
+// not be finished yet
+type ReportRun struct {
+	// State can be saved and passed to ResumeReport if this process
+	// dies before the report is finished
+	State RunState
+
+	c *CognosInstance
+	// ctx stops the run's requests (and waiting for it) when it is done.
+	// nil means they never stop.
+	ctx context.Context
+	// page is the last response we got from Cognos about this run
+	page string
+	// these are filled in as we go for Info
+	polls        int
+	completedAt  time.Time
+	downloadTime time.Duration
+	bytes        int64
+	noData       bool
+	sha256       string
+	lengthKnown  bool
+	// rowLimit is 0 for no limit. rowLimitedBy is for Info.
+	rowLimit     int
+	rowLimitedBy string
+	// downloadRate is in bytes per second. 0 means no limit.
+	downloadRate uint
+	// slowThreshold is in seconds (see SlowReportThreshold). slowReported
+	// is set once the SlowReport hook has been called.
+	slowThreshold uint
+	slowReported  bool
+	// leave is set while Close should wait for the run (see trackRun)
+	leave func()
+}
+
+// runStateFromPage pulls the values we need to poll a report out of the
+// "working" page Cognos returns when a report is started
+func runStateFromPage(page string) RunState {
+	// the list here is stolen from scottorgan
+	return RunState{
+		ReportID:            findJSONValueInPage(page, "ui.object"),
+		StartedAt:           time.Now(),
+		BAction:             findJSONValueInPage(page, "b_action"),
+		ActionState:         findJSONValueInPage(page, "m_sActionState"),
+		CVID:                findJSONValueInPage(page, "cv.id"),
+		ObjectPermissions:   findJSONValueInPage(page, "cv.objectPermissions"),
+		ExecutionParameters: findJSONValueInPage(page, "m_sParameters"),
+		Tracking:            findJSONValueInPage(page, "m_sTracking"),
+		CAFContext:          findJSONValueInPage(page, "m_sCAFContext"),
+		Conversation:        findJSONValueInPage(page, "m_sConversation"),
+		ObjectClass:         findJSONValueInPage(page, "ui.objectClass"),
+		PrimaryAction:       findJSONValueInPage(page, "ui.primaryAction"),
+	}
+}
+
+// pollData returns the post data used to check if the report is done
+func (s RunState) pollData() string {
+	valuesToSend := make(url.Values)
+	valuesToSend.Set("b_action", s.BAction)
+	valuesToSend.Set("cv.actionState", s.ActionState)
+	valuesToSend.Set("cv.catchLogOnFault", "true")
+	valuesToSend.Set("cv.id", s.CVID)
+	valuesToSend.Set("cv.objectPermissions", s.ObjectPermissions)
+	valuesToSend.Set("cv.responseFormat", "data")
+	valuesToSend.Set("cv.showFaultPage", "true")
+	valuesToSend.Set("executionParameters", s.ExecutionParameters)
+	valuesToSend.Set("m_tracking", s.Tracking)
+	valuesToSend.Set("ui.action", "wait")
+	valuesToSend.Set("ui.cafcontextid", s.CAFContext)
+	valuesToSend.Set("ui.conversation", s.Conversation)
+	valuesToSend.Set("ui.object", s.ReportID)
+	valuesToSend.Set("ui.objectClass", s.ObjectClass)
+	valuesToSend.Set("ui.primaryAction", s.PrimaryAction)
+	return valuesToSend.Encode()
+}
+
+// StartReport starts running a report and returns without waiting for it
+// to finish. Call Wait on the result to get the output.
+func (c *CognosInstance) StartReport(id string) *ReportRun {
+	return c.startReportLink(context.Background(), id, c.runLink(id))
+}
+
+// startReportWithOptions starts a report in opts.Format (which must be
+// set), asking Cognos to stop after opts.RowLimit rows (if it isn't 0).
+// For a CSV, Wait and WaitTo will enforce the limit even if Cognos
+// dosen't.
+func (c *CognosInstance) startReportWithOptions(ctx context.Context, id string, opts DownloadOptions) *ReportRun {
+	link := c.runLinkWithFormat(id, opts.Format)
+	if len(opts.Params) > 0 {
+		link += "&" + paramsQuery(opts.Params)
+	}
+	if opts.RowLimit > 0 {
+		link += "&run.rowLimit=" + strconv.Itoa(opts.RowLimit)
+	}
+	run := c.startReportLink(ctx, id, link)
+	if opts.Format == "CSV" {
+		// we can only count rows in a CSV
+		run.rowLimit = opts.RowLimit
+	}
+	if opts.DownloadRate > 0 {
+		run.downloadRate = opts.DownloadRate
+	}
+	if opts.SlowReportThreshold > 0 {
+		run.slowThreshold = opts.SlowReportThreshold
+	}
+	return run
+}
+
+// startReportLink does the work for StartReport, using link to start the
+// report. The run's requests are stopped when ctx is done.
+func (c *CognosInstance) startReportLink(ctx context.Context, id string, link string) *ReportRun {
+	run := &ReportRun{
+		State:         RunState{ReportID: id, StartedAt: time.Now()},
+		c:             c,
+		ctx:           ctx,
+		downloadRate:  c.DownloadRate,
+		slowThreshold: c.SlowReportThreshold,
+	}
+	c.trackRun(run)
+	started := false
+	defer func() {
+		if !started {
+			run.finish()
+		}
+	}()
+	run.page = c.requestContext(run.context(), "GET", link, "", c.viewerHeaders())
+	started = true
+	count(&c.stats.reportsRun)
+
+	// when we re-check if the report is done we need to send along some
+	// post data to identify the report
+	if isWorking(run.page) {
+		var state RunState
+		err := catch(func() {
+			state = runStateFromPage(run.page)
+		})
+		if err != nil {
+			panic(c.dumpFailure(run.page, err))
+		}
+		// Close may be looking at the run's conversation already, since
+		// the run is tracked before it starts
+		c.life.lock.Lock()
+		run.State = state
+		c.life.lock.Unlock()
+	}
+	return run
+}
+
+// ResumeReport picks up a report run started with StartReport, possibly by
+// another process, using its saved State. It checks on the report right
+// away. If Cognos has already forgotten about the run, Wait will panic with
+// ErrConversationGone. If the report finished while nobody was watching,
+// Wait returns the output like normal.
+func (c *CognosInstance) ResumeReport(state RunState) *ReportRun {
+	if state.Conversation == "" {
+		panic(fmt.Errorf("%w: the run state has no conversation", ErrConversationGone))
+	}
+
+	// make sure we have a session (ex: if this is a new process)
+	if !c.hasPassport() {
+		c.Request("GET", c.loginLink(), "")
+	}
+
+	run := &ReportRun{
+		State:         state,
+		c:             c,
+		downloadRate:  c.DownloadRate,
+		slowThreshold: c.SlowReportThreshold,
+	}
+	c.trackRun(run)
+	started := false
+	defer func() {
+		if !started {
+			run.finish()
+		}
+	}()
+	run.poll()
+	started = true
+	return run
+}
+
+// Done returns true if the report has finished (or failed)
+func (r *ReportRun) Done() bool {
+	return !isWorking(r.page)
+}
+
+// poll checks on the report once
+func (r *ReportRun) poll() {
+	r.polls++
+	count(&r.c.stats.polls)
+	headers := r.c.viewerHeaders()
+	headers.Set("Content-Type", formContentType)
+	// the report is already running, so keep checking on it even if the
+	// circuit breaker is open
+	ctx := withIdempotent(exemptFromBreaker(r.context()), true)
+	r.page = r.c.requestContext(ctx, "POST", "/ibmcognos/cgi-bin/cognos.cgi", r.State.pollData(), headers)
+}
+
+// pollFailureLimit returns how many polls in a row can fail before we
+// give up, or -1 for never
+func (c *CognosInstance) pollFailureLimit() int {
+	if c.PollFailureLimit == 0 {
+		return defaultPollFailureLimit
+	}
+	return c.PollFailureLimit
+}
+
+// Wait waits for the report to finish, then downloads and returns the
+// output. It panics if the report fails or prompts for parameters.
+// A poll that fails (even after its retries) is not the end of the world,
+// since the report is still running on the server, so we just poll again
+// next time. If too many polls fail in a row (see PollFailureLimit) Wait
+// panics with ErrPollFailed, and State can be used to resume later.
+func (r *ReportRun) Wait() string {
+	defer r.finish()
+	downloadUrl := r.waitDone()
+	if r.noData {
+		// there is nothing to download
+		r.downloaded(0, 0)
+		return ""
+	}
+	if r.rowLimit > 0 || r.downloadRate > 0 {
+		// this needs to be streamed so it can be cut off or slowed down
+		var output strings.Builder
+		r.streamTo(downloadUrl, &output)
+		return output.String()
+	}
+
+	// download the report. If the connection drops partway through, the
+	// retry picks up where it left off if it can.
+	var output bytes.Buffer
+	download := newResumableDownload()
+	r.c.requestStream(r.downloadContext(), "GET", downloadUrl, "", download.headers, func(resp *http.Response) {
+		if !download.start(resp) {
+			output.Reset()
 		}
+		n, err := io.Copy(&output, resp.Body)
+		download.received += n
+		err = catch(func() { checkLength(resp, n, err) })
+		if err != nil {
+			download.failed()
+		}
+		panicOnErr(err)
+		r.lengthKnown = download.total >= 0
+	})
+	csv := output.String()
+	r.noData = !hasRows(csv)
+	r.sha256 = sha256Hex(csv)
+	r.downloaded(time.Since(r.completedAt), int64(len(csv)))
+	return csv
+}
+
+// checkLength panics with ErrShortDownload if the response said how big
+// it was (Content-Length) and we read a diffrent amount. err is from
+// reading the body, and is panicked with if the length is fine. Since
+// this panics inside requestStream, the download is retried.
+func checkLength(resp *http.Response, read int64, err error) {
+	if resp.ContentLength >= 0 && (read != resp.ContentLength || errors.Is(err, io.ErrUnexpectedEOF)) {
+		panic(fmt.Errorf("%w: got %d of %d bytes", ErrShortDownload, read, resp.ContentLength))
+	}
+	panicOnErr(err)
+}
+
+// sha256Hex returns the hex SHA-256 of s
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// WaitTo is like Wait, but it writes the output to w as it is downloaded
+// instead of holding all of it in memory. It returns the number of bytes
+// written. If the download fails after part of the output has been
+// written to w, the retry asks for just the rest (with a Range request)
+// if the server supports that. If it doesn't, the download can only start
+// over if w can be truncated and rewound (like an *os.File). Otherwise it
+// is not retried, and a download that was shorter than the server said it
+// would be panics with ErrShortDownload. The SHA-256 of what was written
+// is in Info.
+func (r *ReportRun) WaitTo(w io.Writer) int64 {
+	defer r.finish()
+	downloadUrl := r.waitDone()
+	if r.noData {
+		r.downloaded(0, 0)
+		return 0
+	}
+	return r.streamTo(downloadUrl, w)
+}
 
+// streamTo downloads the output from downloadUrl to w, cutting it off at
+// the row limit and slowing it down to the download rate, if there are
+// any. It is the part of WaitTo that comes after the report is done.
+func (r *ReportRun) streamTo(downloadUrl string, w io.Writer) int64 {
+	var written int64
+	var rows *rowDetector
+	var hasher hash.Hash
+	var dest io.Writer
+	var limiter *rowLimitWriter
+	reset := func() {
+		rows = &rowDetector{}
+		hasher = sha256.New()
+		dest = io.MultiWriter(w, rows, hasher)
+		limiter = nil
+		if r.rowLimit > 0 {
+			limiter = &rowLimitWriter{w: dest, limit: r.rowLimit}
+			dest = limiter
+		}
+	}
+	reset()
+	download := newResumableDownload()
+	r.c.requestStream(r.downloadContext(), "GET", downloadUrl, "", download.headers, func(resp *http.Response) {
+		if !download.start(resp) && written > 0 {
+			// we have to start over
+			if !rewind(w) {
+				panic(permanent(fmt.Errorf("%w: the download can't be resumed, and %d bytes were already written", ErrShortDownload, written)))
+			}
+			written = 0
+			reset()
+		}
+		var body io.Reader = resp.Body
+		if r.downloadRate > 0 {
+			body = &throttledReader{r: body, bytesPerSecond: int64(r.downloadRate)}
+		}
+		n, err := io.Copy(dest, body)
+		written += n
+		download.received += n
+		if err == errRowLimitReached {
+			// we have what we asked for, so don't download the rest
+			return
+		}
+		err = catch(func() { checkLength(resp, n, err) })
+		if err != nil && written > 0 && !download.failed() && !canRewind(w) {
+			// we can't take back what we already wrote
+			err = permanent(err)
+		}
+		panicOnErr(err)
+		r.lengthKnown = download.total >= 0
+	})
+	r.sha256 = hex.EncodeToString(hasher.Sum(nil))
+	r.noData = !rows.found
+	if limiter != nil {
+		r.rowLimitedBy = "server"
+		if limiter.cut {
+			r.rowLimitedBy = "client"
+		}
+	}
+	r.downloaded(time.Since(r.completedAt), written)
+	return written
+}
+
+// throttledReader reads from r no faster than bytesPerSecond
+type throttledReader struct {
+	r              io.Reader
+	bytesPerSecond int64
+	start          time.Time
+	read           int64
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	// read a tenth of a second's worth at most, so we don't go in bursts
+	if chunk := t.bytesPerSecond/10 + 1; int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+
+	// wait until we are back under the limit
+	due := time.Duration(float64(t.read) / float64(t.bytesPerSecond) * float64(time.Second))
+	if wait := due - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// errRowLimitReached stops io.Copy once a rowLimitWriter has enough rows
+var errRowLimitReached = errors.New("row limit reached")
+
+// rowLimitWriter passes along the header and the first limit rows of a
+// CSV output, then returns errRowLimitReached if there is anything more.
+// Newlines inside quotes don't count.
+type rowLimitWriter struct {
+	w        io.Writer
+	limit    int
+	newlines int
+	inQuotes bool
+	// cut is set if there was more output after the limit
+	cut bool
+}
+
+func (l *rowLimitWriter) Write(p []byte) (int, error) {
+	// the header plus limit rows is limit+1 lines
+	end := len(p)
+	for i, b := range p {
+		if l.newlines > l.limit {
+			end = i
+			break
+		}
+		if b == '"' {
+			l.inQuotes = !l.inQuotes
+		} else if b == '\n' && !l.inQuotes {
+			l.newlines++
+		}
+	}
+
+	n, err := l.w.Write(p[:end])
+	if err != nil {
+		return n, err
+	}
+	if end < len(p) {
+		l.cut = true
+		return n, errRowLimitReached
+	}
+	return n, nil
+}
+
+// rowDetector is hasRows for output that is streamed instead of held in
+// memory. found is set once something other than whitespace comes after
+// the first newline.
+type rowDetector struct {
+	pastHeader bool
+	found      bool
+}
+
+func (d *rowDetector) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if d.found {
+			break
+		}
+		if !d.pastHeader {
+			d.pastHeader = b == '\n'
+		} else if b != '\n' && b != '\r' && b != ' ' && b != '\t' {
+			d.found = true
+		}
+	}
+	return len(p), nil
+}
+
+// downloaded records how the output download went, and tells the
+// ReportDone hook
+func (r *ReportRun) downloaded(took time.Duration, bytes int64) {
+	r.downloadTime = took
+	r.bytes = bytes
+	atomic.AddInt64(&r.c.stats.bytes, bytes)
+	if r.c.Hooks.ReportDone != nil {
+		r.c.Hooks.ReportDone(r.Info())
+	}
+}
+
+// waitDone waits for the report to finish and returns the link to
+// download the output from. If the report has no data there is no link,
+// and noData is set instead.
+func (r *ReportRun) waitDone() (downloadUrl string) {
+	r.waitFinished()
+	return r.outputLink()
+}
+
+// waitFinished polls until the report is done (or failed)
+func (r *ReportRun) waitFinished() {
+	sleep := r.c.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	ctx := r.context()
+
+	// loop until the report is done
+	failures := 0
+	for !r.Done() {
+		if sleep(ctx, r.c.pollInterval()) != nil {
+			r.stopped()
+		}
+		err := catch(r.poll)
+		if err != nil && ctx.Err() != nil {
+			r.stopped()
+		}
+		r.checkSlow()
+		if err == nil {
+			failures = 0
+			continue
+		}
+		if errors.Is(err, ErrClosed) {
+			panic(err)
+		}
+
+		failures++
+		count(&r.c.stats.pollFailures)
+		limit := r.c.pollFailureLimit()
+		if limit >= 0 && failures >= limit {
+			panic(fmt.Errorf("%w: %d checks in a row failed: %w", ErrPollFailed, failures, err))
+		}
+		r.c.retried(RetryInfo{
+			Link:    r.State.ReportID,
+			Poll:    true,
+			Attempt: failures,
+			Err:     err,
+			Delay:   r.c.pollInterval(),
+		})
+	}
+
+	r.completedAt = time.Now()
+}
+
+// cancelTimeout is how long stopped spends trying to cancel a run
+const cancelTimeout = 10 * time.Second
+
+// stopped is called when the run's ctx is done while we are waiting for
+// the report. It tries to cancel the run on the server, so it dosen't keep
+// going for nobody, then panics with the context's error.
+func (r *ReportRun) stopped() {
+	ctxErr := r.context().Err()
+	if r.State.Conversation != "" {
+		ctx, cancel := context.WithTimeout(allowAfterClose(context.Background()), cancelTimeout)
+		defer cancel()
+		err := catch(func() {
+			r.c.releaseConversation(ctx, r.State.Conversation)
+		})
+		if err != nil {
+			log.Println("Unable to cancel report " + r.State.ReportID + " after we stopped waiting for it: " + r.c.scrub(err.Error()))
+		}
+	}
+	panic(fmt.Errorf("stopped waiting for report %s: %w", r.State.ReportID, ctxErr))
+}
+
+// checkSlow calls the SlowReport hook if the report is still running and
+// has been for longer than slowThreshold, unless it already has been
+func (r *ReportRun) checkSlow() {
+	if r.slowReported || r.slowThreshold == 0 || r.c.Hooks.SlowReport == nil || r.Done() {
+		return
+	}
+	elapsed := time.Since(r.State.StartedAt)
+	if elapsed >= time.Second*time.Duration(r.slowThreshold) {
+		r.slowReported = true
+		r.c.Hooks.SlowReport(r.State.ReportID, elapsed, r.polls)
+	}
+}
+
+// ViewerStatus is what a viewer page says about a report run (see
+// ParseViewerResponse)
+type ViewerStatus uint
+
+const (
+	// ViewerWorking means the report is still running
+	ViewerWorking ViewerStatus = iota
+	// ViewerFinished means there is an output to download
+	ViewerFinished ViewerStatus = iota
+	// ViewerNoData means the report finished, but didn't find anything
+	ViewerNoData ViewerStatus = iota
+	// ViewerPrompting means the report wants prompt values
+	ViewerPrompting ViewerStatus = iota
+	// ViewerFailed means the report failed, or the page is something we
+	// don't understand
+	ViewerFailed ViewerStatus = iota
+)
+
+// ParseViewerResponse parses a page from the report viewer (what we get
+// when we start a report, or check on it). It dosen't make any requests,
+// so it is handy for checking a page you saved.
+//
+// If the report is still working, state has the values needed to keep
+// checking on it (StartedAt is left empty, since the page dosen't say).
+// If it is finished, downloadURL is where the output is. If it failed,
+// err says why, and is the *Fault if Cognos gave us one.
+func ParseViewerResponse(page string) (status ViewerStatus, state RunState, downloadURL string, err error) {
+	if isWorking(page) {
+		err = catch(func() {
+			state = runStateFromPage(page)
+			state.StartedAt = time.Time{}
+		})
+		if err != nil {
+			return ViewerFailed, RunState{}, "", err
+		}
+		return ViewerWorking, state, "", nil
 	}
 
 	downloadLinkRegex := regexp.MustCompile(`var sURL = '([^']+)';`)
-	if matchParts := downloadLinkRegex.FindStringSubmatch(respHTML); len(matchParts) > 0 {
+	if matchParts := downloadLinkRegex.FindStringSubmatch(page); len(matchParts) > 0 {
 		// ^ if a match is found for downloadLinkRegex ^
-		downloadUrl := matchParts[1]
-
-		// download the report
-		csv := c.Request("GET", downloadUrl, "")
-		return csv
-	} else if strings.Contains(respHTML, `"m_sStatus": "prompting"`) {
-		panic("the report prompted for additional information")
+		return ViewerFinished, state, matchParts[1], nil
+	} else if viewerStatus(page) == "prompting" {
+		return ViewerPrompting, state, "", nil
+	} else if fault, found := parseFault(page); found {
+		return ViewerFailed, state, "", fault
+	} else if isNoDataPage(page) {
+		return ViewerNoData, state, "", nil
 	} else {
-		panic("Cognos returned a page we could not understand when attempting to run the report")
+		return ViewerFailed, state, "", errors.New("Cognos returned a page we could not understand")
+	}
+}
+
+// outputLink returns the link to download the output of a finished report,
+// or panics with the reason there isn't one. A report that didn't find
+// anything isn't a failure, so for that it sets noData and returns "".
+func (r *ReportRun) outputLink() string {
+	status, _, downloadURL, err := ParseViewerResponse(r.page)
+	switch status {
+	case ViewerFinished:
+		return downloadURL
+	case ViewerNoData:
+		r.noData = true
+		return ""
+	case ViewerPrompting:
+		panic(&PromptingError{ReportID: r.State.ReportID})
+	}
+
+	var fault *Fault
+	if errors.As(err, &fault) {
+		if r.State.Conversation != "" && isConversationGone(fault) {
+			panic(fmt.Errorf("%w: %v", ErrConversationGone, fault))
+		}
+		if r.c.runAs != "" && isRunAsDenied(fault) {
+			panic(fmt.Errorf("%w: %s: %w", ErrRunAsDenied, r.c.runAs, fault))
+		}
+		panic(fmt.Errorf("%w: Cognos returned an error when attempting to run the report: %w", ErrReportFailed, fault))
+	}
+	panic(r.c.dumpFailure(r.page, fmt.Errorf("%w: Cognos returned a page we could not understand when attempting to run the report", ErrReportFailed)))
+}
+
+// Info returns timing and other details about the run. The timing
+// is only complete after Wait has returned.
+func (r *ReportRun) Info() RunInfo {
+	return RunInfo{
+		ReportID:      r.State.ReportID,
+		Conversation:  r.State.Conversation,
+		Tracking:      r.State.Tracking,
+		SubmittedAt:   r.State.StartedAt,
+		Polls:         r.polls,
+		CompletedAt:   r.completedAt,
+		DownloadTime:  r.downloadTime,
+		Bytes:         r.bytes,
+		NoData:        r.noData,
+		RowLimitedBy:  r.rowLimitedBy,
+		SHA256:        r.sha256,
+		LengthChecked: r.lengthKnown,
+	}
+}
+
+// noDataMessages are the "No Data Available" message in the languages we
+// know of, lower case. There isn't a status for it, so this is all we
+// have to go by if the viewer didn't answer in Language.
+var noDataMessages = []string{
+	"no data available",
+	"no hay datos disponibles",
+	"aucune donnée disponible",
+	"keine daten verfügbar",
+}
+
+// isNoDataPage returns true if Cognos showed its "No Data Available"
+// message instead of an output
+func isNoDataPage(page string) bool {
+	page = strings.ToLower(html.UnescapeString(page))
+	for _, message := range noDataMessages {
+		if strings.Contains(page, message) {
+			return true
+		}
 	}
+	return false
 }
 
-// stolen from scottorgan. This is where it gets messy
-// BUG(jon): searchKey is not escaped
-func findJSONValueInPage(html string, key string) string {
-	// build a regex that searches for
-	// "key": "valuable-data"
-	pattern := regexp.MustCompile(`"` + key + `": "(.*?)"`)
-	matchParts := pattern.FindStringSubmatch(html)
+// isConversationGone guesses if a fault means the conversation we were
+// polling no longer exists. There isn't one error code for this, so we
+// go by the message.
+func isConversationGone(fault *Fault) bool {
+	text := strings.ToLower(fault.Message + " " + fault.Detail)
+	return strings.Contains(text, "conversation")
+}
+
+// stolen from scottorgan (then made less messy). This finds "key": "value"
+// in the JavaScript on a page and returns the value with any escapes
+// (\", \\, \uXXXX, etc) decoded. Some pages (ex: stillWorking) have the
+// whole thing HTML-encoded (&quot;key&quot;: &quot;value&quot;), so we
+// look for that too.
+func findJSONValueInPage(page string, key string) string {
+	if value, found := findJSONValue(page, key); found {
+		return value
+	}
+	if value, found := findJSONValue(html.UnescapeString(page), key); found {
+		return value
+	}
 
 	// panic if we didn't find a match
+	panic("Could not find JSON value " + key + " in page")
+}
+
+// findJSONValue does the work for findJSONValueInPage on an already
+// decoded page
+func findJSONValue(page string, key string) (value string, found bool) {
+	// the value is everything up to the first quote that isn't escaped
+	pattern := regexp.MustCompile(`"` + regexp.QuoteMeta(key) + `"\s*:\s*"((?:[^"\\]|\\.)*)"`)
+	matchParts := pattern.FindStringSubmatch(page)
 	if len(matchParts) == 0 {
-		panic("Could not find JSON value " + key + " in page")
+		return "", false
 	}
+	return unescapeJSString(matchParts[1]), true
+}
 
-	// return only the value (not the whole match)
-	return matchParts[1]
+// unescapeJSString decodes the escapes in the inside of a JavaScript
+// string literal. JSON escapes are handled by encoding/json. JavaScript
+// also allows \' which JSON dosen't, so we take care of that first.
+func unescapeJSString(s string) string {
+	jsonString := `"` + strings.Replace(s, `\'`, `'`, -1) + `"`
+	var value string
+	if err := json.Unmarshal([]byte(jsonString), &value); err != nil {
+		// not valid JSON. The raw value is better than nothing.
+		return s
+	}
+	return value
 }
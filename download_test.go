@@ -0,0 +1,551 @@
+package cognos
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+func TestDownloadReportCSV(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Daily", "a,b\n1,2\n")
+	report.Polls = 2
+
+	if csv := c.DownloadReportCSV(report.ID); csv != "a,b\n1,2\n" {
+		t.Errorf("got %q", csv)
+	}
+	if n := countRequests(srv, isRun); n != 1 {
+		t.Errorf("report was started %d times, want 1", n)
+	}
+	if n := countRequests(srv, isWait); n != 2 {
+		t.Errorf("report was checked on %d times, want 2", n)
+	}
+}
+
+func TestDownloadPromptingReport(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Asks", "a\n1\n")
+	report.Prompting = true
+
+	_, err := c.DownloadReportCSVE(report.ID)
+	var prompting *PromptingError
+	if !errors.As(err, &prompting) || prompting.ReportID != report.ID {
+		t.Errorf("got %v, want a PromptingError for %s", err, report.ID)
+	}
+	if !errors.Is(err, ErrPrompting) {
+		t.Errorf("%v isn't ErrPrompting", err)
+	}
+}
+
+func TestDownloadBrokenReport(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Broken", "a\n1\n")
+	report.Broken = true
+
+	if _, err := c.DownloadReportCSVE(report.ID); err == nil {
+		t.Error("a page we don't understand didn't fail the download")
+	}
+}
+
+func TestResumeReport(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 3
+
+	run := c.StartReport(report.ID)
+	run.poll()
+	stateJSON, err := json.Marshal(run.State)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a new process picks it up from the saved state
+	var state RunState
+	if err := json.Unmarshal(stateJSON, &state); err != nil {
+		t.Fatal(err)
+	}
+	fresh := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 3, 10, 4)
+	fresh.sleep = noSleep
+	if csv := fresh.ResumeReport(state).Wait(); csv != report.CSV {
+		t.Errorf("resumed run got %q", csv)
+	}
+	if n := countRequests(srv, isRun); n != 1 {
+		t.Errorf("report was started %d times, want 1", n)
+	}
+}
+
+func TestResumeReportLogsOnOnlyOnce(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 2
+
+	fresh := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 3, 10, 4)
+	fresh.sleep = noSleep
+	for i := 0; i < 2; i++ {
+		state := c.StartReport(report.ID).State
+		fresh.ResumeReport(state).Wait()
+	}
+	if n := countRequests(srv, isHome); n != 1 {
+		t.Errorf("resuming logged on %d times, want 1 (the session is kept)", n)
+	}
+}
+
+func TestResumeForgottenReport(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 3
+
+	state := c.StartReport(report.ID).State
+	srv.ForgetConversations()
+
+	err := catch(func() {
+		c.ResumeReport(state).Wait()
+	})
+	if !errors.Is(err, ErrConversationGone) {
+		t.Errorf("got %v, want ErrConversationGone", err)
+	}
+}
+
+func TestFindJSONValueInPage(t *testing.T) {
+	tests := []struct {
+		name  string
+		page  string
+		key   string
+		value string
+	}{
+		{"plain", `var oCV = {"m_sStatus": "working"};`, "m_sStatus", "working"},
+		{"no spaces", `{"m_sStatus":"working","b_action":"cognosViewer"}`, "b_action", "cognosViewer"},
+		{"escaped quotes", `{"m_sParameters": "say \"hi\"", "x": "y"}`, "m_sParameters", `say "hi"`},
+		{"windows path", `{"ui.object": "C:\\Reports\\Daily"}`, "ui.object", `C:\Reports\Daily`},
+		{"unicode escape", `{"ui.name": "Caf\u00e9 \u2013 Men\u00fa"}`, "ui.name", "Café – Menú"},
+		{"javascript quote", `{"ui.name": "O\'Brien"}`, "ui.name", "O'Brien"},
+		{"html encoded", `value="{&quot;m_sStatus&quot;: &quot;stillWorking&quot;}"`, "m_sStatus", "stillWorking"},
+		// the dot in the key is not a wildcard
+		{"key is escaped", `{"uixobject": "wrong", "ui.object": "right"}`, "ui.object", "right"},
+	}
+	for _, test := range tests {
+		if value := findJSONValueInPage(test.page, test.key); value != test.value {
+			t.Errorf("%s: got %q, want %q", test.name, value, test.value)
+		}
+	}
+
+	if err := catch(func() { findJSONValueInPage(`{"other": "x"}`, "m_sStatus") }); err == nil {
+		t.Error("a missing key didn't panic")
+	}
+}
+
+func TestPollsHaveContentType(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 3
+
+	run := c.StartReport(report.ID)
+	// the first poll has to be sent again after a 401
+	srv.InjectFaults(401, 1)
+	run.Wait()
+
+	polls := 0
+	for _, r := range srv.Requests() {
+		if r.Method != "POST" {
+			continue
+		}
+		polls++
+		if r.Header.Get("Content-Type") != formContentType {
+			t.Errorf("poll %d has Content-Type %q", polls, r.Header.Get("Content-Type"))
+		}
+	}
+	if polls != 4 {
+		t.Errorf("got %d polls, want 4 (3 and one that got a 401)", polls)
+	}
+}
+
+func TestPollingSurvivesOutage(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 1
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 3
+
+	run := c.StartReport(report.ID)
+	// 3 polls in a row use up their retries
+	srv.InjectFaults(503, 6)
+	if csv := run.Wait(); csv != report.CSV {
+		t.Errorf("got %q", csv)
+	}
+	if n := countRequests(srv, isRun); n != 1 {
+		t.Errorf("report was started %d times, want 1", n)
+	}
+}
+
+func TestPollingGivesUp(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 0
+	c.PollFailureLimit = 3
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 3
+
+	run := c.StartReport(report.ID)
+	srv.InjectFaults(503, 3)
+	err := catch(func() { run.Wait() })
+	if !errors.Is(err, ErrPollFailed) || errors.Is(err, ErrReportFailed) {
+		t.Fatalf("got %v, want ErrPollFailed (and not ErrReportFailed)", err)
+	}
+
+	// the report is still running, so we can pick it back up
+	if csv := c.ResumeReport(run.State).Wait(); csv != report.CSV {
+		t.Errorf("resumed run got %q", csv)
+	}
+}
+
+func TestHasRows(t *testing.T) {
+	tests := map[string]bool{
+		"":               false,
+		"a,b":            false,
+		"a,b\n":          false,
+		"a,b\r\n  \r\n":  false,
+		"a,b\n1,2":       true,
+		"a,b\r\n1,2\r\n": true,
+		"\n\na,b\n1,2\n": true,
+	}
+	for csv, want := range tests {
+		if got := hasRows(csv); got != want {
+			t.Errorf("hasRows(%q) is %v", csv, got)
+		}
+	}
+}
+
+func TestDownloadNoData(t *testing.T) {
+	srv, c := newTestInstance(t)
+	// a real report can say there is no data either way
+	noDataPage := srv.Public.AddReport("Empty", "")
+	noDataPage.NoData = true
+	noDataPage.Columns = []cognostest.Column{{Name: "Student ID", DataType: "integer"}}
+	headerOnly := srv.Public.AddReport("Header", "Student ID,Name\n")
+
+	for _, report := range []*cognostest.Report{noDataPage, headerOnly} {
+		csv, info := c.DownloadReportCSVWithInfo(report.ID)
+		if csv != report.CSV || !info.NoData {
+			t.Errorf("%s: got %q, NoData %v", report.Name, csv, info.NoData)
+		}
+
+		var output bytes.Buffer
+		run := c.StartReport(report.ID)
+		if n := run.WaitTo(&output); n != int64(len(report.CSV)) || !run.Info().NoData {
+			t.Errorf("%s: WaitTo wrote %d bytes, NoData %v", report.Name, n, run.Info().NoData)
+		}
+
+		err := catch(func() {
+			c.DownloadReportCSVWithOptions(report.ID, DownloadOptions{FailOnNoData: true, BypassCache: true})
+		})
+		if !errors.Is(err, ErrNoData) {
+			t.Errorf("%s: FailOnNoData got %v", report.Name, err)
+		}
+	}
+
+	// the columns come from the metadata when there isn't even a header
+	table := c.DownloadReportTable(noDataPage.ID)
+	if !table.NoData || len(table.Rows) != 0 || len(table.Columns) != 1 || table.Columns[0].DataType != "integer" {
+		t.Errorf("got %+v", table)
+	}
+	if table := c.DownloadReportTable(headerOnly.ID); !table.NoData || len(table.Columns) != 2 {
+		t.Errorf("got %+v", table)
+	}
+}
+
+func TestWaitWithRowLimit(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "id\n1\n2\n3\n4\n")
+	var done []RunInfo
+	c.Hooks.ReportDone = func(info RunInfo) {
+		done = append(done, info)
+	}
+
+	for _, ignore := range []bool{false, true} {
+		report.IgnoreRowLimit = ignore
+		done = nil
+		run := c.startReportWithOptions(context.Background(), report.ID, DownloadOptions{Format: "CSV", RowLimit: 2})
+		if csv := run.Wait(); csv != "id\n1\n2\n" {
+			t.Errorf("IgnoreRowLimit %v: got %q", ignore, csv)
+		}
+		want := map[bool]string{false: "server", true: "client"}[ignore]
+		if len(done) != 1 || done[0].RowLimitedBy != want {
+			t.Errorf("IgnoreRowLimit %v: ReportDone got %+v, want one call limited by %s", ignore, done, want)
+		}
+	}
+}
+
+func TestDownloadRate(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Big", "id\n"+strings.Repeat("0123456789\n", 300))
+	c.DownloadRate = 10000
+
+	var info RunInfo
+	c.Hooks.ReportDone = func(i RunInfo) {
+		info = i
+	}
+	start := time.Now()
+	csv := c.DownloadReportCSV(report.ID)
+	took := time.Since(start)
+	if csv != report.CSV {
+		t.Fatalf("got %d bytes, want %d", len(csv), len(report.CSV))
+	}
+	// 3303 bytes at 10000 a second
+	if took < 300*time.Millisecond {
+		t.Errorf("the download took %v, which is faster than DownloadRate allows", took)
+	}
+	if throughput := info.Throughput(); throughput > 11000 {
+		t.Errorf("the hook says it went %.0f bytes a second", throughput)
+	}
+
+	// the limit can be changed for one download
+	start = time.Now()
+	c.DownloadReportCSVWithOptions(report.ID, DownloadOptions{DownloadRate: 1 << 30, BypassCache: true})
+	if took := time.Since(start); took > 200*time.Millisecond {
+		t.Errorf("the download took %v without a real limit", took)
+	}
+}
+
+// downloadAtOnce downloads the report with each instance at the same time,
+// and returns what each one got
+func downloadAtOnce(instances []*CognosInstance, id string, opts DownloadOptions) (outputs []string, errs []error) {
+	outputs = make([]string, len(instances))
+	errs = make([]error, len(instances))
+	var wg sync.WaitGroup
+	for i, c := range instances {
+		wg.Add(1)
+		go func(i int, c *CognosInstance) {
+			defer wg.Done()
+			errs[i] = catch(func() {
+				outputs[i] = c.DownloadReportCSVWithOptions(id, opts)
+			})
+		}(i, c)
+	}
+	wg.Wait()
+	return outputs, errs
+}
+
+func TestSharedRuns(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.CSVFor = map[string]string{"other": "a\n2\n"}
+	report.Polls = 2
+	srv.AllowRunAs = true
+	// every run has to overlap with the others
+	srv.Delay = 50 * time.Millisecond
+
+	same := []*CognosInstance{c, c, c, c}
+	outputs, errs := downloadAtOnce(same, report.ID, DownloadOptions{})
+	for i := range same {
+		if errs[i] != nil || outputs[i] != report.CSV {
+			t.Errorf("download %d got %q: %v", i, outputs[i], errs[i])
+		}
+	}
+	if n := countRequests(srv, isRun); n != 1 {
+		t.Errorf("the report was run %d times, want 1", n)
+	}
+
+	// runs as someone else have diffrent output, so they can't share
+	srv.ResetRequests()
+	outputs, _ = downloadAtOnce([]*CognosInstance{c, c.RunAs("other")}, report.ID, DownloadOptions{})
+	if n := countRequests(srv, isRun); n != 2 || outputs[1] != "a\n2\n" {
+		t.Errorf("the report was run %d times, and the other user got %q", n, outputs[1])
+	}
+
+	srv.ResetRequests()
+	downloadAtOnce(same, report.ID, DownloadOptions{Independent: true})
+	if n := countRequests(srv, isRun); n != 4 {
+		t.Errorf("independent downloads ran the report %d times, want 4", n)
+	}
+
+	// everyone gets the error
+	report.Broken = true
+	srv.ResetRequests()
+	_, errs = downloadAtOnce(same, report.ID, DownloadOptions{})
+	for i := range same {
+		if !errors.Is(errs[i], ErrReportFailed) {
+			t.Errorf("download %d got %v", i, errs[i])
+		}
+	}
+	if n := countRequests(srv, isRun); n != 1 {
+		t.Errorf("the broken report was run %d times, want 1", n)
+	}
+}
+
+// isOutput returns true for a request that downloads a report output
+func isOutput(r cognostest.Request) bool {
+	return strings.HasPrefix(r.URL, "/cognostest/output/")
+}
+
+func TestShortDownloads(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "id,name\n1,Ann\n2,Bob\n3,Cy\n")
+
+	// the retry gets all of it
+	report.ShortDownloads = 1
+	run := c.StartReport(report.ID)
+	if csv := run.Wait(); csv != report.CSV {
+		t.Errorf("got %q", csv)
+	}
+	info := run.Info()
+	if info.SHA256 != sha256Hex(report.CSV) || !info.LengthChecked || info.Bytes != int64(len(report.CSV)) {
+		t.Errorf("got %+v", info)
+	}
+	if n := countRequests(srv, isOutput); n != 2 {
+		t.Errorf("downloaded %d times, want 2", n)
+	}
+
+	// every retry is short too
+	c.RetryCount = 1
+	report.ShortDownloads = 2
+	_, err := c.DownloadReportCSVE(report.ID)
+	if !errors.Is(err, ErrShortDownload) {
+		t.Errorf("got %v, want ErrShortDownload", err)
+	}
+}
+
+func TestShortDownloadTo(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "id,name\n1,Ann\n2,Bob\n3,Cy\n")
+
+	// what was written to a buffer can't be taken back
+	report.ShortDownloads = 1
+	var output bytes.Buffer
+	err := catch(func() { c.StartReport(report.ID).WaitTo(&output) })
+	if !errors.Is(err, ErrShortDownload) || countRequests(srv, isOutput) != 1 {
+		t.Errorf("got %v after %d downloads, want ErrShortDownload after 1", err, countRequests(srv, isOutput))
+	}
+
+	// but a file can start over
+	report.ShortDownloads = 1
+	file, err := os.Create(filepath.Join(t.TempDir(), "roster.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	run := c.StartReport(report.ID)
+	if n := run.WaitTo(file); n != int64(len(report.CSV)) {
+		t.Errorf("wrote %d bytes, want %d", n, len(report.CSV))
+	}
+	if written, _ := os.ReadFile(file.Name()); string(written) != report.CSV {
+		t.Errorf("the file has %q", written)
+	}
+	if run.Info().SHA256 != sha256Hex(report.CSV) {
+		t.Error("the SHA-256 includes the part that was thrown away")
+	}
+}
+
+func TestCheckLength(t *testing.T) {
+	tests := []struct {
+		contentLength int64
+		read          int64
+		err           error
+		short         bool
+	}{
+		{10, 10, nil, false},
+		{-1, 7, nil, false},
+		{10, 5, nil, true},
+		{10, 12, nil, true},
+		{10, 10, io.ErrUnexpectedEOF, true},
+	}
+	for _, test := range tests {
+		resp := &http.Response{ContentLength: test.contentLength}
+		err := catch(func() { checkLength(resp, test.read, test.err) })
+		if errors.Is(err, ErrShortDownload) != test.short {
+			t.Errorf("read %d of %d (%v): got %v", test.read, test.contentLength, test.err, err)
+		}
+	}
+	if err := catch(func() { checkLength(&http.Response{ContentLength: -1}, 3, errors.New("reset")) }); err == nil {
+		t.Error("a read error was ignored")
+	}
+}
+
+func TestSpanishViewer(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.Language = "es"
+	report := srv.Public.AddReport("Roster", "id,name\n1,Ann\n")
+	report.Polls = 2
+	empty := srv.Public.AddReport("Empty", "")
+	empty.NoData = true
+	empty.Polls = 1
+
+	// we pin the viewer to English, so the gateway's default dosen't matter
+	if csv := c.DownloadReportCSV(report.ID); csv != report.CSV {
+		t.Errorf("got %q", csv)
+	}
+	for _, r := range srv.Requests() {
+		if (isRun(r) || isWait(r)) && r.Header.Get("Accept-Language") != "en" {
+			t.Errorf("%s asked for %q", r.URL, r.Header.Get("Accept-Language"))
+		}
+	}
+
+	// and if we ask for Spanish, we still know when it is done
+	c.Language = "es"
+	srv.ResetRequests()
+	run := c.StartReport(report.ID)
+	if csv := run.Wait(); csv != report.CSV {
+		t.Errorf("in Spanish got %q", csv)
+	}
+	if n := countRequests(srv, isWait); n != 2 {
+		t.Errorf("polled %d times, want 2", n)
+	}
+	_, info := c.DownloadReportCSVWithInfo(empty.ID)
+	if !info.NoData {
+		t.Error("the Spanish no data page wasn't noticed")
+	}
+}
+
+// workingViewerPage is what the viewer answers with while a report runs
+const workingViewerPage = `<html><body><script>
+var oCV = {"m_sStatus": "working", "b_action": "cognosViewer", "m_sActionState": "state-1",
+"cv.id": "_NS_", "cv.objectPermissions": "read execute traverse", "m_sParameters": "",
+"m_sTracking": "tracking-1", "m_sCAFContext": "caf-1", "m_sConversation": "conv-1",
+"ui.object": "i123", "ui.objectClass": "report", "ui.primaryAction": "run"};
+</script></body></html>`
+
+func TestParseViewerResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		page         string
+		status       ViewerStatus
+		conversation string
+		downloadURL  string
+		err          bool
+	}{
+		{"working", workingViewerPage, ViewerWorking, "conv-1", "", false},
+		{"finished", `<script>var sURL = '/ibmcognos/cgi-bin/cognos.cgi/output/conv-1';</script>`,
+			ViewerFinished, "", "/ibmcognos/cgi-bin/cognos.cgi/output/conv-1", false},
+		{"prompting", `<script>var oCV = {"m_sStatus": "prompting"};</script>`, ViewerPrompting, "", "", false},
+		{"no data", `<span class="textItem">No Data Available</span>`, ViewerNoData, "", "", false},
+		{"fault", rsvFaultPage, ViewerFailed, "", "", true},
+		{"empty page", "", ViewerFailed, "", "", true},
+		// working, but missing what we need to check on it
+		{"broken working page", `<script>var oCV = {"m_sStatus": "working"};</script>`, ViewerFailed, "", "", true},
+	}
+	for _, test := range tests {
+		status, state, downloadURL, err := ParseViewerResponse(test.page)
+		if status != test.status || state.Conversation != test.conversation ||
+			downloadURL != test.downloadURL || (err != nil) != test.err {
+			t.Errorf("%s: got %v, %+v, %q, %v", test.name, status, state, downloadURL, err)
+		}
+		if !state.StartedAt.IsZero() {
+			t.Errorf("%s: StartedAt is %v, it isn't on the page", test.name, state.StartedAt)
+		}
+	}
+
+	// a fault is given back as the *Fault
+	_, _, _, err := ParseViewerResponse(rsvFaultPage)
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Code != "RSV-SRV-0042" {
+		t.Errorf("got %#v, want the fault", err)
+	}
+}
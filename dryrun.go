@@ -0,0 +1,108 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrDryRun means a request wasn't sent because the instance is doing a
+// dry run (see WithDryRun). Whatever asked for it didn't get real data.
+var ErrDryRun = errors.New("dry run: the request was not sent")
+
+// DryRunRequest is a request that would have been sent if the instance
+// wasn't doing a dry run. It is also an error (wrapping ErrDryRun), which
+// is what is panicked with instead of sending it.
+type DryRunRequest struct {
+	Method string `json:"method"`
+	// URL is the full URL, with the password scrubbed out
+	URL string `json:"url"`
+	// Header has the headers we would send. Authorization is redacted.
+	Header http.Header `json:"header"`
+	// Body is the encoded request body (ex: form data), with the password
+	// scrubbed out
+	Body string `json:"body"`
+}
+
+func (r *DryRunRequest) Error() string {
+	return fmt.Sprintf("%v: %s %s", ErrDryRun, r.Method, r.URL)
+}
+
+func (r *DryRunRequest) Unwrap() error {
+	return ErrDryRun
+}
+
+// dryRunState remembers the first request of a dry run. It is shared
+// between a dry run instance and any instances derived from it.
+type dryRunState struct {
+	lock  sync.Mutex
+	first *DryRunRequest
+}
+
+// WithDryRun returns a copy of c that never sends anything. Instead, the
+// first request anything would make panics with a *DryRunRequest (which
+// wraps ErrDryRun), so nothing ever gets a result it could mistake for
+// real data. Answers we already have cached (ex: folder listings) are
+// still used, since they don't need a request.
+func (c *CognosInstance) WithDryRun() *CognosInstance {
+	derived := *c
+	derived.dryRun = &dryRunState{}
+	return &derived
+}
+
+// DryRun calls f with a dry run copy of c (see WithDryRun), and returns the
+// first request f would have made (ex: for DownloadReportCSV, the request
+// that starts the report), without making it. If f dosen't make any
+// requests, it returns nil. If f panics with something that isn't from the
+// dry run, that is returned as the error.
+func (c *CognosInstance) DryRun(f func(dry *CognosInstance)) (*DryRunRequest, error) {
+	dry := c.WithDryRun()
+	err := catch(func() {
+		f(dry)
+	})
+
+	dry.dryRun.lock.Lock()
+	first := dry.dryRun.first
+	dry.dryRun.lock.Unlock()
+	if err != nil && !errors.Is(err, ErrDryRun) {
+		return first, err
+	}
+	return first, nil
+}
+
+// dryRunRequest describes the request send would make for link, and
+// remembers it if it is the first one
+func (c *CognosInstance) dryRunRequest(method string, link string, reqBody string, headers http.Header) *DryRunRequest {
+	fullURL := c.URL + link
+	if c.viaDispatcher(link) {
+		fullURL = strings.TrimSuffix(c.DispatcherURL, "/") + dispatchPath + strings.TrimPrefix(link, gatewayPath)
+	} else {
+		// the gateway gets basic (NTLM) auth
+		headers = headers.Clone()
+		if headers == nil {
+			headers = make(http.Header)
+		}
+		headers.Set("Authorization", "Basic "+redacted)
+	}
+	req := withXSRFToken(context.Background(), method, fullURL, reqBody, headers, c.xsrfToken(fullURL))
+	if req.Body != nil {
+		// the XSRF token might have been added to it
+		reqBody = readAll(req.Body)
+	}
+
+	dryReq := &DryRunRequest{
+		Method: method,
+		URL:    c.scrub(fullURL),
+		Header: req.Header,
+		Body:   c.scrub(reqBody),
+	}
+	c.dryRun.lock.Lock()
+	if c.dryRun.first == nil {
+		c.dryRun.first = dryReq
+	}
+	c.dryRun.lock.Unlock()
+	return dryReq
+}
@@ -0,0 +1,85 @@
+package cognos
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestDryRun(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.ResetRequests()
+
+	req, err := c.DryRun(func(dry *CognosInstance) {
+		dry.LsFolder(srv.Public.ID)
+		t.Error("LsFolder returned during a dry run")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "GET" || req.URL != srv.URL+folderLinkFromID(srv.Public.ID) || req.Body != "" {
+		t.Errorf("got %+v", req)
+	}
+	if req.Header.Get("Authorization") != "Basic "+redacted {
+		t.Errorf("Authorization is %q", req.Header.Get("Authorization"))
+	}
+	if !errors.Is(req, ErrDryRun) {
+		t.Error("a DryRunRequest isn't ErrDryRun")
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("sent %d requests", n)
+	}
+}
+
+func TestDryRunPost(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.XSRF = true
+	c.DispatcherURL = srv.URL
+	// a real request gets us an XSRF token
+	c.LsFolder(srv.Public.ID)
+	srv.ResetRequests()
+
+	req, err := c.DryRun(func(dry *CognosInstance) {
+		dry.CreateFolder(srv.Public.ID, "New & Improved")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "POST" || req.URL != srv.URL+dispatchPath {
+		t.Errorf("got %s %s", req.Method, req.URL)
+	}
+	// the dispatcher uses a passport, not basic auth
+	if req.Header.Get("Authorization") != "" || req.Header.Get("X-XSRF-TOKEN") == "" {
+		t.Errorf("got headers %v", req.Header)
+	}
+	form, err := url.ParseQuery(req.Body)
+	if err != nil || form.Get("m_folder") != srv.Public.ID || form.Get("m_name") != "New & Improved" {
+		t.Errorf("got body %q", req.Body)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("sent %d requests", n)
+	}
+}
+
+func TestDryRunCached(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.ListingTTL = 60
+	srv.Public.AddReport("Roster", "a\n1\n")
+	c.LsFolder(srv.Public.ID)
+
+	// the cached listing dosen't need a request
+	var listing map[string]FolderEntry
+	req, err := c.DryRun(func(dry *CognosInstance) {
+		listing = dry.LsFolder(srv.Public.ID)
+	})
+	if req != nil || err != nil || len(listing) != 1 {
+		t.Errorf("got %+v, %v, %v", req, err, listing)
+	}
+
+	// anything else that goes wrong is still returned
+	boom := errors.New("boom")
+	_, err = c.DryRun(func(dry *CognosInstance) { panic(boom) })
+	if !errors.Is(err, boom) {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package cognos
+
+import "sync"
+
+// EntryParser works out what a link in a folder listing points to (ex: a
+// link in a custom column of a customized portal). linkText is the name
+// of the entry, and href is the link. It returns false if it dosen't know.
+// If the entry it returns has no Name, linkText is used.
+type EntryParser func(linkText, href string) (FolderEntry, bool)
+
+// entryParsers are the parsers added with RegisterEntryParser
+var entryParsers struct {
+	lock    sync.RWMutex
+	parsers []EntryParser
+}
+
+// RegisterEntryParser teaches LsFolder (and ParseFolderListing) about links
+// it dosen't understand on its own. The built in folder and report parsers
+// always go first, then the registered ones, in the order they were
+// registered. It affects every instance, so call it before you start
+// listing folders (ex: in an init function). It is safe to call from many
+// goroutines at once.
+func RegisterEntryParser(parser EntryParser) {
+	entryParsers.lock.Lock()
+	defer entryParsers.lock.Unlock()
+	entryParsers.parsers = append(entryParsers.parsers, parser)
+}
+
+// parseOtherEntry tries the registered parsers on a link the built in ones
+// couldn't work out
+func parseOtherEntry(linkText, href string) (FolderEntry, bool) {
+	entryParsers.lock.RLock()
+	defer entryParsers.lock.RUnlock()
+	for _, parser := range entryParsers.parsers {
+		if entry, ok := parser(linkText, href); ok {
+			if entry.Name == "" {
+				entry.Name = linkText
+			}
+			return entry, true
+		}
+	}
+	return FolderEntry{}, false
+}
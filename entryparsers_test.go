@@ -0,0 +1,52 @@
+package cognos
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// queryStudioLink is a link to open a report in Query Studio, which the
+// built in parsers don't know about
+const queryStudioLink = "/ibmcognos/cgi-bin/cognos.cgi?b_action=xts.run&m=portal/launch.xts&ui.tool=QueryStudio&ui.object="
+
+func init() {
+	RegisterEntryParser(func(linkText, href string) (FolderEntry, bool) {
+		if !strings.HasPrefix(href, queryStudioLink) {
+			return FolderEntry{}, false
+		}
+		id, err := url.QueryUnescape(strings.TrimPrefix(href, queryStudioLink))
+		if err != nil {
+			return FolderEntry{}, false
+		}
+		return FolderEntry{Type: Report, ID: id}, true
+	})
+}
+
+func TestEntryParsers(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.Public.AddReport("Roster", "a\n1\n")
+	srv.Public.Links = []cognostest.Link{
+		{Name: "Ad Hoc", Href: queryStudioLink + "i0123"},
+		{Name: "Help", Href: "https://example.com/help"},
+	}
+
+	listing := c.LsFolder(srv.Public.ID)
+	if len(listing) != 3 || listing["Roster"].Type != Report {
+		t.Errorf("got %+v", listing)
+	}
+	if entry := listing["Ad Hoc"]; entry != (FolderEntry{Name: "Ad Hoc", Type: Report, ID: "i0123"}) {
+		t.Errorf("the registered parser gave %+v", entry)
+	}
+	if entry := listing["Help"]; entry.Type != Other || entry.Href != "https://example.com/help" || entry.ID != "" {
+		t.Errorf("the unknown link gave %+v", entry)
+	}
+
+	strict := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 4)
+	strict.StrictListings = true
+	if _, err := strict.LsFolderE(srv.Public.ID); err == nil || !strings.Contains(err.Error(), "Help") {
+		t.Errorf("a strict listing got %v", err)
+	}
+}
@@ -0,0 +1,357 @@
+package cognos
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CollisionStrategy says what ExportFolder does when two entries in a
+// folder end up with the same file name after sanitizing
+type CollisionStrategy uint
+
+const (
+	// RenameOnCollision adds " (2)", " (3)", etc to the file name
+	RenameOnCollision CollisionStrategy = iota
+	// SkipOnCollision only exports the first entry with a given file name
+	SkipOnCollision CollisionStrategy = iota
+	// FailOnCollision records an error for the second entry
+	FailOnCollision CollisionStrategy = iota
+)
+
+// ExportOptions controls ExportFolder. The zero value exports every report.
+type ExportOptions struct {
+	// Include decides which entries are exported. Returning false for a
+	// folder skips everything in it. If Include is nil, everything is included.
+	Include func(path []string, entry FolderEntry) bool
+	// SkipExisting skips reports whose file already exists
+	SkipExisting bool
+	// OnCollision defaults to RenameOnCollision
+	OnCollision CollisionStrategy
+	// Progress is called after each report is exported, skipped, or fails.
+	// It may be called from several goroutines at once.
+	Progress func(ExportResult)
+}
+
+// ExportResult is what happened to one report (or folder) in an export
+type ExportResult struct {
+	// Path is relative to the folder being exported
+	Path     []string `json:"path"`
+	ReportID string   `json:"reportId,omitempty"`
+	// File is where the CSV was (or would have been) written
+	File    string `json:"file,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Err     error  `json:"-"`
+}
+
+// ExportManifest lists what happened to every report in an export
+type ExportManifest struct {
+	Results []ExportResult `json:"results"`
+}
+
+// Failed returns the results that have an error
+func (m ExportManifest) Failed() []ExportResult {
+	var failed []ExportResult
+	for _, result := range m.Results {
+		if result.Err != nil {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// windowsReservedName matches file names windows won't let you use
+var windowsReservedName = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9]|lpt[0-9])(\..*)?$`)
+
+// SanitizeFileName turns a folder or report name into something that is
+// safe to use as a file name on windows, mac, and linux. It is what
+// ExportFolder names files with (before the extension is added).
+func SanitizeFileName(name string) string {
+	name = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f]`).ReplaceAllString(name, "_")
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		name = "_"
+	}
+	if windowsReservedName.MatchString(name) {
+		name = "_" + name
+	}
+	return name
+}
+
+// nameClaims keeps track of which file names have been used in each
+// directory. Names are compared without case, since some file systems
+// don't care about case.
+type nameClaims map[string]map[string]bool
+
+// claim returns the name to use for base+ext in dir, following strategy.
+// ok is false if the entry should not be exported.
+func (claims nameClaims) claim(dir, base, ext string, strategy CollisionStrategy) (name string, ok bool, err error) {
+	if claims[dir] == nil {
+		claims[dir] = make(map[string]bool)
+	}
+	used := claims[dir]
+
+	name = base + ext
+	if !used[strings.ToLower(name)] {
+		used[strings.ToLower(name)] = true
+		return name, true, nil
+	}
+
+	switch strategy {
+	case SkipOnCollision:
+		return name, false, nil
+	case FailOnCollision:
+		return name, false, fmt.Errorf("%s collides with another entry in the same folder", name)
+	default:
+		for i := 2; ; i++ {
+			name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+			if !used[strings.ToLower(name)] {
+				used[strings.ToLower(name)] = true
+				return name, true, nil
+			}
+		}
+	}
+}
+
+// writeFileAtomic writes data to a temp file and then renames it, so a
+// failed download never leaves a partial file behind
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".cognos-export-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// ExportFolder downloads every report under the folder with the given id
+// (including subfolders) as CSV into destDir. The folder structure is
+// mirrored with directories, and names are sanitized to be safe file
+// names. Reports are downloaded concurrently, limited by the instance's
+// concurrentRequests. A failed report or folder dosen't stop the export;
+// it is recorded in the returned manifest instead.
+func (c *CognosInstance) ExportFolder(id string, destDir string, opts ExportOptions) ExportManifest {
+	var manifest ExportManifest
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	record := func(result ExportResult) {
+		lock.Lock()
+		manifest.Results = append(manifest.Results, result)
+		lock.Unlock()
+		if opts.Progress != nil {
+			opts.Progress(result)
+		}
+	}
+
+	// the directory each folder was exported to, keyed by its path
+	dirs := map[string]string{"": destDir}
+	claims := make(nameClaims)
+
+	c.WalkFolder(id, func(path []string, entry FolderEntry, err error) error {
+		if err != nil {
+			record(ExportResult{Path: path, Err: err})
+			return nil
+		}
+		if len(path) == 0 {
+			// the folder being exported
+			err = os.MkdirAll(destDir, 0755)
+			if err != nil {
+				record(ExportResult{Err: err})
+				return SkipFolder
+			}
+			return nil
+		}
+		if opts.Include != nil && !opts.Include(path, entry) {
+			if entry.Type == Folder {
+				return SkipFolder
+			}
+			return nil
+		}
+
+		// folders are visited before their contents, so the parent's
+		// directory is always known by now
+		parentDir := dirs[strings.Join(path[:len(path)-1], "\x00")]
+		name := path[len(path)-1]
+
+		if entry.Type == Folder {
+			dirName, ok, err := claims.claim(parentDir, SanitizeFileName(name), "", opts.OnCollision)
+			if err != nil {
+				record(ExportResult{Path: path, Err: err})
+			}
+			if !ok {
+				return SkipFolder
+			}
+			dir := filepath.Join(parentDir, dirName)
+			err = os.MkdirAll(dir, 0755)
+			if err != nil {
+				record(ExportResult{Path: path, Err: err})
+				return SkipFolder
+			}
+			dirs[strings.Join(path, "\x00")] = dir
+			return nil
+		}
+
+		if entry.Type != Report {
+			// jobs don't have output of their own
+			return nil
+		}
+
+		result := ExportResult{Path: path, ReportID: entry.ID}
+		fileName, ok, err := claims.claim(parentDir, SanitizeFileName(name), ".csv", opts.OnCollision)
+		result.File = filepath.Join(parentDir, fileName)
+		if err != nil || !ok {
+			result.Err = err
+			result.Skipped = err == nil
+			record(result)
+			return nil
+		}
+		if opts.SkipExisting {
+			if _, statErr := os.Stat(result.File); statErr == nil {
+				result.Skipped = true
+				record(result)
+				return nil
+			}
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result.Err = catch(func() {
+				csv := c.DownloadReportCSV(result.ReportID)
+				err := writeFileAtomic(result.File, []byte(csv))
+				if err != nil {
+					panic(err)
+				}
+			})
+			record(result)
+		}()
+		return nil
+	})
+	wg.Wait()
+
+	// downloads finish in any order, so sort by path
+	sort.Slice(manifest.Results, func(i, j int) bool {
+		return strings.Join(manifest.Results[i].Path, "\x00") < strings.Join(manifest.Results[j].Path, "\x00")
+	})
+	return manifest
+}
+
+// zipEntryName sanitizes each part of a file name for a zip archive,
+// keeping any / as a directory seperator
+func zipEntryName(name string) string {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	for i, part := range parts {
+		parts[i] = SanitizeFileName(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+// ExportZip runs reports and writes their output into a zip archive on w.
+// entries maps file names in the archive (ex: "attendance/daily.csv") to
+// report IDs. Names are sanitized, and if two come out the same the
+// second one is renamed. The reports are all started at once (limited by
+// the instance's concurrentRequests), then each one is streamed straight
+// into the archive, in order by file name, so the outputs are never all in
+// memory at once. A report that fails is recorded in the returned manifest
+// and left out of the archive. err is only set if the archive itself
+// couldn't be written, in which case it is probably broken.
+func (c *CognosInstance) ExportZip(entries map[string]string, w io.Writer) (manifest ExportManifest, err error) {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// start every report, and keep track of when each one is done
+	type pendingRun struct {
+		result ExportResult
+		run    *ReportRun
+		err    error
+		done   chan struct{}
+	}
+	claims := make(nameClaims)
+	pending := make([]*pendingRun, 0, len(names))
+	for _, name := range names {
+		p := &pendingRun{
+			result: ExportResult{Path: []string{name}, ReportID: entries[name]},
+			done:   make(chan struct{}),
+		}
+		pending = append(pending, p)
+
+		clean := zipEntryName(name)
+		dir, file := path.Split(clean)
+		ext := path.Ext(file)
+		p.result.File, _, _ = claims.claim(dir, strings.TrimSuffix(file, ext), ext, RenameOnCollision)
+		p.result.File = dir + p.result.File
+
+		go func() {
+			defer close(p.done)
+			p.err = catch(func() {
+				p.run = c.StartReport(p.result.ReportID)
+				// this waits for the report without downloading it
+				p.run.waitDone()
+			})
+		}()
+	}
+
+	zipWriter := zip.NewWriter(w)
+	for i, p := range pending {
+		<-p.done
+		if p.err != nil {
+			if p.run != nil {
+				p.run.finish()
+			}
+			p.result.Err = p.err
+			manifest.Results = append(manifest.Results, p.result)
+			continue
+		}
+
+		var entryWriter io.Writer
+		entryWriter, err = zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     p.result.File,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			// the rest are still running (or done and waiting for us), so
+			// Close would wait on them forever. Their output is never
+			// going to be downloaded, so the server can let it go.
+			for _, p := range pending[i:] {
+				<-p.done
+				if p.run == nil {
+					continue
+				}
+				if p.err == nil && p.run.State.Conversation != "" {
+					catch(func() {
+						c.releaseConversation(p.run.context(), p.run.State.Conversation)
+					})
+				}
+				p.run.finish()
+			}
+			return manifest, err
+		}
+		p.result.Err = catch(func() {
+			p.run.WaitTo(entryWriter)
+		})
+		manifest.Results = append(manifest.Results, p.result)
+	}
+	return manifest, zipWriter.Close()
+}
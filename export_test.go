@@ -0,0 +1,106 @@
+package cognos
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+func TestExportZip(t *testing.T) {
+	srv, c := newTestInstance(t)
+	daily := srv.Public.AddReport("Daily", "a\n1\n")
+	weekly := srv.Public.AddReport("Weekly", "a\n7\n")
+	broken := srv.Public.AddReport("Broken", "a\n1\n")
+	broken.Broken = true
+
+	var archive bytes.Buffer
+	manifest, err := c.ExportZip(map[string]string{
+		"attendance/Daily.csv":  daily.ID,
+		"attendance/daily.csv":  weekly.ID,
+		"attendance/con?.csv":   broken.ID,
+		"/grades/<weekly>.csv/": weekly.ID,
+	}, &archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed := manifest.Failed(); len(failed) != 1 || failed[0].ReportID != broken.ID {
+		t.Errorf("got failures %+v, want just the broken report", failed)
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(archive.Bytes()), int64(archive.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, file := range zipReader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents, _ := ioutil.ReadAll(f)
+		f.Close()
+		files[file.Name] = string(contents)
+	}
+	want := map[string]string{
+		"attendance/Daily.csv":     daily.CSV,
+		"attendance/daily (2).csv": weekly.CSV,
+		"grades/_weekly_.csv":      weekly.CSV,
+	}
+	if fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// isCancel returns true for a request that releases a conversation
+func isCancel(r cognostest.Request) bool {
+	return r.Form.Get("b_action") == "cognosViewer" && r.Form.Get("ui.action") == "cancel"
+}
+
+func TestExportZipWriteFails(t *testing.T) {
+	srv, c := newTestInstance(t)
+	entries := make(map[string]string)
+	for i := 0; i < 4; i++ {
+		// enough output that it can't all sit in the zip writer's buffer
+		var csv strings.Builder
+		csv.WriteString("hash\n")
+		for row := 0; row < 500; row++ {
+			fmt.Fprintf(&csv, "%x\n", sha256.Sum256([]byte(fmt.Sprint(i, row))))
+		}
+		report := srv.Public.AddReport(fmt.Sprintf("Report %d", i), csv.String())
+		report.Polls = 2
+		entries[fmt.Sprintf("report %d.csv", i)] = report.ID
+	}
+
+	_, err := c.ExportZip(entries, failingWriter{})
+	if err == nil {
+		t.Fatal("writing to a broken writer worked")
+	}
+	// the first report failed to write, and the second one couldn't be
+	// started in the archive, so that one and the rest were let go
+	if n := countRequests(srv, isCancel); n != 3 {
+		t.Errorf("released %d conversations, want 3", n)
+	}
+
+	// nothing should still be counted as running
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.Close(ctx); err != nil {
+		t.Errorf("Close got %v", err)
+	}
+}
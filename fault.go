@@ -0,0 +1,120 @@
+package cognos
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Fault is an error reported by Cognos itself, parsed from one of its
+// fault pages (ex: RSV-SRV-0042 or CM-REQ-4159 errors).
+type Fault struct {
+	// Code is the Cognos error code (ex: RSV-SRV-0042). It may be empty
+	// if the fault didn't have one.
+	Code string `json:"code"`
+	// Message is the user-facing error message
+	Message string `json:"message"`
+	// Detail is any extra information (often a stack of nested errors)
+	Detail string `json:"detail,omitempty"`
+}
+
+// maxFaultPage is how much of an error response we read looking for a fault
+const maxFaultPage = 64 * 1024
+
+// maxFaultDetail is how much of the detail is included in Error()
+const maxFaultDetail = 500
+
+func (f *Fault) Error() string {
+	s := strings.TrimSpace(f.Code + " " + f.Message)
+	if f.Detail != "" {
+		detail := f.Detail
+		if len(detail) > maxFaultDetail {
+			detail = detail[:maxFaultDetail] + "..."
+		}
+		s += " (" + detail + ")"
+	}
+	return s
+}
+
+// faultCodePattern matches Cognos error codes like RSV-SRV-0042
+var faultCodePattern = regexp.MustCompile(`\b([A-Z]{2,4}-[A-Z]{2,4}-[0-9]{4})\b`)
+
+// parseFault tries to pull a Cognos fault out of a page. found is false if
+// the page dosen't look like a fault. It understands the HTML fault page
+// from the gateway and the soapenv fault the dispatcher sometimes returns.
+func parseFault(page string) (fault *Fault, found bool) {
+	if strings.Contains(page, ":Fault>") || strings.Contains(page, "<Fault>") {
+		return parseSOAPFault(page), true
+	}
+	if viewerStatus(page) == "fault" || faultCodePattern.MatchString(page) {
+		return parseHTMLFault(page)
+	}
+	return nil, false
+}
+
+// xmlText returns the unescaped text of every <tag>...</tag> in page,
+// ignoring namespace prefixes on the tag
+func xmlText(page, tag string) []string {
+	pattern := regexp.MustCompile(`(?s)<(?:[a-zA-Z0-9_-]+:)?` + regexp.QuoteMeta(tag) + `(?:\s[^>]*)?>(.*?)</(?:[a-zA-Z0-9_-]+:)?` + regexp.QuoteMeta(tag) + `>`)
+	var texts []string
+	for _, matchParts := range pattern.FindAllStringSubmatch(page, -1) {
+		text := regexp.MustCompile(`<[^>]*>`).ReplaceAllString(matchParts[1], " ")
+		texts = append(texts, strings.TrimSpace(html.UnescapeString(text)))
+	}
+	return texts
+}
+
+// parseSOAPFault parses a soapenv fault. The first messageString is the
+// message and the rest are the detail.
+func parseSOAPFault(page string) *Fault {
+	fault := &Fault{}
+	messages := xmlText(page, "messageString")
+	if len(messages) == 0 {
+		messages = xmlText(page, "faultstring")
+	}
+	if len(messages) > 0 {
+		fault.Message = messages[0]
+		fault.Detail = strings.Join(messages[1:], "\n")
+	}
+
+	if matchParts := faultCodePattern.FindStringSubmatch(fault.Message); len(matchParts) > 1 {
+		fault.Code = matchParts[1]
+		fault.Message = strings.TrimLeft(strings.TrimPrefix(fault.Message, fault.Code), " :-")
+	} else if codes := xmlText(page, "errorCode"); len(codes) > 0 {
+		fault.Code = codes[0]
+	}
+	return fault
+}
+
+// parseHTMLFault parses the HTML fault page. The line with the first error
+// code is the message, and the lines after it are the detail.
+func parseHTMLFault(page string) (fault *Fault, found bool) {
+	text := regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`).ReplaceAllString(page, "\n")
+	text = regexp.MustCompile(`<[^>]*>`).ReplaceAllString(text, "\n")
+	text = html.UnescapeString(text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	for i, line := range lines {
+		matchParts := faultCodePattern.FindStringSubmatch(line)
+		if len(matchParts) < 2 {
+			continue
+		}
+
+		fault = &Fault{Code: matchParts[1]}
+		fault.Message = strings.TrimLeft(line[strings.Index(line, fault.Code)+len(fault.Code):], " :-")
+		rest := lines[i+1:]
+		if fault.Message == "" && len(rest) > 0 {
+			fault.Message, rest = rest[0], rest[1:]
+		}
+		fault.Detail = strings.Join(rest, "\n")
+		return fault, true
+	}
+	return nil, false
+}
@@ -0,0 +1,69 @@
+package cognos
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// rsvFaultPage is the gateway's HTML fault page for a report that failed
+const rsvFaultPage = `<html><head><title>IBM Cognos Viewer - Error</title>
+<script>var oCV = {"m_sStatus": "fault"};</script></head><body>
+<table class="errorTable"><tr><td class="errorTitle">An error has occurred.</td></tr>
+<tr><td>RSV-SRV-0042 Trace back:</td></tr>
+<tr><td>RSReportService.cpp(758): QFException: CCLException</td></tr>
+<tr><td>UDA-SQL-0107 A general exception has occurred during the operation &quot;prepare&quot;.</td></tr>
+</table></body></html>`
+
+// cmFaultPage is the soapenv fault the dispatcher returns for a search
+// path that dosen't exist
+const cmFaultPage = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><SOAP-ENV:Body>
+<SOAP-ENV:Fault><faultcode>SOAP-ENV:Client</faultcode><faultstring>cmBadRequest</faultstring>
+<detail><bus:exception><bus:message>
+<bus:messageString>CM-REQ-4159 Content Manager returned an error in the response header.</bus:messageString>
+</bus:message><bus:message>
+<bus:messageString>CM-CFG-5036 Content Manager failed to find the object storeID(&quot;i123&quot;).</bus:messageString>
+</bus:message></bus:exception></detail>
+</SOAP-ENV:Fault></SOAP-ENV:Body></SOAP-ENV:Envelope>`
+
+func TestParseFault(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		code    string
+		message string
+		detail  string
+	}{
+		{"RSV-SRV", rsvFaultPage, "RSV-SRV-0042", "Trace back:", "UDA-SQL-0107"},
+		{"CM-REQ", cmFaultPage, "CM-REQ-4159", "Content Manager returned an error in the response header.", `storeID("i123")`},
+	}
+	for _, test := range tests {
+		fault, found := parseFault(test.page)
+		if !found {
+			t.Errorf("%s: no fault found", test.name)
+			continue
+		}
+		if fault.Code != test.code || fault.Message != test.message || !strings.Contains(fault.Detail, test.detail) {
+			t.Errorf("%s: got %+v", test.name, fault)
+		}
+	}
+
+	if _, found := parseFault("<html><body>IBM Cognos Connection</body></html>"); found {
+		t.Error("a normal page was a fault")
+	}
+}
+
+func TestFaultInRequestError(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.SetTransport(faultTransport(rsvFaultPage))
+
+	_, err := c.LsFolderE(srv.Public.ID)
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.Code != "RSV-SRV-0042" {
+		t.Fatalf("got %v, want the RSV-SRV-0042 fault", err)
+	}
+	if !strings.Contains(err.Error(), "RSV-SRV-0042 Trace back:") {
+		t.Errorf("the fault isn't in %q", err)
+	}
+}
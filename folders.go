@@ -0,0 +1,111 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+)
+
+// isAlreadyExists guesses if a fault means there is already something
+// with the name we tried to use. Like isConversationGone, we go by the
+// message.
+func isAlreadyExists(fault *Fault) bool {
+	text := strings.ToLower(fault.Message + " " + fault.Detail)
+	return strings.Contains(text, "already exists") ||
+		strings.Contains(text, "conflicts with an existing")
+}
+
+// CreateFolder makes a folder called name in the folder with the given
+// parentID and returns it. If there is already something called name in
+// the parent, it panics with an error that wraps fs.ErrExist. If we aren't
+// allowed to change the parent it panics with ErrPermissionDenied.
+func (c *CognosInstance) CreateFolder(parentID, name string) FolderEntry {
+	checkID(parentID)
+	values := make(url.Values)
+	values.Set("b_action", "xts.run")
+	values.Set("m", "portal/new_folder.xts")
+	values.Set("m_folder", parentID)
+	values.Set("m_name", name)
+
+	page := c.Request("POST", "/ibmcognos/cgi-bin/cognos.cgi", values.Encode())
+	// the parent has changed, even if this failed (ex: someone else made
+	// the folder first)
+	c.forgetListing(parentID)
+	entry := FolderEntry{Type: Folder, Name: name}
+	if !findJSVar(page, "g_PS_ObjectID", &entry.ID) {
+		if fault, found := parseFault(page); found {
+			if isAlreadyExists(fault) {
+				panic(fmt.Errorf("%s already exists: %w: %w", name, fs.ErrExist, fault))
+			}
+			if isPermissionDenied(fault) {
+				panic(fmt.Errorf("%w: %s: %w", ErrPermissionDenied, parentID, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when creating the folder %s: %w", name, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when creating the folder "+name))
+	}
+	return entry
+}
+
+// EnsureFolderPath is like mkdir -p. It makes every folder in path (see
+// FolderEntryFromPath) that dosen't exist yet, in order, and returns the
+// last one. Folders that already exist are fine, even if someone else
+// makes one while we are working. The root (path[0]) has to exist.
+// If it fails, it panics with an *OpError whose Path ends at the part of
+// the path that failed.
+func (c *CognosInstance) EnsureFolderPath(path []string) FolderEntry {
+	if len(path) == 0 {
+		panic(&OpError{Op: "EnsureFolderPath", Err: errors.New("Cannot make a folder for an empty path")})
+	}
+
+	var current FolderEntry
+	for i := range path {
+		segment := path[:i+1]
+		err := catch(func() {
+			if i == 0 {
+				current = c.FolderEntryFromPath(segment)
+			} else {
+				current = c.ensureFolder(current.ID, path[i])
+			}
+			if current.Type != Folder {
+				panic(fmt.Errorf("%s is not a folder", path[i]))
+			}
+		})
+		if err != nil {
+			var opErr *OpError
+			if errors.As(err, &opErr) {
+				// say what we were doing, not what failed inside it
+				err = opErr.Err
+			}
+			panic(&OpError{Op: "EnsureFolderPath", Path: segment, Err: err})
+		}
+		c.paths.put(c.cacheScope(), segment, current)
+	}
+	return current
+}
+
+// ensureFolder returns the entry called name in the folder with the given
+// parentID, making it if there isn't one
+func (c *CognosInstance) ensureFolder(parentID, name string) FolderEntry {
+	if entry, found := c.LsFolder(parentID)[name]; found {
+		return entry
+	}
+
+	var entry FolderEntry
+	err := catch(func() {
+		entry = c.CreateFolder(parentID, name)
+	})
+	if errors.Is(err, fs.ErrExist) {
+		// someone else made it after we looked. CreateFolder forgot the
+		// listing we had, so this sees theirs.
+		existing, found := c.LsFolder(parentID)[name]
+		if !found {
+			panic(fmt.Errorf("Cognos says %s already exists, but it isn't listed: %w", name, err))
+		}
+		return existing
+	}
+	panicOnErr(err)
+	return entry
+}
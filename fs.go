@@ -0,0 +1,216 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CognosFS is a read-only fs.FS of the Cognos folder tree. The root
+// directory contains "public" (public folders) and "~" (my folders).
+// Folders are directories and reports are files. Opening a report
+// dosen't do anything right away, but the first Read runs the report
+// (see DownloadReportCSV), which can take a long time. Reports are never
+// run by Stat or ReadDir. Modification times are not available, so they
+// are always the zero time, and the size of a report is 0 until it has
+// been read. Entries with a / in their name can't be reached.
+type CognosFS struct {
+	c *CognosInstance
+}
+
+// MakeFS returns an fs.FS for the folder tree c can see
+func MakeFS(c *CognosInstance) CognosFS {
+	return CognosFS{c: c}
+}
+
+// entryInfo is the fs.FileInfo and fs.DirEntry for a folder entry
+type entryInfo struct {
+	name  string
+	entry FolderEntry
+	size  int64
+}
+
+func (i entryInfo) Name() string               { return i.name }
+func (i entryInfo) Size() int64                { return i.size }
+func (i entryInfo) ModTime() time.Time         { return time.Time{} }
+func (i entryInfo) IsDir() bool                { return i.entry.Type == Folder }
+func (i entryInfo) Sys() interface{}           { return i.entry }
+func (i entryInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i entryInfo) Info() (fs.FileInfo, error) { return i, nil }
+func (i entryInfo) Mode() fs.FileMode {
+	if i.IsDir() {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// resolve finds the folder entry for an fs path. The root (".") is
+// returned as a folder with an empty ID.
+func (cfs CognosFS) resolve(op, name string) (entry FolderEntry, err error) {
+	if !fs.ValidPath(name) {
+		return entry, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return FolderEntry{Type: Folder}, nil
+	}
+
+	notFound := false
+	err = catch(func() {
+		parts := strings.Split(name, "/")
+		entry = cfs.c.rootEntry(context.Background(), parts[0])
+
+		for _, part := range parts[1:] {
+			if entry.Type != Folder {
+				notFound = true
+				return
+			}
+			var exists bool
+			entry, exists = cfs.c.LsFolder(entry.ID)[part]
+			if !exists {
+				notFound = true
+				return
+			}
+		}
+	})
+	if notFound || errors.Is(err, fs.ErrNotExist) {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return entry, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	return entry, nil
+}
+
+// readDir lists a folder, sorted by name
+func (cfs CognosFS) readDir(op, name string, entry FolderEntry) ([]fs.DirEntry, error) {
+	if entry.ID == "" {
+		// the root directory
+		return []fs.DirEntry{
+			entryInfo{name: "public", entry: FolderEntry{Type: Folder}},
+			entryInfo{name: "~", entry: FolderEntry{Type: Folder}},
+		}, nil
+	}
+
+	var entries map[string]FolderEntry
+	err := catch(func() {
+		entries = cfs.c.LsFolder(entry.ID)
+	})
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	var dirEntries []fs.DirEntry
+	for entryName, entry := range entries {
+		if strings.Contains(entryName, "/") {
+			continue
+		}
+		dirEntries = append(dirEntries, entryInfo{name: entryName, entry: entry})
+	}
+	sort.Slice(dirEntries, func(i, j int) bool {
+		return dirEntries[i].Name() < dirEntries[j].Name()
+	})
+	return dirEntries, nil
+}
+
+// Open opens a folder or report. Reports are not run until the first Read.
+func (cfs CognosFS) Open(name string) (fs.File, error) {
+	entry, err := cfs.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info := entryInfo{name: path.Base(name), entry: entry}
+	if name == "." {
+		info.name = "."
+	}
+	if entry.Type == Folder {
+		return &dirFile{fs: cfs, path: name, info: info}, nil
+	}
+	return &reportFile{fs: cfs, path: name, info: info}, nil
+}
+
+// ReadDir lists a folder, sorted by name
+func (cfs CognosFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entry, err := cfs.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Type != Folder {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return cfs.readDir("readdir", name, entry)
+}
+
+// dirFile is an open folder
+type dirFile struct {
+	fs      CognosFS
+	path    string
+	info    entryInfo
+	entries []fs.DirEntry
+	listed  bool
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.path, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.listed {
+		entries, err := d.fs.readDir("readdir", d.path, d.info.entry)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.listed = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// reportFile is an open report. The report is run on the first Read.
+type reportFile struct {
+	fs     CognosFS
+	path   string
+	info   entryInfo
+	reader *strings.Reader
+}
+
+func (r *reportFile) Stat() (fs.FileInfo, error) { return r.info, nil }
+func (r *reportFile) Close() error               { return nil }
+
+// Read runs the report the first time it is called
+func (r *reportFile) Read(b []byte) (int, error) {
+	if r.reader == nil {
+		var csv string
+		err := catch(func() {
+			csv = r.fs.c.DownloadReportCSV(r.info.entry.ID)
+		})
+		if err != nil {
+			return 0, &fs.PathError{Op: "read", Path: r.path, Err: err}
+		}
+		r.reader = strings.NewReader(csv)
+		r.info.size = int64(len(csv))
+	}
+	return r.reader.Read(b)
+}
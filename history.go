@@ -0,0 +1,62 @@
+package cognos
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"time"
+)
+
+// RunRecord is one past execution of a report, from the server's run
+// history
+type RunRecord struct {
+	Start time.Time `json:"start"`
+	// End is zero if the run hasn't finished
+	End time.Time `json:"end"`
+	// Status is "succeeded", "failed", or "cancelled"
+	Status string `json:"status"`
+	// User is who requested the run
+	User string `json:"user"`
+	// Error is why the run failed, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// Failed returns true if the run failed
+func (r RunRecord) Failed() bool {
+	return r.Status == "failed"
+}
+
+// runHistoryLinkFromID returns a link to the run history page of an
+// object. If limit is more than 0 the server only lists that many runs.
+func runHistoryLinkFromID(id string, limit int) string {
+	link := objectPageLink("portal/properties_runhistory.xts", id)
+	if limit > 0 {
+		link += "&m_limit=" + strconv.Itoa(limit)
+	}
+	return link
+}
+
+// GetRunHistory returns the most recent runs of the report with the given
+// id, newest first. It includes runs by other people and schedules, not
+// just us. limit is the most runs to fetch. 0 means however many the
+// server keeps. If there is no such report it panics with an error that
+// wraps fs.ErrNotExist.
+func (c *CognosInstance) GetRunHistory(id string, limit int) []RunRecord {
+	page := c.Request("GET", runHistoryLinkFromID(id, limit), "")
+
+	history := []RunRecord{}
+	if !findJSVar(page, "g_PS_RunHistory", &history) {
+		if fault, found := parseFault(page); found {
+			if isMissingObject(fault) {
+				panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when getting run history for %s: %w", id, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when getting run history for "+id))
+	}
+	// in case the server ignored the limit
+	if limit > 0 && len(history) > limit {
+		history = history[:limit]
+	}
+	return history
+}
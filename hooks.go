@@ -0,0 +1,71 @@
+package cognos
+
+import (
+	"log"
+	"time"
+)
+
+// Hooks are functions that get called when things happen inside a
+// CognosInstance. They are meant for feeding a metrics system, so they
+// get called from whatever goroutine is doing the work, and should be
+// quick. Any hook can be nil.
+type Hooks struct {
+	// ReportDone is called after a report has run and its output has been
+	// downloaded (not when the output comes from the cache). See
+	// info.Throughput for how fast the download went (for checking on
+	// DownloadRate).
+	ReportDone func(info RunInfo)
+	// FolderListed is called each time LsFolder is used (including by
+	// WalkFolder, FolderEntryFromPath, etc). fromCache is true if the
+	// listing hadn't changed, so it wasn't parsed again (see ListingTTL).
+	FolderListed func(id string, fromCache bool)
+	// SlowReport is called once if a report is still running after
+	// SlowReportThreshold seconds, with how long it has been running and
+	// how many times we have checked on it. It is called from the
+	// goroutine waiting on the report, so it should return quickly.
+	SlowReport func(reportID string, elapsed time.Duration, polls int)
+	// BreakerChanged is called when the circuit breaker (see
+	// BreakerThreshold) changes to BreakerClosed, BreakerOpen, or
+	// BreakerHalfOpen. It is safe to call BreakerState from it.
+	BreakerChanged func(state string)
+	// Retry is called when a request failed and is about to be tried
+	// again, and when a check on a running report failed and we are going
+	// to check again. Retries are already counted in Stats, so this is
+	// for alerting (ex: on info.Attempt > 2). If it panics, the panic is
+	// logged and the retry goes ahead anyway.
+	Retry func(info RetryInfo)
+}
+
+// RetryInfo is what the Retry hook is told about a retry
+type RetryInfo struct {
+	// Link is what was requested (with any password scrubbed out). For a
+	// check on a running report it is the report ID instead.
+	Link string
+	// Poll is true if this was a check on a running report (see
+	// PollFailureLimit)
+	Poll bool
+	// Attempt is which attempt failed, starting at 1. For a check on a
+	// running report, it is how many checks in a row have failed.
+	Attempt int
+	// Err is why it failed
+	Err error
+	// StatusCode is the HTTP status we got, or 0 if we didn't get one
+	// (ex: the connection failed)
+	StatusCode int
+	// Delay is how long we wait before trying again
+	Delay time.Duration
+}
+
+// retried calls the Retry hook, if there is one, without letting it
+// panic
+func (c *CognosInstance) retried(info RetryInfo) {
+	if c.Hooks.Retry == nil {
+		return
+	}
+	err := catch(func() {
+		c.Hooks.Retry(info)
+	})
+	if err != nil {
+		log.Println("The Retry hook panicked: " + c.scrub(err.Error()))
+	}
+}
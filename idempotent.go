@@ -0,0 +1,41 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// ErrOutcomeUnknown means a request that isn't safe to send twice (ex:
+// creating a schedule) failed in a way where it might have gone through
+// anyway (ex: a timeout, or a 5xx error), so it wasn't retried. Check if
+// it happened before trying again.
+var ErrOutcomeUnknown = errors.New("the request failed, but it may have gone through anyway")
+
+// idempotentKey overrides whether a request is safe to retry
+type idempotentKey struct{}
+
+// withIdempotent returns a context for a request that is (or isn't) safe
+// to send more than once. Without this, GETs are assumed to be, and
+// everything else (ex: POSTs) is assumed not to be.
+func withIdempotent(ctx context.Context, idempotent bool) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, idempotent)
+}
+
+// isIdempotent returns true if a request can be retried without worrying
+// about doing it twice
+func isIdempotent(ctx context.Context, method string) bool {
+	if idempotent, set := ctx.Value(idempotentKey{}).(bool); set {
+		return idempotent
+	}
+	return method == "GET" || method == "HEAD"
+}
+
+// neverSent returns true if a request failed before the server could have
+// gotten it (ex: connection refused), so even a non-idempotent request
+// can be retried. That includes failing to get credentials to send it with.
+func neverSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial" ||
+		errors.Is(err, errCredentialProvider)
+}
@@ -0,0 +1,103 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		ctx    context.Context
+		method string
+		want   bool
+	}{
+		{ctx, "GET", true},
+		{ctx, "HEAD", true},
+		{ctx, "POST", false},
+		{withIdempotent(ctx, true), "POST", true},
+		{withIdempotent(ctx, false), "GET", false},
+	}
+	for i, test := range tests {
+		if got := isIdempotent(test.ctx, test.method); got != test.want {
+			t.Errorf("%d: %s is idempotent %v, want %v", i, test.method, got, test.want)
+		}
+	}
+}
+
+func TestNeverSent(t *testing.T) {
+	tests := map[error]bool{
+		&net.OpError{Op: "dial", Err: errors.New("connection refused")}: true,
+		fmt.Errorf("%w: no password", errCredentialProvider):            true,
+		&net.OpError{Op: "read", Err: errors.New("connection reset")}:   false,
+		errors.New("EOF"): false,
+	}
+	for err, want := range tests {
+		if got := neverSent(fmt.Errorf("sending: %w", err)); got != want {
+			t.Errorf("%v: got %v", err, got)
+		}
+	}
+}
+
+// resetTransport fails every request as if the connection dropped after
+// it was sent
+type resetTransport struct{}
+
+func (resetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+}
+
+func TestPostsAreNotRetried(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 2
+	link := "/ibmcognos/cgi-bin/cognos.cgi"
+
+	// the server might have done it before failing
+	srv.InjectFaults(503, 1)
+	_, err := c.RequestContext(context.Background(), "POST", link, "b_action=xts.run")
+	if !errors.Is(err, ErrOutcomeUnknown) || len(srv.Requests()) != 1 {
+		t.Errorf("a 503 got %v after %d attempts, want ErrOutcomeUnknown after 1", err, len(srv.Requests()))
+	}
+
+	// unless the caller says it is safe
+	srv.ResetRequests()
+	srv.InjectFaults(503, 1)
+	_, err = c.RequestContext(withIdempotent(context.Background(), true), "POST", link, "b_action=xts.run")
+	if err != nil || len(srv.Requests()) != 2 {
+		t.Errorf("an idempotent POST got %v after %d attempts, want to work on the second", err, len(srv.Requests()))
+	}
+
+	// a dropped connection is the same as a 503, but GETs are retried
+	c.SetTransport(resetTransport{})
+	var reqErr *RequestError
+	_, err = c.RequestContext(context.Background(), "POST", link, "b_action=xts.run")
+	if !errors.Is(err, ErrOutcomeUnknown) || !errors.As(err, &reqErr) || reqErr.Attempts != 1 {
+		t.Errorf("a dropped POST got %v", err)
+	}
+	_, err = c.RequestContext(context.Background(), "GET", link, "")
+	if errors.Is(err, ErrOutcomeUnknown) || !errors.As(err, &reqErr) || reqErr.Attempts != 3 {
+		t.Errorf("a dropped GET got %v", err)
+	}
+}
+
+func TestPostsAreRetriedIfNeverSent(t *testing.T) {
+	// nothing is listening here
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	c := MakeInstance(`APSCN\test`, "test", "http://"+addr, "esp", "testsms", 1, 2, 10, 4)
+	c.sleep = noSleep
+	_, err = c.RequestContext(context.Background(), "POST", "/ibmcognos/cgi-bin/cognos.cgi", "b_action=xts.run")
+	var reqErr *RequestError
+	if errors.Is(err, ErrOutcomeUnknown) || !errors.As(err, &reqErr) || reqErr.Attempts != 3 {
+		t.Errorf("a POST that couldn't connect got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package cognos
+
+import (
+	"encoding/json"
+	"regexp"
+)
+
+// Identity is who we are logged in as
+type Identity struct {
+	DisplayName string   `json:"displayName"`
+	CAMID       string   `json:"camid"`
+	Namespace   string   `json:"namespace"`
+	Groups      []string `json:"groups"`
+	Roles       []string `json:"roles"`
+}
+
+// personalLink is the page with the user's personal information
+func personalLink() string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=portal/preferences_personal.xts"
+}
+
+// findJSVar finds var name = <value>; on a page and decodes the value as
+// JSON into v. It returns false if the variable isn't there or isn't
+// valid JSON.
+func findJSVar(page string, name string, v interface{}) bool {
+	pattern := regexp.MustCompile(`var ` + regexp.QuoteMeta(name) + ` = (.*?);\s*\n`)
+	matchParts := pattern.FindStringSubmatch(page)
+	if len(matchParts) < 2 {
+		return false
+	}
+	return json.Unmarshal([]byte(matchParts[1]), v) == nil
+}
+
+// WhoAmI returns who we are logged in as, and what groups and roles we
+// are in. It only needs a login, not access to any folders.
+func (c *CognosInstance) WhoAmI() Identity {
+	page := c.Request("GET", personalLink(), "")
+
+	identity := Identity{Namespace: c.Namespace}
+	if !findJSVar(page, "g_PS_CAMID", &identity.CAMID) {
+		panic(c.notUnderstood(page, "Unable to find CAMID on the personal information page"))
+	}
+	findJSVar(page, "g_PS_UserName", &identity.DisplayName)
+	findJSVar(page, "g_PS_Groups", &identity.Groups)
+	findJSVar(page, "g_PS_Roles", &identity.Roles)
+	return identity
+}
+
+// Capabilities returns the names of the secured functions and features
+// our user is allowed to use (ex: canUseReportStudio, canUseScheduling)
+func (c *CognosInstance) Capabilities() []string {
+	page := c.Request("GET", personalLink(), "")
+
+	var capabilities []string
+	if !findJSVar(page, "g_PS_Capabilities", &capabilities) {
+		panic(c.notUnderstood(page, "Unable to find capabilities on the personal information page"))
+	}
+	return capabilities
+}
+
+// HasCapability returns true if our user has the named capability (see
+// Capabilities)
+func (c *CognosInstance) HasCapability(name string) bool {
+	for _, capability := range c.Capabilities() {
+		if capability == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package cognos
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// JobStep is what happened to one step of a job
+type JobStep struct {
+	Name string `json:"name"`
+	// Status is "succeeded" or "failed" once the job is done
+	Status string `json:"status"`
+	// Error is why the step failed
+	Error string `json:"error,omitempty"`
+	// OutputIDs are the IDs of any saved outputs the step made
+	OutputIDs []string `json:"outputIds,omitempty"`
+}
+
+// Failed returns true if the step failed
+func (s JobStep) Failed() bool {
+	return s.Status != "succeeded"
+}
+
+// JobResult is what happened when a job ran
+type JobResult struct {
+	JobID string `json:"jobId"`
+	// Status is "succeeded" if every step succeeded, "failed" if every
+	// step failed, and "partial" otherwise
+	Status string    `json:"status"`
+	Steps  []JobStep `json:"steps"`
+}
+
+// Failed returns the steps that failed
+func (r JobResult) Failed() []JobStep {
+	var failed []JobStep
+	for _, step := range r.Steps {
+		if step.Failed() {
+			failed = append(failed, step)
+		}
+	}
+	return failed
+}
+
+// jobRunLinkFromID returns a link that starts a job
+func jobRunLinkFromID(id string) string {
+	return objectPageLink("portal/run.xts", id) + "&m_cmd=runJob"
+}
+
+// jobStatusLink returns a link to the status of a running job
+func jobStatusLink(eventID string) string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=portal/jobStatus.xts" +
+		"&m_event=" + url.QueryEscape(eventID)
+}
+
+// RunJob runs the job with the given id and waits for every step to
+// finish. A step failing is not a panic; check the Status of the result
+// (or Failed). It panics if the job couldn't be run at all.
+func (c *CognosInstance) RunJob(id string) JobResult {
+	// this is a GET, but running a job twice would be bad, so don't retry
+	// it if we can't tell if it went through
+	ctx := withIdempotent(context.Background(), false)
+	page := c.requestContext(ctx, "GET", jobRunLinkFromID(id), "", nil)
+
+	var eventID string
+	if !findJSVar(page, "g_PS_EventID", &eventID) {
+		if fault, found := parseFault(page); found {
+			panic(fmt.Errorf("%w: Cognos returned an error when attempting to run the job: %w", ErrReportFailed, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when attempting to run the job"))
+	}
+
+	// loop until the job is done. Like waiting on a report, a failed
+	// check dosen't mean the job failed.
+	sleep := c.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+	result := JobResult{JobID: id}
+	failures := 0
+	for {
+		sleep(context.Background(), c.pollInterval())
+		err := catch(func() {
+			page := c.Request("GET", jobStatusLink(eventID), "")
+			var status JobResult
+			if !findJSVar(page, "g_PS_JobStatus", &status) {
+				panic(c.notUnderstood(page, "Cognos returned a page we could not understand when checking on the job"))
+			}
+			result.Status, result.Steps = status.Status, status.Steps
+		})
+		if err != nil {
+			failures++
+			limit := c.pollFailureLimit()
+			if limit >= 0 && failures >= limit {
+				panic(fmt.Errorf("%w: %d checks in a row failed: %w", ErrPollFailed, failures, err))
+			}
+			continue
+		}
+		failures = 0
+
+		if result.Status != "pending" && result.Status != "executing" {
+			return result
+		}
+	}
+}
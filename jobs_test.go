@@ -0,0 +1,100 @@
+package cognos
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// isJobStatus returns true for a request that checks on a running job
+func isJobStatus(r cognostest.Request) bool {
+	return r.Form.Get("m") == "portal/jobStatus.xts"
+}
+
+// failNth is a transport that answers the first n requests with match in
+// their URL with a 503
+type failNth struct {
+	rt    http.RoundTripper
+	match string
+	lock  sync.Mutex
+	n     int
+}
+
+func (f *failNth) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.lock.Lock()
+	fail := f.n > 0 && strings.Contains(req.URL.String(), f.match)
+	if fail {
+		f.n--
+	}
+	f.lock.Unlock()
+	if !fail {
+		return f.rt.RoundTrip(req)
+	}
+	return &http.Response{
+		Status:     "503 Service Unavailable",
+		StatusCode: 503,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func TestRunJob(t *testing.T) {
+	srv, c := newTestInstance(t)
+	job := srv.Public.AddJob("Nightly",
+		cognostest.JobStep{Name: "Attendance", OutputIDs: []string{"o1"}},
+		cognostest.JobStep{Name: "Grades", Fail: true},
+	)
+	job.Polls = 2
+
+	var sleeps []time.Duration
+	c.sleep = recordSleeps(&sleeps)
+	result := c.RunJob(job.ID)
+	if result.JobID != job.ID || result.Status != "partial" || len(result.Steps) != 2 {
+		t.Fatalf("got %+v", result)
+	}
+	if step := result.Steps[0]; step.Failed() || step.OutputIDs[0] != "o1" {
+		t.Errorf("first step: %+v", step)
+	}
+	failed := result.Failed()
+	if len(failed) != 1 || failed[0].Name != "Grades" || !strings.Contains(failed[0].Error, "RSV-SRV-0042") {
+		t.Errorf("failed steps: %+v", failed)
+	}
+	if n := countRequests(srv, isJobStatus); n != 3 || len(sleeps) != 3 {
+		t.Errorf("checked on the job %d times and slept %d times, want 3", n, len(sleeps))
+	}
+}
+
+func TestRunJobStatusFailures(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 0
+	c.PollFailureLimit = 2
+	job := srv.Public.AddJob("Nightly", cognostest.JobStep{Name: "Attendance"})
+	job.Polls = 1
+
+	// one failed check is fine
+	c.SetTransport(&failNth{rt: c.Transport(), match: "jobStatus.xts", n: 1})
+	if result := c.RunJob(job.ID); result.Status != "succeeded" {
+		t.Errorf("got %+v", result)
+	}
+
+	// two in a row is not
+	c.SetTransport(&failNth{rt: c.Transport(), match: "jobStatus.xts", n: 2})
+	err := catch(func() { c.RunJob(job.ID) })
+	if !errors.Is(err, ErrPollFailed) {
+		t.Errorf("got %v, want ErrPollFailed", err)
+	}
+}
+
+func TestRunMissingJob(t *testing.T) {
+	_, c := newTestInstance(t)
+	if err := catch(func() { c.RunJob("i404") }); err == nil {
+		t.Error("running a job that dosen't exist worked")
+	}
+}
@@ -0,0 +1,194 @@
+package cognos
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// cachedListing is a folder listing we have already parsed, and what we
+// need to tell if it has changed
+type cachedListing struct {
+	entries      map[string]FolderEntry
+	fetchedAt    time.Time
+	etag         string
+	lastModified string
+	// hash is listingHash of the page, for servers that don't do ETags
+	hash string
+}
+
+// listingCache remembers folder listings, per DSN. It is shared between
+// an instance and any instances derived from it with WithDSN.
+type listingCache struct {
+	lock  sync.Mutex
+	byKey map[string]cachedListing
+}
+
+func (l *listingCache) get(key string) (cachedListing, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	listing, found := l.byKey[key]
+	return listing, found
+}
+
+func (l *listingCache) put(key string, listing cachedListing) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.byKey[key] = listing
+}
+
+// ForgetListings clears the remembered folder listings, so the next
+// LsFolder of each folder gets and parses it again
+func (c *CognosInstance) ForgetListings() {
+	c.listings.lock.Lock()
+	defer c.listings.lock.Unlock()
+	c.listings.byKey = make(map[string]cachedListing)
+}
+
+// forgetListing forgets the remembered listing of one folder (for when we
+// have changed it), with and without hidden entries
+func (c *CognosInstance) forgetListing(id string) {
+	c.listings.lock.Lock()
+	defer c.listings.lock.Unlock()
+	delete(c.listings.byKey, c.DSN+"\x00"+id)
+	delete(c.listings.byKey, c.DSN+"\x00hidden\x00"+id)
+}
+
+// listingTableCell matches the cells of the listing table. The rest of the
+// page can change from one request to the next (ex: tokens), so only
+// these are hashed.
+var listingTableCell = regexp.MustCompile(`(?s)<td[^>]*class="tableText"[^>]*>.*?</td>`)
+
+// listingHash hashes the listing table of a folder page. It returns "" if
+// the page dosen't have one (ex: it is an empty folder or an error).
+func listingHash(page string) string {
+	cells := listingTableCell.FindAllString(page, -1)
+	if len(cells) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, cell := range cells {
+		hash.Write([]byte(cell))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// cacheScope is what listings and paths are remembered under. Hidden
+// entries are only listed with ShowHidden, so those are kept seperate.
+func (c *CognosInstance) cacheScope() string {
+	if c.ShowHidden {
+		return c.DSN + "\x00hidden"
+	}
+	return c.DSN
+}
+
+// copyEntries copies a listing, so callers can't change the cached one
+func copyEntries(entries map[string]FolderEntry) map[string]FolderEntry {
+	copied := make(map[string]FolderEntry, len(entries))
+	for name, entry := range entries {
+		copied[name] = entry
+	}
+	return copied
+}
+
+// LsFolder returnes a map of folder/report names to objects. Each object
+// represents a folder entry. Each entry has a type (folder or report)
+// and an ID.
+//
+// Listings are remembered. Within ListingTTL of the last time a folder
+// was listed, the remembered listing is returned without asking the
+// server. After that, the server is asked if the folder changed (with
+// If-None-Match or If-Modified-Since if it gave us an ETag or
+// Last-Modified), and if it didn't, the listing isn't parsed again.
+//
+// Hidden entries are only listed if ShowHidden is set. If listing the
+// folder fails, LsFolder panics with an *OpError.
+func (c *CognosInstance) LsFolder(id string) map[string]FolderEntry {
+	return c.lsFolder(context.Background(), id)
+}
+
+// LsFolderContext is LsFolder, but it returns an error instead of
+// panicking, and it stops as soon as ctx is done. Then the error works
+// with errors.Is(err, ctx.Err()).
+func (c *CognosInstance) LsFolderContext(ctx context.Context, id string) (entries map[string]FolderEntry, err error) {
+	err = catch(func() {
+		entries = c.lsFolder(ctx, id)
+	})
+	return entries, err
+}
+
+// lsFolder does the work for LsFolder, using ctx for the request
+func (c *CognosInstance) lsFolder(ctx context.Context, id string) map[string]FolderEntry {
+	defer wrapOp("LsFolder", id, nil)
+	key := c.cacheScope() + "\x00" + id
+	cached, found := c.listings.get(key)
+	if found && time.Since(cached.fetchedAt) < time.Second*time.Duration(c.ListingTTL) {
+		c.folderListed(id, true)
+		return copyEntries(cached.entries)
+	}
+
+	headers := http.Header{}
+	if found && cached.etag != "" {
+		headers.Set("If-None-Match", cached.etag)
+	}
+	if found && cached.lastModified != "" {
+		headers.Set("If-Modified-Since", cached.lastModified)
+	}
+
+	var respHTML, etag, lastModified string
+	notModified := false
+	link := folderLinkFromID(id)
+	if c.ShowHidden {
+		link += "&m_showHidden=true"
+	}
+	c.requestStream(ctx, "GET", link, "", headers, func(resp *http.Response) {
+		notModified = resp.StatusCode == http.StatusNotModified
+		etag = resp.Header.Get("ETag")
+		lastModified = resp.Header.Get("Last-Modified")
+		respHTML = readAll(resp.Body)
+	})
+
+	if notModified {
+		cached.fetchedAt = time.Now()
+		c.listings.put(key, cached)
+		c.folderListed(id, true)
+		return copyEntries(cached.entries)
+	}
+
+	hash := listingHash(respHTML)
+	if found && hash != "" && hash == cached.hash {
+		cached.fetchedAt = time.Now()
+		cached.etag, cached.lastModified = etag, lastModified
+		c.listings.put(key, cached)
+		c.folderListed(id, true)
+		return copyEntries(cached.entries)
+	}
+
+	entries := c.parseListing(id, respHTML)
+	c.listings.put(key, cachedListing{
+		entries:      entries,
+		fetchedAt:    time.Now(),
+		etag:         etag,
+		lastModified: lastModified,
+		hash:         hash,
+	})
+	c.folderListed(id, false)
+	return copyEntries(entries)
+}
+
+// folderListed calls the FolderListed hook, if there is one
+func (c *CognosInstance) folderListed(id string, fromCache bool) {
+	if fromCache {
+		count(&c.stats.listingHits)
+	} else {
+		count(&c.stats.listingMisses)
+	}
+	if c.Hooks.FolderListed != nil {
+		c.Hooks.FolderListed(id, fromCache)
+	}
+}
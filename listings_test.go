@@ -0,0 +1,111 @@
+package cognos
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLsFolder(t *testing.T) {
+	srv, c := newTestInstance(t)
+	attendance := srv.Public.AddFolder("Attendance")
+	daily := srv.Public.AddReport("Daily", "a,b\n1,2\n")
+	nightly := srv.Public.AddJob("Nightly")
+
+	entries := c.LsFolder(srv.Public.ID)
+	want := map[string]FolderEntry{
+		"Attendance": {Type: Folder, ID: attendance.ID, Name: "Attendance"},
+		"Daily":      {Type: Report, ID: daily.ID, Name: "Daily"},
+		"Nightly":    {Type: Job, ID: nightly.ID, Name: "Nightly"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %v", len(entries), len(want), entries)
+	}
+	for name, entry := range want {
+		if entries[name] != entry {
+			t.Errorf("%s: got %+v, want %+v", name, entries[name], entry)
+		}
+	}
+}
+
+func TestLsFolderHidden(t *testing.T) {
+	srv, c := newTestInstance(t)
+	daily := srv.Public.AddReport("Daily", "a\n1\n")
+	old := srv.Public.AddReport("Old Daily", "a\n1\n")
+	old.Hidden = true
+
+	entries := c.LsFolder(srv.Public.ID)
+	if _, found := entries["Old Daily"]; found || len(entries) != 1 {
+		t.Errorf("the hidden report was listed: %v", entries)
+	}
+
+	c.ShowHidden = true
+	entries = c.LsFolder(srv.Public.ID)
+	if len(entries) != 2 || entries["Daily"].Hidden {
+		t.Errorf("with ShowHidden got %v", entries)
+	}
+	if want := (FolderEntry{Type: Report, ID: old.ID, Name: "Old Daily", Hidden: true}); entries["Old Daily"] != want {
+		t.Errorf("with ShowHidden got %+v, want %+v", entries["Old Daily"], want)
+	}
+	if entries["Daily"].ID != daily.ID {
+		t.Errorf("Daily is %+v", entries["Daily"])
+	}
+}
+
+func TestFolderEntryFromPath(t *testing.T) {
+	srv, c := newTestInstance(t)
+	daily := srv.Public.AddFolder("Attendance").AddReport("Daily", "a\n1\n")
+	mine := srv.My.AddReport("Mine", "a\n1\n")
+
+	if entry := c.FolderEntryFromPath([]string{"public", "Attendance", "Daily"}); entry.ID != daily.ID {
+		t.Errorf("public/Attendance/Daily is %s, not %s", entry.ID, daily.ID)
+	}
+	if entry := c.FolderEntryFromPath([]string{"~", "Mine"}); entry.ID != mine.ID {
+		t.Errorf("~/Mine is %s, not %s", entry.ID, mine.ID)
+	}
+
+	_, err := c.FolderEntryFromPathE([]string{"public", "Attendance", "Weekly"})
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) || notFound.Component != "Weekly" {
+		t.Errorf("missing report gave %v, want a NotFoundError for Weekly", err)
+	}
+}
+
+func TestFolderEntryFromPathWithEntities(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddFolder("Attendance & Discipline").AddReport("Bob's <Daily>", "a\n1\n")
+
+	// the path uses the names as people see them, not how the portal
+	// escapes them
+	entry := c.FolderEntryFromPath([]string{"public", "Attendance & Discipline", "Bob's <Daily>"})
+	if entry.ID != report.ID || entry.Name != "Bob's <Daily>" {
+		t.Errorf("got %+v, want report %s", entry, report.ID)
+	}
+}
+
+func TestLsFolderRetriesServerErrors(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.Public.AddReport("Daily", "a\n1\n")
+	srv.InjectFaults(503, 2)
+
+	if entries := c.LsFolder(srv.Public.ID); len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if n := len(srv.Requests()); n != 3 {
+		t.Errorf("server got %d requests, want 3 (2 failures and a retry that worked)", n)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 1
+	srv.InjectFaults(401, 2)
+
+	_, err := c.LsFolderE(srv.Public.ID)
+	if !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("got %v, want ErrAuthFailed", err)
+	}
+	var reqErr *RequestError
+	if !errors.As(err, &reqErr) || reqErr.Status != 401 || reqErr.Unauthorized != 2 {
+		t.Errorf("got %#v, want a RequestError with 2 401s", reqErr)
+	}
+}
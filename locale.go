@@ -0,0 +1,115 @@
+package cognos
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Locale is how a report formats numbers and dates. Cognos goes by the
+// content locale of the server (or whatever the report author picked), so
+// this needs to match that. Fields that are left empty use the value from
+// USLocale.
+type Locale struct {
+	// DateLayouts are tried in order (see time.Parse) for date and
+	// dateTime columns
+	DateLayouts []string
+	// Decimal is the decimal seperator (ex: "." or ",")
+	Decimal string
+	// Thousands is the thousands seperator (ex: "," or "."). Spaces are
+	// always ignored.
+	Thousands string
+	// CurrencySymbols are stripped off of numbers
+	CurrencySymbols []string
+}
+
+// USLocale is how ADE formats values (ex: 14-Mar-2024 and $1,234.50)
+var USLocale = Locale{
+	DateLayouts: []string{
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+		"Jan 2, 2006 3:04:05 PM",
+		"Jan 2, 2006",
+		"2-Jan-2006",
+		"1/2/2006",
+	},
+	Decimal:         ".",
+	Thousands:       ",",
+	CurrencySymbols: []string{"$"},
+}
+
+// EuropeanLocale is for reports that use 1.234,50 and 14.03.2024
+var EuropeanLocale = Locale{
+	DateLayouts: []string{
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+		"02.01.2006 15:04:05",
+		"02.01.2006",
+		"2.1.2006",
+		"02/01/2006",
+	},
+	Decimal:         ",",
+	Thousands:       ".",
+	CurrencySymbols: []string{"€", "EUR"},
+}
+
+// withDefaults fills in any empty fields from USLocale
+func (l Locale) withDefaults() Locale {
+	if l.DateLayouts == nil {
+		l.DateLayouts = USLocale.DateLayouts
+	}
+	if l.Decimal == "" {
+		l.Decimal = USLocale.Decimal
+	}
+	if l.Thousands == "" {
+		l.Thousands = USLocale.Thousands
+	}
+	if l.CurrencySymbols == nil {
+		l.CurrencySymbols = USLocale.CurrencySymbols
+	}
+	return l
+}
+
+// normalizeNumber turns a formatted number (ex: "$1,234.50" or
+// "(1.234,50 €)") into something strconv can parse (ex: "-1234.50").
+// If it isn't a number, strconv will still complain about the result.
+func (l Locale) normalizeNumber(cell string) string {
+	l = l.withDefaults()
+	number := strings.TrimSpace(cell)
+
+	// accounting style negatives
+	negative := false
+	if strings.HasPrefix(number, "(") && strings.HasSuffix(number, ")") {
+		negative = true
+		number = number[1 : len(number)-1]
+	}
+	for _, symbol := range l.CurrencySymbols {
+		number = strings.ReplaceAll(number, symbol, "")
+	}
+	number = strings.ReplaceAll(number, " ", "")
+	// non-breaking spaces are a common thousands seperator too
+	number = strings.ReplaceAll(number, "\u00a0", "")
+	number = strings.ReplaceAll(number, l.Thousands, "")
+	if l.Decimal != "." {
+		number = strings.ReplaceAll(number, l.Decimal, ".")
+	}
+
+	if negative {
+		number = "-" + number
+	}
+	return number
+}
+
+// parseDate tries each of the locale's DateLayouts
+func (l Locale) parseDate(cell string) (time.Time, error) {
+	l = l.withDefaults()
+	cell = strings.TrimSpace(cell)
+	for _, layout := range l.DateLayouts {
+		if t, err := time.Parse(layout, cell); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("not a date we recognize")
+}
@@ -0,0 +1,91 @@
+package cognos
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNormalizeNumber(t *testing.T) {
+	tests := []struct {
+		locale Locale
+		cell   string
+		want   float64
+	}{
+		{USLocale, "1234", 1234},
+		{USLocale, "$1,234.50", 1234.50},
+		{USLocale, " ($1,234.50) ", -1234.50},
+		{USLocale, "-0.25", -0.25},
+		{Locale{}, "1,000,000", 1000000},
+		{EuropeanLocale, "1.234,50", 1234.50},
+		{EuropeanLocale, "1.234,50 €", 1234.50},
+		{EuropeanLocale, "(1.234,50 EUR)", -1234.50},
+		{EuropeanLocale, "1 234,5", 1234.5},
+		{Locale{Decimal: ",", Thousands: " "}, "1 234,5", 1234.5},
+	}
+	for _, test := range tests {
+		number := test.locale.normalizeNumber(test.cell)
+		got, err := strconv.ParseFloat(number, 64)
+		if err != nil || got != test.want {
+			t.Errorf("%q became %q (%v), want %v", test.cell, number, err, test.want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	march14 := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		locale Locale
+		cell   string
+		want   time.Time
+	}{
+		{"ISO", USLocale, "2024-03-14", march14},
+		{"ISO with time", USLocale, "2024-03-14T13:05:00", march14.Add(13*time.Hour + 5*time.Minute)},
+		{"ADE", USLocale, "14-Mar-2024", march14},
+		{"US month first", USLocale, "3/14/2024", march14},
+		{"spelled out", Locale{}, "Mar 14, 2024", march14},
+		{"european dots", EuropeanLocale, "14.03.2024", march14},
+		{"european day first", EuropeanLocale, "14/03/2024", march14},
+		{"custom layout", Locale{DateLayouts: []string{"20060102"}}, "20240314", march14},
+	}
+	for _, test := range tests {
+		got, err := test.locale.parseDate(test.cell)
+		if err != nil || !got.Equal(test.want) {
+			t.Errorf("%s: %q became %v (%v), want %v", test.name, test.cell, got, err, test.want)
+		}
+	}
+
+	// 14/03/2024 isn't a US date, and the custom locale only has its layout
+	for _, bad := range []struct {
+		locale Locale
+		cell   string
+	}{
+		{USLocale, "14/03/2024"},
+		{Locale{DateLayouts: []string{"20060102"}}, "2024-03-14"},
+		{USLocale, "soon"},
+	} {
+		if got, err := bad.locale.parseDate(bad.cell); err == nil {
+			t.Errorf("%q became %v", bad.cell, got)
+		}
+	}
+}
+
+func TestTypedRowsColumnLocales(t *testing.T) {
+	table := Table{
+		Columns: []ColumnInfo{
+			{Name: "Amount", DataType: "decimal"},
+			{Name: "Betrag", DataType: "decimal"},
+			{Name: "Datum", DataType: "date"},
+		},
+		Rows: [][]string{{"$1,234.50", "1.234,50 €", "14.03.2024"}},
+	}
+	opts := ParseOptions{ColumnLocales: map[string]Locale{
+		"Betrag": EuropeanLocale,
+		"Datum":  EuropeanLocale,
+	}}
+	rows, _ := table.TypedRows(opts)
+	if rows[0][0] != 1234.50 || rows[0][1] != 1234.50 || !rows[0][2].(time.Time).Equal(time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("got %v", rows[0])
+	}
+}
@@ -3,41 +3,192 @@
 // and run/download reports (that have already been built) synchronously to CSV strings.
 // It does not support anything other than default parameters, so save default parameters
 // or build reports that don't have parameters. Basically everything panics on failure.
-// I use a helper function called Try() to handle these panics (http://github.com/9072997/jgh).
 // This library would not have been possible without the code generously open sourced by
 // Scott Organ (https://github.com/scottorgan/cognosant).
 package cognos
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
 	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"reflect"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/antchfx/htmlquery"
 
-	"github.com/9072997/jgh"
 	"github.com/Azure/go-ntlmssp"
-	"golang.org/x/net/publicsuffix"
-	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
 )
 
+// CognosInstance is a connection to a Cognos server. Make one with
+// MakeInstance. It is safe to use one instance from many goroutines at
+// once, but don't change the exported fields once you have started using it.
 type CognosInstance struct {
-	User         string
-	Pass         string
-	URL          string
-	Namespace    string
-	DSN          string
-	RetryDelay   uint
-	RetryCount   int
+	// User is the username without the domain (ex: 0401jpenn). If it has
+	// a domain in front anyway (ex: APSCN\0401jpenn), that is used as
+	// the Domain unless Domain is set.
+	User string
+	// Domain is the Windows domain used to log in (ex: APSCN). It is only
+	// used for authentication.
+	Domain     string
+	Pass       string
+	URL        string
+	Namespace  string
+	DSN        string
+	RetryDelay uint
+	RetryCount int
+	// PollInterval is the number of seconds between checks on a running
+	// report. If it is 0, RetryDelay is used.
+	PollInterval uint
+	// PollFailureLimit is how many checks on a running report can fail in
+	// a row (each after RetryCount retries) before giving up on the report.
+	// 0 means 10, and -1 means never give up.
+	PollFailureLimit int
+	// CacheDir and CacheTTL turn on the report output cache. If both are
+	// set, downloaded reports are saved in CacheDir and reused for CacheTTL
+	// seconds instead of running the report again. An output is only
+	// reused for the same DSN and user, so instances for diffrent users
+	// can share a CacheDir.
+	CacheDir string
+	CacheTTL uint
+	// VolatileLines matches lines of report output that change every run
+	// (ex: a run date) and should be ignored by DownloadReportCSVIfChanged
+	VolatileLines *regexp.Regexp
+	// Hooks are called when things happen, so you can feed them to your
+	// metrics system. Any of them can be left nil.
+	Hooks Hooks
+	// BreakerThreshold turns on the circuit breaker. After this many
+	// requests in a row fail (each retry counts), every request fails
+	// right away with ErrCircuitOpen for BreakerCooldown seconds (0 means
+	// 60), instead of retrying against a server that is down. Then one
+	// request is tried, and if it works, things go back to normal. Checks
+	// on reports that are already running are never stopped. 0 turns the
+	// breaker off.
+	BreakerThreshold int
+	BreakerCooldown  uint
+	// CancelOnClose makes Close cancel reports that are still running
+	// when it gives up waiting for them
+	CancelOnClose bool
+	// SlowReportThreshold is how many seconds a report can run before the
+	// SlowReport hook is called. 0 means never.
+	SlowReportThreshold uint
+	// ListingTTL is how many seconds a folder listing is trusted before
+	// asking the server again. 0 means always ask, but even then a folder
+	// that hasn't changed isn't parsed again.
+	ListingTTL uint
+	// OperationTimeout is how many seconds a request can take in total,
+	// counting every retry and the waits between them, and reading the
+	// response. httpTimeout (see MakeInstance) still limits each attempt.
+	// 0 means there is no limit other than retryCount.
+	OperationTimeout uint
+	// StrictListings makes LsFolder fail if a listing has an entry we
+	// can't work out, instead of making it an Other entry
+	StrictListings bool
+	// ShowHidden makes LsFolder (and everything that uses it, like
+	// FolderEntryFromPath) include entries that have been hidden in the
+	// portal. They are marked with FolderEntry.Hidden.
+	ShowHidden bool
+	// DispatcherURL is the base URL of the Cognos dispatcher (ex:
+	// http://cognos-app:9300). If it is set, requests are sent straight to
+	// the dispatcher's servlet instead of through the gateway at URL, and
+	// we log on with a CAM passport instead of NTLM. Anything only the
+	// gateway serves (ex: report outputs) still goes to URL, and so does
+	// everything else if the dispatcher refuses the connection.
+	DispatcherURL string
+	// DownloadRate limits how fast report outputs are downloaded, in bytes
+	// per second, so a big report dosen't hog a slow link. 0 means no
+	// limit. Everything else (polling, listing folders, etc) is small
+	// enough that it isn't limited.
+	DownloadRate uint
+	// DefaultOutputFormat is the output format DownloadReport and
+	// DownloadReportByPath use when DownloadOptions.Format isn't set (CSV,
+	// PDF, HTML, XLSX, or XML). Empty means CSV. The functions with CSV in
+	// the name always get CSV no matter what this is.
+	DefaultOutputFormat string
+	// LowPriorityMaxWait is how many seconds a LowPriority request (see
+	// WithPriority) waits for a slot before it is let in ahead of normal
+	// ones that started waiting after it, so a busy instance dosen't
+	// starve it forever. High priority requests still go first. 0 means
+	// low priority requests always wait for everything else.
+	LowPriorityMaxWait uint
+	// SlotTimeout is how many seconds a request waits for a request slot
+	// (see concurrentRequests in MakeInstance) before giving up with
+	// ErrBusy, so if every slot is stuck (ex: on a server that stopped
+	// answering) callers find out instead of waiting forever. 0 means wait
+	// as long as it takes (or until the request's context is done, see
+	// RequestContext).
+	SlotTimeout uint
+	// DownloadTimeout is how many seconds downloading a report's output
+	// can take (each attempt), instead of the httpTimeout given to
+	// MakeInstance, since a big output can take much longer than anything
+	// else. 0 means use httpTimeout. See WithCallTimeout for other requests.
+	DownloadTimeout uint
+	// Language is the language we ask the report viewer to answer in (with
+	// Accept-Language), as a language tag (ex: en or es-MX). Some of what
+	// we look for on viewer pages (ex: "No Data Available") is only there
+	// in whatever language the session is in, and a gateway can default
+	// sessions to something we don't know, so empty means English. This
+	// is also the content language, so if your reports are written to
+	// format for another language, set this to it (see Locale too).
+	Language string
+
 	client       http.Client
-	httpLockPool *semaphore.Weighted
+	httpLockPool *slotQueue
+	// concurrentRequests is what httpLockPool was made with
+	concurrentRequests uint
+	slots              *slotCounts
+	// budget is shared by every instance in a Pool. It is nil if the
+	// instance isn't in one.
+	budget   *slotQueue
+	roots    *rootCache
+	paths    *pathCache
+	listings *listingCache
+	breaker  *circuitBreaker
+	life     *lifecycle
+	stats    *statCounters
+	// runs makes identical report runs that happen at the same time share
+	// one run on the server
+	runs       *singleflight.Group
+	version    *versionCache
+	cacheLocks *keyedLocks
+	dispatcher *dispatcherSession
+	creds      *credentials
+	// dumps saves pages we can't understand (see WithDebugDump). It is nil
+	// if we aren't doing that.
+	dumps *debugDumper
+	// dryRun is set if we are only pretending to send requests (see
+	// WithDryRun)
+	dryRun *dryRunState
+	// runAs is who reports are run as (see RunAs)
+	runAs string
+	// priority is what our requests wait for a slot at (see WithPriority)
+	priority Priority
+	sleep    sleeper
+}
+
+// folderRoots holds the IDs of the public folders and "my folders" roots
+type folderRoots struct {
+	public string
+	my     string
+}
+
+// rootCache remembers the folder roots for each DSN. It is shared between
+// an instance and any instances derived from it with WithDSN.
+type rootCache struct {
+	lock     sync.Mutex
+	byDSN    map[string]folderRoots
+	fetching keyedLocks
 }
 
 type FolderEntryType uint
@@ -45,6 +196,11 @@ type FolderEntryType uint
 const (
 	Folder FolderEntryType = iota
 	Report FolderEntryType = iota
+	// Job is a Cognos job, which runs several reports (see RunJob)
+	Job FolderEntryType = iota
+	// Other is a listing entry we couldn't work out (see
+	// RegisterEntryParser). Its Href is the link, and it has no ID.
+	Other FolderEntryType = iota
 )
 
 // FolderEntry represents either a folder or a report
@@ -53,6 +209,15 @@ type FolderEntry struct {
 	// compare this with the constants Folder or Type
 	Type FolderEntryType `json:"type"`
 	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	// Hidden is set for entries that have been hidden in the portal. They
+	// are only listed if ShowHidden is set.
+	Hidden bool `json:"hidden,omitempty"`
+	// Package is set for packages (see ListPackages). They have the Folder
+	// type, since they can be listed like one.
+	Package bool `json:"package,omitempty"`
+	// Href is the link from the listing, for Other entries
+	Href string `json:"href,omitempty"`
 }
 
 // MarshalJSON marshals a field that is basically an enum.
@@ -62,6 +227,10 @@ func (t FolderEntryType) MarshalJSON() ([]byte, error) {
 		return []byte(`"folder"`), nil
 	} else if t == Report {
 		return []byte(`"report"`), nil
+	} else if t == Job {
+		return []byte(`"job"`), nil
+	} else if t == Other {
+		return []byte(`"other"`), nil
 	} else {
 		return nil, &json.UnsupportedValueError{
 			Value: reflect.ValueOf(t),
@@ -70,9 +239,27 @@ func (t FolderEntryType) MarshalJSON() ([]byte, error) {
 	}
 }
 
+// UnmarshalJSON is the opposite of MarshalJSON
+func (t *FolderEntryType) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case `"folder"`:
+		*t = Folder
+	case `"report"`:
+		*t = Report
+	case `"job"`:
+		*t = Job
+	case `"other"`:
+		*t = Other
+	default:
+		return fmt.Errorf("unknown folder entry type %s", data)
+	}
+	return nil
+}
+
 // MakeInstance creates a new cognos object.
 // user is the user used to connect to Cognos (ex: APSCN\0401jpenn).
 // This value also changes which "my folders" folder ~ points to.
+// The domain is split off into the Domain field, so User is just 0401jpenn.
 // url is the base URL of the cognos server (ex: https://adecognos.arkansas.gov).
 // namespace is the first thing you choose when signing in to Cognos.
 // I don't totally know what dsn is, but mine is bentonvisms.
@@ -81,52 +268,156 @@ func (t FolderEntryType) MarshalJSON() ([]byte, error) {
 // retryDelay is the number of seconds before a failed request will be retried.
 // It is also the polling interval when waiting for a report to finish.
 // retryCount is the number of times a failed request will be retried.
-// A retryCount of -1 will retry forever.
+// A retryCount of 0 means each request is only tried once. A retryCount
+// of -1 will retry forever, but only for failures that might go away
+// (server errors and timeouts, not 4xx errors). Anything less than -1 panics.
 // Polling unfinished reports is unaffected by this.
 // httpTimeout is the number seconds before giving up on a Cognos HTTP request.
 // concurrentRequests limits the maximum number of requests going at once.
+// As many connections are kept open for reuse (see TransportOptions).
+// NewInstance is the same thing, but with Options instead of a parameter
+// for everything.
 func MakeInstance(
 	user, pass, url, namespace, dsn string,
 	retryDelay uint,
 	retryCount int,
 	httpTimeout uint,
 	concurrentRequests uint,
-) (c CognosInstance) {
-	c = CognosInstance{
-		User:         user,
-		Pass:         pass,
-		URL:          url,
-		Namespace:    namespace,
-		DSN:          dsn,
-		RetryDelay:   retryDelay,
-		RetryCount:   retryCount,
-		httpLockPool: semaphore.NewWeighted(int64(concurrentRequests)),
-	}
-
-	// make a new cookie jar
-	// (cookie jars are threadsafe)
-	jar, err := cookiejar.New(
-		&cookiejar.Options{
-			PublicSuffixList: publicsuffix.List,
+) *CognosInstance {
+	if retryCount < -1 {
+		panic("retryCount must be -1 (retry forever) or more")
+	}
+	return newInstance(user, pass, url, dsn, instanceOptions{
+		namespace:          namespace,
+		retryDelay:         retryDelay,
+		retryCount:         retryCount,
+		httpTimeout:        time.Duration(httpTimeout) * time.Second,
+		concurrentRequests: concurrentRequests,
+	})
+}
+
+// newInstance does the work for MakeInstance and NewInstance. The options
+// have already been checked.
+func newInstance(user, pass, url, dsn string, o instanceOptions) *CognosInstance {
+	domain, user := splitUser(user)
+	c := &CognosInstance{
+		User:               user,
+		Domain:             domain,
+		Pass:               pass,
+		URL:                url,
+		Namespace:          o.namespace,
+		DSN:                dsn,
+		RetryDelay:         o.retryDelay,
+		RetryCount:         o.retryCount,
+		httpLockPool:       newSlotQueue(o.concurrentRequests),
+		concurrentRequests: o.concurrentRequests,
+		slots:              &slotCounts{},
+		roots: &rootCache{
+			byDSN: make(map[string]folderRoots),
+		},
+		paths: &pathCache{
+			entries: make(map[string]FolderEntry),
+		},
+		listings: &listingCache{
+			byKey: make(map[string]cachedListing),
 		},
-	)
-	jgh.PanicOnErr(err)
+		breaker:    &circuitBreaker{state: BreakerClosed},
+		stats:      &statCounters{},
+		life:       newLifecycle(),
+		runs:       &singleflight.Group{},
+		version:    &versionCache{},
+		cacheLocks: &keyedLocks{},
+		dispatcher: &dispatcherSession{},
+		creds:      &credentials{},
+	}
 
-	// make a httpClient that uses the cookie jar and supports NTLM auth
+	// make a httpClient that uses a cookie jar and supports NTLM auth
+	// (cookie jars are threadsafe)
 	c.client = http.Client{
 		Transport: ntlmssp.Negotiator{
-			RoundTripper: &http.Transport{},
+			RoundTripper: newTransport(TransportOptions{}, o.concurrentRequests),
 		},
-		Jar:     jar,
-		Timeout: time.Duration(httpTimeout) * time.Second,
+		Jar:     newResettableJar(),
+		Timeout: o.httpTimeout,
+	}
+	if o.client != nil {
+		c.useClient(o.client, o.timeoutSet)
 	}
 
-	return
+	return c
+}
+
+// splitUser splits DOMAIN\user into its parts. A user without a domain
+// (including user@domain style names, which NTLM takes as is) comes back
+// with an empty domain.
+func splitUser(user string) (domain, name string) {
+	if i := strings.Index(user, `\`); i >= 0 {
+		return user[:i], user[i+1:]
+	}
+	return "", user
+}
+
+// Username returns the username without the domain. This is what Cognos
+// uses in search paths and "my folders". If the instance has a
+// CredentialProvider that hasn't been asked yet, it is asked now (and this
+// panics if it fails).
+func (c *CognosInstance) Username() string {
+	panicOnErr(c.fetchLogin(context.Background()))
+	user, _, _ := c.login()
+	_, name := splitUser(user)
+	return name
+}
+
+// authUser returns the user to log in with (DOMAIN\user)
+func (c *CognosInstance) authUser() string {
+	user, userDomain, _ := c.login()
+	domain, name := splitUser(user)
+	if userDomain != "" {
+		domain = userDomain
+	}
+	if domain == "" {
+		return name
+	}
+	return domain + `\` + name
+}
+
+// WithDSN returns a copy of c that uses a diffrent DSN (ex: the e-finance one
+// instead of the eschool one). The copy shares the http client, cookie jar,
+// concurrency limit, and settings with c, so one instance can be used for
+// both eschool and e-finance reports without a second session or a second
+// set of retry/concurrency budgets. Folder roots are cached per DSN, so the
+// two instances don't step on each other.
+func (c *CognosInstance) WithDSN(dsn string) *CognosInstance {
+	derived := *c
+	derived.DSN = dsn
+	return &derived
+}
+
+// Transport returns the http.RoundTripper used for requests to Cognos
+func (c *CognosInstance) Transport() http.RoundTripper {
+	return c.client.Transport
+}
+
+// SetTransport replaces the http.RoundTripper used for requests to Cognos.
+// This is mostly useful for wrapping the default one (ex: to record
+// traffic with cognostest.Recorder) or replacing it with one that never
+// hits the network (ex: cognostest.Replayer). Instances already derived
+// from c (ex: with WithDSN) are not affected.
+func (c *CognosInstance) SetTransport(rt http.RoundTripper) {
+	c.client.Transport = rt
+}
+
+// pollInterval returns how long to wait between checks on a running report
+func (c *CognosInstance) pollInterval() time.Duration {
+	if c.PollInterval == 0 {
+		return time.Second * time.Duration(c.RetryDelay)
+	}
+	return time.Second * time.Duration(c.PollInterval)
 }
 
 // loginLink returns the link that you must hit first to get cookies
 // that will let you access the rest of cognos
-func (c CognosInstance) loginLink() string {
+func (c *CognosInstance) loginLink() string {
 	return "/ibmcognos/cgi-bin/cognos.cgi" +
 		"?dsn=" + c.DSN +
 		"&spi_db_name=" + c.DSN +
@@ -136,12 +427,14 @@ func (c CognosInstance) loginLink() string {
 		"&gohome="
 }
 
-// folderLinkFromID returns a link for use with Request() for a given folderID
+// folderLinkFromID returns a link for use with Request() for a given folderID.
+// It panics if id isn't valid (see ValidateID).
 func folderLinkFromID(id string) string {
+	checkID(id)
 	return "/ibmcognos/cgi-bin/cognos.cgi" +
 		"?b_action=xts.run" +
 		"&m=portal/cc.xts" +
-		"&m_folder=" + id
+		"&m_folder=" + url.QueryEscape(id)
 }
 
 // folderIDFromLink tries to pull the folderID out of a link.
@@ -157,119 +450,436 @@ func folderIDFromLink(link string) string {
 
 // reportLinkFromID returns a link for use with Request() for a given reportID
 func reportLinkFromID(id string) string {
+	return reportLinkWithFormat(id, "CSV")
+}
+
+// reportLinkWithFormat is reportLinkFromID for an output format other
+// than CSV (ex: XLSX)
+func reportLinkWithFormat(id string, format string) string {
+	checkID(id)
 	return "/ibmcognos/cgi-bin/cognos.cgi" +
 		"?b_action=cognosViewer" +
 		"&ui.action=run" +
 		"&ui.object=" + url.QueryEscape(id) +
-		"&run.outputFormat=CSV" +
+		"&run.outputFormat=" + url.QueryEscape(format) +
 		"&run.prompt=false"
 }
 
+// EntryFromURL works out what a link copied from the Cognos portal points
+// to. link can be a full URL or just the path and query. Folder links
+// have the ID in m_folder, and report links have it in ui.object. If link
+// has a host, it has to match the instance URL. Only the Type and ID of
+// the result are filled in.
+func (c *CognosInstance) EntryFromURL(link string) (FolderEntry, error) {
+	linkURL, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return FolderEntry{}, fmt.Errorf("unable to parse link %s: %w", link, err)
+	}
+
+	if linkURL.Host != "" {
+		instanceURL, err := url.Parse(c.URL)
+		if err != nil {
+			return FolderEntry{}, fmt.Errorf("unable to parse instance URL: %w", err)
+		}
+		if !strings.EqualFold(linkURL.Host, instanceURL.Host) {
+			return FolderEntry{}, fmt.Errorf("link is for %s, not %s", linkURL.Host, instanceURL.Host)
+		}
+	}
+
+	query := linkURL.Query()
+	if id := query.Get("m_folder"); id != "" {
+		return FolderEntry{Type: Folder, ID: id}, nil
+	}
+	if id := query.Get("ui.object"); id != "" {
+		return FolderEntry{Type: Report, ID: id}, nil
+	}
+	return FolderEntry{}, fmt.Errorf("link %s has no folder ID (m_folder) or report ID (ui.object)", link)
+}
+
 // FolderEntryFromPath returns a folderEntry object representing whatever is
 // at path. Path is a sloce of strings. The first string should be either "public"
-// or "~" for public folders or my folders. Each string after that should represent
-// the name of a folder. The last string may be the name of a report or a folder.
+// or "~" for public folders or my folders, or another root (see ListRoots).
+// Each string after that should represent the name of a folder. The last
+// string may be the name of a report or a folder.
+// Paths that have been resolved before (including the folders on the way
+// to them) are remembered, so shared folders are only listed once. Use
+// ForgetPaths if things have been moved or deleted.
+// If it fails, it panics with an *OpError.
 // BUG(jon): dosen't support "my folders" by username (only ~)
-func (c CognosInstance) FolderEntryFromPath(path []string) FolderEntry {
+func (c *CognosInstance) FolderEntryFromPath(path []string) FolderEntry {
+	return c.folderEntryFromPath(context.Background(), path)
+}
+
+// FolderEntryFromPathContext is FolderEntryFromPath, but it returns an
+// error instead of panicking, and it stops as soon as ctx is done. Then the
+// error says which part of the path we were looking for, and works with
+// errors.Is(err, ctx.Err()).
+func (c *CognosInstance) FolderEntryFromPathContext(ctx context.Context, path []string) (entry FolderEntry, err error) {
+	err = catch(func() {
+		entry = c.folderEntryFromPath(ctx, path)
+	})
+	return entry, err
+}
+
+// folderEntryFromPath does the work for FolderEntryFromPath, using ctx for
+// every request
+func (c *CognosInstance) folderEntryFromPath(ctx context.Context, path []string) FolderEntry {
+	defer wrapOp("FolderEntryFromPath", "", path)
 	if len(path) == 0 {
 		panic("Cannot get folder entry for empty path")
 	}
+	// stopAt panics if ctx is done, or err is because of it, saying we
+	// were looking for component
+	stopAt := func(component string, err error) {
+		if ctx.Err() == nil {
+			return
+		}
+		if err == nil {
+			err = ctx.Err()
+		}
+		panic(fmt.Errorf("stopped while looking for %s: %w", component, err))
+	}
 
-	currentEntry := FolderEntry{
-		Type: Folder,
+	// start from the longest part of the path we already know about
+	start := 1
+	currentEntry, found := FolderEntry{}, false
+	for start = len(path); start > 1; start-- {
+		currentEntry, found = c.paths.get(c.cacheScope(), path[:start])
+		if found {
+			break
+		}
 	}
-	if path[0] == "public" {
-		currentEntry.ID, _ = c.findFolderRoots()
-	} else if path[0] == "~" {
-		_, currentEntry.ID = c.findFolderRoots()
-	} else {
-		panic("Invalid root folder " + path[0])
+	if !found {
+		stopAt(path[0], nil)
+		err := catch(func() {
+			currentEntry = c.rootEntry(ctx, path[0])
+		})
+		stopAt(path[0], err)
+		panicOnErr(err)
+	} else if currentEntry.Type != Folder && start < len(path) {
+		panic(reportInPath(path[start-1]))
 	}
 
-	// skip the first component in the path. We handled it already.
-	for i, pathComponent := range path[1:] {
-		entries := c.LsFolder(currentEntry.ID)
+	// skip the part of the path we handled already
+	for i := start; i < len(path); i++ {
+		pathComponent := path[i]
+		stopAt(pathComponent, nil)
+		var entries map[string]FolderEntry
+		err := catch(func() {
+			entries = c.lsFolder(ctx, currentEntry.ID)
+		})
+		stopAt(pathComponent, err)
+		panicOnErr(err)
 
 		// look at the folder entry named after our next path component
 		// panic if it dosen't exist
 		nextEntry, exists := entries[pathComponent]
 		if !exists {
-			panic("Could not find folder entry " + pathComponent)
+			panic(missingEntry(pathComponent))
 		}
 
 		// panic if we find a report in the middle of a path
-		isLastComponent := len(path)-2 == i
-		if nextEntry.Type == Report && !isLastComponent {
-			panic(pathComponent + " is a report but it is in the middle of a path")
+		isLastComponent := len(path)-1 == i
+		if nextEntry.Type != Folder && !isLastComponent {
+			panic(reportInPath(pathComponent))
 		}
 
 		currentEntry = nextEntry
+		c.paths.put(c.cacheScope(), path[:i+1], currentEntry)
 	}
 
 	return currentEntry
 }
 
+// rootEntry returns the entry for the first component of a path. See
+// ListRoots for what is allowed.
+func (c *CognosInstance) rootEntry(ctx context.Context, root string) FolderEntry {
+	entry := FolderEntry{
+		Type: Folder,
+	}
+	if root == "public" {
+		entry.ID, _ = c.findFolderRoots(ctx)
+		return entry
+	} else if root == "~" {
+		_, entry.ID = c.findFolderRoots(ctx)
+		return entry
+	}
+
+	// anything else is the name of a top level public folder
+	name := strings.TrimPrefix(root, "public:")
+	publicID, _ := c.findFolderRoots(ctx)
+	entry, exists := c.lsFolder(ctx, publicID)[name]
+	if !exists || entry.Type != Folder {
+		panic(&NotFoundError{Component: root, msg: "Invalid root folder " + root})
+	}
+	return entry
+}
+
+// tryCount converts RetryCount to the number of attempts for retry.
+// 0 retries is 1 attempt, and -1 (retry forever) stays -1.
+func (c *CognosInstance) tryCount() int {
+	if c.RetryCount < 0 {
+		return -1
+	}
+	return c.RetryCount + 1
+}
+
+// retryable returns false for HTTP statuses that mean trying again won't
+// help. 5xx errors, timeouts (408), and rate limiting (429) are always
+// retried. Cognos sometimes returns 401 for no good reason, so 401s are
+// retried too, unless we are retrying forever (a wrong password would
+// never stop). Other 4xx errors are never retried.
+func (c *CognosInstance) retryable(status int) bool {
+	switch {
+	case status >= 500, status == 408, status == 429:
+		return true
+	case status == 401:
+		return c.RetryCount >= 0
+	default:
+		return false
+	}
+}
+
+// defaultAccept is the Accept header sent when the caller dosen't pick one
+const defaultAccept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+// formContentType is the Content-Type for url.Values encoded bodies
+const formContentType = "application/x-www-form-urlencoded"
+
 // Request makes a HTTP GET request to the link (not including hostname)
 // provided via the "link" parameter. The response body is returned as a string.
 // Any errors (including a non-200 response) will cause this function to panic.
-func (c CognosInstance) Request(method string, link string, reqBody string) (respBody string) {
-	// limit concurrent requests
+// Once it gives up retrying, it panics with a *RequestError that says what
+// the last attempt got.
+func (c *CognosInstance) Request(method string, link string, reqBody string) (respBody string) {
+	return c.RequestWithHeaders(method, link, reqBody, nil)
+}
+
+// RequestWithHeaders is Request, but with extra headers. If there is a
+// request body and no Content-Type header, the body is assumed to be form
+// data (application/x-www-form-urlencoded). If there is no Accept header
+// one that asks for HTML is added. The headers are also sent on the
+// re-sent requests that happen during NTLM authentication.
+func (c *CognosInstance) RequestWithHeaders(method string, link string, reqBody string, headers http.Header) (respBody string) {
 	// background means don't give up waiting for lock
-	err := c.httpLockPool.Acquire(context.Background(), 1)
-	jgh.PanicOnErr(err)
-	defer c.httpLockPool.Release(1)
+	return c.requestContext(context.Background(), method, link, reqBody, headers)
+}
 
-	// it never makes sense to have a try count of 0, so we ask the user
-	// for retry count and convert it
-	var tryCount int
-	if c.RetryCount < 0 {
-		tryCount = -1
-	} else {
-		tryCount = c.RetryCount + 1
+// RequestContext is Request, but it returns an error instead of panicking,
+// and it gives up as soon as ctx is done, whether we are waiting for a
+// request slot (then the error is ErrBusy), waiting for the server, or
+// waiting to retry. If it gave up because of ctx, the error works with
+// errors.Is(err, ctx.Err()).
+func (c *CognosInstance) RequestContext(ctx context.Context, method string, link string, reqBody string) (respBody string, err error) {
+	err = catch(func() {
+		respBody = c.requestContext(ctx, method, link, reqBody, nil)
+	})
+	return respBody, err
+}
+
+// requestContext does the work for Request. If ctx is done while waiting
+// for a request slot it panics with ErrBusy, and if it is done while
+// retrying, it gives up.
+func (c *CognosInstance) requestContext(ctx context.Context, method string, link string, reqBody string, headers http.Header) (respBody string) {
+	c.requestStream(ctx, method, link, reqBody, headers, func(resp *http.Response) {
+		respBody = readAll(resp.Body)
+	})
+	return respBody
+}
+
+// requestStream is requestContext, but instead of returning the response
+// body it calls readResponse with the successful response. GETs are
+// retried, but anything else is only retried if it is marked with
+// withIdempotent, or the failure means the server never got it. Otherwise
+// it panics with ErrOutcomeUnknown. If readResponse
+// panics, the request is retried like any other failure, so readResponse
+// should start over each time it is called (or panic with a permanent
+// error if it can't). A 304 Not Modified counts as successful if the
+// request was conditional (If-None-Match or If-Modified-Since), and so does
+// a 206 Partial Content if it asked for a Range. headers are read again for
+// each attempt, so readResponse can change them for the next one (see
+// resumableDownload).
+func (c *CognosInstance) requestStream(ctx context.Context, method string, link string, reqBody string, headers http.Header, readResponse func(resp *http.Response)) {
+	if c.dryRun != nil {
+		panic(c.dryRunRequest(method, link, reqBody, headers))
 	}
 
-	success, _ := jgh.Try(int(c.RetryDelay), tryCount, true, "", func() bool {
-		// make an io.reader if we have post data
-		var reqBodyReader io.Reader
-		if len(reqBody) > 0 {
-			reqBodyReader = strings.NewReader(reqBody)
-		} else {
-			reqBodyReader = nil
+	conditional := headers.Get("If-None-Match") != "" || headers.Get("If-Modified-Since") != ""
+	idempotent := isIdempotent(ctx, method)
+
+	// Close waits for requests that have started, even if they are still
+	// waiting for a slot
+	leave := c.enter(ctx)
+	defer leave()
+
+	// if the credentials change while this is going, our session is no
+	// good after it
+	defer c.settleCredentials(c.credentialGeneration())
+
+	// limit concurrent requests
+	release := c.acquireSlot(ctx)
+	defer release()
+
+	// the retries all have to fit in OperationTimeout
+	callerCtx := ctx
+	if c.OperationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(c.OperationTimeout))
+		defer cancel()
+	}
+
+	tryCount := c.tryCount()
+
+	logError := func(err error) {
+		log.Println(c.scrub(err.Error()))
+	}
+	statusCode := 0
+	onRetry := func(attempt int, err error, delay time.Duration) {
+		c.retried(RetryInfo{
+			Link:       c.scrub(link),
+			Attempt:    attempt,
+			Err:        err,
+			StatusCode: statusCode,
+			Delay:      delay,
+		})
+	}
+	// these are for the RequestError if we give up
+	attempts, unauthorized := 0, 0
+	errorBody := ""
+	excerpt := func(body io.Reader) string {
+		start, _ := ioutil.ReadAll(io.LimitReader(body, maxErrorBody))
+		return c.scrub(strings.ToValidUTF8(string(start), ""))
+	}
+	err := retry(ctx, time.Second*time.Duration(c.RetryDelay), tryCount, logError, onRetry, c.sleep, func() {
+		attempts++
+		statusCode = 0
+		errorBody = ""
+		count(&c.stats.requests)
+		if attempts > 1 {
+			count(&c.stats.retries)
 		}
 
-		// set up and send a GET request (no body)
-		req, err := http.NewRequest(method, c.URL+link, reqBodyReader)
-		jgh.PanicOnErr(err)
-		req.SetBasicAuth(c.User, c.Pass)
-		resp, err := c.client.Do(req)
-		jgh.PanicOnErr(err)
+		settle := c.breakerAllow(ctx)
+		defer settle()
+		resp, err := c.send(ctx, method, link, reqBody, headers)
+		if err != nil && ctx.Err() == nil {
+			c.breakerResult(false)
+		}
+		if err != nil && !idempotent && !neverSent(err) {
+			panic(permanent(fmt.Errorf("%w: %s", ErrOutcomeUnknown, c.scrub(err.Error()))))
+		}
+		panicOnErr(err)
 		defer resp.Body.Close()
+		statusCode = resp.StatusCode
+		c.breakerResult(resp.StatusCode < 500)
+		if resp.StatusCode >= 500 && !idempotent {
+			// the server might have done it before falling over
+			errorBody = excerpt(resp.Body)
+			panic(permanent(fmt.Errorf("%w: %s", ErrOutcomeUnknown, resp.Status)))
+		}
 
 		// check HTTP response code
 		if resp.StatusCode == 401 {
+			count(&c.stats.unauthorized)
+			unauthorized++
+			errorBody = excerpt(resp.Body)
+			c.credentialsRejected()
 			// provide a bit of explination for this one, as it can be misleading
-			panic("Invalid Password. Cognos also returns this error randomly sometimes?")
-		} else if resp.StatusCode != 200 {
-			panic("Error from Cognos while logging on: " + resp.Status)
+			err := fmt.Errorf("%w: Invalid Password. Cognos also returns this error randomly sometimes?", ErrAuthFailed)
+			if !c.retryable(resp.StatusCode) {
+				err = permanent(err)
+			}
+			panic(err)
+		} else if resp.StatusCode != 200 && !(resp.StatusCode == 304 && conditional) &&
+			!(resp.StatusCode == 206 && headers.Get("Range") != "") {
+			err := errors.New("Error from Cognos while logging on: " + resp.Status)
+			// error pages often have a Cognos fault that says what went wrong
+			faultPage, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxFaultPage))
+			errorBody = excerpt(bytes.NewReader(faultPage))
+			if fault, found := parseFault(string(faultPage)); found {
+				err = fmt.Errorf("Error from Cognos while logging on: %s: %w", resp.Status, fault)
+			}
+			if !c.retryable(resp.StatusCode) {
+				err = permanent(err)
+			}
+			panic(err)
 		}
 
-		respBody = jgh.ReadAll(resp.Body)
-		return true
+		readResponse(resp)
 	})
-	if !success {
-		panic("Cognos request to " + link + " failed.")
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrClosed) {
+		panic(err)
 	}
-	return respBody
+	if err == nil {
+		return
+	}
+	reqErr := &RequestError{
+		Link:         c.scrub(link),
+		Status:       statusCode,
+		Body:         errorBody,
+		Attempts:     attempts,
+		Unauthorized: unauthorized,
+		err:          err,
+	}
+	if errors.Is(err, ErrOutcomeUnknown) {
+		reqErr.msg = fmt.Sprintf("Cognos %s request to %s: %v", method, c.scrub(link), err)
+	} else if ctx.Err() != nil && callerCtx.Err() == nil {
+		reqErr.msg = fmt.Sprintf("%v: Cognos request to %s took more than %d seconds (%d attempts): %s",
+			ErrOperationTimeout, c.scrub(link), c.OperationTimeout, attempts, c.scrub(err.Error()))
+		reqErr.err = fmt.Errorf("%w: %w", ErrOperationTimeout, err)
+	} else if callerCtx.Err() != nil {
+		reqErr.msg = c.scrub(fmt.Sprintf("Cognos request to %s was stopped (%v) after %d attempts: %v", link, callerCtx.Err(), attempts, err))
+		if !errors.Is(err, callerCtx.Err()) {
+			reqErr.err = fmt.Errorf("%w: %w", callerCtx.Err(), err)
+		}
+	} else {
+		reqErr.msg = c.scrub("Cognos request to " + link + " failed: " + err.Error())
+	}
+	panic(reqErr)
 }
 
-func (c *CognosInstance) findFolderRoots() (publicFolderID string, myFolderID string) {
-	respHTML := c.Request("GET", c.loginLink(), "")
+// findFolderRoots returns the public folder and "my folders" IDs for the
+// current DSN. They are only looked up once per DSN, even if several
+// goroutines ask at once.
+func (c *CognosInstance) findFolderRoots(ctx context.Context) (publicFolderID string, myFolderID string) {
+	// only one goroutine looks up the roots for a DSN at a time. The rest
+	// wait here and then find the roots in the cache.
+	fetchLock := c.roots.fetching.get(c.DSN)
+	fetchLock.Lock()
+	defer fetchLock.Unlock()
+
+	c.roots.lock.Lock()
+	cached, found := c.roots.byDSN[c.DSN]
+	c.roots.lock.Unlock()
+	if found {
+		return cached.public, cached.my
+	}
+
+	respHTML := c.requestContext(ctx, "GET", c.loginLink(), "", nil)
+	publicFolderID, myFolderID, err := ParseFolderRoots(respHTML)
+	if err != nil {
+		panic(c.dumpFailure(respHTML, err))
+	}
+
+	c.roots.lock.Lock()
+	c.roots.byDSN[c.DSN] = folderRoots{
+		public: publicFolderID,
+		my:     myFolderID,
+	}
+	c.roots.lock.Unlock()
 
+	return
+}
+
+// ParseFolderRoots finds the IDs of the public folders and "my folders"
+// on the portal home page (what we get when we log in). It dosen't make
+// any requests.
+func ParseFolderRoots(respHTML string) (publicFolderID string, myFolderID string, err error) {
 	// find the public folder ID from a regex.
 	pattern := regexp.MustCompile(`var g_PS_PFRootId = "([0-9a-zA-Z-]+)";`)
 	matchParts := pattern.FindStringSubmatch(respHTML)
 	if len(matchParts) < 2 {
-		panic("Unable to find Cognos public root folder ID")
+		return "", "", errors.New("Unable to find Cognos public root folder ID")
 	}
 	publicFolderID = matchParts[1]
 
@@ -277,11 +887,11 @@ func (c *CognosInstance) findFolderRoots() (publicFolderID string, myFolderID st
 	pattern = regexp.MustCompile(`var g_PS_MFRootId = "([0-9a-zA-Z-]+)";`)
 	matchParts = pattern.FindStringSubmatch(respHTML)
 	if len(matchParts) < 2 {
-		panic("Unable to find Cognos \"my folder\" ID")
+		return "", "", errors.New("Unable to find Cognos \"my folder\" ID")
 	}
 	myFolderID = matchParts[1]
 
-	return
+	return publicFolderID, myFolderID, nil
 }
 
 // BUG(jon): This just panics on questionable characters.
@@ -294,64 +904,141 @@ func cognosEscape(s string) string {
 	return s
 }
 
-// LsFolder returnes a map of folder/report names to objects. Each object
-// represents a folder entry. Each entry has a type (folder or report)
-// and an ID
-func (c CognosInstance) LsFolder(id string) map[string]FolderEntry {
-	respHTML := c.Request("GET", folderLinkFromID(id), "")
+// cleanEntryName cleans up the name of a folder entry from a listing. The
+// portal escapes names twice, so after the html parser is done with them
+// they still have entities in them (ex: "Attendance &amp; Discipline").
+// It also sometimes puts non-breaking spaces in names.
+func cleanEntryName(name string) string {
+	name = html.UnescapeString(name)
+	name = strings.Replace(name, "\u00a0", " ", -1)
+	return strings.TrimSpace(name)
+}
+
+// parseListing turns a folder listing page into a map of folder entries
+// keyed by name (see LsFolder). It panics if the page can't be parsed.
+func (c *CognosInstance) parseListing(id string, respHTML string) map[string]FolderEntry {
+	entries, err := parseFolderListing(respHTML, c.StrictListings)
+	var fault *Fault
+	if errors.As(err, &fault) {
+		panic(fmt.Errorf("Cognos returned an error when listing folder %s: %w", id, fault))
+	}
+	if err != nil {
+		panic(c.dumpFailure(respHTML, err))
+	}
+	return entries
+}
+
+// ParseFolderListing parses a folder listing page (what LsFolder gets from
+// the server) into a map of folder entries keyed by name. It dosen't make
+// any requests, so it is handy for checking a page you saved. If the page
+// is a Cognos error, err is the *Fault. Links that aren't folders or
+// reports are given to the parsers added with RegisterEntryParser, and if
+// none of them know what it is either, it is an Other entry.
+func ParseFolderListing(respHTML string) (entries map[string]FolderEntry, err error) {
+	return parseFolderListing(respHTML, false)
+}
 
+// parseFolderListing does the work for ParseFolderListing. If strict is
+// set, a link nobody can work out is an error instead of an Other entry.
+func parseFolderListing(respHTML string, strict bool) (entries map[string]FolderEntry, err error) {
 	// get all links in the main table. These correspond to folder entries.
 	docTree, err := htmlquery.Parse(strings.NewReader(respHTML))
-	jgh.PanicOnErr(err)
+	if err != nil {
+		return nil, err
+	}
 	query := `//td[@class="tableText"]/a]`
 	elements := htmlquery.Find(docTree, query)
+	if len(elements) == 0 {
+		// this might be an empty folder, or it might be an error page
+		if fault, found := parseFault(respHTML); found {
+			return nil, fault
+		}
+	}
 
 	// turn our html elements into a map of folder entries
 	// keyed by name
-	entries := make(map[string]FolderEntry)
+	entries = make(map[string]FolderEntry)
 	for _, element := range elements {
-		linkText := htmlquery.InnerText(element)
+		linkText := cleanEntryName(htmlquery.InnerText(element))
 		link := htmlquery.SelectAttr(element, "href")
 
 		// create an entry variable with only the name for now.
 		// we will fill in the other attributes
-		var entry FolderEntry
+		entry := FolderEntry{Name: linkText}
+
+		// hidden entries are greyed out with a class on their link
+		entry.Hidden = strings.Contains(" "+htmlquery.SelectAttr(element, "class")+" ", " hiddenObject ")
 
 		// Get the folder ID. This might not be a folder though,
 		// so don't panic if it isn't
-		foundID, _ := jgh.Try(0, 1, false, "", func() bool {
+		foundID := catch(func() {
 			entry.ID = folderIDFromLink(link)
-			// if we made it this far, it's a folder
+			// if we made it this far, it's a folder (or a package)
 			entry.Type = Folder
-
-			return true
-		})
+			entry.Package = packageLink.MatchString(link)
+		}) == nil
 
 		// if we haven't found the ID yet, try assuming it's a report
 		if !foundID {
-			foundID, _ = jgh.Try(0, 1, false, "", func() bool {
+			foundID = catch(func() {
 				// parse url so we can get reliable query params
 				urlObj, err := url.Parse(link)
-				jgh.PanicOnErr(err)
+				panicOnErr(err)
 				queryParams, err := url.ParseQuery(urlObj.RawQuery)
-				jgh.PanicOnErr(err)
+				panicOnErr(err)
 
 				// fill out our entry struct. This could fail if our link dosen't
 				// have a "ui.object"
 				entry.ID = queryParams["ui.object"][0]
 				entry.Type = Report
+				if queryParams.Get("ui.objectClass") == "jobDefinition" {
+					entry.Type = Job
+				}
+			}) == nil
+		}
 
-				return true
-			})
+		// maybe somebody else knows what it is
+		if !foundID {
+			var parsed FolderEntry
+			parsed, foundID = parseOtherEntry(linkText, link)
+			if foundID {
+				parsed.Hidden = parsed.Hidden || entry.Hidden
+				entry = parsed
+			}
 		}
 
-		// if we still haven't found the ID, panic
+		// if we still haven't found the ID, give up
 		if !foundID {
-			panic("Can not parse " + linkText + " as a folder or as a report")
+			if strict {
+				return nil, errors.New("Can not parse " + linkText + " as a folder or as a report")
+			}
+			entry.Type = Other
+			entry.Href = link
 		}
 
-		entries[linkText] = entry
+		entries[entry.Name] = entry
 	}
 
-	return entries
+	return entries, nil
+}
+
+// packageLink matches the links to packages in a folder listing, which
+// are otherwise the same as folder links
+var packageLink = regexp.MustCompile(`[?&]m_class=package(&|$)`)
+
+// catch runs f and returns any panic from it as an error. Panics that are
+// not errors are converted with fmt.Errorf.
+func catch(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if panicErr, isErr := r.(error); isErr {
+				err = panicErr
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+
+	f()
+	return nil
 }
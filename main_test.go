@@ -0,0 +1,461 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// TestMain keeps the failed attempts we log out of the test output,
+// unless it is verbose
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(ioutil.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// newTestInstance starts a fake server and makes an instance that uses
+// it. The instance dosen't actually wait between retries or polls.
+func newTestInstance(t *testing.T) (*cognostest.Server, *CognosInstance) {
+	t.Helper()
+	srv := cognostest.NewServer()
+	t.Cleanup(srv.Close)
+	c := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 3, 10, 4)
+	c.sleep = noSleep
+	return srv, c
+}
+
+// noSleep is a sleeper that only checks ctx
+func noSleep(ctx context.Context, d time.Duration) error {
+	return ctx.Err()
+}
+
+// countRequests returns how many requests the server has gotten where
+// match returns true
+func countRequests(srv *cognostest.Server, match func(r cognostest.Request) bool) int {
+	n := 0
+	for _, r := range srv.Requests() {
+		if match(r) {
+			n++
+		}
+	}
+	return n
+}
+
+// isRun returns true for a request that starts a report
+func isRun(r cognostest.Request) bool {
+	return r.Form.Get("b_action") == "cognosViewer" && r.Form.Get("ui.action") == "run"
+}
+
+// isHome returns true for a request for the portal home page (which is
+// where the folder roots come from)
+func isHome(r cognostest.Request) bool {
+	return strings.Contains(r.URL, "gohome=")
+}
+
+func TestWithDSNKeepsRootsSeperate(t *testing.T) {
+	srv, eschool := newTestInstance(t)
+	efinance := eschool.WithDSN("testfin")
+
+	schoolPublic, _ := eschool.findFolderRoots(context.Background())
+	if schoolPublic != srv.Public.ID {
+		t.Fatalf("eschool public root is %s, not %s", schoolPublic, srv.Public.ID)
+	}
+
+	// the other DSN has its own tree
+	schoolTree := srv.Public
+	srv.Public = &cognostest.Folder{Name: "Public Folders", ID: "finance-public"}
+	financePublic, _ := efinance.findFolderRoots(context.Background())
+	if financePublic != "finance-public" {
+		t.Fatalf("e-finance public root is %s, not finance-public", financePublic)
+	}
+
+	// neither one should have to look its roots up again, or get the
+	// other one's
+	schoolPublic, _ = eschool.findFolderRoots(context.Background())
+	financePublic, _ = efinance.findFolderRoots(context.Background())
+	if schoolPublic != schoolTree.ID || financePublic != "finance-public" {
+		t.Fatalf("roots got mixed up: eschool %s, e-finance %s", schoolPublic, financePublic)
+	}
+
+	var dsns []string
+	for _, r := range srv.Requests() {
+		if isHome(r) {
+			query, _ := url.ParseQuery(r.URL[strings.Index(r.URL, "?")+1:])
+			dsns = append(dsns, query.Get("dsn"))
+		}
+	}
+	if strings.Join(dsns, ",") != "testsms,testfin" {
+		t.Errorf("home page was requested with DSNs %v, want [testsms testfin]", dsns)
+	}
+}
+
+// isWait returns true for a request that checks on a running report
+func isWait(r cognostest.Request) bool {
+	return r.Form.Get("b_action") == "cognosViewer" && r.Form.Get("ui.action") == "wait"
+}
+
+// staticCredentials is a CredentialProvider that always returns user and pass
+func staticCredentials(user, pass string) CredentialProvider {
+	return func(ctx context.Context) (string, string, error) {
+		return user, pass, nil
+	}
+}
+
+// TestConcurrentUse is most useful with -race
+func TestConcurrentUse(t *testing.T) {
+	srv, c := newTestInstance(t)
+	folder := srv.Public.AddFolder("Attendance")
+	var reports []string
+	for i := 0; i < 4; i++ {
+		report := folder.AddReport(fmt.Sprintf("Report %d", i), fmt.Sprintf("n\n%d\n", i))
+		report.Polls = 2
+		reports = append(reports, report.ID)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entry, err := c.FolderEntryFromPathE([]string{"public", "Attendance"})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if entries, err := c.LsFolderE(entry.ID); err != nil || len(entries) != 4 {
+				errs <- fmt.Errorf("listing got %d entries: %v", len(entries), err)
+			}
+			want := fmt.Sprintf("n\n%d\n", i%4)
+			if csv, err := c.DownloadReportCSVE(reports[i%4]); err != nil || csv != want {
+				errs <- fmt.Errorf("report %d got %q: %v", i%4, csv, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if n := countRequests(srv, isHome); n != 1 {
+		t.Errorf("the folder roots were looked up %d times, want 1", n)
+	}
+	if max := srv.MaxInFlight(); max > 4 {
+		t.Errorf("%d requests were going at once, but the limit is 4", max)
+	}
+}
+
+// pageTransport answers every request with a 200 and the same page
+type pageTransport string
+
+func (p pageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader(string(p))),
+		Request:    req,
+	}, nil
+}
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryCount int
+		status     int
+		faults     int
+		attempts   int
+		works      bool
+	}{
+		{"0 disables retries", 0, 503, 1, 1, false},
+		{"2 retries that run out", 2, 503, 5, 3, false},
+		{"2 retries that are enough", 2, 503, 2, 3, true},
+		{"forever outlasts an outage", -1, 503, 25, 26, true},
+		{"forever stops on a 404", -1, 404, 1, 1, false},
+		{"forever stops on a 401", -1, 401, 1, 1, false},
+		{"a 401 is retried otherwise", 2, 401, 1, 2, true},
+	}
+	for _, test := range tests {
+		srv, c := newTestInstance(t)
+		c.RetryCount = test.retryCount
+		srv.InjectFaults(test.status, test.faults)
+
+		_, err := c.LsFolderE(srv.Public.ID)
+		if (err == nil) != test.works {
+			t.Errorf("%s: got %v", test.name, err)
+		}
+		if n := len(srv.Requests()); n != test.attempts {
+			t.Errorf("%s: made %d attempts, want %d", test.name, n, test.attempts)
+		}
+		var reqErr *RequestError
+		if errors.As(err, &reqErr) && reqErr.Attempts != test.attempts {
+			t.Errorf("%s: the error says %d attempts, want %d", test.name, reqErr.Attempts, test.attempts)
+		}
+	}
+}
+
+func TestMakeInstanceRejectsRetryCount(t *testing.T) {
+	err := catch(func() {
+		MakeInstance(`APSCN\test`, "test", "http://cognos.invalid", "esp", "testsms", 1, -2, 10, 4)
+	})
+	if err == nil {
+		t.Error("a retryCount of -2 was accepted")
+	}
+}
+
+// faultTransport answers every request with a 500 and the same page
+type faultTransport string
+
+func (f faultTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		Status:     "500 Internal Server Error",
+		StatusCode: 500,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader(string(f))),
+		Request:    req,
+	}, nil
+}
+
+func TestRequestWithHeaders(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RequestWithHeaders("POST", "/ibmcognos/cgi-bin/cognos.cgi", "b_action=xts.run", http.Header{"X-Test": {"yes"}})
+
+	sent := srv.Requests()[0].Header
+	if sent.Get("X-Test") != "yes" {
+		t.Error("the extra header wasn't sent")
+	}
+	if sent.Get("Content-Type") != formContentType {
+		t.Errorf("Content-Type is %q, want %q", sent.Get("Content-Type"), formContentType)
+	}
+	if sent.Get("Accept") != defaultAccept {
+		t.Errorf("Accept is %q", sent.Get("Accept"))
+	}
+}
+
+// authRecorder is a transport that remembers the basic auth user of the
+// last request before passing it on
+type authRecorder struct {
+	rt   http.RoundTripper
+	lock sync.Mutex
+	user string
+}
+
+func (a *authRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	a.lock.Lock()
+	a.user, _, _ = req.BasicAuth()
+	a.lock.Unlock()
+	return a.rt.RoundTrip(req)
+}
+
+func TestDomainAndUser(t *testing.T) {
+	srv := cognostest.NewServer()
+	defer srv.Close()
+
+	combined := MakeInstance(`APSCN\0401jpenn`, "pass", srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 4)
+	split := MakeInstance("0401jpenn", "pass", srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 4)
+	split.Domain = "APSCN"
+	for name, c := range map[string]*CognosInstance{"combined": combined, "split": split} {
+		if c.User != "0401jpenn" || c.Domain != "APSCN" {
+			t.Errorf("%s: User is %q and Domain is %q", name, c.User, c.Domain)
+		}
+		if user := c.Username(); user != "0401jpenn" {
+			t.Errorf("%s: Username is %q", name, user)
+		}
+
+		// NTLM gets the domain, but Cognos only ever sees the username
+		auth := &authRecorder{rt: c.Transport()}
+		c.SetTransport(auth)
+		c.LsFolder(srv.Public.ID)
+		if auth.user != `APSCN\0401jpenn` {
+			t.Errorf("%s: logged in as %q", name, auth.user)
+		}
+	}
+
+	noDomain := MakeInstance("0401jpenn@apscn.org", "pass", srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 4)
+	if noDomain.Domain != "" || noDomain.authUser() != "0401jpenn@apscn.org" {
+		t.Errorf("a user@domain user became %q, %q", noDomain.Domain, noDomain.authUser())
+	}
+}
+
+func TestDispatcherLogonUsesUsername(t *testing.T) {
+	srv := cognostest.NewServer()
+	defer srv.Close()
+	c := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 4)
+	c.DispatcherURL = srv.URL
+
+	// the fake dispatcher wants the username without APSCN\
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range srv.Requests() {
+		if r.Form.Get("h_CAM_action") == "logonAs" && r.Form.Get("CAMUsername") != "test" {
+			t.Errorf("logged on to the dispatcher as %q", r.Form.Get("CAMUsername"))
+		}
+	}
+}
+
+func TestEntryFromURL(t *testing.T) {
+	srv, c := newTestInstance(t)
+	folder := srv.Public.AddFolder("Attendance")
+	report := folder.AddReport("Daily", "a\n1\n")
+
+	links := map[string]FolderEntry{
+		folderLinkFromID(folder.ID):                         {Type: Folder, ID: folder.ID},
+		srv.URL + folderLinkFromID(folder.ID):               {Type: Folder, ID: folder.ID},
+		reportLinkFromID(report.ID):                         {Type: Report, ID: report.ID},
+		"  " + srv.URL + reportLinkFromID(report.ID) + "\n": {Type: Report, ID: report.ID},
+	}
+	for link, want := range links {
+		entry, err := c.EntryFromURL(link)
+		if err != nil || entry != want {
+			t.Errorf("%q: got %+v, %v, want %+v", link, entry, err, want)
+		}
+	}
+
+	// what comes back works with the rest of the API
+	entry, _ := c.EntryFromURL(srv.URL + folderLinkFromID(folder.ID))
+	if entries := c.LsFolder(entry.ID); entries["Daily"].ID != report.ID {
+		t.Errorf("listing the folder from the link got %v", entries)
+	}
+	entry, _ = c.EntryFromURL(srv.URL + reportLinkFromID(report.ID))
+	if csv := c.DownloadReportCSV(entry.ID); csv != report.CSV {
+		t.Errorf("running the report from the link got %q", csv)
+	}
+
+	bad := map[string]string{
+		"https://othercognos.example.com" + folderLinkFromID(folder.ID): "not",
+		srv.URL + "/ibmcognos/cgi-bin/cognos.cgi?b_action=xts.run":      "no folder ID",
+		"%zz": "unable to parse",
+	}
+	for link, want := range bad {
+		if _, err := c.EntryFromURL(link); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v, want an error with %q", link, err, want)
+		}
+	}
+}
+
+// entityListingPage is a folder listing like the portal's, which escapes
+// names twice, and sometimes puts non-breaking spaces in them
+const entityListingPage = `<html><body><table>
+<tr><td class="tableText"><a href="/ibmcognos/cgi-bin/cognos.cgi?b_action=xts.run&amp;m=portal/cc.xts&amp;m_folder=i1">Attendance &amp;amp; Discipline</a></td></tr>
+<tr><td class="tableText"><a href="/ibmcognos/cgi-bin/cognos.cgi?b_action=cognosViewer&amp;ui.action=run&amp;ui.object=i2">Bob&amp;#39;s Report</a></td></tr>
+<tr><td class="tableText"><a href="/ibmcognos/cgi-bin/cognos.cgi?b_action=cognosViewer&amp;ui.action=run&amp;ui.object=i3">Daily&amp;nbsp;Counts&nbsp;</a></td></tr>
+</table></body></html>`
+
+func TestParseFolderListingDecodesNames(t *testing.T) {
+	entries, err := ParseFolderListing(entityListingPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]FolderEntry{
+		"Attendance & Discipline": {Type: Folder, ID: "i1", Name: "Attendance & Discipline"},
+		"Bob's Report":            {Type: Report, ID: "i2", Name: "Bob's Report"},
+		"Daily Counts":            {Type: Report, ID: "i3", Name: "Daily Counts"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d entries, want %d: %v", len(entries), len(want), entries)
+	}
+	for name, entry := range want {
+		if entries[name] != entry {
+			t.Errorf("%q: got %+v, want %+v", name, entries[name], entry)
+		}
+	}
+}
+
+func TestParseFolderListing(t *testing.T) {
+	tests := []struct {
+		name    string
+		page    string
+		entries map[string]FolderEntry
+		fault   bool
+	}{
+		{"listing", `<html><body><table>
+<tr><td class="tableText"><a href="/ibmcognos/cgi-bin/cognos.cgi?b_action=xts.run&amp;m=portal/cc.xts&amp;m_folder=i1">Attendance</a></td></tr>
+<tr><td class="tableText"><a href="/ibmcognos/cgi-bin/cognos.cgi?b_action=cognosViewer&amp;ui.action=run&amp;ui.object=i2&amp;ui.objectClass=jobDefinition">Nightly</a></td></tr>
+<tr><td class="tableText"><a href="https://example.com/">Website</a></td></tr>
+</table></body></html>`, map[string]FolderEntry{
+			"Attendance": {Type: Folder, ID: "i1", Name: "Attendance"},
+			"Nightly":    {Type: Job, ID: "i2", Name: "Nightly"},
+			"Website":    {Type: Other, Name: "Website", Href: "https://example.com/"},
+		}, false},
+		{"empty folder", `<html><body><table></table></body></html>`, map[string]FolderEntry{}, false},
+		{"error page", rsvFaultPage, nil, true},
+	}
+	for _, test := range tests {
+		entries, err := ParseFolderListing(test.page)
+		var fault *Fault
+		if test.fault != errors.As(err, &fault) {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if !test.fault && err != nil {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+		if len(entries) != len(test.entries) {
+			t.Errorf("%s: got %d entries, want %d: %v", test.name, len(entries), len(test.entries), entries)
+			continue
+		}
+		for name, entry := range test.entries {
+			if entries[name] != entry {
+				t.Errorf("%s: %q is %+v, want %+v", test.name, name, entries[name], entry)
+			}
+		}
+	}
+}
+
+func TestParseFolderRoots(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   string
+		public string
+		my     string
+		err    bool
+	}{
+		{"home page", `<html><head><script>
+var g_PS_PFRootId = "i1A2b3C";
+var g_PS_MFRootId = "i4D5e6F";
+</script></head><body></body></html>`, "i1A2b3C", "i4D5e6F", false},
+		{"empty page", "", "", "", true},
+		{"no my folders", `<script>var g_PS_PFRootId = "i1A2b3C";</script>`, "", "", true},
+		{"login page", `<html><body><form name="loginForm"></form></body></html>`, "", "", true},
+	}
+	for _, test := range tests {
+		public, my, err := ParseFolderRoots(test.page)
+		if (err != nil) != test.err || public != test.public || my != test.my {
+			t.Errorf("%s: got %q, %q, %v", test.name, public, my, err)
+		}
+	}
+}
+
+func TestParseFolderListingHidden(t *testing.T) {
+	page := `<html><body><table>
+<tr><td class="tableText"><a href="/ibmcognos/cgi-bin/cognos.cgi?b_action=cognosViewer&amp;ui.action=run&amp;ui.object=i1">Daily</a></td></tr>
+<tr><td class="tableText"><a class="hiddenObject" href="/ibmcognos/cgi-bin/cognos.cgi?b_action=cognosViewer&amp;ui.action=run&amp;ui.object=i2">Old Daily</a></td></tr>
+</table></body></html>`
+	entries, err := ParseFolderListing(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries["Daily"].Hidden {
+		t.Error("Daily is hidden")
+	}
+	if want := (FolderEntry{Type: Report, ID: "i2", Name: "Old Daily", Hidden: true}); entries["Old Daily"] != want {
+		t.Errorf("got %+v, want %+v", entries["Old Daily"], want)
+	}
+}
@@ -0,0 +1,101 @@
+package cognos
+
+import (
+	"net/url"
+	"time"
+)
+
+// ManifestNode is one folder or report in a FolderManifest
+type ManifestNode struct {
+	Name string          `json:"name"`
+	ID   string          `json:"id"`
+	Type FolderEntryType `json:"type"`
+	// Path is relative to the root of the manifest
+	Path []string `json:"path"`
+	// Modified is when the entry was last changed, if we know. The
+	// portal folder listing dosen't say, so this is usually nil.
+	Modified *time.Time `json:"modified,omitempty"`
+	// Children is the contents of a folder
+	Children []*ManifestNode `json:"children,omitempty"`
+	// Error is set if this folder couldn't be listed
+	Error string `json:"error,omitempty"`
+}
+
+// FolderManifest is a snapshot of a folder tree
+type FolderManifest struct {
+	GeneratedAt time.Time `json:"generatedAt"`
+	// URL and DSN say where the manifest came from
+	URL  string        `json:"url"`
+	DSN  string        `json:"dsn"`
+	Root *ManifestNode `json:"root"`
+}
+
+// BuildManifest walks the folder with the given id and returns everything
+// in it. Folders that can't be listed have their Error set, and the rest
+// of the tree is still included.
+func (c *CognosInstance) BuildManifest(rootID string) FolderManifest {
+	manifest := FolderManifest{
+		GeneratedAt: time.Now(),
+		URL:         c.publicURL(),
+		DSN:         c.DSN,
+	}
+
+	// the node for each folder, keyed by its path
+	nodes := make(map[string]*ManifestNode)
+	c.WalkFolder(rootID, func(path []string, entry FolderEntry, err error) error {
+		key := pathCacheKey("", path)
+		if err != nil {
+			nodes[key].Error = err.Error()
+			return nil
+		}
+
+		if path == nil {
+			// so the root's path is [] instead of null in JSON
+			path = []string{}
+		}
+		node := &ManifestNode{
+			Name: entry.Name,
+			ID:   entry.ID,
+			Type: entry.Type,
+			Path: path,
+		}
+		if len(path) == 0 {
+			manifest.Root = node
+		} else {
+			parent := nodes[pathCacheKey("", path[:len(path)-1])]
+			parent.Children = append(parent.Children, node)
+		}
+		nodes[key] = node
+		return nil
+	})
+	return manifest
+}
+
+// Flat returns every entry in the manifest keyed by its path (see
+// JoinPath). The entries don't have their Children filled in.
+func (m FolderManifest) Flat() map[string]ManifestNode {
+	flat := make(map[string]ManifestNode)
+	var add func(node *ManifestNode)
+	add = func(node *ManifestNode) {
+		entry := *node
+		entry.Children = nil
+		flat[JoinPath(node.Path)] = entry
+		for _, child := range node.Children {
+			add(child)
+		}
+	}
+	if m.Root != nil {
+		add(m.Root)
+	}
+	return flat
+}
+
+// publicURL returns the instance URL without any credentials in it
+func (c *CognosInstance) publicURL() string {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return c.scrub(c.URL)
+	}
+	u.User = nil
+	return c.scrub(u.String())
+}
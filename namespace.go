@@ -0,0 +1,93 @@
+package cognos
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+)
+
+// Namespace is an authentication namespace offered by the Cognos gateway.
+// ID is the value used for CAMNamespace (ex: esp). Name is what the
+// login page shows to humans.
+type Namespace struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// namespaceSelectLink returns the portal link without a CAMNamespace, which
+// makes the gateway ask which namespace to use
+func (c *CognosInstance) namespaceSelectLink() string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?dsn=" + c.DSN +
+		"&spi_db_name=" + c.DSN +
+		"&b_action=xts.run" +
+		"&m=portal/cc.xts"
+}
+
+// parseNamespaces pulls the list of namespaces out of the gateway's
+// namespace selection page. If the gateway only has one namespace it
+// dosen't ask, so we look for the one it picked instead.
+func parseNamespaces(respHTML string) []Namespace {
+	docTree, err := htmlquery.Parse(strings.NewReader(respHTML))
+	panicOnErr(err)
+
+	// the normal case: a drop down with one option per namespace
+	var namespaces []Namespace
+	options := htmlquery.Find(docTree, `//select[@name="CAMNamespace"]/option`)
+	for _, option := range options {
+		id := htmlquery.SelectAttr(option, "value")
+		if id == "" {
+			// this is the "select a namespace" placeholder
+			continue
+		}
+		namespaces = append(namespaces, Namespace{
+			ID:   id,
+			Name: strings.TrimSpace(htmlquery.InnerText(option)),
+		})
+	}
+	if len(namespaces) > 0 {
+		return namespaces
+	}
+
+	// single namespace gateways put the namespace in a hidden field
+	input := htmlquery.FindOne(docTree, `//input[@name="CAMNamespace"]`)
+	if input != nil && htmlquery.SelectAttr(input, "value") != "" {
+		id := htmlquery.SelectAttr(input, "value")
+		return []Namespace{{ID: id, Name: id}}
+	}
+
+	// or sometimes only in a link
+	pattern := regexp.MustCompile(`CAMNamespace=([0-9a-zA-Z_.-]+)`)
+	if matchParts := pattern.FindStringSubmatch(respHTML); len(matchParts) > 1 {
+		return []Namespace{{ID: matchParts[1], Name: matchParts[1]}}
+	}
+
+	panic("Unable to find any namespaces on the Cognos login page")
+}
+
+// ListNamespaces returns the authentication namespaces the gateway offers.
+// It dosen't use c.Namespace, so it can be called on an instance made with
+// an empty namespace to find out what the namespace should be.
+func (c *CognosInstance) ListNamespaces() []Namespace {
+	return parseNamespaces(c.Request("GET", c.namespaceSelectLink(), ""))
+}
+
+// ValidateNamespace panics if c.Namespace is not one of the namespaces
+// offered by the gateway. Picking the wrong namespace otherwise shows up
+// as a confusing login loop, so setup tools should call this.
+func (c *CognosInstance) ValidateNamespace() {
+	namespaces := c.ListNamespaces()
+	for _, namespace := range namespaces {
+		if namespace.ID == c.Namespace {
+			return
+		}
+	}
+
+	var ids []string
+	for _, namespace := range namespaces {
+		ids = append(ids, namespace.ID)
+	}
+	panic("Namespace " + c.Namespace + " is not offered by Cognos. " +
+		"Valid namespaces are: " + strings.Join(ids, ", "))
+}
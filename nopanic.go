@@ -0,0 +1,43 @@
+package cognos
+
+// The functions here are the same as the ones without the E, but they
+// return an error instead of panicking. The error is the *OpError the
+// other one would have panicked with, so it says what was being done and
+// which request failed, and it unwraps to the reason (ex: a
+// *url.Error for a timeout, ErrReportFailed, or fs.ErrNotExist) so you
+// can decide if it is worth trying again.
+
+// DownloadReportCSVE is DownloadReportCSV, but it returns an error instead
+// of panicking
+func (c *CognosInstance) DownloadReportCSVE(id string) (csv string, err error) {
+	err = catch(func() {
+		csv = c.DownloadReportCSV(id)
+	})
+	return csv, err
+}
+
+// LsFolderE is LsFolder, but it returns an error instead of panicking
+func (c *CognosInstance) LsFolderE(id string) (entries map[string]FolderEntry, err error) {
+	err = catch(func() {
+		entries = c.LsFolder(id)
+	})
+	return entries, err
+}
+
+// FolderEntryFromPathE is FolderEntryFromPath, but it returns an error
+// instead of panicking
+func (c *CognosInstance) FolderEntryFromPathE(path []string) (entry FolderEntry, err error) {
+	err = catch(func() {
+		entry = c.FolderEntryFromPath(path)
+	})
+	return entry, err
+}
+
+// WithPriorityE is WithPriority, but it returns an error instead of
+// panicking
+func (c *CognosInstance) WithPriorityE(priority Priority) (derived *CognosInstance, err error) {
+	err = catch(func() {
+		derived = c.WithPriority(priority)
+	})
+	return derived, err
+}
@@ -0,0 +1,107 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// OpError is what LsFolder, FolderEntryFromPath, and DownloadReportCSV
+// (and the functions built on them) panic with when they fail. It says
+// what they were working on, and unwraps to the reason they failed, so
+// errors.Is still works (ex: with ErrReportFailed).
+type OpError struct {
+	// Op is the function that failed (ex: "LsFolder")
+	Op string
+	// ID is the folder or report it was working on. It is "" if it didn't
+	// get that far.
+	ID string
+	// Path is the path it was working on, if it knows it
+	Path []string
+	// Attempts is how many times the request that failed was tried, or 0
+	// if it wasn't a request that failed
+	Attempts int
+	Err      error
+}
+
+func (e *OpError) Error() string {
+	var target []string
+	if len(e.Path) > 0 {
+		target = append(target, strings.Join(e.Path, "/"))
+	}
+	if e.ID != "" {
+		target = append(target, e.ID)
+	}
+	msg := e.Op
+	if len(target) > 0 {
+		msg += " " + strings.Join(target, " ")
+	}
+	if e.Attempts > 0 {
+		msg += fmt.Sprintf(" (%d attempts)", e.Attempts)
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// maxErrorBody is how much of a response RequestError.Body keeps
+const maxErrorBody = 2 * 1024
+
+// RequestError is what Request (and everything that makes requests) panics
+// with when it gives up on a request. It unwraps to the reason the last
+// attempt failed (ex: a *url.Error for a timeout, or ErrAuthFailed), and
+// OpError gets its Attempts from here. Link and Body have already been
+// scrubbed of the password.
+type RequestError struct {
+	// Link is what was requested
+	Link string
+	// Status is the HTTP status code of the last attempt, or 0 if it
+	// didn't get a response (ex: the host was unreachable)
+	Status int
+	// Body is the start (up to 2KB) of the last attempt's response, if it
+	// got an error status
+	Body string
+	// Attempts is how many times the request was tried
+	Attempts int
+	// Unauthorized is how many of the attempts got a 401, so you can tell
+	// a password that is wrong from a server that is down
+	Unauthorized int
+
+	msg string
+	err error
+}
+
+func (e *RequestError) Error() string {
+	if e.Unauthorized > 0 {
+		return fmt.Sprintf("%s (%d of %d attempts got 401 Unauthorized)", e.msg, e.Unauthorized, e.Attempts)
+	}
+	return e.msg
+}
+
+func (e *RequestError) Unwrap() error { return e.err }
+
+// wrapOp turns a panic into an *OpError and panics again. Defer it at the
+// top of an operation. A panic that is already an *OpError (from an
+// operation inside this one) is left alone.
+func wrapOp(op string, id string, path []string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	err, isErr := r.(error)
+	if !isErr {
+		err = fmt.Errorf("%v", r)
+	}
+	if _, isOpErr := err.(*OpError); isOpErr {
+		panic(err)
+	}
+
+	opErr := &OpError{Op: op, ID: id, Path: path, Err: err}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		opErr.Attempts = reqErr.Attempts
+	}
+	panic(opErr)
+}
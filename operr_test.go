@@ -0,0 +1,58 @@
+package cognos
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOpErrorMessages(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 2
+	report := srv.Public.AddReport("Broken", "a\n1\n")
+	report.Broken = true
+
+	// a request that ran out of retries
+	srv.InjectFaults(503, 3)
+	_, err := c.LsFolderE(srv.Public.ID)
+	var opErr *OpError
+	if !errors.As(err, &opErr) || opErr.Op != "LsFolder" || opErr.ID != srv.Public.ID || opErr.Attempts != 3 {
+		t.Fatalf("got %#v", err)
+	}
+	want := "LsFolder " + srv.Public.ID + " (3 attempts): Cognos request to "
+	if !strings.HasPrefix(err.Error(), want) || !strings.Contains(err.Error(), "503") {
+		t.Errorf("%q should start with %q and have the status", err, want)
+	}
+
+	// a path that isn't there didn't fail a request
+	_, err = c.FolderEntryFromPathE([]string{"public", "Attendance"})
+	if !errors.As(err, &opErr) || opErr.Attempts != 0 || opErr.ID != "" {
+		t.Fatalf("got %#v", err)
+	}
+	if want := "FolderEntryFromPath public/Attendance: "; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("%q should start with %q", err, want)
+	}
+	var notFound *NotFoundError
+	if !errors.As(err, &notFound) {
+		t.Errorf("%v dosen't unwrap to the NotFoundError", err)
+	}
+
+	// an operation inside another one keeps its own OpError
+	_, err = c.DownloadReportCSVE(report.ID)
+	if !errors.As(err, &opErr) || opErr.Op != "DownloadReportCSV" || !errors.Is(err, ErrReportFailed) {
+		t.Errorf("got %#v", err)
+	}
+	if strings.Count(err.Error(), "DownloadReportCSV") != 1 {
+		t.Errorf("%q was wrapped more than once", err)
+	}
+}
+
+func TestWrapOpNonError(t *testing.T) {
+	err := catch(func() {
+		defer wrapOp("Test", "i1", nil)
+		panic("something broke")
+	})
+	if err == nil || err.Error() != "Test i1: something broke" {
+		t.Errorf("got %v", err)
+	}
+}
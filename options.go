@@ -0,0 +1,152 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// These are what NewInstance uses for anything that isn't given an Option.
+// They are the same as the defaults of the command line tool.
+const (
+	defaultNamespace          = "esp"
+	defaultRetryDelay         = 5
+	defaultRetryCount         = 3
+	defaultHTTPTimeout        = 300 * time.Second
+	defaultConcurrentRequests = 4
+)
+
+// Option changes how NewInstance makes an instance (ex: WithRetry). An
+// Option that is given a value that doesn't make sense makes NewInstance
+// return an error.
+type Option func(o *instanceOptions) error
+
+// instanceOptions are the settings Options change. They match the
+// parameters of MakeInstance.
+type instanceOptions struct {
+	namespace          string
+	retryDelay         uint
+	retryCount         int
+	httpTimeout        time.Duration
+	concurrentRequests uint
+	// client is from WithHTTPClient. timeoutSet is true if WithTimeout
+	// was used, so it wins over the client's Timeout.
+	client     *http.Client
+	timeoutSet bool
+}
+
+// NewInstance is MakeInstance, but only the things every instance needs
+// are parameters, and everything else is an Option. Anything without an
+// Option is the same as the command line tool's default: the esp
+// namespace, 3 retries 5 seconds apart, a 300 second HTTP timeout, and 4
+// requests at once. The instance is otherwise exactly what MakeInstance
+// would make with the same settings. If an Option is given something that
+// doesn't make sense (ex: WithConcurrency(0), which would leave every
+// request waiting for a slot forever) the error says so, and no instance
+// is made.
+func NewInstance(user, pass, url, dsn string, opts ...Option) (*CognosInstance, error) {
+	o := instanceOptions{
+		namespace:          defaultNamespace,
+		retryDelay:         defaultRetryDelay,
+		retryCount:         defaultRetryCount,
+		httpTimeout:        defaultHTTPTimeout,
+		concurrentRequests: defaultConcurrentRequests,
+	}
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, fmt.Errorf("invalid Cognos option: %w", err)
+		}
+	}
+	return newInstance(user, pass, url, dsn, o), nil
+}
+
+// WithNamespace sets the namespace (see MakeInstance)
+func WithNamespace(namespace string) Option {
+	return func(o *instanceOptions) error {
+		if namespace == "" {
+			return errors.New("the namespace can't be empty")
+		}
+		o.namespace = namespace
+		return nil
+	}
+}
+
+// WithRetry sets how long to wait before retrying a failed request (which
+// is also how often a running report is checked on, unless PollInterval is
+// set), and how many times to retry (see retryCount in MakeInstance). The
+// delay is rounded up to whole seconds.
+func WithRetry(delay time.Duration, count int) Option {
+	return func(o *instanceOptions) error {
+		if delay < 0 {
+			return fmt.Errorf("the retry delay can't be negative (got %v)", delay)
+		}
+		if count < -1 {
+			return fmt.Errorf("the retry count must be -1 (retry forever) or more (got %d)", count)
+		}
+		o.retryDelay = uint((delay + time.Second - 1) / time.Second)
+		o.retryCount = count
+		return nil
+	}
+}
+
+// WithTimeout sets how long a single HTTP request can take before we give
+// up on it (see OperationTimeout for a limit on all of the retries)
+func WithTimeout(d time.Duration) Option {
+	return func(o *instanceOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("the HTTP timeout must be more than 0 (got %v)", d)
+		}
+		o.httpTimeout = d
+		o.timeoutSet = true
+		return nil
+	}
+}
+
+// WithConcurrency sets how many requests can be going at once (see
+// concurrentRequests in MakeInstance)
+func WithConcurrency(n int) Option {
+	return func(o *instanceOptions) error {
+		if n < 1 {
+			return fmt.Errorf("the concurrency must be at least 1 (got %d)", n)
+		}
+		o.concurrentRequests = uint(n)
+		return nil
+	}
+}
+
+// WithHTTPClient makes the instance use client's settings. Its Transport
+// is used (with NTLM added if it dosen't already do it), and so is its
+// Timeout, unless WithTimeout is given too. We always keep our own cookies,
+// since SetCredentials needs to be able to throw them away, so its Jar
+// isn't used. client itself isn't changed.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *instanceOptions) error {
+		if client == nil {
+			return errors.New("the HTTP client can't be nil")
+		}
+		o.client = client
+		return nil
+	}
+}
+
+// useClient does the work for WithHTTPClient
+func (c *CognosInstance) useClient(client *http.Client, keepTimeout bool) {
+	timeout, jar := c.client.Timeout, c.client.Jar
+	c.client = *client
+	c.client.Jar = jar
+	if keepTimeout {
+		c.client.Timeout = timeout
+	}
+
+	rt := client.Transport
+	if rt == nil {
+		rt = newTransport(TransportOptions{}, c.concurrentRequests)
+	}
+	if _, isNTLM := rt.(ntlmssp.Negotiator); !isNTLM {
+		rt = ntlmssp.Negotiator{RoundTripper: rt}
+	}
+	c.client.Transport = rt
+}
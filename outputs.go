@@ -0,0 +1,137 @@
+package cognos
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// SavedOutput is one saved output version of a report (ex: from a
+// schedule that saves its output)
+type SavedOutput struct {
+	// ID is used with CleanupSavedOutputs
+	ID    string    `json:"id"`
+	Saved time.Time `json:"saved"`
+	// Status is "succeeded" or "failed", like RunRecord.Status
+	Status string `json:"status"`
+	// Formats are the output formats that were saved (ex: CSV, PDF)
+	Formats []string `json:"formats"`
+	// Size is the total size of the outputs in bytes, if Cognos says
+	Size int64 `json:"size"`
+}
+
+// Succeeded returns true if the run that saved the output succeeded
+func (o SavedOutput) Succeeded() bool {
+	return o.Status == "succeeded"
+}
+
+// savedOutputsLinkFromID returns a link to the output versions page of an
+// object
+func savedOutputsLinkFromID(id string) string {
+	return objectPageLink("portal/properties_outputversions.xts", id)
+}
+
+// ListSavedOutputs returns the saved output versions of the report with
+// the given id, newest first. A report with no saved outputs gets an
+// empty slice. If there is no such report it panics with an error that
+// wraps fs.ErrNotExist.
+func (c *CognosInstance) ListSavedOutputs(id string) []SavedOutput {
+	page := c.Request("GET", savedOutputsLinkFromID(id), "")
+
+	outputs := []SavedOutput{}
+	if !findJSVar(page, "g_PS_OutputVersions", &outputs) {
+		if fault, found := parseFault(page); found {
+			if isMissingObject(fault) {
+				panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when getting saved outputs for %s: %w", id, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when getting saved outputs for "+id))
+	}
+	// we don't trust the server to sort them
+	sort.SliceStable(outputs, func(i, j int) bool {
+		return outputs[i].Saved.After(outputs[j].Saved)
+	})
+	return outputs
+}
+
+// CleanupOptions changes how CleanupSavedOutputs works
+type CleanupOptions struct {
+	// DryRun returns what would be deleted without deleting anything
+	DryRun bool
+}
+
+// expiredOutputs picks which of outputs (newest first) CleanupSavedOutputs
+// deletes: everything after the newest keep, and everything saved more
+// than olderThan before now. keep and olderThan are ignored if they are 0.
+// The newest output that succeeded is never picked.
+func expiredOutputs(outputs []SavedOutput, keep int, olderThan time.Duration, now time.Time) []SavedOutput {
+	newestGood := -1
+	for i, output := range outputs {
+		if output.Succeeded() {
+			newestGood = i
+			break
+		}
+	}
+
+	expired := []SavedOutput{}
+	for i, output := range outputs {
+		if i == newestGood {
+			continue
+		}
+		tooMany := keep > 0 && i >= keep
+		tooOld := olderThan > 0 && now.Sub(output.Saved) > olderThan
+		if tooMany || tooOld {
+			expired = append(expired, output)
+		}
+	}
+	return expired
+}
+
+// CleanupSavedOutputs deletes the saved output versions of the report
+// with the given id that are beyond the newest keep versions, or were
+// saved more than olderThan ago. 0 means no limit for either. The newest
+// version that succeeded is never deleted, no matter what. It returns
+// what it deleted (or would have, for a dry run), newest first. If a
+// delete fails it panics, but the versions before it are already gone.
+func (c *CognosInstance) CleanupSavedOutputs(id string, keep int, olderThan time.Duration, opts CleanupOptions) []SavedOutput {
+	if keep < 0 || olderThan < 0 {
+		panic("keep and olderThan can't be negative")
+	}
+	expired := expiredOutputs(c.ListSavedOutputs(id), keep, olderThan, time.Now())
+	if opts.DryRun {
+		return expired
+	}
+
+	for _, output := range expired {
+		values := make(url.Values)
+		values.Set("b_action", "xts.run")
+		values.Set("m", "portal/properties_outputversions.xts")
+		values.Set("m_cmd", "delete")
+		values.Set("m_obj", objectSearchPath(id))
+		values.Set("m_version", output.ID)
+
+		// deleting something that is already gone is harmless, so this
+		// can be retried
+		ctx := withIdempotent(context.Background(), true)
+		page := c.requestContext(ctx, "POST", "/ibmcognos/cgi-bin/cognos.cgi", values.Encode(), nil)
+		if fault, found := parseFault(page); found {
+			if isMissingObject(fault) {
+				// someone else deleted it
+				continue
+			}
+			if isPermissionDenied(fault) {
+				panic(fmt.Errorf("%w: %s: %w", ErrPermissionDenied, id, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when deleting saved output %s of %s: %w", output.ID, id, fault))
+		}
+		var deleted bool
+		if !findJSVar(page, "g_PS_Deleted", &deleted) || !deleted {
+			panic(c.notUnderstood(page, "Cognos returned a page we could not understand when deleting saved output "+output.ID+" of "+id))
+		}
+	}
+	return expired
+}
@@ -0,0 +1,93 @@
+package cognos
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// outputIDs returns the IDs of outputs, joined with spaces
+func outputIDs(outputs []SavedOutput) string {
+	var ids []string
+	for _, output := range outputs {
+		ids = append(ids, output.ID)
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestExpiredOutputs(t *testing.T) {
+	now := time.Date(2024, 3, 14, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	// newest first. 2 is the newest one that worked.
+	outputs := []SavedOutput{
+		{ID: "1", Saved: now.Add(-1 * day), Status: "failed"},
+		{ID: "2", Saved: now.Add(-2 * day), Status: "succeeded"},
+		{ID: "3", Saved: now.Add(-3 * day), Status: "succeeded"},
+		{ID: "4", Saved: now.Add(-10 * day), Status: "failed"},
+		{ID: "5", Saved: now.Add(-30 * day), Status: "succeeded"},
+	}
+	tests := []struct {
+		name      string
+		keep      int
+		olderThan time.Duration
+		want      string
+	}{
+		{"no limits", 0, 0, ""},
+		{"keep 3", 3, 0, "4 5"},
+		{"keep 1 never deletes the newest good one", 1, 0, "3 4 5"},
+		{"older than a week", 0, 7 * day, "4 5"},
+		{"either one", 4, 9 * day, "4 5"},
+		{"everything is old", 0, time.Hour, "1 3 4 5"},
+	}
+	for _, test := range tests {
+		if got := outputIDs(expiredOutputs(outputs, test.keep, test.olderThan, now)); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+
+	// with nothing that worked, everything can go
+	failed := []SavedOutput{{ID: "1", Status: "failed"}, {ID: "2", Status: "failed"}}
+	if got := outputIDs(expiredOutputs(failed, 1, 0, now)); got != "2" {
+		t.Errorf("all failed: got %q", got)
+	}
+}
+
+func TestCleanupSavedOutputs(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Nightly", "a\n1\n")
+	now := time.Now().UTC().Truncate(time.Second)
+	// out of order, to make sure we sort them
+	report.SavedOutputs = []cognostest.SavedOutput{
+		{ID: "v3", Saved: now.Add(-3 * time.Hour), Status: "succeeded", Formats: []string{"CSV"}},
+		{ID: "v1", Saved: now.Add(-1 * time.Hour), Status: "failed"},
+		{ID: "v2", Saved: now.Add(-2 * time.Hour), Status: "succeeded", Formats: []string{"CSV", "PDF"}, Size: 2048},
+	}
+
+	if got := outputIDs(c.ListSavedOutputs(report.ID)); got != "v1 v2 v3" {
+		t.Errorf("listed %q", got)
+	}
+
+	deleted := c.CleanupSavedOutputs(report.ID, 1, 0, CleanupOptions{DryRun: true})
+	if outputIDs(deleted) != "v3" || len(report.SavedOutputs) != 3 {
+		t.Errorf("the dry run picked %q and left %d", outputIDs(deleted), len(report.SavedOutputs))
+	}
+	deleted = c.CleanupSavedOutputs(report.ID, 1, 0, CleanupOptions{})
+	if outputIDs(deleted) != "v3" || outputIDs(c.ListSavedOutputs(report.ID)) != "v1 v2" {
+		t.Errorf("deleted %q", outputIDs(deleted))
+	}
+
+	report.ReadOnly = true
+	err := catch(func() { c.CleanupSavedOutputs(report.ID, 0, time.Minute, CleanupOptions{}) })
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("a read only report got %v", err)
+	}
+
+	err = catch(func() { c.ListSavedOutputs("i404") })
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("a missing report got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package cognos
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/antchfx/htmlquery"
+)
+
+// ReportPackage is the package (data source) a report gets its data from
+type ReportPackage struct {
+	// Name is the package's name. It is "" if Broken is set, or if the
+	// report isn't based on a package (ex: it is a query on a data source
+	// connection), in which case SearchPath is "" too.
+	Name string `json:"name"`
+	// SearchPath is where the report says the package is (ex:
+	// /content/folder[@name='eSchool']/package[@name='Student'])
+	SearchPath string `json:"searchPath"`
+	// Broken is set if the package the report points to isn't there any
+	// more (ex: it was moved or renamed), so the report won't run
+	Broken bool `json:"broken,omitempty"`
+	// Err is why we couldn't look at the report (only used by
+	// ReportPackages)
+	Err error `json:"-"`
+}
+
+// GetReportPackage returns the package the report with the given id is
+// based on, from its properties page. A report whose package is gone is
+// not an error. It gets a ReportPackage with Broken set. If there is no
+// such report it panics with an error that wraps fs.ErrNotExist.
+func (c *CognosInstance) GetReportPackage(id string) ReportPackage {
+	page := c.Request("GET", propertiesLinkFromID(id), "")
+
+	docTree, err := htmlquery.Parse(strings.NewReader(page))
+	panicOnErr(err)
+	classInput := htmlquery.FindOne(docTree, `//input[@name="m_class"]`)
+	if classInput == nil {
+		if fault, found := parseFault(page); found {
+			if isMissingObject(fault) {
+				panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when getting the package of %s: %w", id, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when getting the package of "+id))
+	}
+	if folderClasses[htmlquery.SelectAttr(classInput, "value")] {
+		panic(fmt.Errorf("%s is a %s, not a report", id, htmlquery.SelectAttr(classInput, "value")))
+	}
+
+	var pkg ReportPackage
+	if pathInput := htmlquery.FindOne(docTree, `//input[@name="m_package"]`); pathInput != nil {
+		pkg.SearchPath = htmlquery.SelectAttr(pathInput, "value")
+	}
+	if nameInput := htmlquery.FindOne(docTree, `//input[@name="m_packageName"]`); nameInput != nil {
+		pkg.Name = cleanEntryName(htmlquery.SelectAttr(nameInput, "value"))
+	}
+	// Cognos still shows the path of a package that is gone, but it can't
+	// give us its name
+	pkg.Broken = pkg.SearchPath != "" && pkg.Name == ""
+	return pkg
+}
+
+// ReportPackages walks the folder with the given id (see WalkFolder) and
+// returns the package of every report under it, keyed by path (see
+// JoinPath), so you can tell which reports use a package. A report we
+// couldn't look at gets a ReportPackage with Err set instead of stopping
+// the walk, but the walk does stop if a folder can't be listed.
+func (c *CognosInstance) ReportPackages(id string) (map[string]ReportPackage, error) {
+	packages := make(map[string]ReportPackage)
+	err := c.WalkFolder(id, func(path []string, entry FolderEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type != Report {
+			return nil
+		}
+		var pkg ReportPackage
+		pkg.Err = catch(func() {
+			pkg = c.GetReportPackage(entry.ID)
+		})
+		packages[JoinPath(path)] = pkg
+		return nil
+	})
+	return packages, err
+}
+
+// PackageInfo is a package found by ListPackages
+type PackageInfo struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	// Folder is the path of the folder the package is in (see
+	// FolderEntryFromPath)
+	Folder []string `json:"folder"`
+}
+
+// ListPackages returns every package in the public folders that we can
+// see, in order by path. It lists every folder, so it can take a while on
+// a big server. Use ListPackagesUnder to only look in one folder.
+func (c *CognosInstance) ListPackages() ([]PackageInfo, error) {
+	var public FolderEntry
+	err := catch(func() {
+		public = c.FolderEntryFromPath([]string{"public"})
+	})
+	if err != nil {
+		return nil, err
+	}
+	packages, err := c.ListPackagesUnder(public.ID)
+	for i := range packages {
+		packages[i].Folder = append([]string{"public"}, packages[i].Folder...)
+	}
+	return packages, err
+}
+
+// ListPackagesUnder is ListPackages for the folder with the given id and
+// everything under it. Folder paths are relative to that folder (see
+// WalkFunc). If a folder can't be listed it stops and returns what it
+// found so far along with the error.
+func (c *CognosInstance) ListPackagesUnder(id string) ([]PackageInfo, error) {
+	packages := []PackageInfo{}
+	err := c.WalkFolder(id, func(path []string, entry FolderEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Package {
+			return nil
+		}
+		packages = append(packages, PackageInfo{
+			Name:   entry.Name,
+			ID:     entry.ID,
+			Folder: path[:len(path)-1],
+		})
+		// what is in a package isn't other packages
+		return SkipFolder
+	})
+	return packages, err
+}
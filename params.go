@@ -0,0 +1,267 @@
+package cognos
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MultiValueSeparator seperates the values for a multi-select prompt in a
+// params map (ex: "101\n102\n103")
+const MultiValueSeparator = "\n"
+
+// ParamError is one problem with a prompt value
+type ParamError struct {
+	// Name is the prompt (parameter) name
+	Name    string
+	Problem string
+}
+
+func (e ParamError) Error() string {
+	return e.Name + ": " + e.Problem
+}
+
+// ParamErrors is every problem ValidateParams found
+type ParamErrors []ParamError
+
+func (e ParamErrors) Error() string {
+	problems := make([]string, len(e))
+	for i, paramErr := range e {
+		problems[i] = paramErr.Error()
+	}
+	return "invalid prompt values: " + strings.Join(problems, "; ")
+}
+
+// checkParamValue returns why value isn't valid for a prompt of the given
+// type, or "" if it is. Types we don't know about are assumed to be ok.
+func checkParamValue(promptType string, value string) string {
+	var err error
+	switch promptType {
+	case "xsdInt", "xsdInteger", "xsdLong", "xsdShort":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "xsdDecimal", "xsdDouble", "xsdFloat":
+		_, err = strconv.ParseFloat(value, 64)
+	case "xsdBoolean":
+		_, err = strconv.ParseBool(value)
+	case "xsdDate":
+		_, err = time.Parse("2006-01-02", value)
+	case "xsdDateTime":
+		_, err = time.Parse("2006-01-02T15:04:05", value)
+	}
+	if err != nil {
+		return fmt.Sprintf("%q is not a valid %s", value, promptType)
+	}
+	return ""
+}
+
+// validateParams checks params against prompts (see ValidateParams)
+func validateParams(prompts []Prompt, params map[string]string) error {
+	var problems ParamErrors
+	for _, name := range missingPrompts(prompts, params) {
+		problems = append(problems, ParamError{Name: name, Problem: "a value is required"})
+	}
+	for _, name := range unknownParams(prompts, params) {
+		problems = append(problems, ParamError{Name: name, Problem: "the report dosen't prompt for this"})
+	}
+
+	for _, prompt := range prompts {
+		value, found := params[prompt.Name]
+		if !found {
+			continue
+		}
+		values := strings.Split(value, MultiValueSeparator)
+		if len(values) > 1 && !prompt.Multi {
+			problems = append(problems, ParamError{Name: prompt.Name, Problem: "only one value is allowed"})
+		}
+		for _, v := range values {
+			if isSelectChoices(v) {
+				continue
+			}
+			if problem := checkParamValue(prompt.Type, v); problem != "" {
+				problems = append(problems, ParamError{Name: prompt.Name, Problem: problem})
+			}
+		}
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Name < problems[j].Name
+	})
+	return problems
+}
+
+// ValidateParams checks prompt values against what the report with the
+// given id asks for (see GetReportPrompts), without running it. It finds
+// required prompts that are missing, names the report dosen't prompt for,
+// values that aren't the right type (dates are 2006-01-02, date-times
+// are 2006-01-02T15:04:05), and more than one value (see
+// MultiValueSeparator) for a prompt that only takes one. Ranges (see
+// RangeValue) aren't checked. It returns nil if everything is fine, or
+// ParamErrors with every problem.
+func (c *CognosInstance) ValidateParams(id string, params map[string]string) error {
+	return validateParams(c.GetReportPrompts(id), params)
+}
+
+// paramsQuery turns prompt values into p_ URL parameters. Multi-select
+// values are sent as the same parameter more than once. The result is
+// sorted, so it can be used in a cache key.
+func paramsQuery(params map[string]string) string {
+	values := make(url.Values)
+	addParams(values, params)
+	return values.Encode()
+}
+
+// addParams adds prompt values to a form as p_ parameters, like
+// paramsQuery
+func addParams(values url.Values, params map[string]string) {
+	for name, value := range params {
+		values["p_"+name] = strings.Split(value, MultiValueSeparator)
+	}
+}
+
+// ParamValue is a typed prompt value, so you don't have to know how Cognos
+// wants dates, ranges, and multi-select values written. Turn them into a
+// params map (for DownloadOptions.Params, CreateReportView, etc) with
+// EncodeParams. The types are StringValue, IntValue, DateValue,
+// RangeValue, and MultiValue.
+type ParamValue interface {
+	// paramValues returns what goes in the p_ parameter. There is more
+	// than one for a multi-select.
+	paramValues() []string
+}
+
+// StringValue is a prompt value that is sent as is
+type StringValue string
+
+// IntValue is a whole number prompt value
+type IntValue int64
+
+// DateValue is a date prompt value. Only the date matters (in the
+// time.Time's own location, not converted to UTC or local time), and it
+// is always sent as 2006-01-02 no matter what locale we are in.
+type DateValue time.Time
+
+// RangeValue is a prompt value for a range prompt (ex: a between filter).
+// From or To can be nil for a range that is open on that end, but not
+// both. They can't be ranges or multi-selects themselves.
+type RangeValue struct {
+	From ParamValue
+	To   ParamValue
+}
+
+// MultiValue is a multi-select prompt value. It can have ranges in it, as
+// long as the prompt allows ranges.
+type MultiValue []ParamValue
+
+func (v StringValue) paramValues() []string {
+	return []string{string(v)}
+}
+
+func (v IntValue) paramValues() []string {
+	return []string{strconv.FormatInt(int64(v), 10)}
+}
+
+func (v DateValue) paramValues() []string {
+	return []string{time.Time(v).Format("2006-01-02")}
+}
+
+// Ranges (and multi-selects with ranges in them) are sent as one
+// selectChoices XML value, which is how Cognos writes them itself.
+func (v RangeValue) paramValues() []string {
+	return []string{"<selectChoices>" + v.choice() + "</selectChoices>"}
+}
+
+func (v MultiValue) paramValues() []string {
+	hasRange := false
+	for _, value := range v {
+		if _, isRange := value.(RangeValue); isRange {
+			hasRange = true
+		}
+	}
+
+	if !hasRange {
+		// plain values are sent as the same parameter more than once
+		var values []string
+		for _, value := range v {
+			values = append(values, singleParamValue(value))
+		}
+		return values
+	}
+
+	var choices strings.Builder
+	choices.WriteString("<selectChoices>")
+	for _, value := range v {
+		if r, isRange := value.(RangeValue); isRange {
+			choices.WriteString(r.choice())
+		} else {
+			choices.WriteString(selectBound("selectOption", singleParamValue(value)))
+		}
+	}
+	choices.WriteString("</selectChoices>")
+	return []string{choices.String()}
+}
+
+// choice returns the range as one of the choices in a selectChoices
+func (v RangeValue) choice() string {
+	switch {
+	case v.From != nil && v.To != nil:
+		return "<selectBoundRange>" +
+			selectBound("start", singleParamValue(v.From)) +
+			selectBound("end", singleParamValue(v.To)) +
+			"</selectBoundRange>"
+	case v.From != nil:
+		return "<selectUnboundedEndRange>" +
+			selectBound("start", singleParamValue(v.From)) +
+			"</selectUnboundedEndRange>"
+	case v.To != nil:
+		return "<selectUnboundedStartRange>" +
+			selectBound("end", singleParamValue(v.To)) +
+			"</selectUnboundedStartRange>"
+	default:
+		panic("a RangeValue needs a From or a To")
+	}
+}
+
+// selectBound returns an element of a selectChoices with value as both the
+// use and display value
+func selectBound(element string, value string) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(value))
+	return "<" + element +
+		` useValue="` + escaped.String() + `"` +
+		` displayValue="` + escaped.String() + `"/>`
+}
+
+// singleParamValue returns the one value of a prompt value that can't be
+// a range or a multi-select (ex: the ends of a range)
+func singleParamValue(value ParamValue) string {
+	switch value.(type) {
+	case RangeValue, MultiValue:
+		panic(fmt.Sprintf("%T can't be inside a range or a multi-select", value))
+	}
+	return value.paramValues()[0]
+}
+
+// EncodeParams turns typed prompt values into the params map taken by
+// DownloadOptions.Params, CreateReportView, SaveDefaultPromptValues, and
+// EmailDelivery.Params. It panics if a value can't be encoded (ex: a range
+// inside a range).
+func EncodeParams(params map[string]ParamValue) map[string]string {
+	encoded := make(map[string]string, len(params))
+	for name, value := range params {
+		encoded[name] = strings.Join(value.paramValues(), MultiValueSeparator)
+	}
+	return encoded
+}
+
+// isSelectChoices returns true for a value in Cognos's XML format (see
+// RangeValue), which we can't check the type of
+func isSelectChoices(value string) bool {
+	return strings.HasPrefix(value, "<selectChoices>")
+}
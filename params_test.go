@@ -0,0 +1,75 @@
+package cognos
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncodeParams(t *testing.T) {
+	day := DateValue(time.Date(2024, 8, 15, 23, 30, 0, 0, time.FixedZone("CST", -6*60*60)))
+	tests := []struct {
+		name  string
+		value ParamValue
+		want  string
+	}{
+		{"string", StringValue("Lincoln & Sons"), "Lincoln & Sons"},
+		{"int", IntValue(-42), "-42"},
+		// not converted to UTC, which would be the 16th
+		{"date", day, "2024-08-15"},
+		{"multi", MultiValue{IntValue(1), StringValue("two")}, "1\ntwo"},
+		{"range", RangeValue{From: IntValue(1), To: IntValue(10)},
+			`<selectChoices><selectBoundRange><start useValue="1" displayValue="1"/><end useValue="10" displayValue="10"/></selectBoundRange></selectChoices>`},
+		{"from", RangeValue{From: day},
+			`<selectChoices><selectUnboundedEndRange><start useValue="2024-08-15" displayValue="2024-08-15"/></selectUnboundedEndRange></selectChoices>`},
+		{"to", RangeValue{To: StringValue("<b>")},
+			`<selectChoices><selectUnboundedStartRange><end useValue="&lt;b&gt;" displayValue="&lt;b&gt;"/></selectUnboundedStartRange></selectChoices>`},
+		{"multi with range", MultiValue{StringValue("A"), RangeValue{From: IntValue(5), To: IntValue(6)}},
+			`<selectChoices><selectOption useValue="A" displayValue="A"/><selectBoundRange><start useValue="5" displayValue="5"/><end useValue="6" displayValue="6"/></selectBoundRange></selectChoices>`},
+	}
+	for _, test := range tests {
+		got := EncodeParams(map[string]ParamValue{"p": test.value})
+		if got["p"] != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got["p"], test.want)
+		}
+	}
+}
+
+func TestEncodeParamsPanics(t *testing.T) {
+	bad := []ParamValue{
+		RangeValue{},
+		RangeValue{From: RangeValue{From: IntValue(1)}},
+		RangeValue{To: MultiValue{IntValue(1)}},
+		MultiValue{MultiValue{IntValue(1)}},
+	}
+	for _, value := range bad {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%#v didn't panic", value)
+				}
+			}()
+			EncodeParams(map[string]ParamValue{"p": value})
+		}()
+	}
+}
+
+func TestEncodedParamsSent(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "a\n1\n")
+
+	c.DownloadReport(report.ID, DownloadOptions{Params: EncodeParams(map[string]ParamValue{
+		"School": MultiValue{IntValue(10), IntValue(20)},
+		"Since":  DateValue(time.Date(2024, 8, 15, 0, 0, 0, 0, time.UTC)),
+	})})
+	var sent map[string][]string
+	for _, r := range srv.Requests() {
+		if isRun(r) {
+			sent = map[string][]string{"p_School": r.Form["p_School"], "p_Since": r.Form["p_Since"]}
+		}
+	}
+	want := map[string][]string{"p_School": {"10", "20"}, "p_Since": {"2024-08-15"}}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("sent %q", sent)
+	}
+}
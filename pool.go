@@ -0,0 +1,107 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// PoolMember is one instance in a Pool (ex: one district)
+type PoolMember struct {
+	// Key is what you pass to Pool.Get to get this instance
+	Key    string
+	Config Config
+}
+
+// Pool is a group of instances, usually one per district, that share a
+// budget of requests going at once. Everything else (sessions, cookies,
+// folder roots, caches) is kept seperate for each instance.
+type Pool struct {
+	instances map[string]*CognosInstance
+	keys      []string
+}
+
+// MakePool makes an instance from each member's Config. Each instance is
+// still limited by its own ConcurrentRequests, but on top of that no more
+// than concurrentRequests requests are going at once across the whole
+// pool. It panics if a Config is invalid, or if two members have the same
+// Key.
+func MakePool(concurrentRequests uint, members []PoolMember) *Pool {
+	budget := newSlotQueue(concurrentRequests)
+	p := &Pool{instances: make(map[string]*CognosInstance)}
+	for _, member := range members {
+		if _, dup := p.instances[member.Key]; dup {
+			panic(fmt.Errorf("the pool has more than one member with the key %q", member.Key))
+		}
+		c := member.Config.MakeInstance()
+		c.budget = budget
+		p.instances[member.Key] = c
+		p.keys = append(p.keys, member.Key)
+	}
+	sort.Strings(p.keys)
+	return p
+}
+
+// Get returns the instance for a key. It panics if there isn't one.
+func (p *Pool) Get(key string) *CognosInstance {
+	c, found := p.instances[key]
+	if !found {
+		panic(fmt.Errorf("no instance in the pool for %q", key))
+	}
+	return c
+}
+
+// Keys returns the key of every instance in the pool, sorted
+func (p *Pool) Keys() []string {
+	return append([]string(nil), p.keys...)
+}
+
+// Stats adds up the Stats of every instance in the pool
+func (p *Pool) Stats() Stats {
+	total := Stats{Queued: make(map[Priority]int)}
+	for _, c := range p.instances {
+		stats := c.Stats()
+		total.Requests += stats.Requests
+		total.Retries += stats.Retries
+		total.Unauthorized += stats.Unauthorized
+		total.ReportsRun += stats.ReportsRun
+		total.Polls += stats.Polls
+		total.PollFailures += stats.PollFailures
+		total.BytesDownloaded += stats.BytesDownloaded
+		total.CacheHits += stats.CacheHits
+		total.CacheMisses += stats.CacheMisses
+		total.ListingHits += stats.ListingHits
+		total.ListingMisses += stats.ListingMisses
+		total.InFlight += stats.InFlight
+		total.Waiting += stats.Waiting
+		for priority, queued := range stats.Queued {
+			total.Queued[priority] += queued
+		}
+	}
+	return total
+}
+
+// Close closes every instance in the pool at the same time (see
+// CognosInstance.Close), and returns all their errors joined together.
+func (p *Pool) Close(ctx context.Context) error {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+	for _, key := range p.keys {
+		key := key
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.instances[key].Close(ctx)
+			if err != nil {
+				lock.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
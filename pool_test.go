@@ -0,0 +1,70 @@
+package cognos
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// poolMember makes a PoolMember that uses srv
+func poolMember(key string, srv *cognostest.Server) PoolMember {
+	return PoolMember{Key: key, Config: Config{
+		User:               srv.User,
+		Pass:               srv.Pass,
+		URL:                srv.URL,
+		Namespace:          srv.Namespace,
+		DSN:                srv.DSN,
+		RetryDelay:         1,
+		HTTPTimeout:        10,
+		ConcurrentRequests: 4,
+	}}
+}
+
+func TestPoolSharesBudget(t *testing.T) {
+	srv := cognostest.NewServer()
+	defer srv.Close()
+	srv.Delay = 20 * time.Millisecond
+	pool := MakePool(2, []PoolMember{poolMember("bentonville", srv), poolMember("rogers", srv)})
+
+	if keys := strings.Join(pool.Keys(), ","); keys != "bentonville,rogers" {
+		t.Errorf("got keys %s", keys)
+	}
+
+	// each instance would allow 4 at once, but the pool only allows 2
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		c := pool.Get(pool.Keys()[i%2])
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.LsFolder(srv.Public.ID)
+		}()
+	}
+	wg.Wait()
+	if max := srv.MaxInFlight(); max != 2 {
+		t.Errorf("%d requests were going at once, want 2", max)
+	}
+
+	// everything else is per instance
+	if pool.Get("bentonville").client.Jar == pool.Get("rogers").client.Jar {
+		t.Error("the instances share cookies")
+	}
+	if stats := pool.Stats(); stats.Requests != int64(len(srv.Requests())) {
+		t.Errorf("the pool made %d requests, but the server got %d", stats.Requests, len(srv.Requests()))
+	}
+}
+
+func TestPoolPanics(t *testing.T) {
+	srv := cognostest.NewServer()
+	defer srv.Close()
+	if err := catch(func() { MakePool(2, []PoolMember{poolMember("a", srv), poolMember("a", srv)}) }); err == nil {
+		t.Error("two members with the same key were accepted")
+	}
+	pool := MakePool(2, []PoolMember{poolMember("a", srv)})
+	if err := catch(func() { pool.Get("b") }); err == nil {
+		t.Error("getting a key that isn't in the pool worked")
+	}
+}
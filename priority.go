@@ -0,0 +1,165 @@
+package cognos
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Priority decides who gets the next free request slot (see WithPriority)
+type Priority uint
+
+const (
+	// NormalPriority is the default
+	NormalPriority Priority = iota
+	// HighPriority requests get a free slot before anything else
+	HighPriority Priority = iota
+	// LowPriority requests only get a free slot when nothing else is
+	// waiting (but see LowPriorityMaxWait)
+	LowPriority Priority = iota
+)
+
+// numPriorities is how many Priority values there are
+const numPriorities = 3
+
+// String returns "normal", "high", or "low"
+func (p Priority) String() string {
+	switch p {
+	case HighPriority:
+		return "high"
+	case LowPriority:
+		return "low"
+	default:
+		return "normal"
+	}
+}
+
+// WithPriority returns a copy of c whose requests wait for a request slot
+// at the given priority. When a slot frees up, it goes to the highest
+// priority request that is waiting, and to the one that has waited the
+// longest within a priority. The copy shares everything else with c,
+// including the slots, like WithDSN. It panics if priority isn't one of
+// the Priority constants.
+func (c *CognosInstance) WithPriority(priority Priority) *CognosInstance {
+	if priority >= numPriorities {
+		panic(fmt.Errorf("%d is not a priority (use HighPriority, NormalPriority, or LowPriority)", priority))
+	}
+	derived := *c
+	derived.priority = priority
+	return &derived
+}
+
+// slotWaiter is a request waiting for a slot
+type slotWaiter struct {
+	ready    chan struct{}
+	priority Priority
+	queued   time.Time
+	// promoteAt is when a low priority waiter starts being treated as a
+	// normal one. It is zero for never.
+	promoteAt time.Time
+}
+
+// slotQueue is a semaphore where waiters are let in by priority, then in
+// the order they started waiting
+type slotQueue struct {
+	lock    sync.Mutex
+	size    int
+	used    int
+	waiters [numPriorities]*list.List
+}
+
+func newSlotQueue(size uint) *slotQueue {
+	q := &slotQueue{size: int(size)}
+	for i := range q.waiters {
+		q.waiters[i] = list.New()
+	}
+	return q
+}
+
+// waiting returns how many waiters there are at each priority
+func (q *slotQueue) waiting() (counts [numPriorities]int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, waiters := range q.waiters {
+		counts[i] = waiters.Len()
+	}
+	return counts
+}
+
+// acquire waits for a slot, or until ctx is done. A low priority waiter is
+// treated as a normal one after maxLowWait (0 means never).
+func (q *slotQueue) acquire(ctx context.Context, priority Priority, maxLowWait time.Duration) error {
+	q.lock.Lock()
+	empty := true
+	for _, waiters := range q.waiters {
+		empty = empty && waiters.Len() == 0
+	}
+	if q.used < q.size && empty {
+		q.used++
+		q.lock.Unlock()
+		return nil
+	}
+
+	waiter := &slotWaiter{
+		ready:    make(chan struct{}),
+		priority: priority,
+		queued:   time.Now(),
+	}
+	if priority == LowPriority && maxLowWait > 0 {
+		waiter.promoteAt = waiter.queued.Add(maxLowWait)
+	}
+	elem := q.waiters[priority].PushBack(waiter)
+	q.lock.Unlock()
+
+	select {
+	case <-waiter.ready:
+		return nil
+	case <-ctx.Done():
+		q.lock.Lock()
+		select {
+		case <-waiter.ready:
+			// we were given the slot just as we gave up, so pass it on
+			q.lock.Unlock()
+			q.release()
+		default:
+			q.waiters[priority].Remove(elem)
+			q.lock.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// release gives a slot back, handing it straight to the next waiter if
+// there is one
+func (q *slotQueue) release() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if elem := q.next(); elem != nil {
+		waiter := elem.Value.(*slotWaiter)
+		q.waiters[waiter.priority].Remove(elem)
+		close(waiter.ready)
+		return
+	}
+	q.used--
+}
+
+// next returns the waiter that should get the next slot, or nil. The
+// queue must be locked.
+func (q *slotQueue) next() *list.Element {
+	if front := q.waiters[HighPriority].Front(); front != nil {
+		return front
+	}
+	normal := q.waiters[NormalPriority].Front()
+	low := q.waiters[LowPriority].Front()
+	if low != nil {
+		lowWaiter := low.Value.(*slotWaiter)
+		promoted := !lowWaiter.promoteAt.IsZero() && time.Now().After(lowWaiter.promoteAt)
+		if normal == nil || (promoted && lowWaiter.queued.Before(normal.Value.(*slotWaiter).queued)) {
+			return low
+		}
+	}
+	return normal
+}
@@ -0,0 +1,129 @@
+package cognos
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queueInOrder has each priority in order wait for a slot in q (one at a
+// time, so they queue in that order), and returns the order they got one
+func queueInOrder(t *testing.T, q *slotQueue, maxLowWait time.Duration, priorities ...Priority) []Priority {
+	var lock sync.Mutex
+	var order []Priority
+	var wg sync.WaitGroup
+	for i, priority := range priorities {
+		wg.Add(1)
+		go func(priority Priority) {
+			defer wg.Done()
+			q.acquire(context.Background(), priority, maxLowWait)
+			lock.Lock()
+			order = append(order, priority)
+			lock.Unlock()
+			q.release()
+		}(priority)
+		waitFor(t, "the waiter to queue", func() bool {
+			total := 0
+			for _, n := range q.waiting() {
+				total += n
+			}
+			return total == i+1
+		})
+	}
+	// let them go
+	q.release()
+	wg.Wait()
+	return order
+}
+
+func TestSlotQueueOrder(t *testing.T) {
+	q := newSlotQueue(1)
+	q.acquire(context.Background(), NormalPriority, 0)
+	order := queueInOrder(t, q, 0, LowPriority, NormalPriority, HighPriority, NormalPriority, HighPriority)
+	want := []Priority{HighPriority, HighPriority, NormalPriority, NormalPriority, LowPriority}
+	if len(order) != len(want) {
+		t.Fatalf("got %v", order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("got %v, want %v", order, want)
+		}
+	}
+}
+
+func TestSlotQueuePromotesLow(t *testing.T) {
+	q := newSlotQueue(1)
+	q.acquire(context.Background(), NormalPriority, 0)
+	// the low one has waited long enough by the time the normal one queues
+	order := queueInOrder(t, q, time.Nanosecond, LowPriority, NormalPriority)
+	if order[0] != LowPriority {
+		t.Errorf("got %v, want the low priority waiter to go first", order)
+	}
+}
+
+func TestWithPriority(t *testing.T) {
+	srv, _ := newTestInstance(t)
+	c := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 1)
+	folders := map[Priority]string{
+		LowPriority:    srv.Public.AddFolder("Low").ID,
+		NormalPriority: srv.Public.AddFolder("Normal").ID,
+		HighPriority:   srv.Public.AddFolder("High").ID,
+	}
+	// log in first, so that isn't in the way
+	c.LsFolder(srv.Public.ID)
+	srv.SetDelay(50 * time.Millisecond)
+	wait := saturate(t, c, srv.Public.ID, 1)
+
+	var wg sync.WaitGroup
+	for i, priority := range []Priority{LowPriority, NormalPriority, HighPriority} {
+		wg.Add(1)
+		go func(priority Priority) {
+			defer wg.Done()
+			c.WithPriority(priority).LsFolderContext(context.Background(), folders[priority])
+		}(priority)
+		waitFor(t, "the request to queue", func() bool {
+			_, waiting := c.RequestSlots()
+			return waiting == i+1
+		})
+	}
+	if queued := c.QueuedRequests(); queued[LowPriority] != 1 || queued[HighPriority] != 1 {
+		t.Errorf("QueuedRequests got %v", queued)
+	}
+	wg.Wait()
+	wait()
+
+	var order []string
+	for _, r := range srv.Requests() {
+		for priority, id := range folders {
+			if strings.Contains(r.URL, id) {
+				order = append(order, priority.String())
+			}
+		}
+	}
+	if strings.Join(order, " ") != "high normal low" {
+		t.Errorf("the server got them in the order %v", order)
+	}
+}
+
+func TestWithPriorityRejectsBadPriority(t *testing.T) {
+	srv, c := newTestInstance(t)
+	for _, priority := range []Priority{HighPriority, NormalPriority, LowPriority} {
+		if derived, err := c.WithPriorityE(priority); err != nil || derived.priority != priority {
+			t.Errorf("%v got %v", priority, err)
+		}
+	}
+
+	derived, err := c.WithPriorityE(Priority(3))
+	if err == nil || derived != nil {
+		t.Fatal("priority 3 worked")
+	}
+	if err := catch(func() { c.WithPriority(Priority(100)) }); err == nil {
+		t.Error("priority 100 didn't panic")
+	}
+	// c still works
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,168 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Prompt is a parameter a report asks for when it runs
+type Prompt struct {
+	// Name is the parameter name (what goes after p_ in a URL)
+	Name string `json:"name"`
+	// Caption is what the user sees
+	Caption string `json:"caption"`
+	// Type is the data type Cognos expects (ex: xsdString, xsdDate,
+	// xsdInt, xsdDecimal)
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	// Multi is true if more than one value can be chosen
+	Multi bool `json:"multi"`
+}
+
+// promptsLinkFromID returns a link to the prompt information for a report
+func promptsLinkFromID(id string) string {
+	return objectPageLink("portal/report_prompts.xts", id)
+}
+
+// GetReportPrompts returns the parameters the report with the given id
+// asks for. A report without any gets an empty slice. This dosen't run
+// the report.
+func (c *CognosInstance) GetReportPrompts(id string) []Prompt {
+	page := c.Request("GET", promptsLinkFromID(id), "")
+
+	prompts := []Prompt{}
+	if !findJSVar(page, "g_PS_Prompts", &prompts) {
+		if fault, found := parseFault(page); found {
+			if isMissingObject(fault) {
+				panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when getting prompts for %s: %w", id, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when getting prompts for "+id))
+	}
+	return prompts
+}
+
+// missingPrompts returns the names of the required prompts that don't
+// have a value in params, sorted
+func missingPrompts(prompts []Prompt, params map[string]string) []string {
+	var missing []string
+	for _, prompt := range prompts {
+		if _, found := params[prompt.Name]; prompt.Required && !found {
+			missing = append(missing, prompt.Name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// unknownParams returns the names in params that the report dosen't
+// prompt for, sorted
+func unknownParams(prompts []Prompt, params map[string]string) []string {
+	known := make(map[string]bool)
+	for _, prompt := range prompts {
+		known[prompt.Name] = true
+	}
+	var unknown []string
+	for name := range params {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// CreateReportView makes a report view of the report with the given
+// sourceReportID in the folder with the given destFolderID, with params
+// saved as its prompt values. The view runs without prompting, so it can
+// be used with DownloadReportCSV like any other report. params are checked
+// against the report's prompts first, and if any required ones are
+// missing (or any aren't prompts at all) it panics before creating
+// anything.
+func (c *CognosInstance) CreateReportView(sourceReportID, destFolderID, name string, params map[string]string) FolderEntry {
+	prompts := c.GetReportPrompts(sourceReportID)
+	var problems []string
+	if missing := missingPrompts(prompts, params); len(missing) > 0 {
+		problems = append(problems, "missing required prompt values: "+strings.Join(missing, ", "))
+	}
+	if unknown := unknownParams(prompts, params); len(unknown) > 0 {
+		problems = append(problems, "the report dosen't prompt for: "+strings.Join(unknown, ", "))
+	}
+	if len(problems) > 0 {
+		panic(errors.New("unable to create report view: " + strings.Join(problems, "; ")))
+	}
+
+	values := make(url.Values)
+	values.Set("b_action", "xts.run")
+	values.Set("m", "portal/new_reportview.xts")
+	values.Set("m_obj", objectSearchPath(sourceReportID))
+	checkID(destFolderID)
+	values.Set("m_folder", destFolderID)
+	values.Set("m_name", name)
+	addParams(values, params)
+
+	page := c.Request("POST", "/ibmcognos/cgi-bin/cognos.cgi", values.Encode())
+	entry := FolderEntry{Type: Report, Name: name}
+	if !findJSVar(page, "g_PS_ObjectID", &entry.ID) {
+		if fault, found := parseFault(page); found {
+			panic(fmt.Errorf("Cognos returned an error when creating the report view: %w", fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when creating the report view"))
+	}
+	return entry
+}
+
+// ErrPermissionDenied means Cognos wouldn't let us change something,
+// probably because our user can only read it
+var ErrPermissionDenied = errors.New("not allowed to change the object")
+
+// isPermissionDenied guesses if a fault means we aren't allowed to change
+// an object. Like isConversationGone, we go by the message.
+func isPermissionDenied(fault *Fault) bool {
+	text := strings.ToLower(fault.Message + " " + fault.Detail)
+	return strings.Contains(text, "permission") ||
+		strings.Contains(text, "access denied") ||
+		strings.Contains(text, "not authorized")
+}
+
+// SaveDefaultPromptValues saves params as the default prompt values of the
+// report with the given id, like setting them in the report's properties
+// in the portal. When the report is run without prompting, these are the
+// values it uses. Prompts that aren't in params keep whatever default they
+// already had. The names in params are checked against the report's
+// prompts first, and if any aren't prompts it panics before changing
+// anything. If we aren't allowed to change the report (most people can't
+// change public reports) it panics with ErrPermissionDenied.
+func (c *CognosInstance) SaveDefaultPromptValues(id string, params map[string]string) {
+	prompts := c.GetReportPrompts(id)
+	if unknown := unknownParams(prompts, params); len(unknown) > 0 {
+		panic(errors.New("unable to save default prompt values: the report dosen't prompt for: " + strings.Join(unknown, ", ")))
+	}
+
+	values := make(url.Values)
+	values.Set("b_action", "xts.run")
+	values.Set("m", "portal/report_options.xts")
+	values.Set("m_cmd", "saveParameters")
+	values.Set("m_obj", objectSearchPath(id))
+	addParams(values, params)
+
+	// saving the same values twice is harmless, so this can be retried
+	ctx := withIdempotent(context.Background(), true)
+	page := c.requestContext(ctx, "POST", "/ibmcognos/cgi-bin/cognos.cgi", values.Encode(), nil)
+	if fault, found := parseFault(page); found {
+		if isPermissionDenied(fault) {
+			panic(fmt.Errorf("%w: %s: %w", ErrPermissionDenied, id, fault))
+		}
+		panic(fmt.Errorf("Cognos returned an error when saving default prompt values for %s: %w", id, fault))
+	}
+	var saved bool
+	if !findJSVar(page, "g_PS_Saved", &saved) || !saved {
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when saving default prompt values for "+id))
+	}
+}
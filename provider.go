@@ -0,0 +1,113 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/go-ntlmssp"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrAuthFailed means we couldn't log in to Cognos (ex: the password is
+// wrong, or the CredentialProvider failed)
+var ErrAuthFailed = errors.New("unable to log in to Cognos")
+
+// errCredentialProvider is wrapped around errors from a CredentialProvider.
+// The request was never sent, so it can be retried no matter what it is.
+var errCredentialProvider = errors.New("the credential provider failed")
+
+// CredentialProvider returns the user (like the user passed to
+// MakeInstance) and password to log in with (ex: from a secrets manager)
+type CredentialProvider func(ctx context.Context) (user, pass string, err error)
+
+// WithCredentialProvider returns a copy of c that gets its credentials from
+// provider instead of the User, Domain, and Pass fields. The provider is
+// asked when the copy first needs to log in, and the answer is used until
+// the server rejects it (a 401, or the dispatcher refusing to log us on).
+// Then the provider is asked again on the retry, so a password that
+// expired in the secrets manager is picked up. If the provider returns an
+// error, the request fails with an error that wraps both ErrAuthFailed and
+// the provider's error (and is retried like any other failure).
+//
+// The copy shares and dosen't share the same things with c as one made
+// with WithUser, since the provider might not log in as the same user.
+func (c *CognosInstance) WithCredentialProvider(provider CredentialProvider) *CognosInstance {
+	return c.withOwnSession(&credentials{provider: provider})
+}
+
+// withOwnSession returns a copy of c that logs in with creds. It gets its
+// own cookies, passport, and connections (NTLM logs in per connection),
+// and its own folder roots, paths, listings, and report runs to share,
+// since those depend on who is logged in. It is closed on its own, or when
+// c is. Everything else is shared with c like it is for WithDSN.
+func (c *CognosInstance) withOwnSession(creds *credentials) *CognosInstance {
+	derived := *c
+	derived.creds = creds
+	derived.dispatcher = &dispatcherSession{}
+	derived.roots = &rootCache{
+		byDSN: make(map[string]folderRoots),
+	}
+	derived.paths = &pathCache{
+		entries: make(map[string]FolderEntry),
+	}
+	derived.listings = &listingCache{
+		byKey: make(map[string]cachedListing),
+	}
+	derived.runs = &singleflight.Group{}
+	derived.client.Jar = newResettableJar()
+	derived.client.Transport = cloneTransport(c.client.Transport)
+	c.deriveLife(&derived)
+	return &derived
+}
+
+// cloneTransport returns a transport like rt that dosen't share any
+// connections with it. A transport set with SetTransport is shared, since
+// we don't know how to copy it.
+func cloneTransport(rt http.RoundTripper) http.RoundTripper {
+	negotiator, isNTLM := rt.(ntlmssp.Negotiator)
+	if !isNTLM {
+		return rt
+	}
+	transport, ok := negotiator.RoundTripper.(*http.Transport)
+	if !ok {
+		return rt
+	}
+	return ntlmssp.Negotiator{RoundTripper: transport.Clone()}
+}
+
+// fetchLogin asks the credential provider for credentials, if we have one
+// and we don't already have credentials from it that still work
+func (c *CognosInstance) fetchLogin(ctx context.Context) error {
+	if c.creds == nil || c.creds.provider == nil {
+		return nil
+	}
+	c.creds.fetching.Lock()
+	defer c.creds.fetching.Unlock()
+
+	c.creds.lock.RLock()
+	fresh := c.creds.set && !c.creds.stale
+	c.creds.lock.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	user, pass, err := c.creds.provider(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w: %w", ErrAuthFailed, errCredentialProvider, err)
+	}
+	c.setLogin(user, pass)
+	return nil
+}
+
+// credentialsRejected is called when the server says our credentials are
+// wrong, so the credential provider (if we have one) is asked again
+func (c *CognosInstance) credentialsRejected() {
+	if c.creds == nil || c.creds.provider == nil {
+		return
+	}
+	c.creds.lock.Lock()
+	c.creds.stale = true
+	c.creds.lock.Unlock()
+}
@@ -0,0 +1,106 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// rotatingProvider is a CredentialProvider that gives out each password
+// in turn, sticking on the last one, and counts how often it is asked
+type rotatingProvider struct {
+	lock   sync.Mutex
+	user   string
+	passes []string
+	asked  int
+}
+
+func (p *rotatingProvider) provide(ctx context.Context) (string, string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pass := p.passes[len(p.passes)-1]
+	if p.asked < len(p.passes) {
+		pass = p.passes[p.asked]
+	}
+	p.asked++
+	return p.user, pass, nil
+}
+
+func (p *rotatingProvider) count() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.asked
+}
+
+func TestCredentialProviderAskedOnce(t *testing.T) {
+	srv, base := newDispatcherInstance(t)
+	provider := &rotatingProvider{user: srv.User, passes: []string{srv.Pass}}
+	c := base.WithCredentialProvider(provider.provide)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := provider.count(); n != 1 {
+		t.Errorf("the provider was asked %d times", n)
+	}
+}
+
+func TestCredentialProviderRotation(t *testing.T) {
+	srv, base := newDispatcherInstance(t)
+	// the secrets manager still has the old password the first time
+	provider := &rotatingProvider{user: srv.User, passes: []string{"old", srv.Pass}}
+	c := base.WithCredentialProvider(provider.provide)
+
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := provider.count(); n != 2 {
+		t.Errorf("the provider was asked %d times", n)
+	}
+	passwords := []string{}
+	for _, r := range srv.Requests() {
+		if r.Form.Get("h_CAM_action") == "logonAs" {
+			passwords = append(passwords, r.Form.Get("CAMPassword"))
+		}
+	}
+	if len(passwords) != 2 || passwords[0] != "old" || passwords[1] != srv.Pass {
+		t.Errorf("logged on with %q", passwords)
+	}
+
+	// the instance it came from still uses its own fields and session
+	srv.ResetRequests()
+	if _, err := base.LsFolderE(srv.Public.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n := logonsAs(srv, "test"); n != 1 {
+		t.Errorf("the base instance logged on %d times", n)
+	}
+}
+
+func TestCredentialProviderError(t *testing.T) {
+	srv, base := newTestInstance(t)
+	vaultDown := errors.New("vault is sealed")
+	c := base.WithCredentialProvider(func(ctx context.Context) (string, string, error) {
+		return "", "", vaultDown
+	})
+	srv.ResetRequests()
+
+	_, err := c.LsFolderE(srv.Public.ID)
+	if !errors.Is(err, ErrAuthFailed) || !errors.Is(err, vaultDown) {
+		t.Errorf("got %v", err)
+	}
+	if n := countRequests(srv, func(cognostest.Request) bool { return true }); n != 0 {
+		t.Errorf("made %d requests without credentials", n)
+	}
+}
@@ -0,0 +1,102 @@
+package cognos
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPassword is a password that won't show up anywhere by accident
+const testPassword = "s3cret P@ss/word"
+
+func TestPasswordNotInErrorsOrLogs(t *testing.T) {
+	srv, _ := newTestInstance(t)
+	srv.SetCredentials(srv.User, testPassword)
+	c := MakeInstance(srv.User, testPassword, srv.URL, srv.Namespace, srv.DSN, 1, 1, 10, 4)
+	c.sleep = noSleep
+
+	var logged bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logged)
+
+	// the password is in the link (and so in the error), and the request
+	// fails with a server error, which is logged
+	srv.InjectFaults(500, 2)
+	_, err := c.RequestContext(context.Background(), "GET", "/ibmcognos/cgi-bin/cognos.cgi?b_action=xts.run&p="+testPassword, "")
+	if err == nil {
+		t.Fatal("the request didn't fail")
+	}
+
+	printed := map[string]string{
+		"error":        err.Error(),
+		"error %+v":    fmt.Sprintf("%+v", err),
+		"log":          logged.String(),
+		"instance %v":  fmt.Sprintf("%v", c),
+		"instance %+v": fmt.Sprintf("%+v", *c),
+		"instance %#v": fmt.Sprintf("%#v", c),
+		"config %#v":   fmt.Sprintf("%#v", Config{User: srv.User, Pass: testPassword}),
+	}
+	for what, s := range printed {
+		for _, leak := range []string{testPassword, "s3cret+P", "s3cret%20P"} {
+			if strings.Contains(s, leak) {
+				t.Errorf("the %s has the password in it: %s", what, s)
+			}
+		}
+	}
+	if !strings.Contains(printed["instance %v"], redacted) {
+		t.Errorf("the password isn't masked in %s", printed["instance %v"])
+	}
+}
+
+func TestPasswordNotInDebugDump(t *testing.T) {
+	_, c := newTestInstance(t)
+	dir := t.TempDir()
+	c.Pass = testPassword
+	c = c.WithDebugDump(dir)
+	c.SetTransport(pageTransport("<html>we didn't expect " + testPassword + " here</html>"))
+
+	if _, err := c.DownloadReportCSVE("i1"); err == nil {
+		t.Fatal("a viewer page without a status was understood")
+	}
+	dumps, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(dumps) != 1 {
+		t.Fatalf("got %d dumps, want 1", len(dumps))
+	}
+	page, _ := os.ReadFile(dumps[0])
+	if strings.Contains(string(page), testPassword) || !strings.Contains(string(page), "expect "+redacted) {
+		t.Errorf("the password wasn't scrubbed from the dump: %s", page)
+	}
+}
+
+func TestScrubShortPassword(t *testing.T) {
+	_, c := newTestInstance(t)
+	c.Pass = "ab"
+
+	tests := map[string]string{
+		// a short password is left alone in ordinary text
+		"about a tab":    "about a tab",
+		"Cognos is down": "Cognos is down",
+		// but not where credentials go
+		"https://test:ab@cognos.example.com/ibmcognos":             "https://test:" + redacted + "@cognos.example.com/ibmcognos",
+		"h_CAM_action=logonAs&CAMUsername=test&CAMPassword=ab&x=1": "h_CAM_action=logonAs&CAMUsername=test&CAMPassword=" + redacted + "&x=1",
+		"GET /report?password=ab":                                  "GET /report?password=" + redacted,
+		"Authorization: Basic dGVzdDphYg==":                        "Authorization: Basic " + redacted,
+		"map[Authorization:[Basic dGVzdDphYg==]]":                  "map[Authorization:[Basic " + redacted + "]]",
+	}
+	for s, want := range tests {
+		if got := c.scrub(s); got != want {
+			t.Errorf("%q: got %q, want %q", s, got, want)
+		}
+	}
+
+	// a long password is still replaced anywhere
+	c.Pass = testPassword
+	if got := c.scrub("we didn't expect " + testPassword + " here"); got != "we didn't expect "+redacted+" here" {
+		t.Errorf("got %q", got)
+	}
+}
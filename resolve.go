@@ -0,0 +1,192 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// pathCache remembers what paths resolved to, per DSN. It is shared
+// between an instance and any instances derived from it with WithDSN.
+type pathCache struct {
+	lock    sync.Mutex
+	entries map[string]FolderEntry
+}
+
+// pathCacheKey uses a separator that can't be in a folder name
+func pathCacheKey(dsn string, path []string) string {
+	return dsn + "\x00" + strings.Join(path, "\x00")
+}
+
+func (p *pathCache) get(dsn string, path []string) (FolderEntry, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	entry, found := p.entries[pathCacheKey(dsn, path)]
+	return entry, found
+}
+
+func (p *pathCache) put(dsn string, path []string, entry FolderEntry) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.entries[pathCacheKey(dsn, path)] = entry
+}
+
+// ForgetPaths clears the remembered results of FolderEntryFromPath and
+// ResolvePaths, for when things have been moved, renamed, or deleted
+func (c *CognosInstance) ForgetPaths() {
+	c.paths.lock.Lock()
+	defer c.paths.lock.Unlock()
+	c.paths.entries = make(map[string]FolderEntry)
+}
+
+// JoinPath turns a path into the key used by ResolvePaths
+func JoinPath(path []string) string {
+	return strings.Join(path, "/")
+}
+
+// pathNode is one folder entry in the tree of paths ResolvePaths is
+// looking for
+type pathNode struct {
+	children map[string]*pathNode
+	// path is set if this node is one of the paths we were asked for
+	path []string
+}
+
+func (n *pathNode) child(name string) *pathNode {
+	if n.children == nil {
+		n.children = make(map[string]*pathNode)
+	}
+	if _, exists := n.children[name]; !exists {
+		n.children[name] = &pathNode{}
+	}
+	return n.children[name]
+}
+
+// requested calls f for every requested path at or under n
+func (n *pathNode) requested(f func(path []string)) {
+	if n.path != nil {
+		f(n.path)
+	}
+	for _, child := range n.children {
+		child.requested(f)
+	}
+}
+
+// ResolvePaths is FolderEntryFromPath for lots of paths at once. Paths
+// that share folders are resolved together, so each folder is listed at
+// most once. The results are keyed by JoinPath(path). A path that can't
+// be resolved gets an error in errs instead of stopping the whole batch.
+func (c *CognosInstance) ResolvePaths(paths [][]string) (entries map[string]FolderEntry, errs map[string]error) {
+	entries = make(map[string]FolderEntry)
+	errs = make(map[string]error)
+
+	// build a tree of everything we are looking for
+	roots := make(map[string]*pathNode)
+	for _, path := range paths {
+		if len(path) == 0 {
+			errs[JoinPath(path)] = errors.New("Cannot get folder entry for empty path")
+			continue
+		}
+		if roots[path[0]] == nil {
+			roots[path[0]] = &pathNode{}
+		}
+		node := roots[path[0]]
+		for _, name := range path[1:] {
+			node = node.child(name)
+		}
+		node.path = path
+	}
+
+	for rootName, node := range roots {
+		var root FolderEntry
+		err := catch(func() {
+			root = c.rootEntry(context.Background(), rootName)
+		})
+		if err != nil {
+			node.requested(func(path []string) {
+				errs[JoinPath(path)] = err
+			})
+			continue
+		}
+		c.resolveTree(root, []string{rootName}, node, entries, errs)
+	}
+	return entries, errs
+}
+
+// resolveTree fills in entries and errs for everything under node, which
+// is the folder at path
+func (c *CognosInstance) resolveTree(
+	folder FolderEntry,
+	path []string,
+	node *pathNode,
+	entries map[string]FolderEntry,
+	errs map[string]error,
+) {
+	if node.path != nil {
+		entries[JoinPath(node.path)] = folder
+	}
+	if len(node.children) == 0 {
+		return
+	}
+
+	// sorted so the order of requests is predictable
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// we only need to list this folder if we don't already know about
+	// everything in it that we are looking for
+	var listing map[string]FolderEntry
+	var listErr error
+	for _, name := range names {
+		if _, found := c.paths.get(c.cacheScope(), append(path[:len(path):len(path)], name)); !found {
+			listErr = catch(func() {
+				listing = c.LsFolder(folder.ID)
+			})
+			break
+		}
+	}
+
+	for _, name := range names {
+		child := node.children[name]
+		childPath := append(path[:len(path):len(path)], name)
+		fail := func(err error) {
+			child.requested(func(path []string) {
+				errs[JoinPath(path)] = err
+			})
+		}
+
+		entry, found := c.paths.get(c.cacheScope(), childPath)
+		if !found {
+			if listErr != nil {
+				fail(listErr)
+				continue
+			}
+			entry, found = listing[name]
+			if !found {
+				fail(missingEntry(name))
+				continue
+			}
+			c.paths.put(c.cacheScope(), childPath, entry)
+		}
+
+		if entry.Type != Folder && len(child.children) > 0 {
+			// the report itself might have been asked for, just not
+			// anything "under" it
+			if child.path != nil {
+				entries[JoinPath(child.path)] = entry
+			}
+			for _, grandchild := range child.children {
+				grandchild.requested(func(path []string) {
+					errs[JoinPath(path)] = reportInPath(name)
+				})
+			}
+			continue
+		}
+		c.resolveTree(entry, childPath, child, entries, errs)
+	}
+}
@@ -0,0 +1,82 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// isListing returns true for a request for a folder listing
+func isListing(r cognostest.Request) bool {
+	return r.Form.Get("m_folder") != ""
+}
+
+func TestResolvePaths(t *testing.T) {
+	srv, c := newTestInstance(t)
+	// public/District/Reports/School n/Report m
+	reports := srv.Public.AddFolder("District").AddFolder("Reports")
+	var paths [][]string
+	want := make(map[string]string)
+	for school := 0; school < 4; school++ {
+		folder := reports.AddFolder(fmt.Sprintf("School %d", school))
+		for i := 0; i < 20; i++ {
+			report := folder.AddReport(fmt.Sprintf("Report %d", i), "a\n1\n")
+			path := []string{"public", "District", "Reports", folder.Name, report.Name}
+			paths = append(paths, path)
+			want[JoinPath(path)] = report.ID
+		}
+	}
+	missing := []string{"public", "District", "Reports", "School 9", "Report 0"}
+	paths = append(paths, missing)
+
+	entries, errs := c.ResolvePaths(paths)
+	if len(entries) != 80 {
+		t.Errorf("resolved %d paths, want 80", len(entries))
+	}
+	for key, id := range want {
+		if entries[key].ID != id {
+			t.Errorf("%s is %s, want %s", key, entries[key].ID, id)
+		}
+	}
+	if len(errs) != 1 || !errors.Is(errs[JoinPath(missing)], ErrNotFound) {
+		t.Errorf("got errors %v, want just ErrNotFound for %s", errs, JoinPath(missing))
+	}
+
+	// public, District, Reports, and the 4 schools
+	if n := countRequests(srv, isListing); n != 7 {
+		t.Errorf("listed %d folders, want 7 (each one once)", n)
+	}
+
+	// FolderEntryFromPath uses what ResolvePaths found
+	srv.ResetRequests()
+	if entry := c.FolderEntryFromPath(paths[5]); entry.ID != want[JoinPath(paths[5])] {
+		t.Errorf("%s is %s after ResolvePaths", JoinPath(paths[5]), entry.ID)
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("a path ResolvePaths found took %d more requests", n)
+	}
+}
+
+func TestFolderEntryFromPathRemembersPrefixes(t *testing.T) {
+	srv, c := newTestInstance(t)
+	reports := srv.Public.AddFolder("District").AddFolder("Reports")
+	reports.AddReport("Daily", "a\n1\n")
+	reports.AddReport("Weekly", "a\n1\n")
+
+	c.FolderEntryFromPath([]string{"public", "District", "Reports", "Daily"})
+	srv.ResetRequests()
+	c.FolderEntryFromPath([]string{"public", "District", "Reports", "Weekly"})
+	if n := countRequests(srv, isListing); n != 1 {
+		t.Errorf("a path through remembered folders listed %d folders, want 1 (just Reports)", n)
+	}
+
+	srv.ResetRequests()
+	c.ForgetPaths()
+	c.ForgetListings()
+	c.FolderEntryFromPath([]string{"public", "District", "Reports", "Weekly"})
+	if n := countRequests(srv, isListing); n != 3 {
+		t.Errorf("after ForgetPaths, listed %d folders, want 3", n)
+	}
+}
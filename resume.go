@@ -0,0 +1,101 @@
+package cognos
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// resumableDownload keeps track of a report output being downloaded, so
+// if the connection drops partway through, the retry can ask for just the
+// rest with a Range request. That only works if the server said it
+// supports ranges (Accept-Ranges: bytes) and how big the output is.
+// Otherwise the retry downloads the whole thing again.
+type resumableDownload struct {
+	// headers are sent with each attempt (see requestStream). Range and
+	// If-Range are set on them to resume.
+	headers http.Header
+	// received is how much of the output we have
+	received int64
+	// total is the size of the whole output, or -1 if we don't know
+	total int64
+	// resumable is set if the server supports ranges
+	resumable bool
+	// validator is the ETag (or Last-Modified) of the output, so a
+	// resumed download can't be stitched together from two diffrent
+	// outputs
+	validator string
+}
+
+func newResumableDownload() *resumableDownload {
+	return &resumableDownload{headers: make(http.Header), total: -1}
+}
+
+// start is called with each response. It returns true if the response
+// picks up where the last one left off, or false if it is the whole
+// output from the beginning (ex: the server ignored our Range), in which
+// case anything we already have should be thrown away.
+func (d *resumableDownload) start(resp *http.Response) (resumed bool) {
+	if resp.StatusCode == http.StatusPartialContent {
+		want := fmt.Sprintf("bytes %d-%d/%d", d.received, d.total-1, d.total)
+		if got := resp.Header.Get("Content-Range"); got != want {
+			// start over next time
+			d.headers.Del("Range")
+			d.headers.Del("If-Range")
+			panic(fmt.Errorf("%w: asked for %q but got %q", ErrShortDownload, want, got))
+		}
+		return true
+	}
+
+	d.received = 0
+	d.total = resp.ContentLength
+	d.resumable = resp.Header.Get("Accept-Ranges") == "bytes" && d.total > 0
+	d.validator = resp.Header.Get("ETag")
+	if d.validator == "" {
+		d.validator = resp.Header.Get("Last-Modified")
+	}
+	d.headers.Del("Range")
+	d.headers.Del("If-Range")
+	return false
+}
+
+// failed is called when reading a response fails. It returns true if the
+// next attempt will pick up where this one left off.
+func (d *resumableDownload) failed() bool {
+	if !d.resumable || d.received <= 0 || d.received >= d.total {
+		d.headers.Del("Range")
+		d.headers.Del("If-Range")
+		return false
+	}
+	d.headers.Set("Range", fmt.Sprintf("bytes=%d-", d.received))
+	if d.validator != "" {
+		d.headers.Set("If-Range", d.validator)
+	}
+	return true
+}
+
+// rewindable is a writer that can be started over, like an *os.File
+type rewindable interface {
+	io.Seeker
+	Truncate(size int64) error
+}
+
+// canRewind returns true if w can be started over with rewind
+func canRewind(w io.Writer) bool {
+	_, ok := w.(rewindable)
+	return ok
+}
+
+// rewind throws away everything written to w, so a download can start
+// over. It returns false if it can't.
+func rewind(w io.Writer) bool {
+	file, ok := w.(rewindable)
+	if !ok {
+		return false
+	}
+	if file.Truncate(0) != nil {
+		return false
+	}
+	_, err := file.Seek(0, io.SeekStart)
+	return err == nil
+}
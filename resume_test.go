@@ -0,0 +1,87 @@
+package cognos
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// outputRanges returns the Range header of each download of a report
+// output ("" for the whole thing), and checks that a resumed one also had
+// If-Range
+func outputRanges(t *testing.T, srv *cognostest.Server) []string {
+	t.Helper()
+	var ranges []string
+	for _, r := range srv.Requests() {
+		if !isOutput(r) {
+			continue
+		}
+		ranges = append(ranges, r.Header.Get("Range"))
+		if r.Header.Get("Range") != "" && r.Header.Get("If-Range") == "" {
+			t.Error("resumed without If-Range")
+		}
+	}
+	return ranges
+}
+
+func TestResumeDownload(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "id,name\n1,Ann\n2,Bob\n3,Cy\n")
+	report.AcceptRanges = true
+	report.ShortDownloads = 2
+
+	// 25 bytes: 0-11, then 12-17, then 18-24
+	run := c.StartReport(report.ID)
+	if csv := run.Wait(); csv != report.CSV {
+		t.Errorf("got %q", csv)
+	}
+	info := run.Info()
+	if info.SHA256 != sha256Hex(report.CSV) || !info.LengthChecked || info.Bytes != int64(len(report.CSV)) {
+		t.Errorf("got %+v", info)
+	}
+	want := []string{"", "bytes=12-", "bytes=18-"}
+	if got := outputRanges(t, srv); len(got) != 3 || got[0] != want[0] || got[1] != want[1] || got[2] != want[2] {
+		t.Errorf("downloaded with ranges %q, want %q", got, want)
+	}
+}
+
+func TestResumeDownloadTo(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "id,name\n1,Ann\n2,Bob\n3,Cy\n")
+	report.AcceptRanges = true
+	report.ShortDownloads = 1
+
+	// unlike TestShortDownloadTo, a buffer is fine, since nothing written
+	// to it has to be taken back
+	var output bytes.Buffer
+	run := c.StartReport(report.ID)
+	if n := run.WaitTo(&output); n != int64(len(report.CSV)) || output.String() != report.CSV {
+		t.Errorf("wrote %d bytes: %q", n, output.String())
+	}
+	if run.Info().SHA256 != sha256Hex(report.CSV) {
+		t.Error("the SHA-256 is wrong")
+	}
+	if got := outputRanges(t, srv); len(got) != 2 || got[1] != "bytes=12-" {
+		t.Errorf("downloaded with ranges %q", got)
+	}
+}
+
+func TestResumeDownloadRetriesUsedUp(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 1
+	report := srv.Public.AddReport("Roster", "id,name\n1,Ann\n2,Bob\n3,Cy\n")
+	report.AcceptRanges = true
+	report.ShortDownloads = 2
+
+	var output bytes.Buffer
+	err := catch(func() { c.StartReport(report.ID).WaitTo(&output) })
+	if !errors.Is(err, ErrShortDownload) {
+		t.Errorf("got %v, want ErrShortDownload", err)
+	}
+	// what we did get is still in order
+	if output.String() != report.CSV[:18] {
+		t.Errorf("wrote %q", output.String())
+	}
+}
@@ -0,0 +1,107 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// ErrOperationTimeout means a request was given up on because the
+// retries took longer than OperationTimeout
+var ErrOperationTimeout = errors.New("the operation took too long")
+
+// sleeper waits for d, or until ctx is done. It returns ctx.Err() if ctx
+// finished first. Tests can swap it out so they don't actually sleep.
+type sleeper func(ctx context.Context, d time.Duration) error
+
+// sleepContext is the normal sleeper
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// permanentError is panicked with (see permanent) to tell retry that
+// trying again won't help
+type permanentError struct {
+	err error
+}
+
+func (p permanentError) Error() string { return p.err.Error() }
+func (p permanentError) Unwrap() error { return p.err }
+
+// permanent marks err as not worth retrying. If f panics with a permanent
+// error, retry gives up right away and returns the original error.
+func permanent(err error) error {
+	return permanentError{err: err}
+}
+
+// retry calls f until it returns without panicking. It gives up after
+// tries attempts (or never, if tries is -1) or when ctx is done, and
+// returns the last panic as an error. A panic with a permanent error stops
+// the retries right away. It waits delay between attempts
+// using sleep (sleepContext if sleep is nil). If logError is not nil, it is
+// called with the error from each failed attempt. If onRetry is not nil,
+// it is called before waiting to try again (so not after the last
+// attempt) with the attempt that failed (starting at 1).
+func retry(ctx context.Context, delay time.Duration, tries int, logError func(error), onRetry func(attempt int, err error, delay time.Duration), sleep sleeper, f func()) (err error) {
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	for attempt := 1; tries < 0 || attempt <= tries; attempt++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if err == nil {
+				err = ctxErr
+			}
+			return err
+		}
+
+		err = catch(f)
+		if err == nil {
+			return nil
+		}
+		if logError != nil {
+			logError(err)
+		}
+
+		var perm permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+
+		// don't sleep after the last attempt
+		if tries >= 0 && attempt >= tries {
+			break
+		}
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+		if sleepErr := sleep(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// panicOnErr panics if err is not nil
+func panicOnErr(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
+
+// readAll reads everything from r into a string, or panics
+func readAll(r io.Reader) string {
+	b, err := ioutil.ReadAll(r)
+	panicOnErr(err)
+	return string(b)
+}
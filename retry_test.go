@@ -0,0 +1,151 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordSleeps returns a sleeper that records how long it was asked to
+// sleep instead of sleeping
+func recordSleeps(sleeps *[]time.Duration) sleeper {
+	return func(ctx context.Context, d time.Duration) error {
+		*sleeps = append(*sleeps, d)
+		return ctx.Err()
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		tries    int
+		failures int
+		calls    int
+		sleeps   int
+		fails    bool
+	}{
+		{"works first time", 3, 0, 1, 0, false},
+		{"works on the last try", 3, 2, 3, 2, false},
+		{"never works", 3, 5, 3, 2, true},
+		{"one try", 1, 5, 1, 0, true},
+		{"forever", -1, 20, 21, 20, false},
+	}
+	for _, test := range tests {
+		var sleeps []time.Duration
+		var retried []int
+		calls := 0
+		err := retry(context.Background(), time.Second, test.tries, nil,
+			func(attempt int, err error, delay time.Duration) {
+				retried = append(retried, attempt)
+			},
+			recordSleeps(&sleeps),
+			func() {
+				calls++
+				if calls <= test.failures {
+					panic(errors.New("attempt failed"))
+				}
+			},
+		)
+		if calls != test.calls || len(sleeps) != test.sleeps || len(retried) != test.sleeps || (err != nil) != test.fails {
+			t.Errorf("%s: %d calls, %d sleeps, %d retries, err %v", test.name, calls, len(sleeps), len(retried), err)
+		}
+		for _, d := range sleeps {
+			if d != time.Second {
+				t.Errorf("%s: slept %v, want 1s", test.name, d)
+			}
+		}
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	reason := errors.New("no such report")
+	calls := 0
+	err := retry(context.Background(), time.Second, 5, nil, nil, noSleep, func() {
+		calls++
+		panic(permanent(reason))
+	})
+	if calls != 1 {
+		t.Errorf("a permanent error was tried %d times", calls)
+	}
+	if err != reason {
+		t.Errorf("got %v, want the original error", err)
+	}
+}
+
+func TestRetryStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := retry(ctx, time.Second, -1, nil, nil, noSleep, func() {
+		calls++
+		if calls == 2 {
+			cancel()
+		}
+		panic("still down")
+	})
+	if calls != 2 {
+		t.Errorf("got %d calls after the context was cancelled, want 2", calls)
+	}
+	if err == nil || !strings.Contains(err.Error(), "still down") {
+		t.Errorf("got %v, want the last failure", err)
+	}
+}
+
+func TestCatch(t *testing.T) {
+	if err := catch(func() {}); err != nil {
+		t.Errorf("no panic gave %v", err)
+	}
+	if err := catch(func() { panic("a string") }); err == nil || err.Error() != "a string" {
+		t.Errorf("a string panic gave %v", err)
+	}
+	reason := errors.New("an error")
+	if err := catch(func() { panic(reason) }); err != reason {
+		t.Errorf("an error panic gave %v", err)
+	}
+}
+
+func TestReadAll(t *testing.T) {
+	if s := readAll(strings.NewReader("a,b\n")); s != "a,b\n" {
+		t.Errorf("got %q", s)
+	}
+}
+
+// tickSleep is a sleeper that waits a tenth of a second no matter how long
+// it was asked to, so retries don't take forever in tests
+func tickSleep(ctx context.Context, d time.Duration) error {
+	return sleepContext(ctx, 100*time.Millisecond)
+}
+
+func TestOperationTimeout(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.sleep = tickSleep
+	c.RetryCount = -1
+	c.OperationTimeout = 1
+	srv.InjectFaults(503, 1000)
+
+	start := time.Now()
+	_, err := c.LsFolderE(srv.Public.ID)
+	took := time.Since(start)
+	if !errors.Is(err, ErrOperationTimeout) {
+		t.Fatalf("got %v, want ErrOperationTimeout", err)
+	}
+	if !strings.Contains(err.Error(), "took more than 1 seconds") {
+		t.Errorf("%q dosen't say how long it was given", err)
+	}
+	if took < time.Second || took > 2*time.Second {
+		t.Errorf("gave up after %v, want about a second", took)
+	}
+	// about one attempt every tenth of a second
+	if n := len(srv.Requests()); n < 5 || n > 15 {
+		t.Errorf("made %d attempts", n)
+	}
+
+	// the caller giving up first isn't a timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	_, err = c.LsFolderContext(ctx, srv.Public.ID)
+	if errors.Is(err, ErrOperationTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("the caller's timeout got %v", err)
+	}
+}
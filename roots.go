@@ -0,0 +1,39 @@
+package cognos
+
+import (
+	"context"
+	"sort"
+)
+
+// Root is somewhere a path can start
+type Root struct {
+	// Name is what goes at the start of a path (ex: "public", "~", or
+	// "public:State Reports")
+	Name string `json:"name"`
+	ID   string `json:"id"`
+}
+
+// ListRoots returns the places a path can start. "public" is the default
+// public folders root, and "~" is my folders. Some installs (ex: ADE) keep
+// seperate trees (district content, state content, packages) as folders
+// at the top of public folders, so each of those is a root too, named
+// "public:<folder name>". They can also be used by just the folder name,
+// as long as it isn't "public" or "~".
+func (c *CognosInstance) ListRoots() []Root {
+	publicID, myID := c.findFolderRoots(context.Background())
+	roots := []Root{
+		{Name: "public", ID: publicID},
+		{Name: "~", ID: myID},
+	}
+
+	var named []Root
+	for name, entry := range c.LsFolder(publicID) {
+		if entry.Type == Folder {
+			named = append(named, Root{Name: "public:" + name, ID: entry.ID})
+		}
+	}
+	sort.Slice(named, func(i, j int) bool {
+		return named[i].Name < named[j].Name
+	})
+	return append(roots, named...)
+}
@@ -0,0 +1,45 @@
+package cognos
+
+import (
+	"net/url"
+	"strings"
+)
+
+// RunAs returns a copy of c that runs reports as another user, so you can
+// see what they see (reports that use data security give diffrent people
+// diffrent data). It is for administrators, and our user needs the
+// capability to impersonate others. If it dosen't, running a report
+// panics with ErrRunAsDenied. username is the same as you would use to
+// log in as that user, without the domain.
+//
+// Only running reports is affected. Listing folders and everything else
+// still happens as our own user, unless the server decides otherwise.
+// Like WithDSN, the copy shares everything else with c.
+func (c *CognosInstance) RunAs(username string) *CognosInstance {
+	derived := *c
+	derived.runAs = username
+	return &derived
+}
+
+// runLink is reportLinkFromID, plus anything this instance needs to add
+// when running a report
+func (c *CognosInstance) runLink(id string) string {
+	return c.runLinkWithFormat(id, "CSV")
+}
+
+// runLinkWithFormat is runLink for an output format other than CSV
+func (c *CognosInstance) runLinkWithFormat(id string, format string) string {
+	link := reportLinkWithFormat(id, format)
+	if c.runAs != "" {
+		link += "&run.runAs=" + url.QueryEscape(c.runAs)
+	}
+	return link
+}
+
+// isRunAsDenied guesses if a fault means we aren't allowed to run as
+// someone else. Like isConversationGone, we go by the message.
+func isRunAsDenied(fault *Fault) bool {
+	text := strings.ToLower(fault.Message + " " + fault.Detail)
+	return strings.Contains(text, "capability") ||
+		strings.Contains(text, "impersonat")
+}
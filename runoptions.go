@@ -0,0 +1,94 @@
+package cognos
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// RunOptions are how a report is set up to run, from its run options in
+// the portal. Options the report has never had set are left as zero
+// values, with their Set flag false, instead of being an error.
+type RunOptions struct {
+	// Formats are the output formats the report runs in by default (ex:
+	// PDF, CSV). Cognos uses HTML if FormatsSet is false.
+	Formats    []string `json:"formats"`
+	FormatsSet bool     `json:"formatsSet"`
+	// Prompt is set if the report asks for prompt values when it is run.
+	// A report like that can still be downloaded (see
+	// DownloadOptions.Params), but it won't run unattended from the
+	// portal or a schedule.
+	Prompt    bool `json:"prompt"`
+	PromptSet bool `json:"promptSet"`
+	// SaveOutput, Email, and EmailTo are where the output goes when the
+	// report is run in the background (ex: by a schedule)
+	SaveOutput  bool     `json:"saveOutput"`
+	Email       bool     `json:"email"`
+	EmailTo     []string `json:"emailTo"`
+	DeliverySet bool     `json:"deliverySet"`
+	// Languages are the languages the report can be run in (ex: en-us)
+	Languages    []string `json:"languages"`
+	LanguagesSet bool     `json:"languagesSet"`
+}
+
+// HasFormat returns true if format (ex: CSV) is one of the report's
+// default output formats. Case dosen't matter.
+func (o RunOptions) HasFormat(format string) bool {
+	for _, f := range o.Formats {
+		if strings.EqualFold(f, format) {
+			return true
+		}
+	}
+	return false
+}
+
+// runOptionsLinkFromID returns a link to the run options of a report
+func runOptionsLinkFromID(id string) string {
+	return objectPageLink("portal/run_options.xts", id)
+}
+
+// GetRunOptions returns how the report with the given id is set up to run
+// (see RunOptions), without running it. If there is no such report it
+// panics with an error that wraps fs.ErrNotExist.
+func (c *CognosInstance) GetRunOptions(id string) RunOptions {
+	page := c.Request("GET", runOptionsLinkFromID(id), "")
+
+	// pointers, so we can tell what the page left out
+	var raw struct {
+		Formats  *[]string `json:"outputFormats"`
+		Prompt   *bool     `json:"prompt"`
+		Delivery *struct {
+			Save  bool     `json:"save"`
+			Email bool     `json:"email"`
+			To    []string `json:"to"`
+		} `json:"delivery"`
+		Languages *[]string `json:"languages"`
+	}
+	if !findJSVar(page, "g_PS_RunOptions", &raw) {
+		if fault, found := parseFault(page); found {
+			if isMissingObject(fault) {
+				panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when getting the run options of %s: %w", id, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when getting the run options of "+id))
+	}
+
+	var opts RunOptions
+	if raw.Formats != nil {
+		opts.Formats, opts.FormatsSet = *raw.Formats, true
+	}
+	if raw.Prompt != nil {
+		opts.Prompt, opts.PromptSet = *raw.Prompt, true
+	}
+	if raw.Delivery != nil {
+		opts.SaveOutput = raw.Delivery.Save
+		opts.Email = raw.Delivery.Email
+		opts.EmailTo = raw.Delivery.To
+		opts.DeliverySet = true
+	}
+	if raw.Languages != nil {
+		opts.Languages, opts.LanguagesSet = *raw.Languages, true
+	}
+	return opts
+}
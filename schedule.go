@@ -0,0 +1,249 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schedule is a schedule attached to a report on the server
+type Schedule struct {
+	// ID is used with UpdateSchedule and DeleteSchedule
+	ID string `json:"id"`
+	// Frequency describes how often it runs (ex: "Every day at 6:00 AM")
+	Frequency string `json:"frequency"`
+	// NextRun and LastRun are zero if there is no next or last run
+	NextRun time.Time `json:"nextRun"`
+	LastRun time.Time `json:"lastRun"`
+	Owner   string    `json:"owner"`
+	Enabled bool      `json:"enabled"`
+	// Formats are the output formats (ex: CSV, PDF)
+	Formats []string `json:"formats"`
+	// Destination is where the output goes (ex: "Save", "Email")
+	Destination string `json:"destination"`
+}
+
+// scheduleLinkFromID returns a link to the schedules page of an object
+func scheduleLinkFromID(id string) string {
+	return objectPageLink("portal/properties_schedule.xts", id)
+}
+
+// GetSchedules returns the schedules attached to the report with the
+// given id. A report with no schedules gets an empty slice. If there is no
+// such report it panics with an error that wraps fs.ErrNotExist.
+func (c *CognosInstance) GetSchedules(id string) []Schedule {
+	page := c.Request("GET", scheduleLinkFromID(id), "")
+
+	schedules := []Schedule{}
+	if !findJSVar(page, "g_PS_Schedules", &schedules) {
+		if fault, found := parseFault(page); found {
+			if isMissingObject(fault) {
+				panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+			}
+			panic(fmt.Errorf("Cognos returned an error when getting schedules for %s: %w", id, fault))
+		}
+		panic(c.notUnderstood(page, "Cognos returned a page we could not understand when getting schedules for "+id))
+	}
+	return schedules
+}
+
+// ScheduleFrequency is how often a ScheduleSpec runs
+type ScheduleFrequency uint
+
+const (
+	// Daily runs every day at the start time
+	Daily ScheduleFrequency = iota
+	// Weekly runs on ScheduleSpec.Weekdays at the start time
+	Weekly ScheduleFrequency = iota
+)
+
+// ScheduleDelivery is what happens to the output of a scheduled run
+type ScheduleDelivery uint
+
+const (
+	// SaveOutput saves the output in the content store, next to the report
+	SaveOutput ScheduleDelivery = iota
+	// EmailOutput emails the output to ScheduleSpec.EmailTo
+	EmailOutput ScheduleDelivery = iota
+)
+
+// scheduleFormats are the output formats a schedule can make
+var scheduleFormats = map[string]bool{
+	"CSV":  true,
+	"PDF":  true,
+	"HTML": true,
+	"XLSX": true,
+	"XML":  true,
+}
+
+// ScheduleSpec describes a schedule to create or update
+type ScheduleSpec struct {
+	Frequency ScheduleFrequency
+	// Weekdays is which days a Weekly schedule runs
+	Weekdays []time.Weekday
+	// Start is when the schedule starts. Its time of day is when it runs.
+	Start time.Time
+	// Format is the output format (CSV, PDF, HTML, XLSX, or XML)
+	Format   string
+	Delivery ScheduleDelivery
+	// EmailTo is who gets the output if Delivery is EmailOutput
+	EmailTo []string
+	// Disabled creates the schedule turned off
+	Disabled bool
+}
+
+// Validate returns an error describing every problem with the spec that
+// Cognos wouldn't accept, or nil if there aren't any
+func (spec ScheduleSpec) Validate() error {
+	var problems []string
+	switch spec.Frequency {
+	case Daily:
+		if len(spec.Weekdays) > 0 {
+			problems = append(problems, "a daily schedule can't have weekdays")
+		}
+	case Weekly:
+		if len(spec.Weekdays) == 0 {
+			problems = append(problems, "a weekly schedule needs at least one weekday")
+		}
+		for _, day := range spec.Weekdays {
+			if day < time.Sunday || day > time.Saturday {
+				problems = append(problems, fmt.Sprintf("%d is not a weekday", day))
+			}
+		}
+	default:
+		problems = append(problems, "unknown frequency")
+	}
+	if spec.Start.IsZero() {
+		problems = append(problems, "a start time is required")
+	}
+	if !scheduleFormats[strings.ToUpper(spec.Format)] {
+		problems = append(problems, "unsupported format "+spec.Format)
+	}
+	switch spec.Delivery {
+	case SaveOutput:
+		if len(spec.EmailTo) > 0 {
+			problems = append(problems, "saved output can't have email recipients")
+		}
+	case EmailOutput:
+		if len(spec.EmailTo) == 0 {
+			problems = append(problems, "emailed output needs at least one recipient")
+		}
+	default:
+		problems = append(problems, "unknown delivery")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid schedule: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// form adds the schedule form fields for the spec to values
+func (spec ScheduleSpec) form(values url.Values) {
+	if spec.Frequency == Weekly {
+		values.Set("sch_frequency", "weekly")
+		days := append([]time.Weekday(nil), spec.Weekdays...)
+		sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+		var dayNames []string
+		for _, day := range days {
+			dayNames = append(dayNames, strings.ToLower(day.String()[:3]))
+		}
+		values.Set("sch_days", strings.Join(dayNames, ","))
+	} else {
+		values.Set("sch_frequency", "daily")
+	}
+	values.Set("sch_start", spec.Start.Format(time.RFC3339))
+	values.Set("sch_format", strings.ToUpper(spec.Format))
+	if spec.Delivery == EmailOutput {
+		values.Set("sch_delivery", "email")
+		values.Set("sch_email", strings.Join(spec.EmailTo, ","))
+	} else {
+		values.Set("sch_delivery", "save")
+	}
+	if spec.Disabled {
+		values.Set("sch_enabled", "false")
+	} else {
+		values.Set("sch_enabled", "true")
+	}
+}
+
+// ScheduleOptions changes how CreateSchedule, UpdateSchedule, and
+// DeleteSchedule work
+type ScheduleOptions struct {
+	// DryRun returns the request that would be sent without sending it
+	DryRun bool
+}
+
+// ScheduleRequest is the request sent to Cognos to change a schedule
+type ScheduleRequest struct {
+	Method string `json:"method"`
+	Link   string `json:"link"`
+	Body   string `json:"body"`
+	// ScheduleID is the ID of the schedule that was created, updated, or
+	// deleted. It is empty for a dry run of CreateSchedule.
+	ScheduleID string `json:"scheduleId,omitempty"`
+}
+
+// sendScheduleForm posts the portal schedule form, unless this is a dry run
+func (c *CognosInstance) sendScheduleForm(values url.Values, opts ScheduleOptions) ScheduleRequest {
+	values.Set("b_action", "xts.run")
+	values.Set("m", "portal/schedule.xts")
+	request := ScheduleRequest{
+		Method:     "POST",
+		Link:       "/ibmcognos/cgi-bin/cognos.cgi",
+		Body:       values.Encode(),
+		ScheduleID: values.Get("m_schedule"),
+	}
+	if opts.DryRun {
+		return request
+	}
+
+	page := c.Request(request.Method, request.Link, request.Body)
+	if fault, found := parseFault(page); found {
+		panic(fmt.Errorf("Cognos returned an error when saving the schedule: %w", fault))
+	}
+	if values.Get("m_cmd") != "delete" {
+		if !findJSVar(page, "g_PS_ScheduleID", &request.ScheduleID) {
+			panic(c.notUnderstood(page, "Cognos returned a page we could not understand when saving the schedule"))
+		}
+	}
+	return request
+}
+
+// CreateSchedule adds a schedule to the report with the given id. The
+// spec is checked with Validate before anything is sent.
+func (c *CognosInstance) CreateSchedule(id string, spec ScheduleSpec, opts ScheduleOptions) ScheduleRequest {
+	if err := spec.Validate(); err != nil {
+		panic(err)
+	}
+	values := make(url.Values)
+	values.Set("m_cmd", "create")
+	values.Set("m_obj", objectSearchPath(id))
+	spec.form(values)
+	return c.sendScheduleForm(values, opts)
+}
+
+// UpdateSchedule replaces the settings of a schedule (see Schedule.ID)
+// with spec. The spec is checked with Validate before anything is sent.
+func (c *CognosInstance) UpdateSchedule(scheduleID string, spec ScheduleSpec, opts ScheduleOptions) ScheduleRequest {
+	if err := spec.Validate(); err != nil {
+		panic(err)
+	}
+	values := make(url.Values)
+	values.Set("m_cmd", "update")
+	values.Set("m_schedule", scheduleID)
+	spec.form(values)
+	return c.sendScheduleForm(values, opts)
+}
+
+// DeleteSchedule removes a schedule (see Schedule.ID)
+func (c *CognosInstance) DeleteSchedule(scheduleID string, opts ScheduleOptions) ScheduleRequest {
+	values := make(url.Values)
+	values.Set("m_cmd", "delete")
+	values.Set("m_schedule", scheduleID)
+	return c.sendScheduleForm(values, opts)
+}
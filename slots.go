@@ -0,0 +1,78 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ErrBusy means we gave up waiting for a request slot (see
+// concurrentRequests in MakeInstance) because every slot was in use until
+// SlotTimeout was up or the context was done
+var ErrBusy = errors.New("timed out waiting for a request slot")
+
+// slotCounts keeps track of how the request slots are being used. It is
+// shared between an instance and any instances derived from it with
+// WithDSN, since they share the slots too.
+type slotCounts struct {
+	inFlight int64
+	waiting  int64
+	// queued is waiting split up by Priority
+	queued [numPriorities]int64
+}
+
+// acquireSlot waits for a request slot and returns a function that gives
+// it back. Slots go to waiters by priority (see WithPriority). It panics
+// with ErrBusy if ctx is done (or SlotTimeout is up) first.
+func (c *CognosInstance) acquireSlot(ctx context.Context) (release func()) {
+	started := time.Now()
+	if c.SlotTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Second*time.Duration(c.SlotTimeout))
+		defer cancel()
+	}
+	maxLowWait := time.Second * time.Duration(c.LowPriorityMaxWait)
+	atomic.AddInt64(&c.slots.waiting, 1)
+	atomic.AddInt64(&c.slots.queued[c.priority], 1)
+	err := c.httpLockPool.acquire(ctx, c.priority, maxLowWait)
+	if err == nil && c.budget != nil {
+		err = c.budget.acquire(ctx, c.priority, maxLowWait)
+		if err != nil {
+			c.httpLockPool.release()
+		}
+	}
+	atomic.AddInt64(&c.slots.queued[c.priority], -1)
+	atomic.AddInt64(&c.slots.waiting, -1)
+	if err != nil {
+		inFlight, waiting := c.RequestSlots()
+		panic(fmt.Errorf("%w: waited %v for one of %d slots (%d requests going, %d more waiting): %w",
+			ErrBusy, time.Since(started).Round(time.Millisecond), c.concurrentRequests, inFlight, waiting, err))
+	}
+
+	atomic.AddInt64(&c.slots.inFlight, 1)
+	return func() {
+		atomic.AddInt64(&c.slots.inFlight, -1)
+		if c.budget != nil {
+			c.budget.release()
+		}
+		c.httpLockPool.release()
+	}
+}
+
+// RequestSlots returns how many requests are going right now, and how
+// many are waiting for a slot
+func (c *CognosInstance) RequestSlots() (inFlight, waiting int) {
+	return int(atomic.LoadInt64(&c.slots.inFlight)), int(atomic.LoadInt64(&c.slots.waiting))
+}
+
+// QueuedRequests returns how many requests are waiting for a slot at each
+// priority
+func (c *CognosInstance) QueuedRequests() map[Priority]int {
+	queued := make(map[Priority]int, numPriorities)
+	for priority := range c.slots.queued {
+		queued[Priority(priority)] = int(atomic.LoadInt64(&c.slots.queued[priority]))
+	}
+	return queued
+}
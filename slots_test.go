@@ -0,0 +1,108 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor waits up to 5 seconds for cond to be true
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("gave up waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// saturate starts n slow listings in the background. The returned
+// function waits for them to finish.
+func saturate(t *testing.T, c *CognosInstance, id string, n int) (wait func()) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.LsFolderContext(context.Background(), id)
+		}()
+	}
+	waitFor(t, "the slots to fill up", func() bool {
+		inFlight, _ := c.RequestSlots()
+		return inFlight == n
+	})
+	return wg.Wait
+}
+
+func TestCancelWhileWaitingForSlot(t *testing.T) {
+	srv, _ := newTestInstance(t)
+	c := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 2)
+	srv.Delay = 300 * time.Millisecond
+	wait := saturate(t, c, srv.Public.ID, 2)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := c.LsFolderContext(ctx, srv.Public.ID)
+		done <- err
+	}()
+	waitFor(t, "the request to queue", func() bool {
+		_, waiting := c.RequestSlots()
+		return waiting == 1
+	})
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrBusy) || !errors.Is(err, context.Canceled) {
+			t.Errorf("got %v, want ErrBusy and context.Canceled", err)
+		}
+	case <-time.After(200 * time.Millisecond):
+		t.Fatal("the queued request didn't give up when it was cancelled")
+	}
+	if _, waiting := c.RequestSlots(); waiting != 0 {
+		t.Errorf("%d requests are still waiting", waiting)
+	}
+
+	wait()
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("the server got %d requests, want 2 (the cancelled one wasn't sent)", n)
+	}
+}
+
+func TestSlotTimeout(t *testing.T) {
+	srv, _ := newTestInstance(t)
+	c := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 2)
+	c.SlotTimeout = 1
+	srv.Delay = 1500 * time.Millisecond
+	wait := saturate(t, c, srv.Public.ID, 2)
+
+	start := time.Now()
+	_, err := c.LsFolderE(srv.Public.ID)
+	took := time.Since(start)
+	if !errors.Is(err, ErrBusy) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want ErrBusy and context.DeadlineExceeded", err)
+	} else if !strings.Contains(err.Error(), "one of 2 slots (2 requests going, 0 more waiting)") {
+		t.Errorf("%q dosen't say what the slots were doing", err)
+	}
+	if took < time.Second {
+		t.Errorf("gave up after %v, want 1s", took)
+	}
+	wait()
+	if n := len(srv.Requests()); n != 2 {
+		t.Errorf("the server got %d requests, want 2 (the one that gave up wasn't sent)", n)
+	}
+
+	// a slot that frees up in time is used
+	srv.SetDelay(300 * time.Millisecond)
+	wait = saturate(t, c, srv.Public.ID, 2)
+	if _, err := c.LsFolderE(srv.Public.ID); err != nil {
+		t.Errorf("waiting less than SlotTimeout got %v", err)
+	}
+	wait()
+}
@@ -0,0 +1,164 @@
+package cognos
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// ErrUnsupportedLayout means we can't work out the columns of a report
+// from its specification, because its output isn't a simple list (ex: it
+// is a crosstab)
+var ErrUnsupportedLayout = errors.New("the report layout is not a list")
+
+// specNode is any element of a report specification
+type specNode struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []specNode `xml:",any"`
+}
+
+// attr returns the value of an attribute, or ""
+func (n *specNode) attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// find returns the first element under n (or n itself) with one of the
+// given names, looking depth first, or nil
+func (n *specNode) find(names ...string) *specNode {
+	for _, name := range names {
+		if n.XMLName.Local == name {
+			return n
+		}
+	}
+	for i := range n.Children {
+		if found := n.Children[i].find(names...); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// findAll returns every element under n (or n itself) with the given name
+func (n *specNode) findAll(name string) []*specNode {
+	var found []*specNode
+	if n.XMLName.Local == name {
+		found = append(found, n)
+	}
+	for i := range n.Children {
+		found = append(found, n.Children[i].findAll(name)...)
+	}
+	return found
+}
+
+// specLayouts are the elements of a report specification that hold data.
+// Only list can be turned into columns.
+var specLayouts = []string{"list", "crosstab", "chart", "repeater", "repeaterTable", "map"}
+
+// specDataTypes is the DataType we give a column based on how the report
+// says its data item is used. Only facts (measures) tell us anything.
+var specDataTypes = map[string]string{
+	"fact": "decimal",
+}
+
+// ParseReportSpecColumns works out the columns a report outputs from its
+// specification (the XML you get from Report Studio's "Copy Report to
+// Clipboard"), in order. It uses the first list in the report, which is
+// what the CSV output comes from. The names are the data items the list
+// shows, and DataType is only known for facts. For anything other than a
+// list (ex: a crosstab, where the columns come from the data) it returns
+// ErrUnsupportedLayout.
+func ParseReportSpecColumns(spec string) ([]ColumnInfo, error) {
+	var report specNode
+	err := xml.Unmarshal([]byte(spec), &report)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the report specification: %w", err)
+	}
+	if report.XMLName.Local != "report" {
+		return nil, errors.New("unable to parse the report specification: it isn't a report")
+	}
+
+	// how each data item is used, by query then name
+	usages := make(map[string]map[string]string)
+	for _, query := range report.findAll("query") {
+		items := make(map[string]string)
+		for _, item := range query.findAll("dataItem") {
+			items[item.attr("name")] = ""
+			for _, xmlAttr := range item.findAll("XMLAttribute") {
+				if xmlAttr.attr("name") == "RS_dataUsage" {
+					items[item.attr("name")] = xmlAttr.attr("value")
+				}
+			}
+		}
+		usages[query.attr("name")] = items
+	}
+
+	var layout *specNode
+	if layouts := report.find("layouts"); layouts != nil {
+		layout = layouts.find(specLayouts...)
+	}
+	if layout == nil {
+		return nil, fmt.Errorf("%w: it has no data", ErrUnsupportedLayout)
+	}
+	if layout.XMLName.Local != "list" {
+		return nil, fmt.Errorf("%w: it is a %s", ErrUnsupportedLayout, layout.XMLName.Local)
+	}
+
+	items := usages[layout.attr("refQuery")]
+	columns := []ColumnInfo{}
+	for _, listColumn := range layout.findAll("listColumn") {
+		body := listColumn.find("listColumnBody")
+		if body == nil {
+			continue
+		}
+		value := body.find("dataItemValue")
+		if value == nil {
+			// ex: a column that is only text or an image
+			continue
+		}
+		name := value.attr("refDataItem")
+		dataType, found := specDataTypes[items[name]]
+		if !found {
+			dataType = UnknownType
+		}
+		columns = append(columns, ColumnInfo{Name: name, DataType: dataType})
+	}
+	return columns, nil
+}
+
+// specLinkFromID returns a link to the specification of a report
+func specLinkFromID(id string) string {
+	return objectPageLink("portal/report_spec.xts", id)
+}
+
+// GetReportColumnsFromSpec is ParseReportSpecColumns for the report with
+// the given id. If there is no such report the error wraps
+// fs.ErrNotExist.
+func (c *CognosInstance) GetReportColumnsFromSpec(id string) (columns []ColumnInfo, err error) {
+	err = catch(func() {
+		page := c.Request("GET", specLinkFromID(id), "")
+		if !strings.Contains(page, "<report") {
+			if fault, found := parseFault(page); found {
+				if isMissingObject(fault) {
+					panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+				}
+				panic(fmt.Errorf("Cognos returned an error when getting the specification of %s: %w", id, fault))
+			}
+			panic(c.notUnderstood(page, "Cognos returned a page we could not understand when getting the specification of "+id))
+		}
+		var parseErr error
+		columns, parseErr = ParseReportSpecColumns(page)
+		panicOnErr(parseErr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
@@ -0,0 +1,91 @@
+package cognos
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+const listSpec = `<report xmlns="http://developer.cognos.com/schemas/report/15.0/">
+<queries>
+	<query name="Query1">
+		<selection>
+			<dataItem name="Student ID"><expression>[Student].[ID]</expression></dataItem>
+			<dataItem name="Name"><expression>[Student].[Name]</expression></dataItem>
+			<dataItem name="GPA" aggregate="average">
+				<expression>[Student].[GPA]</expression>
+				<XMLAttributes><XMLAttribute name="RS_dataUsage" value="fact"/></XMLAttributes>
+			</dataItem>
+		</selection>
+	</query>
+</queries>
+<layouts><layout><reportPages><page name="Page1"><pageBody><contents>
+	<list refQuery="Query1">
+		<listColumns>
+			<listColumn><listColumnBody><contents><dataItemValue refDataItem="Student ID"/></contents></listColumnBody></listColumn>
+			<listColumn><listColumnBody><contents><textItem><dataSource><staticValue>logo</staticValue></dataSource></textItem></contents></listColumnBody></listColumn>
+			<listColumn><listColumnBody><contents><dataItemValue refDataItem="Name"/></contents></listColumnBody></listColumn>
+			<listColumn><listColumnBody><contents><dataItemValue refDataItem="GPA"/></contents></listColumnBody></listColumn>
+		</listColumns>
+	</list>
+</contents></pageBody></page></reportPages></layout></layouts>
+</report>`
+
+const crosstabSpec = `<report xmlns="http://developer.cognos.com/schemas/report/15.0/">
+<queries><query name="Query1"><selection/></query></queries>
+<layouts><layout><reportPages><page name="Page1"><pageBody><contents>
+	<crosstab refQuery="Query1"/>
+</contents></pageBody></page></reportPages></layout></layouts>
+</report>`
+
+func TestParseReportSpecColumns(t *testing.T) {
+	columns, err := ParseReportSpecColumns(listSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ColumnInfo{
+		{Name: "Student ID", DataType: UnknownType},
+		{Name: "Name", DataType: UnknownType},
+		{Name: "GPA", DataType: "decimal"},
+	}
+	if !reflect.DeepEqual(columns, want) {
+		t.Errorf("got %+v", columns)
+	}
+
+	_, err = ParseReportSpecColumns(crosstabSpec)
+	if !errors.Is(err, ErrUnsupportedLayout) {
+		t.Errorf("crosstab got %v", err)
+	}
+	_, err = ParseReportSpecColumns("<html><body>not a report</body></html>")
+	if err == nil || errors.Is(err, ErrUnsupportedLayout) {
+		t.Errorf("html got %v", err)
+	}
+}
+
+func TestGetReportColumnsFromSpec(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "Student ID,Name,GPA\n1,Ann,3.5\n")
+	report.Spec = listSpec
+
+	// there is no metadata, so this has to come from the spec
+	columns, ok := c.GetReportColumns(report.ID)
+	if !ok || len(columns) != 3 || columns[2] != (ColumnInfo{Name: "GPA", DataType: "decimal"}) {
+		t.Errorf("got %+v, %v", columns, ok)
+	}
+
+	crosstab := srv.Public.AddReport("Matrix", "a,b\n")
+	crosstab.Spec = crosstabSpec
+	if _, ok := c.GetReportColumns(crosstab.ID); ok {
+		t.Error("GetReportColumns worked for a crosstab")
+	}
+	_, err := c.GetReportColumnsFromSpec(crosstab.ID)
+	if !errors.Is(err, ErrUnsupportedLayout) {
+		t.Errorf("crosstab got %v", err)
+	}
+
+	_, err = c.GetReportColumnsFromSpec("i0000000000000000000000000000000")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing report got %v", err)
+	}
+}
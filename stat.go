@@ -0,0 +1,192 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/antchfx/htmlquery"
+)
+
+// ErrNotFound means an object (or part of a path) isn't there. It is the
+// same as fs.ErrNotExist, so errors.Is works with either one.
+var ErrNotFound = fs.ErrNotExist
+
+// notExist makes an error for something that isn't there. It works with
+// errors.Is(err, ErrNotFound).
+func notExist(message string) error {
+	return fmt.Errorf("%s: %w", message, ErrNotFound)
+}
+
+// NotFoundError is what we fail with when part of a path isn't there (or
+// is a report in the middle of the path). It works with
+// errors.Is(err, ErrNotFound).
+type NotFoundError struct {
+	// Component is the part of the path that is missing (ex: the name of
+	// a folder, or a root)
+	Component string
+	// msg is what went wrong
+	msg string
+}
+
+func (e *NotFoundError) Error() string {
+	return e.msg + ": " + ErrNotFound.Error()
+}
+
+func (e *NotFoundError) Unwrap() error { return ErrNotFound }
+
+// missingEntry makes a *NotFoundError for an entry that isn't in its
+// folder
+func missingEntry(name string) error {
+	return &NotFoundError{Component: name, msg: "Could not find folder entry " + name}
+}
+
+// reportInPath makes a *NotFoundError for a report in the middle of a path
+func reportInPath(name string) error {
+	return &NotFoundError{Component: name, msg: name + " is a report but it is in the middle of a path"}
+}
+
+// EntryInfo is what StatEntry knows about an object
+type EntryInfo struct {
+	Type FolderEntryType `json:"type"`
+	ID   string          `json:"id"`
+	Name string          `json:"name"`
+	// Class is the Cognos object class (ex: report, query, folder, package)
+	Class string `json:"class"`
+}
+
+// folderClasses are the object classes we treat as folders. Everything
+// else is treated as a report.
+var folderClasses = map[string]bool{
+	"folder":  true,
+	"package": true,
+}
+
+// bareStoreID matches an ID like the ones in folder links, as opposed to
+// a search path
+var bareStoreID = regexp.MustCompile(`^[0-9a-zA-Z-]+$`)
+
+// searchPathStart matches the start of the search paths we accept as IDs
+var searchPathStart = regexp.MustCompile(`^(storeID\("[0-9a-zA-Z-]+"\)|CAMID\("|/)`)
+
+// ErrInvalidID means an ID isn't a store ID or a search path. It is
+// checked before building a link with it, so a mangled ID (ex: with a
+// stray space) can't end up pointing at some other object, or nothing.
+var ErrInvalidID = errors.New("invalid object ID")
+
+// ValidateID returns an error wrapping ErrInvalidID if id isn't a store ID
+// (ex: i1A2B3C4D5E6F) or a search path (ex: storeID("i1A2B3C4D5E6F") or
+// /content/folder[@name='Reports']), or nil if it is
+func ValidateID(id string) error {
+	valid := bareStoreID.MatchString(id) ||
+		(searchPathStart.MatchString(id) && strings.TrimSpace(id) == id)
+	for _, r := range id {
+		valid = valid && !unicode.IsControl(r)
+	}
+	if !valid {
+		return fmt.Errorf("%w: %q", ErrInvalidID, id)
+	}
+	return nil
+}
+
+// checkID panics if id isn't valid (see ValidateID)
+func checkID(id string) {
+	panicOnErr(ValidateID(id))
+}
+
+// objectPageLink returns a link to one of the portal pages about an
+// object (ex: portal/properties_general.xts). id can be a store ID or a
+// search path.
+func objectPageLink(page string, id string) string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=" + page +
+		"&m_obj=" + url.QueryEscape(objectSearchPath(id))
+}
+
+// objectSearchPath turns a store ID into a search path. Anything else is
+// assumed to be a search path already. It panics if id isn't valid (see
+// ValidateID).
+func objectSearchPath(id string) string {
+	checkID(id)
+	if bareStoreID.MatchString(id) {
+		return `storeID("` + id + `")`
+	}
+	return id
+}
+
+// propertiesLinkFromID returns a link to the properties page of an object
+func propertiesLinkFromID(id string) string {
+	return objectPageLink("portal/properties_general.xts", id)
+}
+
+// StatEntry looks up an object by ID, so you can check that an ID you
+// saved earlier still points to something (objects get deleted, and then
+// their IDs are no good). If there is no such object the error wraps
+// fs.ErrNotExist.
+func (c *CognosInstance) StatEntry(id string) (info EntryInfo, err error) {
+	err = catch(func() {
+		page := c.Request("GET", propertiesLinkFromID(id), "")
+
+		docTree, err := htmlquery.Parse(strings.NewReader(page))
+		panicOnErr(err)
+		classInput := htmlquery.FindOne(docTree, `//input[@name="m_class"]`)
+		if classInput == nil {
+			if fault, found := parseFault(page); found {
+				if isMissingObject(fault) {
+					panic(fmt.Errorf("Could not find object %s: %w: %w", id, fs.ErrNotExist, fault))
+				}
+				panic(fmt.Errorf("Cognos returned an error when looking up %s: %w", id, fault))
+			}
+			panic(c.notUnderstood(page, "Cognos returned a page we could not understand when looking up "+id))
+		}
+
+		info.ID = id
+		info.Class = htmlquery.SelectAttr(classInput, "value")
+		if nameInput := htmlquery.FindOne(docTree, `//input[@name="m_name"]`); nameInput != nil {
+			info.Name = cleanEntryName(htmlquery.SelectAttr(nameInput, "value"))
+		}
+		if folderClasses[info.Class] {
+			info.Type = Folder
+		} else {
+			info.Type = Report
+		}
+	})
+	if err != nil {
+		return EntryInfo{}, err
+	}
+	return info, nil
+}
+
+// isMissingObject guesses if a fault means the object we asked about
+// doesn't exist. Like isConversationGone, we go by the message.
+func isMissingObject(fault *Fault) bool {
+	text := strings.ToLower(fault.Message + " " + fault.Detail)
+	return strings.Contains(text, "not found") ||
+		strings.Contains(text, "does not exist") ||
+		strings.Contains(text, "not valid")
+}
+
+// EntryExists checks if there is something at path (see
+// FolderEntryFromPath), and if so, what type it is. Something not being
+// there is not an error. err is only set if we couldn't find out (ex:
+// Cognos is down). Like FolderEntryFromPath, paths that were resolved
+// before are remembered, so call ForgetPaths first if things might have
+// been deleted since.
+func (c *CognosInstance) EntryExists(path []string) (exists bool, entryType FolderEntryType, err error) {
+	var entry FolderEntry
+	err = catch(func() {
+		entry = c.FolderEntryFromPath(path)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, 0, nil
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	return true, entry.Type, nil
+}
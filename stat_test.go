@@ -0,0 +1,74 @@
+package cognos
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestValidateID(t *testing.T) {
+	valid := []string{
+		"i1A2B3C4D5E6F",
+		`storeID("i1A2B3C4D5E6F")`,
+		`CAMID(":")`,
+		"/content/folder[@name='Reports']",
+	}
+	for _, id := range valid {
+		if err := ValidateID(id); err != nil {
+			t.Errorf("%q: %v", id, err)
+		}
+	}
+	invalid := []string{
+		"",
+		" i1A2B3C4D5E6F",
+		"i1A2B3C4D5E6F\n",
+		"i1A2B3C4D5E6F&m=portal/logoff.xts",
+		`storeID("i1A2B3C4D5E6F") `,
+		"/content/folder[@name='Re\x00ports']",
+	}
+	for _, id := range invalid {
+		if err := ValidateID(id); !errors.Is(err, ErrInvalidID) {
+			t.Errorf("%q: got %v", id, err)
+		}
+	}
+}
+
+func TestStatEntry(t *testing.T) {
+	srv, c := newTestInstance(t)
+	folder := srv.Public.AddFolder("Reports")
+	report := folder.AddReport("Roster", "a\n1\n")
+
+	info, err := c.StatEntry(folder.ID)
+	if err != nil || info.Type != Folder || info.Name != "Reports" {
+		t.Errorf("folder got %+v, %v", info, err)
+	}
+	info, err = c.StatEntry(`storeID("` + report.ID + `")`)
+	if err != nil || info.Type != Report || info.Name != "Roster" {
+		t.Errorf("report got %+v, %v", info, err)
+	}
+	_, err = c.StatEntry("i0000000000000000000000000000000")
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing got %v", err)
+	}
+}
+
+func TestStatEntryInvalidID(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "a\n1\n")
+	srv.ResetRequests()
+
+	// a mangled ID must not reach the server at all
+	for _, id := range []string{report.ID + " ", report.ID + "&m=portal/logoff.xts"} {
+		_, err := c.StatEntry(id)
+		if !errors.Is(err, ErrInvalidID) {
+			t.Errorf("%q: got %v", id, err)
+		}
+		_, err = c.GetReportColumnsFromSpec(id)
+		if !errors.Is(err, ErrInvalidID) {
+			t.Errorf("spec %q: got %v", id, err)
+		}
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("made %d requests", n)
+	}
+}
@@ -0,0 +1,80 @@
+package cognos
+
+import "sync/atomic"
+
+// statCounters are the counters behind Stats. It is shared between an
+// instance and any instances derived from it.
+type statCounters struct {
+	requests      int64
+	retries       int64
+	unauthorized  int64
+	reportsRun    int64
+	polls         int64
+	pollFailures  int64
+	bytes         int64
+	cacheHits     int64
+	cacheMisses   int64
+	listingHits   int64
+	listingMisses int64
+}
+
+// Stats are counts of what an instance (and any instances derived from
+// it) has done since it was made
+type Stats struct {
+	// Requests is every HTTP request we sent, including retries
+	Requests int64
+	// Retries is how many of those were retries
+	Retries int64
+	// Unauthorized is how many 401s we got
+	Unauthorized int64
+	// ReportsRun is how many reports we started running
+	ReportsRun int64
+	// Polls is how many times we checked on a running report
+	Polls int64
+	// PollFailures is how many of those failed (after their own retries)
+	PollFailures int64
+	// BytesDownloaded is the total size of the report outputs we downloaded
+	BytesDownloaded int64
+	// CacheHits and CacheMisses are for the report output cache (see
+	// CacheDir). They are 0 if it is turned off.
+	CacheHits   int64
+	CacheMisses int64
+	// ListingHits and ListingMisses are folder listings that were (and
+	// weren't) remembered (see ListingTTL)
+	ListingHits   int64
+	ListingMisses int64
+	// InFlight and Waiting are from RequestSlots
+	InFlight int
+	Waiting  int
+	// Queued is Waiting split up by Priority (see QueuedRequests)
+	Queued map[Priority]int
+}
+
+// count adds 1 to a counter
+func count(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+// Stats returns a snapshot of the instance's counters. Each counter is
+// read atomically, but they aren't all read at exactly the same time, so
+// something that is happening while Stats is called might only be
+// partly counted.
+func (c *CognosInstance) Stats() Stats {
+	inFlight, waiting := c.RequestSlots()
+	return Stats{
+		Requests:        atomic.LoadInt64(&c.stats.requests),
+		Retries:         atomic.LoadInt64(&c.stats.retries),
+		Unauthorized:    atomic.LoadInt64(&c.stats.unauthorized),
+		ReportsRun:      atomic.LoadInt64(&c.stats.reportsRun),
+		Polls:           atomic.LoadInt64(&c.stats.polls),
+		PollFailures:    atomic.LoadInt64(&c.stats.pollFailures),
+		BytesDownloaded: atomic.LoadInt64(&c.stats.bytes),
+		CacheHits:       atomic.LoadInt64(&c.stats.cacheHits),
+		CacheMisses:     atomic.LoadInt64(&c.stats.cacheMisses),
+		ListingHits:     atomic.LoadInt64(&c.stats.listingHits),
+		ListingMisses:   atomic.LoadInt64(&c.stats.listingMisses),
+		InFlight:        inFlight,
+		Waiting:         waiting,
+		Queued:          c.QueuedRequests(),
+	}
+}
@@ -0,0 +1,50 @@
+package cognos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.ListingTTL = 60
+	c.CacheDir = t.TempDir()
+	c.CacheTTL = 60
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 2
+	attendance := srv.Public.AddFolder("Attendance")
+
+	// one retry, then a remembered listing
+	srv.InjectFaults(503, 1)
+	c.LsFolder(srv.Public.ID)
+	c.LsFolder(srv.Public.ID)
+	// one run, then a cached output
+	c.DownloadReportCSV(report.ID)
+	c.DownloadReportCSV(report.ID)
+	// a 401 and a retry
+	srv.InjectFaults(401, 1)
+	c.LsFolder(attendance.ID)
+
+	want := Stats{
+		Requests:        int64(len(srv.Requests())),
+		Retries:         2,
+		Unauthorized:    1,
+		ReportsRun:      1,
+		Polls:           2,
+		BytesDownloaded: int64(len(report.CSV)),
+		CacheHits:       1,
+		CacheMisses:     1,
+		ListingHits:     1,
+		ListingMisses:   2,
+		Queued:          map[Priority]int{HighPriority: 0, NormalPriority: 0, LowPriority: 0},
+	}
+	got := c.Stats()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+
+	// derived instances share the counters
+	if derived := c.WithDSN("testfin").Stats(); derived.Requests != want.Requests {
+		t.Errorf("the derived instance has %d requests, want %d", derived.Requests, want.Requests)
+	}
+}
@@ -0,0 +1,246 @@
+package cognos
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// UnknownType is the DataType of a column when Cognos didn't tell us
+const UnknownType = "unknown"
+
+// ColumnInfo is a column of a report's output
+type ColumnInfo struct {
+	Name string `json:"name"`
+	// DataType is the type Cognos says the column is: "string", "integer",
+	// "decimal", "date", "dateTime", "boolean", or UnknownType
+	DataType string `json:"dataType"`
+	// Original is the name before Table.NormalizeHeaders, if it was used
+	Original string `json:"original,omitempty"`
+}
+
+// Table is a report output split into rows and columns
+type Table struct {
+	Columns []ColumnInfo `json:"columns"`
+	// Rows do not include the header. Short rows are not padded.
+	Rows [][]string `json:"rows"`
+	// NoData is true if the report didn't find anything. Columns is
+	// still filled in if Cognos told us what they would have been.
+	NoData bool `json:"noData"`
+}
+
+// metadataLinkFromID returns a link to the query metadata of a report
+func metadataLinkFromID(id string) string {
+	return objectPageLink("portal/report_metadata.xts", id)
+}
+
+// GetReportColumns returns the columns the report with the given id says
+// it outputs, without running it. If Cognos won't tell us (some reports,
+// like ones with more than one query, don't have this), the columns are
+// worked out from the report specification instead (see
+// GetReportColumnsFromSpec), which knows less about the data types. ok is
+// false if that didn't work either (ex: the report is a crosstab).
+func (c *CognosInstance) GetReportColumns(id string) (columns []ColumnInfo, ok bool) {
+	page := c.Request("GET", metadataLinkFromID(id), "")
+
+	if !findJSVar(page, "g_PS_Columns", &columns) {
+		columns, err := c.GetReportColumnsFromSpec(id)
+		return columns, err == nil
+	}
+	return columns, true
+}
+
+// sniffRows is how many rows (after the header) sniffDelimiter looks at
+const sniffRows = 20
+
+// sniffDelimiter guesses the field seperator of a report output. Some
+// reports are set up to use tabs or semicolons, even though the format is
+// still called CSV. Each one is tried on the first few rows, and the one
+// where the most rows have as many fields as the header wins. The header
+// has to have more than one field. Quotes are respected, so a comma
+// seperated output with semicolons in quoted values isn't mistaken for a
+// semicolon seperated one. If nothing fits, it is a comma.
+func sniffDelimiter(output string) rune {
+	best, bestScore, bestFields := ',', -1, 0
+	for _, delimiter := range []rune{',', '\t', ';'} {
+		reader := csv.NewReader(strings.NewReader(output))
+		reader.Comma = delimiter
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		header, err := reader.Read()
+		if err != nil || len(header) < 2 {
+			continue
+		}
+
+		score := 0
+		for i := 0; i < sniffRows; i++ {
+			record, err := reader.Read()
+			if err != nil {
+				break
+			}
+			if len(record) == len(header) {
+				score++
+			}
+		}
+		if score > bestScore || (score == bestScore && len(header) > bestFields) {
+			best, bestScore, bestFields = delimiter, score, len(header)
+		}
+	}
+	return best
+}
+
+// parseCSV splits a report output into a header and rows. delimiter is
+// the field seperator, or 0 to guess (see sniffDelimiter).
+func parseCSV(output string, delimiter rune) (header []string, rows [][]string, err error) {
+	if delimiter == 0 {
+		delimiter = sniffDelimiter(output)
+	}
+	reader := csv.NewReader(strings.NewReader(output))
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, [][]string{}, nil
+	}
+	// excel likes to put a BOM at the start
+	records[0][0] = strings.TrimPrefix(records[0][0], "\ufeff")
+	return records[0], records[1:], nil
+}
+
+// matchColumns gives each column in header the type from metadata with
+// the same name. Names are taken from the header, since that is what is
+// actually in the output.
+func matchColumns(header []string, metadata []ColumnInfo) []ColumnInfo {
+	types := make(map[string]string)
+	for _, column := range metadata {
+		types[strings.ToLower(column.Name)] = column.DataType
+	}
+
+	columns := make([]ColumnInfo, len(header))
+	for i, name := range header {
+		columns[i] = ColumnInfo{Name: name, DataType: UnknownType}
+		if dataType := types[strings.ToLower(name)]; dataType != "" {
+			columns[i].DataType = dataType
+		}
+	}
+	return columns
+}
+
+// DownloadReportTable downloads a report like DownloadReportCSV, then
+// splits it into rows and columns, and looks up what type each column is.
+// If Cognos won't tell us the types, the column names still come from the
+// CSV header, with a DataType of UnknownType.
+func (c *CognosInstance) DownloadReportTable(id string) Table {
+	return c.DownloadReportTableWithOptions(id, DownloadOptions{})
+}
+
+// DownloadReportTableWithOptions is DownloadReportTable with options
+func (c *CognosInstance) DownloadReportTableWithOptions(id string, opts DownloadOptions) Table {
+	output := c.DownloadReportCSVWithOptions(id, opts)
+	header, rows, err := parseCSV(output, opts.Delimiter)
+	if err != nil {
+		panic(fmt.Errorf("Unable to parse the output of report %s as CSV: %w", id, err))
+	}
+
+	// not having types isn't worth failing over
+	var metadata []ColumnInfo
+	catch(func() {
+		metadata, _ = c.GetReportColumns(id)
+	})
+	if header == nil {
+		// the "No Data Available" page dosen't tell us the columns, but
+		// the metadata might
+		header = make([]string, len(metadata))
+		for i, column := range metadata {
+			header[i] = column.Name
+		}
+	}
+	return Table{
+		Columns: matchColumns(header, metadata),
+		Rows:    rows,
+		NoData:  len(rows) == 0,
+	}
+}
+
+// PreviewReport gets the first n rows of a report, for checking that it
+// works without waiting for the whole thing. See DownloadOptions.RowLimit.
+func (c *CognosInstance) PreviewReport(id string, n int) Table {
+	return c.DownloadReportTableWithOptions(id, DownloadOptions{RowLimit: n})
+}
+
+// HeaderOptions controls Table.NormalizeHeaders
+type HeaderOptions struct {
+	// SnakeCase makes names lower case, with words seperated by _
+	// (ex: "Student ID" becomes "student_id")
+	SnakeCase bool
+}
+
+// normalizeHeader cleans up one column name
+func normalizeHeader(name string, opts HeaderOptions) string {
+	name = strings.Join(strings.Fields(name), " ")
+	if opts.SnakeCase {
+		var snake strings.Builder
+		for _, r := range strings.ToLower(name) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				snake.WriteRune(r)
+			} else if snake.Len() > 0 && !strings.HasSuffix(snake.String(), "_") {
+				snake.WriteByte('_')
+			}
+		}
+		name = strings.TrimSuffix(snake.String(), "_")
+	}
+	return name
+}
+
+// NormalizeHeaders returns a copy of t with cleaned up column names:
+// spaces are trimmed off the ends, runs of whitespace become one space,
+// and names are converted to snake_case if opts says to. If two columns
+// end up with the same name, the second gets " 2" (or "_2") added, the
+// third " 3", and so on, skipping any that are already taken by another
+// column. The original names are kept in ColumnInfo.Original. Do this
+// before Decode so struct tags can use the normalized names.
+func (t Table) NormalizeHeaders(opts HeaderOptions) Table {
+	seperator := " "
+	if opts.SnakeCase {
+		seperator = "_"
+	}
+
+	names := make([]string, len(t.Columns))
+	taken := make(map[string]bool)
+	for i, column := range t.Columns {
+		names[i] = normalizeHeader(column.Name, opts)
+		taken[names[i]] = true
+	}
+
+	// the first column with a name keeps it. Later ones get a number.
+	seen := make(map[string]bool)
+	columns := make([]ColumnInfo, len(t.Columns))
+	for i, column := range t.Columns {
+		name := names[i]
+		if seen[name] {
+			for n := 2; ; n++ {
+				numbered := name + seperator + strconv.Itoa(n)
+				if !taken[numbered] {
+					name = numbered
+					taken[name] = true
+					break
+				}
+			}
+		}
+		seen[name] = true
+
+		columns[i] = column
+		columns[i].Name = name
+		if column.Original == "" {
+			columns[i].Original = column.Name
+		}
+	}
+	t.Columns = columns
+	return t
+}
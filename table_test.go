@@ -0,0 +1,126 @@
+package cognos
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+func TestDownloadReportTable(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "Student ID,Name,Birth Date,Extra\n1,Ann,2010-04-01,x\n2,Bob,2011-09-30\n")
+	report.Columns = []cognostest.Column{
+		{Name: "student id", DataType: "integer"},
+		{Name: "Name", DataType: "string"},
+		{Name: "Birth Date", DataType: "date"},
+	}
+
+	table := c.DownloadReportTable(report.ID)
+	wantColumns := []ColumnInfo{
+		{Name: "Student ID", DataType: "integer"},
+		{Name: "Name", DataType: "string"},
+		{Name: "Birth Date", DataType: "date"},
+		// the metadata dosen't know about this one
+		{Name: "Extra", DataType: UnknownType},
+	}
+	if !reflect.DeepEqual(table.Columns, wantColumns) {
+		t.Errorf("got columns %+v", table.Columns)
+	}
+	wantRows := [][]string{{"1", "Ann", "2010-04-01", "x"}, {"2", "Bob", "2011-09-30"}}
+	if !reflect.DeepEqual(table.Rows, wantRows) || table.NoData {
+		t.Errorf("got rows %q (NoData %v)", table.Rows, table.NoData)
+	}
+}
+
+func TestDownloadReportTableWithoutMetadata(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Roster", "\ufeffStudent ID,Name\n1,Ann\n")
+
+	if _, ok := c.GetReportColumns(report.ID); ok {
+		t.Error("GetReportColumns worked without metadata or a spec")
+	}
+	table := c.DownloadReportTable(report.ID)
+	wantColumns := []ColumnInfo{
+		{Name: "Student ID", DataType: UnknownType},
+		{Name: "Name", DataType: UnknownType},
+	}
+	if !reflect.DeepEqual(table.Columns, wantColumns) {
+		t.Errorf("got columns %+v", table.Columns)
+	}
+}
+
+func TestNormalizeHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []string
+		opts    HeaderOptions
+		want    []string
+	}{
+		{"spaces", []string{"  Student   ID ", "Name\t"}, HeaderOptions{}, []string{"Student ID", "Name"}},
+		{"snake case", []string{"Student ID", "Birth-Date", "GPA (weighted)"}, HeaderOptions{SnakeCase: true}, []string{"student_id", "birth_date", "gpa_weighted"}},
+		{"duplicates", []string{"Name", "Name", "Name"}, HeaderOptions{}, []string{"Name", "Name 2", "Name 3"}},
+		{"duplicates after cleanup", []string{"Name", " Name", "Name  "}, HeaderOptions{}, []string{"Name", "Name 2", "Name 3"}},
+		// Name 2 is already a column, so the second Name skips it
+		{"taken number", []string{"Name", "Name", "Name 2"}, HeaderOptions{}, []string{"Name", "Name 3", "Name 2"}},
+		{"snake case duplicates", []string{"Student ID", "student id", "STUDENT_ID"}, HeaderOptions{SnakeCase: true}, []string{"student_id", "student_id_2", "student_id_3"}},
+	}
+	for _, test := range tests {
+		table := Table{}
+		for _, header := range test.headers {
+			table.Columns = append(table.Columns, ColumnInfo{Name: header, DataType: "string"})
+		}
+		normalized := table.NormalizeHeaders(test.opts)
+		for i, column := range normalized.Columns {
+			if column.Name != test.want[i] || column.Original != test.headers[i] || column.DataType != "string" {
+				t.Errorf("%s: column %d is %+v, want %q", test.name, i, column, test.want[i])
+			}
+		}
+		if table.Columns[0].Original != "" {
+			t.Errorf("%s: the original table was changed", test.name)
+		}
+
+		// doing it again changes nothing, and keeps the first names
+		again := normalized.NormalizeHeaders(test.opts)
+		if !reflect.DeepEqual(again.Columns, normalized.Columns) {
+			t.Errorf("%s: normalizing twice got %+v", test.name, again.Columns)
+		}
+	}
+}
+
+func TestSniffDelimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   rune
+	}{
+		{"comma", "id,name\n1,Ann\n2,Bob\n", ','},
+		{"tab", "id\tname\n1\tAnn\n2\tBob\n", '\t'},
+		{"semicolon", "id;name;amount\n1;Ann;1,50\n2;Bob;2,75\n", ';'},
+		// the semicolons are in quoted values
+		{"quoted semicolons", "id,note\n1,\"a;b\"\n2,\"c;d;e\"\n", ','},
+		{"commas in a tab output", "id\tname\n1\tPenn, Jon\n2\tDoe, Jane\n", '\t'},
+		{"one column", "id\n1\n2\n", ','},
+		{"empty", "", ','},
+	}
+	for _, test := range tests {
+		if got := sniffDelimiter(test.output); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestDownloadReportTableDelimiter(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Semicolons", "id;amount\n1;1,50\n")
+
+	table := c.DownloadReportTable(report.ID)
+	if len(table.Columns) != 2 || !reflect.DeepEqual(table.Rows, [][]string{{"1", "1,50"}}) {
+		t.Errorf("guessing got %+v", table)
+	}
+	// saying what it is wins over guessing
+	table = c.DownloadReportTableWithOptions(report.ID, DownloadOptions{Delimiter: ','})
+	if !reflect.DeepEqual(table.Rows, [][]string{{"1;1", "50"}}) {
+		t.Errorf("a comma delimiter got %+v", table.Rows)
+	}
+}
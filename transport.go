@@ -0,0 +1,71 @@
+package cognos
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"github.com/Azure/go-ntlmssp"
+)
+
+// defaultIdleConnTimeout is used when TransportOptions.IdleConnTimeout is 0
+const defaultIdleConnTimeout = 90
+
+// TransportOptions tunes the connections to Cognos (see
+// SetTransportOptions). The zero value is what MakeInstance uses.
+//
+// NTLM authenticates a connection, not a request, so every new connection
+// costs an extra handshake before the real request can be sent. Keeping
+// enough connections open for reuse avoids that (and avoids setting off
+// alarms about how many connections we are making). The handshake also
+// has to happen on one connection from start to finish, which is why
+// HTTP/2 (where the server can't tell requests on a connection apart by
+// who sent them) is off unless you ask for it (even over TLS, where Go
+// would otherwise use it on its own). Some gateways (ex: IIS)
+// refuse NTLM over HTTP/2 all together.
+type TransportOptions struct {
+	// MaxIdleConnsPerHost is how many unused connections are kept open
+	// for reuse. 0 means concurrentRequests (see MakeInstance), so every
+	// request slot can have one.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how many seconds an unused connection is kept
+	// open. 0 means 90.
+	IdleConnTimeout uint
+	// HTTP2 uses HTTP/2 if the server supports it
+	HTTP2 bool
+}
+
+// newTransport makes the transport that goes under the NTLM negotiator
+func newTransport(opts TransportOptions, concurrentRequests uint) *http.Transport {
+	idlePerHost := opts.MaxIdleConnsPerHost
+	if idlePerHost == 0 {
+		idlePerHost = int(concurrentRequests)
+	}
+	idleTimeout := opts.IdleConnTimeout
+	if idleTimeout == 0 {
+		idleTimeout = defaultIdleConnTimeout
+	}
+	transport := &http.Transport{
+		MaxIdleConnsPerHost:   idlePerHost,
+		IdleConnTimeout:       time.Duration(idleTimeout) * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     opts.HTTP2,
+	}
+	if !opts.HTTP2 {
+		// without this, Go still offers h2 over TLS on its own. A non-nil
+		// empty map turns that off.
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport
+}
+
+// SetTransportOptions replaces the transport with a new one tuned by opts.
+// Like SetTransport, this replaces any transport set before (including
+// one set with SetTransport), and instances already derived from c (ex:
+// with WithDSN) are not affected.
+func (c *CognosInstance) SetTransportOptions(opts TransportOptions) {
+	c.client.Transport = ntlmssp.Negotiator{
+		RoundTripper: newTransport(opts, c.concurrentRequests),
+	}
+}
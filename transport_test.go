@@ -0,0 +1,88 @@
+package cognos
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConnectionsAreReused(t *testing.T) {
+	for _, test := range []struct {
+		name        string
+		opts        *TransportOptions
+		connections func(n int) bool
+	}{
+		{"default", nil, func(n int) bool { return n <= 4 }},
+		{"one idle connection", &TransportOptions{MaxIdleConnsPerHost: 1}, func(n int) bool { return n > 4 }},
+	} {
+		srv, c := newTestInstance(t)
+		srv.Delay = 10 * time.Millisecond
+		if test.opts != nil {
+			c.SetTransportOptions(*test.opts)
+		}
+
+		// 5 rounds of as many requests as we are allowed at once
+		for round := 0; round < 5; round++ {
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					c.Request("GET", folderLinkFromID(srv.Public.ID), "")
+				}()
+			}
+			wg.Wait()
+		}
+		if n := srv.Connections(); !test.connections(n) {
+			t.Errorf("%s: made %d connections for 20 requests, 4 at a time", test.name, n)
+		}
+	}
+}
+
+func TestNewTransport(t *testing.T) {
+	transport := newTransport(TransportOptions{}, 6)
+	if transport.MaxIdleConnsPerHost != 6 || transport.IdleConnTimeout != 90*time.Second || transport.ForceAttemptHTTP2 {
+		t.Errorf("the defaults are %d idle connections for %v, HTTP/2 %v",
+			transport.MaxIdleConnsPerHost, transport.IdleConnTimeout, transport.ForceAttemptHTTP2)
+	}
+	transport = newTransport(TransportOptions{MaxIdleConnsPerHost: 2, IdleConnTimeout: 5, HTTP2: true}, 6)
+	if transport.MaxIdleConnsPerHost != 2 || transport.IdleConnTimeout != 5*time.Second || !transport.ForceAttemptHTTP2 {
+		t.Error("the options were ignored")
+	}
+}
+
+func TestHTTP2Option(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	roots := srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	for _, http2 := range []bool{false, true} {
+		transport := newTransport(TransportOptions{HTTP2: http2}, 4)
+		// Go won't use HTTP/2 on its own if we set a TLS config, so let it
+		// decide first (CloseIdleConnections makes it), and then trust the
+		// test server in the config it made
+		transport.CloseIdleConnections()
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.RootCAs = roots
+		resp, err := (&http.Client{Transport: transport}).Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		want := 1
+		if http2 {
+			want = 2
+		}
+		if resp.ProtoMajor != want {
+			t.Errorf("HTTP2 %v got %s", http2, resp.Proto)
+		}
+		transport.CloseIdleConnections()
+	}
+}
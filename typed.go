@@ -0,0 +1,260 @@
+package cognos
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Caster converts a cell to a Go value. It is only called for cells that
+// aren't empty.
+type Caster func(cell string) (interface{}, error)
+
+// ParseOptions controls how Table.TypedRows and Table.Decode convert cells
+type ParseOptions struct {
+	// Casters convert the cells of a column, keyed by column name. They
+	// win over the column's DataType (or the struct field's type).
+	Casters map[string]Caster
+	// BestEffort collects conversion errors and keeps going, instead of
+	// panicking on the first one. A cell that fails is left empty.
+	BestEffort bool
+	// Locale is how numbers and dates are formatted. The zero value is
+	// what ADE uses (see USLocale).
+	Locale Locale
+	// ColumnLocales overrides Locale for some columns, keyed by column name
+	ColumnLocales map[string]Locale
+}
+
+// locale returns the Locale for a column
+func (opts ParseOptions) locale(column string) Locale {
+	if locale, found := opts.ColumnLocales[column]; found {
+		return locale
+	}
+	return opts.Locale
+}
+
+// CellError is a cell that couldn't be converted
+type CellError struct {
+	// Row and Column start at 0. Row does not count the header.
+	Row    int
+	Column int
+	// Name is the column name
+	Name  string
+	Value string
+	Err   error
+}
+
+func (e *CellError) Error() string {
+	return fmt.Sprintf("row %d, column %q: can't convert %q: %v", e.Row, e.Name, e.Value, e.Err)
+}
+
+func (e *CellError) Unwrap() error {
+	return e.Err
+}
+
+// castByDataType converts a cell based on a ColumnInfo.DataType. Strings
+// and columns with an unknown type are left alone.
+func castByDataType(dataType string, cell string, locale Locale) (interface{}, error) {
+	switch dataType {
+	case "integer":
+		return strconv.ParseInt(locale.normalizeNumber(cell), 10, 64)
+	case "decimal":
+		return strconv.ParseFloat(locale.normalizeNumber(cell), 64)
+	case "boolean":
+		return strconv.ParseBool(cell)
+	case "date", "dateTime":
+		return locale.parseDate(cell)
+	default:
+		return cell, nil
+	}
+}
+
+// TypedRows converts every cell to a Go value based on its column's
+// DataType: integer becomes int64, decimal becomes float64, boolean
+// becomes bool, date and dateTime become time.Time, and everything else
+// stays a string. Empty cells become nil. If a cell can't be converted
+// TypedRows panics with a *CellError, unless opts.BestEffort is set, in
+// which case every failure is returned in errs.
+func (t Table) TypedRows(opts ParseOptions) (rows [][]interface{}, errs []*CellError) {
+	rows = make([][]interface{}, len(t.Rows))
+	for r, row := range t.Rows {
+		rows[r] = make([]interface{}, len(row))
+		for col, cell := range row {
+			if cell == "" {
+				continue
+			}
+			column := t.column(col)
+			var value interface{}
+			var err error
+			if caster, found := opts.Casters[column.Name]; found {
+				value, err = caster(cell)
+			} else {
+				value, err = castByDataType(column.DataType, cell, opts.locale(column.Name))
+			}
+			if err != nil {
+				cellErr := &CellError{Row: r, Column: col, Name: column.Name, Value: cell, Err: err}
+				if !opts.BestEffort {
+					panic(cellErr)
+				}
+				errs = append(errs, cellErr)
+				continue
+			}
+			rows[r][col] = value
+		}
+	}
+	return rows, errs
+}
+
+// column returns the ColumnInfo for column i, even if the row has more
+// cells than the header
+func (t Table) column(i int) ColumnInfo {
+	if i < len(t.Columns) {
+		return t.Columns[i]
+	}
+	return ColumnInfo{Name: strconv.Itoa(i), DataType: UnknownType}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// castToType converts a cell to typ, which may be a string, bool, any
+// kind of int, uint, or float, or time.Time
+func castToType(cell string, typ reflect.Type, locale Locale) (reflect.Value, error) {
+	value := reflect.New(typ).Elem()
+	if typ == timeType {
+		t, err := locale.parseDate(cell)
+		value.Set(reflect.ValueOf(t))
+		return value, err
+	}
+
+	switch typ.Kind() {
+	case reflect.String:
+		value.SetString(cell)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(cell)
+		if err != nil {
+			return value, err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(locale.normalizeNumber(cell), 10, typ.Bits())
+		if err != nil {
+			return value, err
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(locale.normalizeNumber(cell), 10, typ.Bits())
+		if err != nil {
+			return value, err
+		}
+		value.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(locale.normalizeNumber(cell), typ.Bits())
+		if err != nil {
+			return value, err
+		}
+		value.SetFloat(f)
+	default:
+		return value, fmt.Errorf("unsupported type %s", typ)
+	}
+	return value, nil
+}
+
+// fieldForColumn returns the index of the struct field a column goes in,
+// or -1. A field with a `cognos:"Column Name"` tag gets that column,
+// otherwise the field name is compared with the column name, ignoring
+// case, spaces, and underscores. A field tagged `cognos:"-"` is never
+// filled in.
+func fieldForColumn(structType reflect.Type, column string) int {
+	squash := func(s string) string {
+		s = strings.ReplaceAll(s, " ", "")
+		return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+	}
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if tag, tagged := field.Tag.Lookup("cognos"); tagged {
+			if tag == column {
+				return i
+			}
+			continue
+		}
+		if squash(field.Name) == squash(column) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Decode fills dest, which must be a pointer to a slice of structs, with
+// one struct per row. See fieldForColumn for how columns are matched up
+// with fields. Cells are converted to the type of the field. Empty cells
+// leave the field as its zero value, so use a pointer field (ex: *int) if
+// you need to tell empty and 0 apart. Columns without a field are
+// ignored. Conversion errors are handled the same as TypedRows.
+func (t Table) Decode(dest interface{}, opts ParseOptions) (errs []*CellError) {
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice ||
+		slice.Elem().Type().Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("Decode needs a pointer to a slice of structs, not %T", dest))
+	}
+	slice = slice.Elem()
+	structType := slice.Type().Elem()
+
+	fields := make([]int, len(t.Columns))
+	for col, column := range t.Columns {
+		fields[col] = fieldForColumn(structType, column.Name)
+	}
+
+	rows := reflect.MakeSlice(slice.Type(), len(t.Rows), len(t.Rows))
+	for r, row := range t.Rows {
+		for col, cell := range row {
+			if col >= len(fields) || fields[col] < 0 || cell == "" {
+				continue
+			}
+			field := rows.Index(r).Field(fields[col])
+			fieldType := field.Type()
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+
+			var value reflect.Value
+			var err error
+			if caster, found := opts.Casters[t.Columns[col].Name]; found {
+				var casted interface{}
+				casted, err = caster(cell)
+				if err == nil {
+					value = reflect.ValueOf(casted)
+					if !value.IsValid() || !value.Type().ConvertibleTo(fieldType) {
+						err = fmt.Errorf("caster returned %T, which can't go in a %s", casted, fieldType)
+					} else {
+						value = value.Convert(fieldType)
+					}
+				}
+			} else {
+				value, err = castToType(cell, fieldType, opts.locale(t.Columns[col].Name))
+			}
+			if err != nil {
+				cellErr := &CellError{Row: r, Column: col, Name: t.Columns[col].Name, Value: cell, Err: err}
+				if !opts.BestEffort {
+					panic(cellErr)
+				}
+				errs = append(errs, cellErr)
+				continue
+			}
+
+			if field.Kind() == reflect.Ptr {
+				pointer := reflect.New(fieldType)
+				pointer.Elem().Set(value)
+				value = pointer
+			}
+			field.Set(value)
+		}
+	}
+	slice.Set(rows)
+	return errs
+}
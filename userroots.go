@@ -0,0 +1,120 @@
+package cognos
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// UserRoot is the My Folders of one account in the namespace
+type UserRoot struct {
+	// Account is the account's name (ex: 0401jpenn)
+	Account string `json:"account"`
+	CAMID   string `json:"camid"`
+	// ID is the account's My Folders, for LsFolder or WalkFolder. It is ""
+	// if the account dosen't have one (ex: it has never logged in), or if
+	// Err is set.
+	ID string `json:"id,omitempty"`
+	// Empty is set if My Folders has nothing in it
+	Empty bool `json:"empty,omitempty"`
+	// Err is why we couldn't get to the account's My Folders (ex: we don't
+	// have permission)
+	Err error `json:"-"`
+}
+
+// directoryAccount is an account as listed on the directory page
+type directoryAccount struct {
+	Name  string `json:"name"`
+	CAMID string `json:"camid"`
+}
+
+// directoryLink returns the link for the page of accounts in a namespace
+// starting at start
+func directoryLink(namespace string, start int) string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=portal/directory.xts" +
+		"&m_namespace=" + url.QueryEscape(namespace) +
+		"&m_start=" + strconv.Itoa(start)
+}
+
+// accountLinkFromCAMID returns the link for the properties of an account
+func accountLinkFromCAMID(camid string) string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=portal/properties_account.xts" +
+		"&m_obj=" + url.QueryEscape(camid)
+}
+
+// listAccounts returns every account in our namespace. The directory only
+// shows so many at a time, so this may take several requests.
+func (c *CognosInstance) listAccounts() []directoryAccount {
+	var accounts []directoryAccount
+	for {
+		page := c.Request("GET", directoryLink(c.Namespace, len(accounts)), "")
+		var pageAccounts []directoryAccount
+		if !findJSVar(page, "g_PS_Accounts", &pageAccounts) {
+			if fault, found := parseFault(page); found {
+				panic(fmt.Errorf("Cognos returned an error when listing the accounts in %s: %w", c.Namespace, fault))
+			}
+			panic(c.notUnderstood(page, "Unable to find the accounts on the directory page"))
+		}
+		accounts = append(accounts, pageAccounts...)
+
+		var more bool
+		findJSVar(page, "g_PS_MoreAccounts", &more)
+		if !more || len(pageAccounts) == 0 {
+			return accounts
+		}
+	}
+}
+
+// userRoot finds the My Folders of an account, and checks if it is empty
+func (c *CognosInstance) userRoot(account directoryAccount) (root UserRoot) {
+	root = UserRoot{Account: account.Name, CAMID: account.CAMID}
+	root.Err = catch(func() {
+		page := c.Request("GET", accountLinkFromCAMID(account.CAMID), "")
+		if !findJSVar(page, "g_PS_MFRootId", &root.ID) {
+			if fault, found := parseFault(page); found {
+				panic(fault)
+			}
+			panic(c.notUnderstood(page, "Unable to find My Folders on the account page"))
+		}
+		if root.ID != "" {
+			root.Empty = len(c.LsFolder(root.ID)) == 0
+		}
+	})
+	if root.Err != nil {
+		root.ID = ""
+	}
+	return root
+}
+
+// ListAllUserRoots returns the My Folders of every account in our
+// namespace, sorted by account name, so you can look through them with
+// WalkFolder (ex: for an audit). Our user needs to be allowed to browse
+// the directory. An account whose My Folders we can't get to has Err set,
+// instead of stopping the whole thing. This makes a few requests per
+// account, which are limited by concurrentRequests (see MakeInstance)
+// like everything else.
+func (c *CognosInstance) ListAllUserRoots() []UserRoot {
+	accounts := c.listAccounts()
+	roots := make([]UserRoot, len(accounts))
+	var wg sync.WaitGroup
+	for i, account := range accounts {
+		i, account := i, account
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			roots[i] = c.userRoot(account)
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(roots, func(i, j int) bool {
+		return roots[i].Account < roots[j].Account
+	})
+	return roots
+}
@@ -0,0 +1,119 @@
+package cognos
+
+import (
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Version is the product version of a Cognos server (ex: 10.2.2).
+// Raw is the version string exactly as Cognos reported it.
+type Version struct {
+	Major int    `json:"major"`
+	Minor int    `json:"minor"`
+	Patch int    `json:"patch"`
+	Raw   string `json:"raw"`
+}
+
+// versionCache holds the server version once we have looked it up. It is
+// shared between an instance and any instances derived from it.
+type versionCache struct {
+	lock    sync.Mutex
+	version *Version
+}
+
+// String returns the version as Cognos reported it
+func (v Version) String() string {
+	return v.Raw
+}
+
+// Compare returns -1, 0, or 1 depending on if v is older, the same as,
+// or newer than other. Only major, minor, and patch are compared.
+func (v Version) Compare(other Version) int {
+	vParts := [3]int{v.Major, v.Minor, v.Patch}
+	otherParts := [3]int{other.Major, other.Minor, other.Patch}
+	for i := range vParts {
+		if vParts[i] < otherParts[i] {
+			return -1
+		} else if vParts[i] > otherParts[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// AtLeast returns true if v is major.minor or newer (ex: AtLeast(11, 0))
+func (v Version) AtLeast(major, minor int) bool {
+	return v.Compare(Version{Major: major, Minor: minor}) >= 0
+}
+
+// aboutLink returns the link for the "About IBM Cognos Connection" page,
+// which lists the product version.
+func aboutLink() string {
+	return "/ibmcognos/cgi-bin/cognos.cgi" +
+		"?b_action=xts.run" +
+		"&m=portal/about.xts"
+}
+
+// versionPatterns are tried in order against the login page and then
+// the about page. The first capture group must be the version string.
+var versionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`var g_PS_ProductVersion = "([0-9]+(?:\.[0-9]+)+)";`),
+	regexp.MustCompile(`(?i)product\s*version(?:</[^>]+>|<[^>]+>|[\s:"=])*([0-9]+(?:\.[0-9]+)+)`),
+	regexp.MustCompile(`(?i)IBM Cognos (?:Business Intelligence |Analytics )?([0-9]+(?:\.[0-9]+)+)`),
+}
+
+// parseVersion turns a string like 10.2.2 or 11.0.13.0 into a Version.
+// Anything after the patch number is ignored, except in Raw.
+func parseVersion(raw string) Version {
+	parts := regexp.MustCompile(`[0-9]+`).FindAllString(raw, 3)
+	if len(parts) < 2 {
+		panic("Unable to parse Cognos version " + raw)
+	}
+
+	v := Version{Raw: raw}
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			panic("Unable to parse Cognos version " + raw)
+		}
+		*numbers[i] = n
+	}
+	return v
+}
+
+// findVersionInPage looks for a product version in the html of a Cognos page.
+// found is false if no version was found.
+func findVersionInPage(html string) (raw string, found bool) {
+	for _, pattern := range versionPatterns {
+		if matchParts := pattern.FindStringSubmatch(html); len(matchParts) > 1 {
+			return matchParts[1], true
+		}
+	}
+	return "", false
+}
+
+// ServerVersion returns the product version of the Cognos server. It is
+// pulled from the login page, or the about page if the login page doesn't
+// say. The result is cached, so only the first call makes requests.
+// This panics if the version can't be found. It does not guess.
+func (c *CognosInstance) ServerVersion() Version {
+	c.version.lock.Lock()
+	defer c.version.lock.Unlock()
+	if c.version.version != nil {
+		return *c.version.version
+	}
+
+	raw, found := findVersionInPage(c.Request("GET", c.loginLink(), ""))
+	if !found {
+		raw, found = findVersionInPage(c.Request("GET", aboutLink(), ""))
+	}
+	if !found {
+		panic("Unable to determine Cognos server version from the login or about pages")
+	}
+
+	v := parseVersion(raw)
+	c.version.version = &v
+	return v
+}
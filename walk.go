@@ -0,0 +1,226 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+)
+
+// SkipFolder can be returned by a WalkFunc to skip the contents of a folder
+var SkipFolder = errors.New("skip this folder")
+
+// WalkFunc is called by WalkFolder for each folder entry. path is the names
+// of the folders leading to the entry plus the entry's own name, relative
+// to the folder being walked (so the starting folder has an empty path).
+// If listing a folder fails, the WalkFunc is called a second time for that
+// folder with the error. Returning SkipFolder for a folder skips its
+// contents. Returning any other error stops the walk, and WalkFolder
+// returns that error.
+type WalkFunc func(path []string, entry FolderEntry, err error) error
+
+// WalkFolder calls walkFn for the folder with the given id and everything
+// under it. Entries in a folder are visited in order by name, and a folder
+// is visited before its contents.
+func (c *CognosInstance) WalkFolder(id string, walkFn WalkFunc) error {
+	err := c.walk(nil, FolderEntry{Type: Folder, ID: id}, walkFn)
+	if err == SkipFolder {
+		return nil
+	}
+	return err
+}
+
+func (c *CognosInstance) walk(path []string, entry FolderEntry, walkFn WalkFunc) error {
+	err := walkFn(path, entry, nil)
+	if err != nil || entry.Type != Folder {
+		return err
+	}
+
+	var entries map[string]FolderEntry
+	err = catch(func() {
+		entries = c.LsFolder(entry.ID)
+	})
+	if err != nil {
+		return walkFn(path, entry, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// copy the path so the WalkFunc can keep it
+		childPath := append(append([]string(nil), path...), name)
+		err = c.walk(childPath, entries[name], walkFn)
+		if err == SkipFolder {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WalkOptions changes how WalkFolderParallel works. The zero value is fine.
+type WalkOptions struct {
+	// Parallelism is how many folders can be listed at once. 0 means 4.
+	// Listings still count against the instance's concurrentRequests.
+	Parallelism int
+	// FailFast stops the walk at the first folder that can't be listed.
+	// Otherwise the walk keeps going and the errors are returned together
+	// at the end.
+	FailFast bool
+}
+
+// folderListing is a folder listing that might still be in progress
+type folderListing struct {
+	done    chan struct{}
+	entries map[string]FolderEntry
+	err     error
+	// children are the listings of the folders in this one
+	children map[string]*folderListing
+	parent   *folderListing
+	// skipped is set (atomically) if the WalkFunc returned SkipFolder
+	skipped int32
+}
+
+// errWalkSkipped is the err of a listing that was never done because
+// nobody needs it anymore
+var errWalkSkipped = errors.New("walk skipped this folder")
+
+type parallelWalker struct {
+	c       *CognosInstance
+	opts    WalkOptions
+	walkFn  WalkFunc
+	workers chan struct{}
+	stopped int32
+	errs    []error
+}
+
+// WalkFolderParallel is like WalkFolder, but it lists folders ahead of time,
+// several at once, so big trees are walked much faster. walkFn is still
+// called from one goroutine at a time, in the same order as WalkFolder.
+// Unlike WalkFolder, a folder that can't be listed doesn't stop the walk
+// (unless opts.FailFast is set) even if walkFn returns nil for it. The
+// listing errors are returned at the end, joined with errors.Join.
+func (c *CognosInstance) WalkFolderParallel(id string, opts WalkOptions, walkFn WalkFunc) error {
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = 4
+	}
+	w := &parallelWalker{
+		c:       c,
+		opts:    opts,
+		walkFn:  walkFn,
+		workers: make(chan struct{}, parallelism),
+	}
+	// make any listings that haven't started yet give up once we return
+	defer atomic.StoreInt32(&w.stopped, 1)
+
+	root := FolderEntry{Type: Folder, ID: id}
+	err := w.walk(nil, root, w.list(root, nil))
+	if err == SkipFolder {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	return errors.Join(w.errs...)
+}
+
+// list starts listing a folder in the background
+func (w *parallelWalker) list(entry FolderEntry, parent *folderListing) *folderListing {
+	listing := &folderListing{
+		done:   make(chan struct{}),
+		parent: parent,
+	}
+	go func() {
+		defer close(listing.done)
+		w.workers <- struct{}{}
+		defer func() { <-w.workers }()
+
+		if w.abandoned(listing) {
+			listing.err = errWalkSkipped
+			return
+		}
+		listing.err = catch(func() {
+			listing.entries = w.c.LsFolder(entry.ID)
+		})
+		if listing.err != nil {
+			return
+		}
+
+		// start on the next level down
+		listing.children = make(map[string]*folderListing)
+		for name, child := range listing.entries {
+			if child.Type == Folder {
+				listing.children[name] = w.list(child, listing)
+			}
+		}
+	}()
+	return listing
+}
+
+// abandoned returns true if the walk is over, or if listing is in a folder
+// that was skipped
+func (w *parallelWalker) abandoned(listing *folderListing) bool {
+	if atomic.LoadInt32(&w.stopped) != 0 {
+		return true
+	}
+	for l := listing; l != nil; l = l.parent {
+		if atomic.LoadInt32(&l.skipped) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *parallelWalker) walk(path []string, entry FolderEntry, listing *folderListing) error {
+	err := w.walkFn(path, entry, nil)
+	if err == SkipFolder && listing != nil {
+		atomic.StoreInt32(&listing.skipped, 1)
+	}
+	if err != nil || entry.Type != Folder {
+		return err
+	}
+
+	<-listing.done
+	if listing.err != nil {
+		err = w.walkFn(path, entry, listing.err)
+		if err != nil {
+			return err
+		}
+		name := JoinPath(path)
+		if name == "" {
+			name = entry.ID
+		}
+		listErr := fmt.Errorf("unable to list folder %s: %w", name, listing.err)
+		if w.opts.FailFast {
+			return listErr
+		}
+		w.errs = append(w.errs, listErr)
+		return nil
+	}
+
+	names := make([]string, 0, len(listing.entries))
+	for name := range listing.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		// copy the path so the WalkFunc can keep it
+		childPath := append(append([]string(nil), path...), name)
+		err = w.walk(childPath, listing.entries[name], listing.children[name])
+		if err == SkipFolder {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
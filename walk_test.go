@@ -0,0 +1,138 @@
+package cognos
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// addTree adds width folders (each with a report) to folder, and the same
+// under each of those, depth levels deep
+func addTree(folder *cognostest.Folder, depth, width int) {
+	if depth == 0 {
+		return
+	}
+	for i := 0; i < width; i++ {
+		child := folder.AddFolder(fmt.Sprintf("Folder %d", i))
+		child.AddReport("Report", "a\n1\n")
+		addTree(child, depth-1, width)
+	}
+}
+
+// walkPaths walks a folder and returns every path it visits
+func walkPaths(walk func(WalkFunc) error) ([]string, error) {
+	var paths []string
+	err := walk(func(path []string, entry FolderEntry, err error) error {
+		if err == nil {
+			paths = append(paths, JoinPath(path))
+		}
+		return err
+	})
+	return paths, err
+}
+
+// failListing is a transport that fails listings of one folder
+type failListing struct {
+	rt http.RoundTripper
+	id string
+}
+
+func (f failListing) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Query().Get("m_folder") == f.id {
+		return nil, errors.New("connection reset")
+	}
+	return f.rt.RoundTrip(req)
+}
+
+func TestWalkFolderParallelOrder(t *testing.T) {
+	srv, c := newTestInstance(t)
+	addTree(srv.Public, 3, 3)
+
+	serial, err := walkPaths(func(walkFn WalkFunc) error {
+		return c.WalkFolder(srv.Public.ID, walkFn)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parallel, err := walkPaths(func(walkFn WalkFunc) error {
+		return c.WalkFolderParallel(srv.Public.ID, WalkOptions{Parallelism: 8}, walkFn)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 39 folders, 39 reports, and the start
+	if len(serial) != 79 || !reflect.DeepEqual(serial, parallel) {
+		t.Errorf("WalkFolder visited %d entries and WalkFolderParallel visited %d in a diffrent order", len(serial), len(parallel))
+	}
+}
+
+func TestWalkFolderParallelErrors(t *testing.T) {
+	srv, c := newTestInstance(t)
+	c.RetryCount = 0
+	addTree(srv.Public, 2, 2)
+	broken := c.FolderEntryFromPath([]string{"public", "Folder 0"})
+	c.SetTransport(failListing{rt: c.Transport(), id: broken.ID})
+
+	paths, err := walkPaths(func(walkFn WalkFunc) error {
+		return c.WalkFolderParallel(srv.Public.ID, WalkOptions{}, func(path []string, entry FolderEntry, err error) error {
+			walkFn(path, entry, err)
+			return nil
+		})
+	})
+	if err == nil || !strings.Contains(err.Error(), "unable to list folder Folder 0") {
+		t.Errorf("got %v, want the Folder 0 listing error", err)
+	}
+	// everything but what is in Folder 0
+	if len(paths) != 8 {
+		t.Errorf("visited %d entries, want 8: %v", len(paths), paths)
+	}
+
+	_, err = walkPaths(func(walkFn WalkFunc) error {
+		return c.WalkFolderParallel(srv.Public.ID, WalkOptions{FailFast: true}, func(path []string, entry FolderEntry, err error) error {
+			if JoinPath(path) == "Folder 1" {
+				t.Error("the walk kept going after Folder 0 failed")
+			}
+			walkFn(path, entry, err)
+			return nil
+		})
+	})
+	if err == nil {
+		t.Error("FailFast didn't return the error")
+	}
+}
+
+// benchmarkWalk walks a tree of 120 folders on a server that takes 2ms to
+// answer anything
+func benchmarkWalk(b *testing.B, walk func(c *CognosInstance, id string) error) {
+	srv := cognostest.NewServer()
+	defer srv.Close()
+	addTree(srv.Public, 3, 4)
+	srv.Delay = 2 * time.Millisecond
+	c := MakeInstance(srv.User, srv.Pass, srv.URL, srv.Namespace, srv.DSN, 1, 0, 10, 8)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.ForgetListings()
+		if err := walk(c, srv.Public.ID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWalkFolder(b *testing.B) {
+	benchmarkWalk(b, func(c *CognosInstance, id string) error {
+		return c.WalkFolder(id, func([]string, FolderEntry, error) error { return nil })
+	})
+}
+
+func BenchmarkWalkFolderParallel(b *testing.B) {
+	benchmarkWalk(b, func(c *CognosInstance, id string) error {
+		return c.WalkFolderParallel(id, WalkOptions{Parallelism: 8}, func([]string, FolderEntry, error) error { return nil })
+	})
+}
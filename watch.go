@@ -0,0 +1,151 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+// FolderChangeType says what happened to a folder entry (see WatchFolder)
+type FolderChangeType int
+
+const (
+	EntryAdded FolderChangeType = iota
+	EntryRemoved
+	// EntryModified means the entry is still there, but it has a diffrent
+	// name, type, or hidden flag
+	EntryModified
+)
+
+func (t FolderChangeType) String() string {
+	switch t {
+	case EntryAdded:
+		return "added"
+	case EntryRemoved:
+		return "removed"
+	case EntryModified:
+		return "modified"
+	default:
+		return "unknown"
+	}
+}
+
+// FolderChange is something that changed in a folder being watched
+type FolderChange struct {
+	Type FolderChangeType
+	// Entry is the entry as it is now (or was before it was removed)
+	Entry FolderEntry
+	// Old is the entry as it was before, for EntryModified
+	Old FolderEntry
+}
+
+// folderChanges returns what changed between two listings of a folder,
+// ordered by name. Entries are matched up by ID, so an entry that was
+// replaced by a new one with the same name is removed and added, and one
+// that was renamed is modified.
+func folderChanges(before, after map[string]FolderEntry) []FolderChange {
+	beforeByID := make(map[string]FolderEntry, len(before))
+	for _, entry := range before {
+		beforeByID[watchKey(entry)] = entry
+	}
+	afterByID := make(map[string]FolderEntry, len(after))
+	for _, entry := range after {
+		afterByID[watchKey(entry)] = entry
+	}
+
+	var changes []FolderChange
+	for id, entry := range afterByID {
+		old, found := beforeByID[id]
+		if !found {
+			changes = append(changes, FolderChange{Type: EntryAdded, Entry: entry})
+		} else if old != entry {
+			changes = append(changes, FolderChange{Type: EntryModified, Entry: entry, Old: old})
+		}
+	}
+	for id, entry := range beforeByID {
+		if _, found := afterByID[id]; !found {
+			changes = append(changes, FolderChange{Type: EntryRemoved, Entry: entry})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Entry.Name != changes[j].Entry.Name {
+			return changes[i].Entry.Name < changes[j].Entry.Name
+		}
+		return changes[i].Type < changes[j].Type
+	})
+	return changes
+}
+
+// watchKey is what folderChanges matches entries up by. Other entries
+// don't have an ID, so their link is used instead.
+func watchKey(entry FolderEntry) string {
+	if entry.Type == Other {
+		return "\x00" + entry.Href
+	}
+	return entry.ID
+}
+
+// WatchFolder lists the folder with the given id every interval, and sends
+// what changed since the last listing on the returned channel (ex: a new
+// saved output showing up). What is already in the folder when we start
+// isn't sent. Each change is only sent once, and nothing is sent for a
+// listing that is the same as the last one. The listings don't have
+// modification times, so an entry only counts as modified if its name,
+// type, or hidden flag changes. If the first listing fails, the error is
+// returned. After that, a listing that fails is logged and tried again
+// next time, without closing the channel. The channel is closed once ctx
+// is done. Read from it promptly, since the next listing waits until
+// the changes from this one have been read.
+func (c *CognosInstance) WatchFolder(ctx context.Context, id string, interval time.Duration) (<-chan FolderChange, error) {
+	if interval <= 0 {
+		return nil, errors.New("the interval for WatchFolder must be more than 0")
+	}
+	if err := ValidateID(id); err != nil {
+		return nil, err
+	}
+
+	// the listing cache would hide changes for ListingTTL
+	watcher := *c
+	watcher.ListingTTL = 0
+
+	var last map[string]FolderEntry
+	err := catch(func() {
+		last = watcher.LsFolder(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sleep := c.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	changes := make(chan FolderChange)
+	go func() {
+		defer close(changes)
+		for sleep(ctx, interval) == nil {
+			var listing map[string]FolderEntry
+			err := catch(func() {
+				listing = watcher.LsFolder(id)
+			})
+			if err != nil {
+				log.Println(c.scrub("Unable to list watched folder " + id + ": " + err.Error()))
+				continue
+			}
+
+			for _, change := range folderChanges(last, listing) {
+				select {
+				case changes <- change:
+				case <-ctx.Done():
+					return
+				}
+			}
+			last = listing
+		}
+	}()
+	return changes, nil
+}
@@ -0,0 +1,117 @@
+package cognos
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// manualTicks is a sleeper that says when it starts sleeping on asleep,
+// and then sleeps until the test sends on ticks (or ctx is done)
+func manualTicks(asleep, ticks chan struct{}) sleeper {
+	return func(ctx context.Context, d time.Duration) error {
+		select {
+		case asleep <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-ticks:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func TestWatchFolder(t *testing.T) {
+	srv, c := newTestInstance(t)
+	// retries would sleep too, and use up ticks
+	c.RetryCount = 0
+	asleep, ticks := make(chan struct{}), make(chan struct{})
+	c.sleep = manualTicks(asleep, ticks)
+	folder := srv.Public.AddFolder("Outputs")
+	folder.AddReport("A", "a\n1\n")
+	folder.AddReport("B", "a\n1\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := c.WatchFolder(ctx, folder.ID, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func(ch chan struct{}, what string) {
+		t.Helper()
+		select {
+		case <-ch:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the watcher never " + what)
+		}
+	}
+	// list has the watcher list the folder once, and checks what it sends
+	list := func(want ...string) {
+		t.Helper()
+		select {
+		case ticks <- struct{}{}:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the watcher never woke up")
+		}
+		for _, w := range want {
+			select {
+			case change := <-changes:
+				if got := change.Entry.Name + " " + change.Type.String(); got != w {
+					t.Errorf("got %s, want %s", got, w)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("never got %s", w)
+			}
+		}
+		// if it sends anything else it never goes back to sleep
+		wait(asleep, "went back to sleep")
+	}
+	wait(asleep, "started sleeping")
+
+	folder.AddReport("C", "a\n1\n")
+	folder.Remove("A")
+	folder.Rename("B", "B2")
+	list("A removed", "B2 modified", "C added")
+
+	// nothing changed, so nothing is sent
+	list()
+
+	// a listing that fails is skipped, without closing the channel
+	srv.InjectFaults(503, 1)
+	list()
+	folder.AddReport("D", "a\n1\n")
+	list("D added")
+
+	cancel()
+	select {
+	case change, open := <-changes:
+		if open {
+			t.Errorf("got %+v after cancelling", change)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the channel wasn't closed")
+	}
+}
+
+func TestWatchFolderErrors(t *testing.T) {
+	srv, c := newTestInstance(t)
+	ctx := context.Background()
+
+	if _, err := c.WatchFolder(ctx, srv.Public.ID, 0); err == nil {
+		t.Error("an interval of 0 worked")
+	}
+	if _, err := c.WatchFolder(ctx, " "+srv.Public.ID, time.Minute); !errors.Is(err, ErrInvalidID) {
+		t.Errorf("a bad ID got %v", err)
+	}
+	// the first listing failing is returned
+	c.RetryCount = 0
+	srv.InjectFaults(503, 1)
+	if _, err := c.WatchFolder(ctx, srv.Public.ID, time.Minute); err == nil {
+		t.Error("a failed first listing worked")
+	}
+}
@@ -0,0 +1,90 @@
+package cognos
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Portals with newer fix packs give us an XSRF token in a cookie, and
+// reject POSTs that don't send it back. Servers that don't do this never
+// set the cookie, so nothing extra is sent to them.
+const (
+	xsrfCookie = "XSRF-TOKEN"
+	xsrfHeader = "X-XSRF-TOKEN"
+	// xsrfField is the form field the token goes in. Some pages check the
+	// header and some check the form, so we send both.
+	xsrfField = "XSRF-TOKEN"
+)
+
+// xsrfToken returns the XSRF token the server at fullURL gave us, or "" if
+// it hasn't given us one
+func (c *CognosInstance) xsrfToken(fullURL string) string {
+	parsedURL, err := url.Parse(fullURL)
+	if err != nil || c.client.Jar == nil {
+		return ""
+	}
+	for _, cookie := range c.client.Jar.Cookies(parsedURL) {
+		if cookie.Name == xsrfCookie {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// withXSRFToken makes a request, adding the XSRF token to it if it is a
+// POST and we have one
+func withXSRFToken(ctx context.Context, method string, fullURL string, reqBody string, headers http.Header, token string) *http.Request {
+	if method != "POST" || token == "" {
+		return newRequest(ctx, method, fullURL, reqBody, headers)
+	}
+
+	contentType := headers.Get("Content-Type")
+	if contentType == "" || strings.HasPrefix(contentType, formContentType) {
+		field := url.Values{xsrfField: {token}}.Encode()
+		if reqBody == "" {
+			reqBody = field
+		} else {
+			reqBody += "&" + field
+		}
+	}
+	req := newRequest(ctx, method, fullURL, reqBody, headers)
+	req.Header.Set(xsrfHeader, token)
+	return req
+}
+
+// do sends a request to fullURL, with the XSRF token if it needs one. The
+// server can change the token whenever it wants. If it rejects a POST
+// because the token we sent is out of date, the rejection comes with the
+// new one, so we send the POST again with that. The server didn't do
+// anything with the first one, so this is safe even for POSTs that aren't
+// idempotent.
+func (c *CognosInstance) do(ctx context.Context, method string, fullURL string, reqBody string, headers http.Header, basicAuth bool) (*http.Response, error) {
+	client := &c.client
+	if timeout, set := callTimeout(ctx); set {
+		withTimeout := c.client
+		withTimeout.Timeout = timeout
+		client = &withTimeout
+	}
+	send := func(token string) (*http.Response, error) {
+		req := withXSRFToken(ctx, method, fullURL, reqBody, headers, token)
+		if basicAuth {
+			_, _, pass := c.login()
+			req.SetBasicAuth(c.authUser(), pass)
+		}
+		return client.Do(req)
+	}
+
+	token := c.xsrfToken(fullURL)
+	resp, err := send(token)
+	if err != nil || method != "POST" || resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+	newToken := c.xsrfToken(fullURL)
+	if newToken == token {
+		return resp, err
+	}
+	resp.Body.Close()
+	return send(newToken)
+}
@@ -0,0 +1,57 @@
+package cognos
+
+import (
+	"context"
+	"testing"
+
+	"github.com/9072997/cognos/cognostest"
+)
+
+// isPost returns true for a POST request
+func isPost(r cognostest.Request) bool {
+	return r.Method == "POST"
+}
+
+func TestXSRFToken(t *testing.T) {
+	srv, c := newTestInstance(t)
+	srv.XSRF = true
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 3
+
+	run := c.StartReport(report.ID)
+	run.poll()
+	// the next poll is rejected, then sent again with the new token
+	srv.RotateXSRFToken()
+	if csv := run.Wait(); csv != report.CSV {
+		t.Errorf("got %q", csv)
+	}
+	if n := countRequests(srv, isPost); n != 4 {
+		t.Errorf("got %d POSTs, want 4 (3 polls and one that was rejected)", n)
+	}
+	for _, r := range srv.Requests() {
+		if r.Method == "POST" && r.Header.Get(xsrfHeader) == "" {
+			t.Error("a POST didn't have the token")
+		}
+	}
+
+	// this isn't safe to retry, but the server never did the rejected one
+	srv.RotateXSRFToken()
+	srv.ResetRequests()
+	_, err := c.RequestContext(context.Background(), "POST", "/ibmcognos/cgi-bin/cognos.cgi", "b_action=xts.run")
+	if err != nil || len(srv.Requests()) != 2 {
+		t.Errorf("a POST after the token changed got %v after %d requests", err, len(srv.Requests()))
+	}
+}
+
+func TestNoXSRFToken(t *testing.T) {
+	srv, c := newTestInstance(t)
+	report := srv.Public.AddReport("Slow", "a\n1\n")
+	report.Polls = 1
+
+	c.DownloadReportCSV(report.ID)
+	for _, r := range srv.Requests() {
+		if r.Header.Get(xsrfHeader) != "" {
+			t.Error("we sent a token the server never gave us")
+		}
+	}
+}